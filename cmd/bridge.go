@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// bridgeCmd represents the bridge command
+var bridgeCmd = &cobra.Command{
+	Use:   "bridge",
+	Short: "Bridge the switches to other protocols",
+	Long: `Run a remoteSwitch bridge
+
+Make all switches on the network available through another protocol`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Please select the bridge type (--help for available options)")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bridgeCmd)
+}
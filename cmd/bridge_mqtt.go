@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/dh1tw/remoteSwitch/hub"
+	"github.com/dh1tw/remoteSwitch/mqttbridge"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var mqttBridgeCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "bridge all switches on the network to an MQTT broker",
+	Long: `
+The MQTT bridge discovers the switches the same way as the web server does
+(through NATS and/or gRPC) and publishes their state as retained messages on
+an MQTT broker. Terminals can be switched by publishing ON / OFF to their
+set topic:
+
+  remoteswitch/<switch>/<port>/<terminal>/state   {"state":true}
+  remoteswitch/<switch>/<port>/<terminal>/set     ON | OFF
+
+Spaces, slashes and wildcards in the names are replaced by underscores.
+With --homeassistant the switches show up automatically in Home Assistant.`,
+	Run: mqttBridge,
+}
+
+func init() {
+	bridgeCmd.AddCommand(mqttBridgeCmd)
+	mqttBridgeCmd.Flags().String("mqtt-url", "tcp://localhost:1883", "MQTT broker URL (tcp://, ssl://, ws://)")
+	mqttBridgeCmd.Flags().String("mqtt-username", "", "MQTT Username")
+	mqttBridgeCmd.Flags().String("mqtt-password", "", "MQTT Password")
+	mqttBridgeCmd.Flags().String("client-id", "", "MQTT client id (default remoteSwitch-<station>)")
+	mqttBridgeCmd.Flags().String("topic-prefix", "remoteswitch", "root of the MQTT topic tree")
+	mqttBridgeCmd.Flags().Bool("homeassistant", false, "publish Home Assistant MQTT discovery configs")
+	mqttBridgeCmd.Flags().String("discovery-prefix", "homeassistant", "Home Assistant discovery prefix")
+	mqttBridgeCmd.Flags().StringP("station", "X", "mystation", "Your station callsign")
+	mqttBridgeCmd.Flags().StringSlice("stations", []string{}, "additional stations (callsigns) whose switches will be bridged")
+	mqttBridgeCmd.Flags().StringP("broker-url", "u", "localhost", "Broker URL")
+	mqttBridgeCmd.Flags().IntP("broker-port", "p", 4222, "Broker Port")
+	mqttBridgeCmd.Flags().StringP("password", "P", "", "NATS Password")
+	mqttBridgeCmd.Flags().StringP("username", "U", "", "NATS Username")
+	mqttBridgeCmd.Flags().StringSlice("servers", []string{}, "NATS server URLs, e.g. nats://host1:4222,tls://host2:4222 (overrides broker-url & broker-port)")
+	mqttBridgeCmd.Flags().Bool("no-randomize", false, "connect to the NATS servers in the provided order")
+	mqttBridgeCmd.Flags().StringP("transport", "t", "nats", "transport used to discover the switches (nats|grpc)")
+	mqttBridgeCmd.Flags().StringSlice("grpc-endpoints", []string{}, "gRPC switch servers to attach to, e.g. host1:7020,host2:7020")
+}
+
+func mqttBridge(cmd *cobra.Command, args []string) {
+
+	// Try to read config file
+	if err := viper.ReadInConfig(); err == nil {
+		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	} else {
+		if strings.Contains(err.Error(), "Not Found in") {
+			fmt.Println("no config file found")
+		} else {
+			fmt.Println("Error parsing config file", viper.ConfigFileUsed())
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	viper.BindPFlag("mqtt.url", cmd.Flags().Lookup("mqtt-url"))
+	viper.BindPFlag("mqtt.username", cmd.Flags().Lookup("mqtt-username"))
+	viper.BindPFlag("mqtt.password", cmd.Flags().Lookup("mqtt-password"))
+	viper.BindPFlag("mqtt.client-id", cmd.Flags().Lookup("client-id"))
+	viper.BindPFlag("mqtt.topic-prefix", cmd.Flags().Lookup("topic-prefix"))
+	viper.BindPFlag("mqtt.homeassistant", cmd.Flags().Lookup("homeassistant"))
+	viper.BindPFlag("mqtt.discovery-prefix", cmd.Flags().Lookup("discovery-prefix"))
+	viper.BindPFlag("shackbus.station", cmd.Flags().Lookup("station"))
+	viper.BindPFlag("mqtt.stations", cmd.Flags().Lookup("stations"))
+	viper.BindPFlag("shackbus.transport", cmd.Flags().Lookup("transport"))
+	viper.BindPFlag("nats.broker-url", cmd.Flags().Lookup("broker-url"))
+	viper.BindPFlag("nats.broker-port", cmd.Flags().Lookup("broker-port"))
+	viper.BindPFlag("nats.password", cmd.Flags().Lookup("password"))
+	viper.BindPFlag("nats.username", cmd.Flags().Lookup("username"))
+	viper.BindPFlag("nats.servers", cmd.Flags().Lookup("servers"))
+	viper.BindPFlag("nats.no-randomize", cmd.Flags().Lookup("no-randomize"))
+	viper.BindPFlag("grpc.endpoints", cmd.Flags().Lookup("grpc-endpoints"))
+
+	station, err := validateStation(viper.GetString("shackbus.station"))
+	if err != nil {
+		fmt.Printf("invalid station (shackbus.station): %v\n", err)
+		os.Exit(1)
+	}
+
+	stations := map[string]bool{station: true}
+	for _, st := range viper.GetStringSlice("mqtt.stations") {
+		st, err := validateStation(st)
+		if err != nil {
+			fmt.Printf("invalid station (mqtt.stations): %v\n", err)
+			os.Exit(1)
+		}
+		stations[st] = true
+	}
+
+	// the hub serves only as the registry of the discovered switches;
+	// it doesn't listen for HTTP connections
+	h, err := hub.NewHub()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	w := webserver{
+		Hub:      h,
+		station:  station,
+		stations: stations,
+	}
+
+	clientID := viper.GetString("mqtt.client-id")
+	if len(clientID) == 0 {
+		clientID = "remoteSwitch-" + station
+	}
+
+	opts := []func(*mqttbridge.Bridge){
+		mqttbridge.Broker(viper.GetString("mqtt.url")),
+		mqttbridge.ClientID(clientID),
+		mqttbridge.Credentials(viper.GetString("mqtt.username"), viper.GetString("mqtt.password")),
+		mqttbridge.TopicPrefix(viper.GetString("mqtt.topic-prefix")),
+		mqttbridge.Switches(h),
+	}
+
+	if viper.GetBool("mqtt.homeassistant") {
+		opts = append(opts, mqttbridge.HomeAssistant(viper.GetString("mqtt.discovery-prefix")))
+	}
+
+	b := mqttbridge.New(opts...)
+
+	if err := b.Connect(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer b.Close()
+
+	for _, endpoint := range viper.GetStringSlice("grpc.endpoints") {
+		go w.attachGrpcSwitch(endpoint)
+	}
+
+	connClosed := make(chan struct{})
+
+	switch transport := viper.GetString("shackbus.transport"); transport {
+	case "nats":
+		if err := w.connectNats(connClosed); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "grpc":
+		if len(viper.GetStringSlice("grpc.endpoints")) == 0 {
+			fmt.Println("no gRPC endpoints (grpc.endpoints) provided")
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("unknown transport %s\n", transport)
+		os.Exit(1)
+	}
+
+	// switches which have been removed from the hub are marked
+	// offline on the broker
+	removed := time.NewTicker(time.Second)
+	defer removed.Stop()
+
+	// Channel to handle OS signals
+	osSignals := make(chan os.Signal, 1)
+
+	//subscribe to os.Interrupt (CTRL-C signal)
+	signal.Notify(osSignals, os.Interrupt)
+
+	for {
+		select {
+		case sig := <-osSignals:
+			if sig == os.Interrupt {
+				return
+			}
+		case <-connClosed:
+			for _, s := range w.Switches() {
+				if w.isGrpcSwitch(s.Name()) {
+					continue
+				}
+				s.Close()
+			}
+		case <-removed.C:
+			for _, name := range b.Names() {
+				if _, ok := w.Switch(name); !ok {
+					log.Printf("switch '%s' has been removed\n", name)
+					b.Remove(name)
+				}
+			}
+		case device := <-bcast:
+			b.Update(device)
+		}
+	}
+}
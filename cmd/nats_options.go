@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/spf13/viper"
+)
+
+// natsOptions assembles the nats connection options which are shared by
+// all commands connecting to a nats broker (or a cluster of brokers).
+// The returned options still have to be individualized (e.g. Name) by
+// the caller.
+func natsOptions() (nats.Options, error) {
+
+	servers, err := natsServerURLs(viper.GetStringSlice("nats.servers"),
+		viper.GetString("nats.broker-url"),
+		viper.GetInt("nats.broker-port"))
+	if err != nil {
+		return nats.Options{}, err
+	}
+
+	// start from default nats config and add the common options
+	nopts := nats.GetDefaultOptions()
+	nopts.Servers = servers
+	nopts.User = viper.GetString("nats.username")
+	nopts.Password = viper.GetString("nats.password")
+	nopts.NoRandomize = viper.GetBool("nats.no-randomize")
+
+	// the following settings are relevant when connecting to a cluster or
+	// a leaf node which might be restarted or temporarily unreachable.
+	// By default we never give up reconnecting and we detect stale
+	// connections faster than the nats defaults.
+	if viper.IsSet("nats.max-reconnect") {
+		nopts.MaxReconnect = viper.GetInt("nats.max-reconnect")
+	} else {
+		nopts.MaxReconnect = -1 // reconnect forever
+	}
+
+	if viper.IsSet("nats.reconnect-wait") {
+		nopts.ReconnectWait = viper.GetDuration("nats.reconnect-wait")
+	}
+
+	if viper.IsSet("nats.ping-interval") {
+		nopts.PingInterval = viper.GetDuration("nats.ping-interval")
+	} else {
+		nopts.PingInterval = time.Second * 20
+	}
+
+	if viper.IsSet("nats.max-pings-out") {
+		nopts.MaxPingsOut = viper.GetInt("nats.max-pings-out")
+	}
+
+	if viper.IsSet("nats.connect-timeout") {
+		nopts.Timeout = viper.GetDuration("nats.connect-timeout")
+	}
+
+	nopts.RetryOnFailedConnect = viper.GetBool("nats.retry-on-failed-connect")
+
+	return nopts, nil
+}
+
+// natsServerURLs returns the list of nats server URLs to connect to. If
+// no servers have been provided, the legacy broker url & port parameters
+// will be used instead. Servers without a scheme default to "nats://".
+func natsServerURLs(servers []string, brokerURL string, brokerPort int) ([]string, error) {
+
+	if len(servers) == 0 {
+		servers = []string{fmt.Sprintf("%s:%d", brokerURL, brokerPort)}
+	}
+
+	urls := make([]string, 0, len(servers))
+
+	for _, s := range servers {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		if !strings.Contains(s, "://") {
+			s = "nats://" + s
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nats server url %s: %v", s, err)
+		}
+		switch u.Scheme {
+		case "nats", "tls", "ws", "wss":
+		default:
+			return nil, fmt.Errorf("unsupported scheme '%s' in nats server url %s", u.Scheme, s)
+		}
+		if len(u.Hostname()) == 0 {
+			return nil, fmt.Errorf("missing host in nats server url %s", s)
+		}
+		urls = append(urls, u.String())
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no nats server url provided")
+	}
+
+	return urls, nil
+}
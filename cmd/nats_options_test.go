@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_natsServerURLs(t *testing.T) {
+	type args struct {
+		servers    []string
+		brokerURL  string
+		brokerPort int
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{"fall back to broker url & port",
+			args{nil, "localhost", 4222},
+			[]string{"nats://localhost:4222"}, false},
+		{"servers override broker url & port",
+			args{[]string{"nats://n1:4222", "tls://n2:4443"}, "localhost", 4222},
+			[]string{"nats://n1:4222", "tls://n2:4443"}, false},
+		{"add missing scheme",
+			args{[]string{"n1:4222", " ws://n2:8080 "}, "", 0},
+			[]string{"nats://n1:4222", "ws://n2:8080"}, false},
+		{"credentials in url",
+			args{[]string{"nats://user:pass@n1:4222"}, "", 0},
+			[]string{"nats://user:pass@n1:4222"}, false},
+		{"unsupported scheme",
+			args{[]string{"http://n1:4222"}, "", 0},
+			nil, true},
+		{"missing host",
+			args{[]string{"nats://:4222"}, "", 0},
+			nil, true},
+		{"only empty entries",
+			args{[]string{" ", ""}, "", 0},
+			nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := natsServerURLs(tt.args.servers, tt.args.brokerURL, tt.args.brokerPort)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("natsServerURLs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("natsServerURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
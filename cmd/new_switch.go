@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dh1tw/remoteSwitch/configparser"
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	ip9258 "github.com/dh1tw/remoteSwitch/switch/aviosys_ip9258"
+	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
+	rb "github.com/dh1tw/remoteSwitch/switch/ea4tx_remotebox"
+	lineprotocol "github.com/dh1tw/remoteSwitch/switch/line_protocol"
+	modbusrelay "github.com/dh1tw/remoteSwitch/switch/modbus_relay"
+	mpGPIO "github.com/dh1tw/remoteSwitch/switch/multi-purpose-switch-gpio"
+	"github.com/dh1tw/remoteSwitch/switch/pins"
+	"github.com/dh1tw/remoteSwitch/switch/pulse"
+	"github.com/dh1tw/remoteSwitch/switch/ratelimit"
+	serialrelay "github.com/dh1tw/remoteSwitch/switch/serial_relay"
+	"github.com/dh1tw/remoteSwitch/switch/smartplug"
+	snmppdu "github.com/dh1tw/remoteSwitch/switch/snmp_pdu"
+	smGPIO "github.com/dh1tw/remoteSwitch/switch/stackmatch_gpio"
+	"github.com/spf13/viper"
+)
+
+// newSwitch creates and initializes the switch which is defined in the
+// [switch] section of the config file. It is shared by all server
+// commands, independent of the transport used to expose the switch.
+// State changes are reported through the eventHandler. Switches which
+// can fail at runtime will close the errorCh on a fatal error.
+// The switch is wrapped so that it supports pulses. If rate limits are
+// configured in [switch.rate-limit], the switch is wrapped accordingly.
+func newSwitch(eventHandler func(sw.Switcher, sw.Device), errorCh chan struct{}) (sw.Switcher, error) {
+
+	limits, err := configparser.GetRateLimitConfig("switch.rate-limit")
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newDriver(eventHandler, errorCh)
+	if err != nil {
+		return nil, err
+	}
+
+	// the revert of a pulse must not be rate limited
+	s = pulse.New(s)
+
+	if limits == nil {
+		return s, nil
+	}
+
+	return ratelimit.New(s, limits...), nil
+}
+
+// newDriver creates and initializes the driver of the switch type
+// set in switch.type.
+func newDriver(eventHandler func(sw.Switcher, sw.Device), errorCh chan struct{}) (sw.Switcher, error) {
+
+	if !viper.IsSet("switch.type") {
+		return nil, fmt.Errorf("missing configuration for switch (switch.type)")
+	}
+
+	if !viper.IsSet("switch.name") {
+		return nil, fmt.Errorf("missing configuration for switch (switch.name)")
+	}
+
+	switchType := viper.GetString("switch.type")
+	switchName := viper.GetString("switch.name")
+
+	// with switch.simulate the GPIO switches run without hardware; the
+	// level changes of the pins are logged
+	simulate := viper.GetBool("switch.simulate")
+	if simulate && switchType != "multi_purpose_gpio" && switchType != "stackmatch_gpio" {
+		return nil, fmt.Errorf("switch type %s can not be simulated", switchType)
+	}
+
+	switch switchType {
+	case "multi_purpose_gpio":
+		sc, err := configparser.GetMPGPIOSwitchConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts := []func(*mpGPIO.MPSwitchGPIO){
+			mpGPIO.Switch(sc),
+			mpGPIO.EventHandler(eventHandler),
+		}
+		if simulate {
+			opts = append(opts, mpGPIO.Backend(pins.NewSimulated(log.Printf)))
+		}
+		sw := mpGPIO.NewMPSwitchGPIO(opts...)
+
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "dummy_switch":
+		sc, err := configparser.GetDummySwitchConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		sw := ds.NewDummySwitch(ds.Switch(sc), ds.EventHandler(eventHandler))
+
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "stackmatch_gpio":
+		sc, err := configparser.GetSmGPIOConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts := []func(*smGPIO.SmGPIO){
+			smGPIO.Config(sc),
+			smGPIO.EventHandler(eventHandler),
+		}
+		if simulate {
+			opts = append(opts, smGPIO.Backend(pins.NewSimulated(log.Printf)))
+		}
+		sw := smGPIO.NewStackmatchGPIO(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "ea4tx-remotebox":
+		opts, err := configparser.GetEA4TXRemoteboxConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, rb.EventHandler(eventHandler))
+		opts = append(opts, rb.ErrorCh(errorCh))
+		sw := rb.New(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "aviosys-ip9258":
+		opts, err := configparser.GetIP9258Config(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, ip9258.EventHandler(eventHandler))
+		opts = append(opts, ip9258.ErrorCh(errorCh))
+		sw := ip9258.NewIP9258(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "smartplug":
+		opts, err := configparser.GetSmartPlugConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, smartplug.EventHandler(eventHandler))
+		opts = append(opts, smartplug.ErrorCh(errorCh))
+		sw := smartplug.NewSmartPlug(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "snmp_pdu":
+		opts, err := configparser.GetSnmpPduConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, snmppdu.EventHandler(eventHandler))
+		opts = append(opts, snmppdu.ErrorCh(errorCh))
+		sw := snmppdu.NewPDU(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "serial_relay":
+		opts, err := configparser.GetSerialRelayConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, serialrelay.EventHandler(eventHandler))
+		sw := serialrelay.NewSerialRelay(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "line_protocol":
+		opts, err := configparser.GetLineProtocolConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lineprotocol.EventHandler(eventHandler))
+		sw := lineprotocol.NewLineProtocol(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+
+	case "modbus_relay":
+		opts, err := configparser.GetModbusRelayConfig(switchName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, modbusrelay.EventHandler(eventHandler))
+		sw := modbusrelay.NewModbusRelay(opts...)
+		if err := sw.Init(); err != nil {
+			return nil, err
+		}
+		return sw, nil
+	}
+
+	return nil, fmt.Errorf("unknown switch type %s", switchType)
+}
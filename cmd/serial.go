@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// serialCmd represents the serial command
+var serialCmd = &cobra.Command{
+	Use:   "serial",
+	Short: "Serial port utilities",
+	Long: `Serial port utilities
+
+Find the USB serial devices to which the switches are connected`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Please select the command (--help for available options)")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serialCmd)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	rb "github.com/dh1tw/remoteSwitch/switch/ea4tx_remotebox"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+	"github.com/spf13/cobra"
+)
+
+var serialListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the USB serial devices",
+	Long: `
+List the USB serial devices attached to this computer with the properties
+by which they can be selected in the config file instead of their portname
+(usb-vendor-id, usb-product-id, usb-serial and by-id).
+
+Unless --probe=false is set, each device is probed for an EA4TX Remotebox
+by sending its identification request ("O"). Don't probe while the devices
+are in use.`,
+	Run: serialList,
+}
+
+func init() {
+	serialCmd.AddCommand(serialListCmd)
+	serialListCmd.Flags().Bool("probe", true, "probe the devices for an EA4TX Remotebox")
+}
+
+func serialList(cmd *cobra.Command, args []string) {
+
+	probe, _ := cmd.Flags().GetBool("probe")
+
+	devices, err := serialport.List()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if len(devices) == 0 {
+		fmt.Println("no USB serial devices found")
+		return
+	}
+
+	for _, d := range devices {
+		fmt.Println(d.Name)
+		fmt.Printf("  usb-vendor-id:  %s\n", d.VendorID)
+		fmt.Printf("  usb-product-id: %s\n", d.ProductID)
+		if len(d.Serial) > 0 {
+			fmt.Printf("  usb-serial:     %s\n", d.Serial)
+		}
+		if desc := strings.TrimSpace(d.Manufacturer + " " + d.Product); len(desc) > 0 {
+			fmt.Printf("  description:    %s\n", desc)
+		}
+		for _, link := range d.ByID {
+			fmt.Printf("  by-id:          %s\n", link)
+		}
+		if !probe {
+			continue
+		}
+		model, fw, err := rb.Probe(d.Name)
+		if err != nil {
+			fmt.Println("  remotebox:      not found")
+			continue
+		}
+		fmt.Printf("  remotebox:      %s (firmware %s)\n", model, fw)
+	}
+}
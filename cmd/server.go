@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // serverCmd represents the server command
@@ -20,4 +21,6 @@ Start a remoteSwitch server using a specific transport protocol`,
 
 func init() {
 	rootCmd.AddCommand(serverCmd)
+	serverCmd.PersistentFlags().Bool("simulate", false, "simulate the GPIO pins instead of accessing the hardware (GPIO switches only)")
+	viper.BindPFlag("switch.simulate", serverCmd.PersistentFlags().Lookup("simulate"))
 }
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+var grpcServerCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "expose your Switch via gRPC",
+	Long: `
+The gRPC server exposes a Switch directly via gRPC, without the need of a
+broker. State changes are streamed to the clients through the WatchDevice
+RPC. The web server can attach to gRPC servers listed in its config file.`,
+	Run: grpcServer,
+}
+
+func init() {
+	serverCmd.AddCommand(grpcServerCmd)
+	grpcServerCmd.Flags().StringP("host", "w", "127.0.0.1", "Host (use '0.0.0.0' to listen on all network adapters)")
+	grpcServerCmd.Flags().IntP("port", "k", 7020, "gRPC port")
+}
+
+func grpcServer(cmd *cobra.Command, args []string) {
+
+	// Try to read config file
+	if err := viper.ReadInConfig(); err == nil {
+		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	} else {
+		if strings.Contains(err.Error(), "Not Found in") {
+			fmt.Println("no config file found")
+		} else {
+			fmt.Println("Error parsing config file", viper.ConfigFileUsed())
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	viper.BindPFlag("grpc.host", cmd.Flags().Lookup("host"))
+	viper.BindPFlag("grpc.port", cmd.Flags().Lookup("port"))
+
+	gs := &grpcSwitch{
+		tracker: newStateTracker(),
+	}
+
+	switchError := make(chan struct{})
+
+	swi, err := newSwitch(gs.deviceUpdate, switchError)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gs.sw = swi
+
+	addr := net.JoinHostPort(viper.GetString("grpc.host"),
+		fmt.Sprintf("%d", viper.GetInt("grpc.port")))
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// allow the clients to detect dead connections through keepalive
+	// pings, even if the switch doesn't change its state for a long time
+	svr := grpc.NewServer(
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             time.Second * 10,
+			PermitWithoutStream: true,
+		}),
+	)
+	sbSwitch.RegisterSbSwitchServer(svr, gs)
+
+	log.Printf("serving '%s' via gRPC on %s", swi.Name(), lis.Addr())
+
+	svrError := make(chan error, 1)
+	go func() {
+		svrError <- svr.Serve(lis)
+	}()
+
+	// Channel to handle OS signals
+	osSignals := make(chan os.Signal, 1)
+
+	//subscribe to os.Interrupt (CTRL-C signal)
+	signal.Notify(osSignals, os.Interrupt)
+
+	select {
+	case <-osSignals:
+		svr.Stop()
+		swi.Close()
+	case <-switchError:
+		svr.Stop()
+		os.Exit(1)
+	case err := <-svrError:
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// grpcSwitch implements the SbSwitch gRPC service for a switch.Switcher
+type grpcSwitch struct {
+	sbSwitch.UnimplementedSbSwitchServer
+	sw      sw.Switcher
+	tracker *stateTracker
+}
+
+func (s *grpcSwitch) deviceUpdate(swi sw.Switcher, d sw.Device) {
+	s.tracker.publish(swi)
+}
+
+func (s *grpcSwitch) GetPort(ctx context.Context, portName *sbSwitch.PortName) (*sbSwitch.Port, error) {
+	p, err := s.sw.GetPort(portName.GetName())
+	if err != nil {
+		return nil, s.grpcError(err, portName.GetName())
+	}
+	return portToSbPort(p), nil
+}
+
+func (s *grpcSwitch) SetPort(ctx context.Context, portReq *sbSwitch.PortRequest) (*sbSwitch.None, error) {
+	port := portRequestToPort(portReq)
+	if err := s.sw.SetPort(port); err != nil {
+		return nil, s.grpcError(err, port.Name, port.Terminals...)
+	}
+	return &sbSwitch.None{}, nil
+}
+
+func (s *grpcSwitch) Pulse(ctx context.Context, req *sbSwitch.PulseRequest) (*sbSwitch.None, error) {
+	p, ok := s.sw.(sw.Pulser)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "pulses are not supported")
+	}
+	portName, t, d := pulseRequestToPulse(req)
+	if err := p.Pulse(portName, t, d); err != nil {
+		return nil, s.grpcError(err, portName, t)
+	}
+	return &sbSwitch.None{}, nil
+}
+
+// grpcError converts an error returned by the switch into a gRPC status,
+// so that the clients can tell rejected requests from unavailable
+// hardware. Requests for ports or terminals which don't exist result in
+// NotFound, rate limited requests in ResourceExhausted and all other
+// errors in Unavailable.
+func (s *grpcSwitch) grpcError(err error, portName string, terminals ...sw.Terminal) error {
+	if errors.Is(err, sw.ErrRateLimited) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if !hasTerminals(s.sw.Serialize(), portName, terminals...) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// hasTerminals checks if the device has a port with the given name and
+// if the port has all the given terminals.
+func hasTerminals(d sw.Device, portName string, terminals ...sw.Terminal) bool {
+	for _, p := range d.Ports {
+		if p.Name != portName {
+			continue
+		}
+		names := make(map[string]bool, len(p.Terminals))
+		for _, t := range p.Terminals {
+			names[t.Name] = true
+		}
+		for _, t := range terminals {
+			if !names[t.Name] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (s *grpcSwitch) GetDevice(ctx context.Context, in *sbSwitch.None) (*sbSwitch.Device, error) {
+	return deviceToSbDevice(s.sw.Serialize()), nil
+}
+
+func (s *grpcSwitch) WatchDevice(in *sbSwitch.None, stream sbSwitch.SbSwitch_WatchDeviceServer) error {
+	return watchDevice(stream.Context(), s.sw, s.tracker, stream.Send)
+}
+
+func (s *grpcSwitch) Subscribe(in *sbSwitch.None, stream sbSwitch.SbSwitch_SubscribeServer) error {
+	return subscribe(stream.Context(), s.sw, s.tracker, stream.Send)
+}
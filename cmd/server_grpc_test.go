@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
+	"github.com/dh1tw/remoteSwitch/switch/pulse"
+	"github.com/dh1tw/remoteSwitch/switch/ratelimit"
+	"github.com/dh1tw/remoteSwitch/switch/sbSwitchProxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startGrpcSwitch serves a dummy switch via gRPC on an in-memory
+// listener and returns a client connection to it. The switch is wrapped
+// like in newSwitch; if limits are provided, the switch is rate limited.
+func startGrpcSwitch(t *testing.T, limits ...func(*ratelimit.Switch)) (*grpcSwitch, *grpc.ClientConn) {
+	t.Helper()
+
+	gs := &grpcSwitch{
+		tracker: newStateTracker(),
+	}
+
+	sc := ds.SwitchConfig{
+		Name: "Antenna Switch",
+		Ports: []ds.PortConfig{
+			{
+				Name:      "Radio",
+				Exclusive: true,
+				Terminals: []ds.PinConfig{
+					{Name: "Yagi", Index: 0},
+					{Name: "Dipole", Index: 1},
+				},
+			},
+		},
+	}
+
+	dummy := ds.NewDummySwitch(ds.Switch(sc), ds.EventHandler(gs.deviceUpdate))
+	if err := dummy.Init(); err != nil {
+		t.Fatal(err)
+	}
+	gs.sw = pulse.New(dummy)
+	if len(limits) > 0 {
+		gs.sw = ratelimit.New(gs.sw, limits...)
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	svr := grpc.NewServer()
+	sbSwitch.RegisterSbSwitchServer(svr, gs)
+	go svr.Serve(lis)
+	t.Cleanup(svr.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return gs, conn
+}
+
+func terminalState(d sw.Device, portName, terminalName string) bool {
+	for _, p := range d.Ports {
+		if p.Name != portName {
+			continue
+		}
+		for _, t := range p.Terminals {
+			if t.Name == terminalName {
+				return t.State
+			}
+		}
+	}
+	return false
+}
+
+func TestGrpcSwitch_WatchDevice(t *testing.T) {
+
+	gs, conn := startGrpcSwitch(t)
+
+	cli := sbSwitch.NewSbSwitchClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	stream, err := cli.WatchDevice(ctx, &sbSwitch.None{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the current state is sent immediately
+	snapshot, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.GetName() != "Antenna Switch" {
+		t.Fatalf("got device %s, want Antenna Switch", snapshot.GetName())
+	}
+
+	req := &sbSwitch.PortRequest{
+		Name:      "Radio",
+		Terminals: []*sbSwitch.Terminal{{Name: "Dipole", State: true}},
+	}
+	if _, err := cli.SetPort(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := gs.sw.Serialize()
+	if !terminalState(d, "Radio", "Dipole") {
+		t.Fatal("terminal Dipole has not been activated")
+	}
+
+	got := update.GetPorts()[0].GetTerminals()
+	for _, terminal := range got {
+		if terminal.GetName() == "Dipole" && !terminal.GetState() {
+			t.Fatal("update doesn't contain the activated terminal Dipole")
+		}
+	}
+
+	if _, err := cli.GetPort(ctx, &sbSwitch.PortName{Name: "unknown"}); err == nil {
+		t.Fatal("expected error for unknown port")
+	}
+}
+
+func TestGrpcSwitch_errors(t *testing.T) {
+
+	_, conn := startGrpcSwitch(t)
+
+	cli := sbSwitch.NewSbSwitchClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"GetPort unknown port", func() error {
+			_, err := cli.GetPort(ctx, &sbSwitch.PortName{Name: "unknown"})
+			return err
+		}, codes.NotFound},
+		{"SetPort unknown port", func() error {
+			_, err := cli.SetPort(ctx, &sbSwitch.PortRequest{Name: "unknown",
+				Terminals: []*sbSwitch.Terminal{{Name: "Yagi", State: true}}})
+			return err
+		}, codes.NotFound},
+		{"SetPort unknown terminal", func() error {
+			_, err := cli.SetPort(ctx, &sbSwitch.PortRequest{Name: "Radio",
+				Terminals: []*sbSwitch.Terminal{{Name: "unknown", State: true}}})
+			return err
+		}, codes.NotFound},
+		{"Pulse unknown terminal", func() error {
+			_, err := cli.Pulse(ctx, &sbSwitch.PulseRequest{Port: "Radio",
+				Terminal: "unknown", State: true, Duration: 10})
+			return err
+		}, codes.NotFound},
+	}
+
+	for _, tc := range tests {
+		if got := status.Code(tc.call()); got != tc.want {
+			t.Errorf("%s: got code %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHasTerminals(t *testing.T) {
+
+	d := sw.Device{
+		Ports: []sw.Port{
+			{Name: "Radio", Terminals: []sw.Terminal{{Name: "Yagi"}, {Name: "Dipole"}}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		port      string
+		terminals []sw.Terminal
+		want      bool
+	}{
+		{"port only", "Radio", nil, true},
+		{"known terminals", "Radio", []sw.Terminal{{Name: "Yagi"}, {Name: "Dipole"}}, true},
+		{"unknown terminal", "Radio", []sw.Terminal{{Name: "Yagi"}, {Name: "Vertical"}}, false},
+		{"unknown port", "Rotator", nil, false},
+	}
+
+	for _, tc := range tests {
+		if got := hasTerminals(d, tc.port, tc.terminals...); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGrpcSwitch_proxy(t *testing.T) {
+
+	_, conn := startGrpcSwitch(t)
+
+	events := make(chan sw.Device, 10)
+	eh := func(s sw.Switcher, d sw.Device) {
+		events <- d
+	}
+
+	p, err := sbSwitchProxy.New(sbSwitchProxy.GrpcConn(conn),
+		sbSwitchProxy.EventHandler(eh),
+		sbSwitchProxy.DoneCh(make(chan struct{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if p.Name() != "Antenna Switch" {
+		t.Fatalf("got name %s, want Antenna Switch", p.Name())
+	}
+
+	port := sw.Port{
+		Name:      "Radio",
+		Terminals: []sw.Terminal{{Name: "Yagi", State: true}},
+	}
+	if err := p.SetPort(port); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(time.Second * 5)
+	for {
+		select {
+		case d := <-events:
+			if terminalState(d, "Radio", "Yagi") {
+				if d.Health == nil || !d.Health.Online {
+					t.Fatalf("expected switch to be online, got %v", d.Health)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for the state update")
+		}
+	}
+}
+
+func TestGrpcSwitch_rateLimited(t *testing.T) {
+
+	_, conn := startGrpcSwitch(t, ratelimit.TerminalInterval(time.Hour))
+
+	p, err := sbSwitchProxy.New(sbSwitchProxy.GrpcConn(conn),
+		sbSwitchProxy.DoneCh(make(chan struct{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	set := func(state bool) error {
+		return p.SetPort(sw.Port{
+			Name:      "Radio",
+			Terminals: []sw.Terminal{{Name: "Yagi", State: state}},
+		})
+	}
+
+	if err := set(true); err != nil {
+		t.Fatal(err)
+	}
+
+	err = set(false)
+	if !errors.Is(err, sw.ErrRateLimited) {
+		t.Fatalf("expected rate limited error, got %v", err)
+	}
+}
+
+func TestGrpcSwitch_pulse(t *testing.T) {
+
+	_, conn := startGrpcSwitch(t)
+
+	events := make(chan sw.Device, 10)
+	eh := func(s sw.Switcher, d sw.Device) {
+		events <- d
+	}
+
+	p, err := sbSwitchProxy.New(sbSwitchProxy.GrpcConn(conn),
+		sbSwitchProxy.EventHandler(eh),
+		sbSwitchProxy.DoneCh(make(chan struct{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	yagi := sw.Terminal{Name: "Yagi", State: true}
+	if err := p.Pulse("Radio", yagi, time.Millisecond*100); err != nil {
+		t.Fatal(err)
+	}
+
+	// the terminal is switched on and reverted by the server
+	want := []bool{true, false}
+	timeout := time.After(time.Second * 5)
+	for len(want) > 0 {
+		select {
+		case d := <-events:
+			if terminalState(d, "Radio", "Yagi") == want[0] {
+				want = want[1:]
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for the state update")
+		}
+	}
+
+	if err := p.Pulse("Radio", yagi, 0); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
@@ -14,16 +16,10 @@ import (
 	natsTr "github.com/asim/go-micro/plugins/transport/nats/v3"
 	micro "github.com/asim/go-micro/v3"
 	"github.com/asim/go-micro/v3/broker"
+	microErrors "github.com/asim/go-micro/v3/errors"
 	"github.com/asim/go-micro/v3/server"
-	"github.com/dh1tw/remoteSwitch/configparser"
 	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
 	sw "github.com/dh1tw/remoteSwitch/switch"
-	ip9258 "github.com/dh1tw/remoteSwitch/switch/aviosys_ip9258"
-	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
-	rb "github.com/dh1tw/remoteSwitch/switch/ea4tx_remotebox"
-	mpGPIO "github.com/dh1tw/remoteSwitch/switch/multi-purpose-switch-gpio"
-	smGPIO "github.com/dh1tw/remoteSwitch/switch/stackmatch_gpio"
-	nats "github.com/nats-io/nats.go"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"google.golang.org/protobuf/proto"
@@ -45,6 +41,10 @@ func init() {
 	natsServerCmd.Flags().IntP("broker-port", "p", 4222, "Broker Port")
 	natsServerCmd.Flags().StringP("password", "P", "", "NATS Password")
 	natsServerCmd.Flags().StringP("username", "U", "", "NATS Username")
+	natsServerCmd.Flags().StringSlice("servers", []string{}, "NATS server URLs, e.g. nats://host1:4222,tls://host2:4222 (overrides broker-url & broker-port)")
+	natsServerCmd.Flags().Bool("no-randomize", false, "connect to the NATS servers in the provided order")
+	natsServerCmd.Flags().StringP("station", "X", "mystation", "Your station callsign")
+	natsServerCmd.Flags().Duration("heartbeat-interval", time.Second*5, "interval in which the heartbeat will be published")
 }
 
 func natsServer(cmd *cobra.Command, args []string) {
@@ -66,6 +66,10 @@ func natsServer(cmd *cobra.Command, args []string) {
 	viper.BindPFlag("nats.broker-port", cmd.Flags().Lookup("broker-port"))
 	viper.BindPFlag("nats.password", cmd.Flags().Lookup("password"))
 	viper.BindPFlag("nats.username", cmd.Flags().Lookup("username"))
+	viper.BindPFlag("nats.servers", cmd.Flags().Lookup("servers"))
+	viper.BindPFlag("nats.no-randomize", cmd.Flags().Lookup("no-randomize"))
+	viper.BindPFlag("shackbus.station", cmd.Flags().Lookup("station"))
+	viper.BindPFlag("nats.heartbeat-interval", cmd.Flags().Lookup("heartbeat-interval"))
 
 	// Profiling (uncomment if needed)
 	// go func() {
@@ -74,100 +78,30 @@ func natsServer(cmd *cobra.Command, args []string) {
 
 	// // struct which holds the switch.Switcher instance, implements the
 	// // RPC Service methods and publishes changes via the Broker
-	rpcSwitch := &rpcSwitch{}
+	rpcSwitch := &rpcSwitch{
+		tracker: newStateTracker(),
+	}
 
 	switchError := make(chan struct{})
 
-	if !viper.IsSet("switch.type") {
-		log.Fatal("missing configuration for switch (switch.type)")
+	swi, err := newSwitch(rpcSwitch.PublishDeviceUpdate, switchError)
+	if err != nil {
+		log.Fatal(err)
 	}
+	rpcSwitch.sw = swi
 
-	if !viper.IsSet("switch.name") {
-		log.Fatal("missing configuration for switch (switch.name)")
-	}
-
-	switchType := viper.GetString("switch.type")
-	switchName := viper.GetString("switch.name")
-
-	switch switchType {
-	case "multi_purpose_gpio":
-		sc, err := configparser.GetMPGPIOSwitchConfig(switchName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		sw := mpGPIO.NewMPSwitchGPIO(mpGPIO.Switch(sc),
-			mpGPIO.EventHandler(rpcSwitch.PublishDeviceUpdate))
-
-		if err := sw.Init(); err != nil {
-			log.Fatal(err)
-		}
-		rpcSwitch.sw = sw
-
-	case "dummy_switch":
-		sc, err := configparser.GetDummySwitchConfig(switchName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		sw := ds.NewDummySwitch(ds.Switch(sc), ds.EventHandler(rpcSwitch.PublishDeviceUpdate))
-
-		if err := sw.Init(); err != nil {
-			log.Fatal(err)
-		}
-		rpcSwitch.sw = sw
-
-	case "stackmatch_gpio":
-		sc, err := configparser.GetSmGPIOConfig(switchName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		sw := smGPIO.NewStackmatchGPIO(smGPIO.Config(sc), smGPIO.EventHandler(rpcSwitch.PublishDeviceUpdate))
-		if err := sw.Init(); err != nil {
-			log.Fatal(err)
-		}
-		rpcSwitch.sw = sw
-
-	case "ea4tx-remotebox":
-		opts, err := configparser.GetEA4TXRemoteboxConfig(switchName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		opts = append(opts, rb.EventHandler(rpcSwitch.PublishDeviceUpdate))
-		opts = append(opts, rb.ErrorCh(switchError))
-		sw := rb.New(opts...)
-		if err := sw.Init(); err != nil {
-			log.Fatal(err)
-		}
-		rpcSwitch.sw = sw
-	case "aviosys-ip9258":
-		opts, err := configparser.GetIP9258Config(switchName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		opts = append(opts, ip9258.EventHandler(rpcSwitch.PublishDeviceUpdate))
-		opts = append(opts, ip9258.ErrorCh(switchError))
-		sw := ip9258.NewIP9258(opts...)
-		if err := sw.Init(); err != nil {
-			log.Fatal(err)
-		}
-		rpcSwitch.sw = sw
-	default:
-		log.Fatalf("unknown switch type %s", switchType)
+	station := viper.GetString("shackbus.station")
+	if _, err := validateStation(station); err != nil {
+		log.Fatalf("invalid station (shackbus.station): %v", err)
 	}
 
 	// better call this Addrs(?)
-	serviceName := fmt.Sprintf("shackbus.switch.%s", rpcSwitch.sw.Name())
-
-	username := viper.GetString("nats.username")
-	password := viper.GetString("nats.password")
-	url := viper.GetString("nats.broker-url")
-	port := viper.GetInt("nats.broker-port")
-	addr := fmt.Sprintf("nats://%s:%v", url, port)
+	serviceName := switchServiceName(station, rpcSwitch.sw.Name())
 
-	// start from default nats config and add the common options
-	nopts := nats.GetDefaultOptions()
-	nopts.Servers = []string{addr}
-	nopts.User = username
-	nopts.Password = password
+	nopts, err := natsOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	regNatsOpts := nopts
 	brNatsOpts := nopts
@@ -230,6 +164,7 @@ func natsServer(cmd *cobra.Command, args []string) {
 	rpcSwitch.Lock()
 	rpcSwitch.service = ss
 	rpcSwitch.pubSubTopic = fmt.Sprintf("%s.state", strings.Replace(serviceName, " ", "_", -1))
+	rpcSwitch.heartbeatTopic = fmt.Sprintf("%s.heartbeat", strings.Replace(serviceName, " ", "_", -1))
 
 	// register our Rotator RPC handler
 	sbSwitch.RegisterSbSwitchHandler(ss.Server(), rpcSwitch)
@@ -237,6 +172,13 @@ func natsServer(cmd *cobra.Command, args []string) {
 	rpcSwitch.initialized = true
 	rpcSwitch.Unlock()
 
+	heartbeatInterval := viper.GetDuration("nats.heartbeat-interval")
+	if heartbeatInterval <= 0 {
+		log.Fatal("heartbeat-interval must be greater than zero")
+	}
+
+	go rpcSwitch.publishHeartbeats(heartbeatInterval)
+
 	go func() {
 		for {
 			select {
@@ -255,10 +197,67 @@ func natsServer(cmd *cobra.Command, args []string) {
 
 type rpcSwitch struct {
 	sync.Mutex
-	initialized bool
-	service     micro.Service
-	sw          sw.Switcher
-	pubSubTopic string
+	initialized    bool
+	service        micro.Service
+	sw             sw.Switcher
+	tracker        *stateTracker
+	pubSubTopic    string
+	heartbeatTopic string
+}
+
+// publishHeartbeats publishes periodically a heartbeat containing the
+// health of the switch. This function is blocking and should be
+// executed in its own go routine.
+func (s *rpcSwitch) publishHeartbeats(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.publishHeartbeat(interval)
+		<-ticker.C
+	}
+}
+
+func (s *rpcSwitch) publishHeartbeat(interval time.Duration) {
+
+	s.Lock()
+	defer s.Unlock()
+	if !s.initialized {
+		return
+	}
+
+	// switches which can not report their health are considered
+	// to be healthy as long as this process is alive
+	health := sw.Health{
+		Online:   true,
+		LastSeen: time.Now(),
+	}
+
+	if hr, ok := s.sw.(sw.HealthReporter); ok {
+		health = hr.Health()
+	}
+
+	hb := &sbSwitch.Heartbeat{
+		Name:      s.sw.Name(),
+		Timestamp: time.Now().UnixMilli(),
+		Interval:  int32(interval / time.Millisecond),
+		Health:    healthToSbHealth(health),
+	}
+
+	data, err := proto.Marshal(hb)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	msg := broker.Message{
+		Body: data,
+	}
+
+	if err := s.service.Options().Broker.Publish(s.heartbeatTopic, &msg); err != nil {
+		log.Println(err)
+	}
 }
 
 func (s *rpcSwitch) PublishDeviceUpdate(swi sw.Switcher, d sw.Device) {
@@ -269,6 +268,8 @@ func (s *rpcSwitch) PublishDeviceUpdate(swi sw.Switcher, d sw.Device) {
 		return
 	}
 
+	s.tracker.publish(swi)
+
 	data, err := proto.Marshal(deviceToSbDevice(swi.Serialize()))
 	if err != nil {
 		log.Println(err)
@@ -300,6 +301,70 @@ func (s *rpcSwitch) GetPort(ctx context.Context, portName *sbSwitch.PortName, po
 }
 
 func (s *rpcSwitch) SetPort(ctx context.Context, portReq *sbSwitch.PortRequest, out *sbSwitch.None) error {
+	err := s.sw.SetPort(portRequestToPort(portReq))
+	// the status code allows the clients to recognize rejected requests
+	if errors.Is(err, sw.ErrRateLimited) {
+		return microErrors.New(s.service.Name(), err.Error(), http.StatusTooManyRequests)
+	}
+	return err
+}
+
+func (s *rpcSwitch) Pulse(ctx context.Context, req *sbSwitch.PulseRequest, out *sbSwitch.None) error {
+	p, ok := s.sw.(sw.Pulser)
+	if !ok {
+		return microErrors.New(s.service.Name(), "pulses are not supported", http.StatusNotImplemented)
+	}
+	portName, t, d := pulseRequestToPulse(req)
+	err := p.Pulse(portName, t, d)
+	if errors.Is(err, sw.ErrRateLimited) {
+		return microErrors.New(s.service.Name(), err.Error(), http.StatusTooManyRequests)
+	}
+	return err
+}
+
+func (s *rpcSwitch) GetDevice(ctx context.Context, in *sbSwitch.None, sbDevice *sbSwitch.Device) error {
+
+	myDevice := deviceToSbDevice(s.sw.Serialize())
+
+	sbDevice.Name = myDevice.GetName()
+	sbDevice.Index = myDevice.GetIndex()
+	sbDevice.Exclusive = myDevice.GetExclusive()
+	sbDevice.Health = myDevice.GetHealth()
+	sbDevice.Ports = myDevice.GetPorts()
+
+	return nil
+}
+
+func (s *rpcSwitch) WatchDevice(ctx context.Context, in *sbSwitch.None, stream sbSwitch.SbSwitch_WatchDeviceStream) error {
+	defer stream.Close()
+	ctx = streamContext(ctx, stream)
+	return watchDevice(ctx, s.sw, s.tracker, stream.Send)
+}
+
+func (s *rpcSwitch) Subscribe(ctx context.Context, in *sbSwitch.None, stream sbSwitch.SbSwitch_SubscribeStream) error {
+	defer stream.Close()
+	ctx = streamContext(ctx, stream)
+	return subscribe(ctx, s.sw, s.tracker, stream.Send)
+}
+
+// streamContext returns a context which is canceled when the client
+// closes the stream. go-micro doesn't cancel the context of a stream
+// handler, however the client sends an end-of-stream message which
+// terminates a pending RecvMsg.
+func streamContext(ctx context.Context, stream interface{ RecvMsg(interface{}) error }) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		for {
+			if err := stream.RecvMsg(&sbSwitch.None{}); err != nil {
+				return
+			}
+		}
+	}()
+	return ctx
+}
+
+func portRequestToPort(portReq *sbSwitch.PortRequest) sw.Port {
 
 	port := sw.Port{
 		Name:      portReq.GetName(),
@@ -314,28 +379,30 @@ func (s *rpcSwitch) SetPort(ctx context.Context, portReq *sbSwitch.PortRequest,
 		port.Terminals = append(port.Terminals, terminal)
 	}
 
-	return s.sw.SetPort(port)
+	return port
 }
 
-func (s *rpcSwitch) GetDevice(ctx context.Context, in *sbSwitch.None, sbDevice *sbSwitch.Device) error {
-
-	myDevice := deviceToSbDevice(s.sw.Serialize())
-
-	sbDevice.Name = myDevice.GetName()
-	sbDevice.Index = myDevice.GetIndex()
-	sbDevice.Exclusive = myDevice.GetExclusive()
-	sbDevice.Ports = myDevice.GetPorts()
-
-	return nil
+// pulseRequestToPulse returns the port name, the terminal and the
+// duration of a pulse request.
+func pulseRequestToPulse(req *sbSwitch.PulseRequest) (string, sw.Terminal, time.Duration) {
+	t := sw.Terminal{
+		Name:  req.GetTerminal(),
+		State: req.GetState(),
+	}
+	return req.GetPort(), t, time.Duration(req.GetDuration()) * time.Millisecond
 }
 
 func deviceToSbDevice(device sw.Device) *sbSwitch.Device {
 
 	sbDevice := &sbSwitch.Device{
-		Name:  device.Name,
-		Index: int32(device.Index),
-		// Exclusive: device.Exclusive,
-		Ports: []*sbSwitch.Port{},
+		Name:      device.Name,
+		Index:     int32(device.Index),
+		Exclusive: device.Exclusive,
+		Ports:     []*sbSwitch.Port{},
+	}
+
+	if device.Health != nil {
+		sbDevice.Health = healthToSbHealth(*device.Health)
 	}
 
 	for _, p := range device.Ports {
@@ -344,20 +411,48 @@ func deviceToSbDevice(device sw.Device) *sbSwitch.Device {
 	return sbDevice
 }
 
+func healthToSbHealth(health sw.Health) *sbSwitch.Health {
+
+	sbHealth := &sbSwitch.Health{
+		Online:   health.Online,
+		Error:    health.Error,
+		Model:    health.Model,
+		Firmware: health.Firmware,
+	}
+
+	if !health.LastSeen.IsZero() {
+		sbHealth.LastSeen = health.LastSeen.UnixMilli()
+	}
+
+	return sbHealth
+}
+
+// copyBool returns a copy of an optional bool, so that the messages don't
+// share their fields with the devices they have been created from.
+func copyBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	return &c
+}
+
 func portToSbPort(port sw.Port) *sbSwitch.Port {
 
 	sbPort := &sbSwitch.Port{
-		Name:  port.Name,
-		Index: int32(port.Index),
-		// Exclusive: port.Exclusive,
+		Name:      port.Name,
+		Index:     int32(port.Index),
+		Exclusive: port.Exclusive,
 		Terminals: []*sbSwitch.Terminal{},
 	}
 
 	for _, t := range port.Terminals {
 		sbTerminal := &sbSwitch.Terminal{
-			Name:  t.Name,
-			Index: int32(t.Index),
-			State: t.State,
+			Name:     t.Name,
+			Index:    int32(t.Index),
+			State:    t.State,
+			Sensed:   copyBool(t.Sensed),
+			Mismatch: t.Mismatch,
 		}
 		sbPort.Terminals = append(sbPort.Terminals, sbTerminal)
 	}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// all switch services are registered in the registry with a fully qualified
+// service name (FQSN) of the form:
+//
+//	shackbus.<station>.switch.<switch name>
+//
+// The station (callsign) allows several stations / clubs to share
+// the same broker without seeing each other's switches.
+const (
+	fqsnPrefix  = "shackbus"
+	fqsnService = "switch"
+)
+
+// sanitizeStation returns the station name as used within a FQSN.
+func sanitizeStation(station string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(station), " ", "_", -1))
+}
+
+// validateStation returns the station name as used within a FQSN. Station
+// names must not interfere with the dot separated FQSN; neither can they
+// contain dots, nor can they be named "switch", since the service names
+// of their switches couldn't be told apart from the service names of
+// older versions (shackbus.switch.<switch name>).
+func validateStation(station string) (string, error) {
+
+	st := sanitizeStation(station)
+
+	switch {
+	case len(st) == 0:
+		return "", fmt.Errorf("station must not be empty")
+	case strings.Contains(st, "."):
+		return "", fmt.Errorf("station %q must not contain dots", station)
+	case st == fqsnService:
+		return "", fmt.Errorf("%q can't be used as station", station)
+	}
+
+	return st, nil
+}
+
+// switchServiceName returns the fully qualified service name (FQSN) of a
+// switch belonging to the given station.
+func switchServiceName(station, switchName string) string {
+	return fmt.Sprintf("%s.%s.%s.%s", fqsnPrefix, sanitizeStation(station),
+		fqsnService, switchName)
+}
+
+// parseServiceName extracts the station and the switch name from a fully
+// qualified service name (FQSN). Switches of older versions are registered
+// without a station (shackbus.switch.<switch name>); for them the station
+// is empty and the switch is considered to belong to the local station.
+// Since no station can be named "switch", shackbus.switch.<a>.<b> is
+// always the switch "<a>.<b>" of an older version.
+// If the service name is not a switch service, ok will be false.
+func parseServiceName(serviceName string) (station, switchName string, ok bool) {
+
+	splitted := strings.SplitN(serviceName, ".", 4)
+	if len(splitted) < 3 || splitted[0] != fqsnPrefix {
+		return "", "", false
+	}
+
+	if len(splitted) == 4 && splitted[1] != fqsnService && splitted[2] == fqsnService {
+		if len(splitted[1]) == 0 || len(splitted[3]) == 0 {
+			return "", "", false
+		}
+		return splitted[1], strings.Replace(splitted[3], "_", " ", -1), true
+	}
+
+	// legacy service name without station
+	legacyPrefix := fqsnPrefix + "." + fqsnService + "."
+	if !strings.HasPrefix(serviceName, legacyPrefix) {
+		return "", "", false
+	}
+	switchName = strings.TrimPrefix(serviceName, legacyPrefix)
+	if len(switchName) == 0 {
+		return "", "", false
+	}
+	return "", strings.Replace(switchName, "_", " ", -1), true
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import "testing"
+
+func Test_switchServiceName(t *testing.T) {
+	tests := []struct {
+		name       string
+		station    string
+		switchName string
+		want       string
+	}{
+		{"simple", "dh1tw", "6x2 Bandswitch", "shackbus.dh1tw.switch.6x2 Bandswitch"},
+		{"callsign in upper case", "DL0ABC", "stackmatch", "shackbus.dl0abc.switch.stackmatch"},
+		{"sanitize station", " My Station ", "sw", "shackbus.my_station.switch.sw"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := switchServiceName(tt.station, tt.switchName); got != tt.want {
+				t.Errorf("switchServiceName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateStation(t *testing.T) {
+	tests := []struct {
+		name    string
+		station string
+		want    string
+		wantErr bool
+	}{
+		{"callsign", " DH1TW ", "dh1tw", false},
+		{"spaces", "my station", "my_station", false},
+		{"empty", " ", "", true},
+		{"dots", "my.station", "", true},
+		{"switch", "Switch", "", true},
+		{"switch as part of the name", "switchyard", "switchyard", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateStation(tt.station)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateStation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("validateStation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseServiceName(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceName string
+		wantStation string
+		wantSwitch  string
+		wantOk      bool
+	}{
+		{"valid switch service", "shackbus.dh1tw.switch.6x2_Bandswitch", "dh1tw", "6x2 Bandswitch", true},
+		{"switch name containing dots", "shackbus.dh1tw.switch.sw.v2", "dh1tw", "sw.v2", true},
+		{"legacy service name without station", "shackbus.switch.6x2_Bandswitch", "", "6x2 Bandswitch", true},
+		{"legacy switch name containing dots", "shackbus.switch.sw.v2", "", "sw.v2", true},
+		{"legacy empty switch name", "shackbus.switch.", "", "", false},
+		{"legacy switch name containing dots and switch", "shackbus.switch.a.switch.b", "", "a.switch.b", true},
+		{"legacy switch name starting with switch", "shackbus.switch.switch.b", "", "switch.b", true},
+		{"rotator service", "shackbus.dh1tw.rotator.ham4", "", "", false},
+		{"empty switch name", "shackbus.dh1tw.switch.", "", "", false},
+		{"other service", "go.micro.registry", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			station, switchName, ok := parseServiceName(tt.serviceName)
+			if ok != tt.wantOk {
+				t.Fatalf("parseServiceName() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if station != tt.wantStation {
+				t.Errorf("parseServiceName() station = %v, want %v", station, tt.wantStation)
+			}
+			if switchName != tt.wantSwitch {
+				t.Errorf("parseServiceName() switchName = %v, want %v", switchName, tt.wantSwitch)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// simulateCmd represents the simulate command
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulate a device",
+	Long: `Simulate a device
+
+Serve the protocol of a device on a TCP socket, so that remoteSwitch can be
+tested and demonstrated without hardware`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Please select the device (--help for available options)")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	rb "github.com/dh1tw/remoteSwitch/switch/ea4tx_remotebox"
+	"github.com/spf13/cobra"
+)
+
+var simulateRemoteboxCmd = &cobra.Command{
+	Use:   "ea4tx-remotebox",
+	Short: "simulate an EA4TX Remotebox",
+	Long: fmt.Sprintf(`
+Simulate an EA4TX Remotebox behind a serial server. The simulator serves the
+line protocol of the Remotebox on a TCP socket; point the portname of an
+ea4tx-remotebox switch to it (e.g. portname = "localhost:7000").
+
+Models: %s
+Firmware versions: %s (later versions behave like 1.3g)`,
+		strings.Join(rb.Models(), ", "), strings.Join(rb.Firmwares(), ", ")),
+	Run: simulateRemotebox,
+}
+
+func init() {
+	simulateCmd.AddCommand(simulateRemoteboxCmd)
+	simulateRemoteboxCmd.Flags().String("listen", ":7000", "address on which the simulator listens")
+	simulateRemoteboxCmd.Flags().String("model", "2x12", "Remotebox model")
+	simulateRemoteboxCmd.Flags().String("firmware", "1.3g", "firmware version")
+	simulateRemoteboxCmd.Flags().StringSlice("antenna-names", []string{}, "names of the antennas (up to 4 characters), starting with antenna 1")
+}
+
+func simulateRemotebox(cmd *cobra.Command, args []string) {
+
+	listen, _ := cmd.Flags().GetString("listen")
+	model, _ := cmd.Flags().GetString("model")
+	firmware, _ := cmd.Flags().GetString("firmware")
+	names, _ := cmd.Flags().GetStringSlice("antenna-names")
+
+	sim, err := rb.NewSimulator(model, firmware)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for i, name := range names {
+		if err := sim.SetAntennaName(i+1, name); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	sim.SetLogger(log.Printf)
+
+	addr, err := sim.Listen(listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sim.Close()
+
+	log.Printf("simulating EA4TX Remotebox %s (firmware %s) on %s", model, firmware, addr)
+
+	// Channel to handle OS signals
+	osSignals := make(chan os.Signal, 1)
+
+	//subscribe to os.Interrupt (CTRL-C signal)
+	signal.Notify(osSignals, os.Interrupt)
+
+	<-osSignals
+}
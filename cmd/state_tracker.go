@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// subscriberBufferSize is the amount of updates which can be queued for
+// a subscriber. If a subscriber falls further behind, its queue is
+// replaced by a snapshot.
+const subscriberBufferSize = 16
+
+// keepaliveInterval is the interval in which an empty update is sent to
+// idle subscribers. Some transports (e.g. go-micro over nats) terminate
+// streams on which nothing has been received for a few seconds. The web
+// server's nats transport times out after 2 seconds, so the interval must
+// be clearly shorter.
+const keepaliveInterval = time.Second
+
+// stateTracker keeps track of the state of a switch and distributes
+// the changes as sequenced updates to all subscribers (Subscribe and
+// WatchDevice streams). Sequence numbers are consecutive, so that a
+// subscriber can detect a missed update and resubscribe.
+type stateTracker struct {
+	sync.Mutex
+	sequence    uint64
+	device      *sw.Device // state at the current sequence number
+	subscribers map[chan *sbSwitch.StateUpdate]struct{}
+}
+
+func newStateTracker() *stateTracker {
+	return &stateTracker{
+		subscribers: make(map[chan *sbSwitch.StateUpdate]struct{}),
+	}
+}
+
+// subscribe registers a new subscriber. The returned channel already
+// contains a snapshot of the switch's state.
+func (t *stateTracker) subscribe(s sw.Switcher) chan *sbSwitch.StateUpdate {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.device == nil {
+		device := s.Serialize()
+		t.device = &device
+	}
+
+	ch := make(chan *sbSwitch.StateUpdate, subscriberBufferSize)
+	ch <- t.snapshot()
+	t.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (t *stateTracker) unsubscribe(ch chan *sbSwitch.StateUpdate) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.subscribers, ch)
+}
+
+// current returns the state of the switch at the current sequence
+// number.
+func (t *stateTracker) current() sw.Device {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.device == nil {
+		return sw.Device{}
+	}
+	return *t.device
+}
+
+// publish compares the current state of the switch with the last known
+// state and sends the differences to all subscribers. The switch is
+// serialized while holding the lock so that concurrent calls can't
+// overtake each other with an outdated state.
+func (t *stateTracker) publish(s sw.Switcher) {
+	t.Lock()
+	defer t.Unlock()
+
+	device := s.Serialize()
+
+	update := diffDevice(t.device, &device)
+	if update == nil {
+		return
+	}
+
+	t.sequence++
+	update.Sequence = t.sequence
+	t.device = &device
+
+	for ch := range t.subscribers {
+		select {
+		case ch <- update:
+		default:
+			// the subscriber is too slow. Instead of dropping an update
+			// we replace its queue with a snapshot.
+			for len(ch) > 0 {
+				select {
+				case <-ch:
+				default:
+				}
+			}
+			ch <- t.snapshot()
+		}
+	}
+}
+
+// snapshot returns a StateUpdate containing the full state of the
+// switch. This method is not threadsafe.
+func (t *stateTracker) snapshot() *sbSwitch.StateUpdate {
+	return &sbSwitch.StateUpdate{
+		Sequence: t.sequence,
+		Snapshot: deviceToSbDevice(*t.device),
+	}
+}
+
+// diffDevice returns the update which transforms the old state of a
+// device into the new state. If the structure of the device (name,
+// ports, terminals) has changed, the update contains a snapshot. If
+// nothing (except the last seen timestamp) has changed, nil is returned.
+func diffDevice(old, new *sw.Device) *sbSwitch.StateUpdate {
+
+	healthChanged := old != nil && healthDiffers(old.Health, new.Health)
+
+	// removing the health can't be expressed incrementally either
+	if old == nil || !sameStructure(*old, *new) ||
+		(healthChanged && new.Health == nil) {
+		return &sbSwitch.StateUpdate{
+			Snapshot: deviceToSbDevice(*new),
+		}
+	}
+
+	update := &sbSwitch.StateUpdate{}
+
+	for i, p := range new.Ports {
+		for j, t := range p.Terminals {
+			if !terminalDiffers(old.Ports[i].Terminals[j], t) {
+				continue
+			}
+			update.Changes = append(update.Changes, &sbSwitch.TerminalChange{
+				Port:     p.Name,
+				Terminal: t.Name,
+				State:    t.State,
+				Sensed:   copyBool(t.Sensed),
+				Mismatch: t.Mismatch,
+			})
+		}
+	}
+
+	if healthChanged {
+		update.Health = healthToSbHealth(*new.Health)
+	}
+
+	if len(update.Changes) == 0 && !healthChanged {
+		return nil
+	}
+
+	return update
+}
+
+// sameStructure checks if both devices have the same name, index,
+// exclusivity, ports and terminals (ignoring their state).
+func sameStructure(a, b sw.Device) bool {
+
+	if a.Name != b.Name || a.Index != b.Index || a.Exclusive != b.Exclusive ||
+		len(a.Ports) != len(b.Ports) {
+		return false
+	}
+
+	for i := range a.Ports {
+		pa, pb := a.Ports[i], b.Ports[i]
+		if pa.Name != pb.Name || pa.Index != pb.Index ||
+			pa.Exclusive != pb.Exclusive || len(pa.Terminals) != len(pb.Terminals) {
+			return false
+		}
+		for j := range pa.Terminals {
+			ta, tb := pa.Terminals[j], pb.Terminals[j]
+			if ta.Name != tb.Name || ta.Index != tb.Index {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// terminalDiffers checks if the state of the terminal has changed. A
+// change contains all fields, so that it replaces the old state.
+func terminalDiffers(a, b sw.Terminal) bool {
+	if a.State != b.State || a.Mismatch != b.Mismatch {
+		return true
+	}
+	if a.Sensed == nil || b.Sensed == nil {
+		return a.Sensed != b.Sensed
+	}
+	return *a.Sensed != *b.Sensed
+}
+
+// healthDiffers checks if the health has changed. The last seen
+// timestamp is ignored, since it changes with every interaction.
+func healthDiffers(a, b *sw.Health) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+	return a.Online != b.Online || a.Error != b.Error ||
+		a.Model != b.Model || a.Firmware != b.Firmware
+}
+
+// subscribe sends a snapshot of the switch and afterwards the
+// incremental updates through send until the context is canceled or
+// sending fails. It implements the Subscribe RPC independent of the
+// transport.
+func subscribe(ctx context.Context, s sw.Switcher, tracker *stateTracker,
+	send func(*sbSwitch.StateUpdate) error) error {
+
+	ch := tracker.subscribe(s)
+	defer tracker.unsubscribe(ch)
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	var sequence uint64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepalive.C:
+			// an update without changes and the last sequence number
+			if err := send(&sbSwitch.StateUpdate{Sequence: sequence}); err != nil {
+				return err
+			}
+		case update := <-ch:
+			if err := send(update); err != nil {
+				return err
+			}
+			sequence = update.GetSequence()
+			keepalive.Reset(keepaliveInterval)
+		}
+	}
+}
+
+// watchDevice sends the current state of the switch and afterwards
+// the full state on every change through send until the context is
+// canceled or sending fails. It implements the WatchDevice RPC
+// independent of the transport.
+func watchDevice(ctx context.Context, s sw.Switcher, tracker *stateTracker,
+	send func(*sbSwitch.Device) error) error {
+
+	ch := tracker.subscribe(s)
+	defer tracker.unsubscribe(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update := <-ch:
+			if snapshot := update.GetSnapshot(); snapshot != nil {
+				if err := send(snapshot); err != nil {
+					return err
+				}
+				continue
+			}
+			// skip outdated updates if we have fallen behind
+			if len(ch) > 0 {
+				continue
+			}
+			if err := send(deviceToSbDevice(tracker.current())); err != nil {
+				return err
+			}
+		}
+	}
+}
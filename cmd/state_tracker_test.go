@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"testing"
+
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
+)
+
+func testDevice(states ...bool) *sw.Device {
+	d := &sw.Device{
+		Name:   "Antenna Switch",
+		Health: &sw.Health{Online: true},
+		Ports: []sw.Port{
+			{
+				Name: "Radio",
+				Terminals: []sw.Terminal{
+					{Name: "Yagi", Index: 0},
+					{Name: "Dipole", Index: 1},
+				},
+			},
+		},
+	}
+	for i, state := range states {
+		d.Ports[0].Terminals[i].State = state
+	}
+	return d
+}
+
+func Test_diffDevice(t *testing.T) {
+
+	renamed := testDevice(false, false)
+	renamed.Ports[0].Terminals[1].Name = "Vertical"
+
+	offline := testDevice(false, false)
+	offline.Health = &sw.Health{Online: false, Error: "serial port closed"}
+
+	noHealth := testDevice(false, false)
+	noHealth.Health = nil
+
+	exclusive := testDevice(false, false)
+	exclusive.Ports[0].Exclusive = true
+
+	on, off := true, false
+	sensedOff := testDevice(false, false)
+	sensedOff.Ports[0].Terminals[1].Sensed = &off
+	sensedOn := testDevice(false, false)
+	sensedOn.Ports[0].Terminals[1].Sensed = &on
+	sensedOn.Ports[0].Terminals[1].Mismatch = true
+
+	tests := []struct {
+		name         string
+		old          *sw.Device
+		new          *sw.Device
+		wantNil      bool
+		wantSnapshot bool
+		wantChanges  []*sbSwitch.TerminalChange
+		wantHealth   bool
+	}{
+		{"initial state", nil, testDevice(false, false), false, true, nil, false},
+		{"no change", testDevice(true, false), testDevice(true, false), true, false, nil, false},
+		{"terminal activated", testDevice(false, false), testDevice(false, true), false, false,
+			[]*sbSwitch.TerminalChange{{Port: "Radio", Terminal: "Dipole", State: true}}, false},
+		{"exclusive switch over", testDevice(true, false), testDevice(false, true), false, false,
+			[]*sbSwitch.TerminalChange{
+				{Port: "Radio", Terminal: "Yagi", State: false},
+				{Port: "Radio", Terminal: "Dipole", State: true},
+			}, false},
+		{"terminal renamed", testDevice(false, false), renamed, false, true, nil, false},
+		{"health changed", testDevice(false, false), offline, false, false, nil, true},
+		{"health removed", testDevice(false, false), noHealth, false, true, nil, false},
+		{"port became exclusive", testDevice(false, false), exclusive, false, true, nil, false},
+		{"sense input read", testDevice(false, false), sensedOff, false, false,
+			[]*sbSwitch.TerminalChange{{Port: "Radio", Terminal: "Dipole", Sensed: &off}}, false},
+		{"external change", sensedOff, sensedOn, false, false,
+			[]*sbSwitch.TerminalChange{{Port: "Radio", Terminal: "Dipole", Sensed: &on, Mismatch: true}}, false},
+		{"no sensed change", sensedOn, sensedOn, true, false, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffDevice(tt.old, tt.new)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("diffDevice() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("diffDevice() = nil")
+			}
+			if (got.GetSnapshot() != nil) != tt.wantSnapshot {
+				t.Fatalf("diffDevice() snapshot = %v, want snapshot %v", got.GetSnapshot(), tt.wantSnapshot)
+			}
+			if len(got.GetChanges()) != len(tt.wantChanges) {
+				t.Fatalf("diffDevice() changes = %v, want %v", got.GetChanges(), tt.wantChanges)
+			}
+			for i, c := range got.GetChanges() {
+				want := tt.wantChanges[i]
+				if c.GetPort() != want.GetPort() || c.GetTerminal() != want.GetTerminal() ||
+					c.GetState() != want.GetState() || (c.Sensed == nil) != (want.Sensed == nil) ||
+					c.GetSensed() != want.GetSensed() || c.GetMismatch() != want.GetMismatch() {
+					t.Errorf("diffDevice() change %d = %v, want %v", i, c, want)
+				}
+			}
+			if (got.GetHealth() != nil) != tt.wantHealth {
+				t.Errorf("diffDevice() health = %v, want health %v", got.GetHealth(), tt.wantHealth)
+			}
+		})
+	}
+}
+
+func Test_stateTracker(t *testing.T) {
+
+	tracker := newStateTracker()
+
+	sc := ds.SwitchConfig{
+		Name: "Antenna Switch",
+		Ports: []ds.PortConfig{
+			{
+				Name:      "Radio",
+				Exclusive: true,
+				Terminals: []ds.PinConfig{
+					{Name: "Yagi", Index: 0},
+					{Name: "Dipole", Index: 1},
+				},
+			},
+		},
+	}
+
+	dummy := ds.NewDummySwitch(ds.Switch(sc))
+	if err := dummy.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := tracker.subscribe(dummy)
+	defer tracker.unsubscribe(ch)
+
+	if u := <-ch; u.GetSnapshot() == nil || u.GetSequence() != 0 {
+		t.Fatalf("expected snapshot with sequence 0, got %v", u)
+	}
+
+	toggle := func(terminal string) {
+		port := sw.Port{
+			Name:      "Radio",
+			Terminals: []sw.Terminal{{Name: terminal, State: true}},
+		}
+		if err := dummy.SetPort(port); err != nil {
+			t.Fatal(err)
+		}
+		tracker.publish(dummy)
+	}
+
+	toggle("Yagi")
+	u := <-ch
+	if u.GetSequence() != 1 || len(u.GetChanges()) != 1 {
+		t.Fatalf("expected update 1 with one change, got %v", u)
+	}
+
+	// publishing without a change doesn't create an update
+	tracker.publish(dummy)
+	if len(ch) != 0 {
+		t.Fatalf("unexpected update %v", <-ch)
+	}
+
+	// let the subscriber fall behind; it must receive a snapshot
+	// instead of an incomplete sequence of updates
+	terminals := []string{"Dipole", "Yagi"}
+	for i := 0; i < subscriberBufferSize+1; i++ {
+		toggle(terminals[i%2])
+	}
+
+	if len(ch) != 1 {
+		t.Fatalf("expected only a snapshot in the queue, got %d updates", len(ch))
+	}
+	u = <-ch
+	if u.GetSnapshot() == nil || u.GetSequence() != uint64(subscriberBufferSize+2) {
+		t.Fatalf("expected snapshot with sequence %d, got %v", subscriberBufferSize+2, u)
+	}
+}
@@ -25,6 +25,11 @@ import (
 	nats "github.com/nats-io/nats.go"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
 var webServerCmd = &cobra.Command{
@@ -39,10 +44,15 @@ func init() {
 	webServerCmd.Flags().StringP("host", "w", "127.0.0.1", "Host (use '0.0.0.0' to listen on all network adapters)")
 	webServerCmd.Flags().IntP("port", "k", 7010, "webserver http port")
 	webServerCmd.Flags().StringP("station", "X", "mystation", "Your station callsign")
+	webServerCmd.Flags().StringSlice("stations", []string{}, "additional stations (callsigns) whose switches will be shown")
 	webServerCmd.Flags().StringP("broker-url", "u", "localhost", "Broker URL")
 	webServerCmd.Flags().IntP("broker-port", "p", 4222, "Broker Port")
 	webServerCmd.Flags().StringP("password", "P", "", "NATS Password")
 	webServerCmd.Flags().StringP("username", "U", "", "NATS Username")
+	webServerCmd.Flags().StringSlice("servers", []string{}, "NATS server URLs, e.g. nats://host1:4222,tls://host2:4222 (overrides broker-url & broker-port)")
+	webServerCmd.Flags().Bool("no-randomize", false, "connect to the NATS servers in the provided order")
+	webServerCmd.Flags().StringP("transport", "t", "nats", "transport used to discover the switches (nats|grpc)")
+	webServerCmd.Flags().StringSlice("grpc-endpoints", []string{}, "gRPC switch servers to attach to, e.g. host1:7020,host2:7020")
 }
 
 func webServer(cmd *cobra.Command, args []string) {
@@ -68,11 +78,15 @@ func webServer(cmd *cobra.Command, args []string) {
 	viper.BindPFlag("web.host", cmd.Flags().Lookup("host"))
 	viper.BindPFlag("web.port", cmd.Flags().Lookup("port"))
 	viper.BindPFlag("shackbus.station", cmd.Flags().Lookup("station"))
+	viper.BindPFlag("web.stations", cmd.Flags().Lookup("stations"))
 	viper.BindPFlag("shackbus.transport", cmd.Flags().Lookup("transport"))
 	viper.BindPFlag("nats.broker-url", cmd.Flags().Lookup("broker-url"))
 	viper.BindPFlag("nats.broker-port", cmd.Flags().Lookup("broker-port"))
 	viper.BindPFlag("nats.password", cmd.Flags().Lookup("password"))
 	viper.BindPFlag("nats.username", cmd.Flags().Lookup("username"))
+	viper.BindPFlag("nats.servers", cmd.Flags().Lookup("servers"))
+	viper.BindPFlag("nats.no-randomize", cmd.Flags().Lookup("no-randomize"))
+	viper.BindPFlag("grpc.endpoints", cmd.Flags().Lookup("grpc-endpoints"))
 
 	h, err := hub.NewHub()
 	if err != nil {
@@ -80,29 +94,130 @@ func webServer(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	station, err := validateStation(viper.GetString("shackbus.station"))
+	if err != nil {
+		fmt.Printf("invalid station (shackbus.station): %v\n", err)
+		os.Exit(1)
+	}
+
+	// the switches of our own station are always shown. Optionally
+	// the switches of other stations (sharing the same broker) can be
+	// aggregated.
+	stations := map[string]bool{station: true}
+	for _, st := range viper.GetStringSlice("web.stations") {
+		st, err := validateStation(st)
+		if err != nil {
+			fmt.Printf("invalid station (web.stations): %v\n", err)
+			os.Exit(1)
+		}
+		stations[st] = true
+	}
+
+	w := webserver{
+		Hub:      h,
+		station:  station,
+		stations: stations,
+	}
+
+	// will be closed when an error occurs in the webserver goroutine
+	webserverErrorCh := make(chan struct{})
+
+	// launch webserver
+	go w.ListenHTTP(viper.GetString("web.host"), viper.GetInt("web.port"), webserverErrorCh)
+
+	// gRPC switch servers are statically configured. They are attached
+	// independent of the selected transport.
+	for _, endpoint := range viper.GetStringSlice("grpc.endpoints") {
+		go w.attachGrpcSwitch(endpoint)
+	}
+
+	connClosed := make(chan struct{})
+
+	switch transport := viper.GetString("shackbus.transport"); transport {
+	case "nats":
+		if err := w.connectNats(connClosed); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	case "grpc":
+		if len(viper.GetStringSlice("grpc.endpoints")) == 0 {
+			fmt.Println("no gRPC endpoints (grpc.endpoints) provided")
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("unknown transport %s\n", transport)
+		os.Exit(1)
+	}
+
+	// Channel to handle OS signals
+	osSignals := make(chan os.Signal, 1)
+
+	//subscribe to os.Interrupt (CTRL-C signal)
+	signal.Notify(osSignals, os.Interrupt)
+
+	for {
+		select {
+		case sig := <-osSignals:
+			if sig == os.Interrupt {
+				return
+			}
+		case <-connClosed:
+			for _, s := range w.Switches() {
+				// switches attached through gRPC don't depend on the broker
+				if w.isGrpcSwitch(s.Name()) {
+					continue
+				}
+				s.Close()
+			}
+		case <-webserverErrorCh:
+			fmt.Println("web server crashed")
+			return
+		case device := <-bcast:
+			ev := hub.Event{
+				Name:       hub.UpdateSwitch,
+				DeviceName: device.Name,
+				Device:     device,
+			}
+			w.BroadcastToWsClients(ev)
+		}
+	}
+}
+
+// connectNats connects the webserver to the nats broker, adds all
+// switches found in the registry and watches the registry for changes.
+// The connClosed channel is notified when the connection to the broker
+// has been closed for good.
+func (w *webserver) connectNats(connClosed chan struct{}) error {
+
 	var reg registry.Registry
 	var tr transport.Transport
 	var br broker.Broker
 	var cl client.Client
 
-	connClosed := make(chan struct{})
+	nopts, err := natsOptions()
+	if err != nil {
+		return err
+	}
+	if !viper.IsSet("nats.connect-timeout") {
+		nopts.Timeout = time.Second * 10
+	}
 
-	url := viper.GetString("nats.broker-url")
-	port := viper.GetInt("nats.broker-port")
-	username := viper.GetString("nats.username")
-	password := viper.GetString("nats.password")
+	// when connected to a cluster, a disconnect is usually followed by a
+	// reconnect to another server of the cluster. Only when the connection
+	// has been closed for good (all reconnect attempts failed) we drop the
+	// switches.
+	disconnectedHdlr := func(conn *nats.Conn, err error) {
+		log.Println("disconnected from nats broker:", err)
+	}
 
-	nopts := nats.GetDefaultOptions()
-	nopts.Servers = []string{fmt.Sprintf("%s:%d", url, port)}
-	nopts.User = username
-	nopts.Password = password
-	nopts.Timeout = time.Second * 10
+	reconnectedHdlr := func(conn *nats.Conn) {
+		log.Println("reconnected to nats broker", conn.ConnectedUrlRedacted())
+	}
 
-	disconnectedHdlr := func(conn *nats.Conn) {
+	closedHdlr := func(conn *nats.Conn) {
 		log.Println("connection to nats broker closed")
 		connClosed <- struct{}{}
 	}
-	// nopts.DisconnectedCB = disconnectHdlr
 
 	errorHdlr := func(conn *nats.Conn, sub *nats.Subscription, err error) {
 		log.Printf("Error Handler called (%s): %s", sub.Subject, err)
@@ -112,7 +227,9 @@ func webServer(cmd *cobra.Command, args []string) {
 	regNatsOpts := nopts
 	brNatsOpts := nopts
 	trNatsOpts := nopts
-	regNatsOpts.DisconnectedCB = disconnectedHdlr
+	regNatsOpts.DisconnectedErrCB = disconnectedHdlr
+	regNatsOpts.ReconnectedCB = reconnectedHdlr
+	regNatsOpts.ClosedCB = closedHdlr
 	regNatsOpts.Name = "remoteSwitch.client:registry"
 	brNatsOpts.Name = "remoteSwitch.client:broker"
 	trNatsOpts.Name = "remoteSwitch.client:transport"
@@ -135,21 +252,14 @@ func webServer(cmd *cobra.Command, args []string) {
 	)
 
 	if err := cl.Init(); err != nil {
-		log.Println(err)
-		return
+		return err
 	}
 
-	cache := &serviceCache{
+	w.cli = cl
+	w.cache = &serviceCache{
 		ttl:   time.Second * 25,
 		cache: make(map[string]time.Time),
 	}
-	w := webserver{h, cl, cache}
-
-	// will be closed when an error occurs in the webserver goroutine
-	webserverErrorCh := make(chan struct{})
-
-	// launch webserver
-	go w.ListenHTTP(viper.GetString("web.host"), viper.GetInt("web.port"), webserverErrorCh)
 
 	// at startup query the registry and add all found rotators
 	if err := w.listAndAddSwitch(); err != nil {
@@ -162,35 +272,7 @@ func webServer(cmd *cobra.Command, args []string) {
 	// check regularly if the proxy objects are still alive
 	go w.checkTimeout()
 
-	// Channel to handle OS signals
-	osSignals := make(chan os.Signal, 1)
-
-	//subscribe to os.Interrupt (CTRL-C signal)
-	signal.Notify(osSignals, os.Interrupt)
-
-	for {
-		select {
-		case sig := <-osSignals:
-			if sig == os.Interrupt {
-				return
-			}
-		case <-connClosed:
-			switches := w.Switches()
-			for _, s := range switches {
-				s.Close()
-			}
-		case <-webserverErrorCh:
-			fmt.Println("web server crashed")
-			return
-		case device := <-bcast:
-			ev := hub.Event{
-				Name:       hub.UpdateSwitch,
-				DeviceName: device.Name,
-				Device:     device,
-			}
-			w.BroadcastToWsClients(ev)
-		}
-	}
+	return nil
 }
 
 var bcast = make(chan sw.Device, 10)
@@ -207,20 +289,36 @@ type serviceCache struct {
 
 type webserver struct {
 	*hub.Hub
-	cli   client.Client
-	cache *serviceCache
+	cli          client.Client
+	cache        *serviceCache
+	station      string          // our own station
+	stations     map[string]bool // all stations which will be shown
+	grpcSwitches sync.Map        // names of the switches attached through gRPC
 }
 
-//extract the service's name from its fully qualified service name (FQSN)
-func nameFromFQSN(serviceName string) string {
-	splitted := strings.Split(serviceName, ".")
-	name := splitted[len(splitted)-1]
-	return strings.Replace(name, "_", " ", -1)
+// hubName returns the name under which a switch service will be
+// registered in the hub. Switches of our own station keep their name,
+// while the switches of other stations are suffixed with '@station' to
+// avoid collisions.
+func (w *webserver) hubName(serviceName string) string {
+	station, switchName, ok := w.parseServiceName(serviceName)
+	if !ok {
+		return ""
+	}
+	if station == w.station {
+		return switchName
+	}
+	return fmt.Sprintf("%s@%s", switchName, station)
 }
 
 func (w *webserver) addSwitch(switchServiceName string) error {
 
-	switchName := nameFromFQSN(switchServiceName)
+	station, _, ok := w.parseServiceName(switchServiceName)
+	if !ok {
+		return fmt.Errorf("invalid switch service name %s", switchServiceName)
+	}
+
+	switchName := w.hubName(switchServiceName)
 
 	// only continue if this rotator(name) does not exist yet
 	_, exists := w.Switch(switchName)
@@ -233,14 +331,15 @@ func (w *webserver) addSwitch(switchServiceName string) error {
 	done := sbSwitchProxy.DoneCh(doneCh)
 	cli := sbSwitchProxy.Client(w.cli)
 	eh := sbSwitchProxy.EventHandler(ev)
-	name := sbSwitchProxy.Name(switchName)
+	alias := sbSwitchProxy.Alias(switchName)
+	st := sbSwitchProxy.Station(station)
 	serviceName := sbSwitchProxy.ServiceName(strings.Replace(switchServiceName, " ", "_", -1))
 
 	// create new switch proxy object
-	r, err := sbSwitchProxy.New(done, cli, eh, name, serviceName)
+	r, err := sbSwitchProxy.New(done, cli, eh, alias, st, serviceName)
 	if err != nil {
 		close(doneCh)
-		return fmt.Errorf("unable to create proxy object: %v", err)
+		return fmt.Errorf("unable to create proxy object: %w", err)
 	}
 
 	if err := w.AddSwitch(r); err != nil {
@@ -269,7 +368,7 @@ func (w *webserver) listAndAddSwitch() error {
 
 	for _, service := range services {
 		// fmt.Println("found:", service.Name)
-		if !isSwitch(service.Name) {
+		if !w.isSwitch(service.Name) {
 			continue
 		}
 		if err := w.addSwitch(service.Name); err != nil {
@@ -280,9 +379,25 @@ func (w *webserver) listAndAddSwitch() error {
 	return nil
 }
 
+// parseServiceName extracts the station and the switch name from a
+// switch service name. Switches registered without a station (older
+// versions) are assigned to our own station.
+func (w *webserver) parseServiceName(serviceName string) (station, switchName string, ok bool) {
+	station, switchName, ok = parseServiceName(serviceName)
+	if ok && len(station) == 0 {
+		station = w.station
+	}
+	return station, switchName, ok
+}
+
 // isSwitch checks a serviceName string if it is a shackbus switch
-func isSwitch(serviceName string) bool {
-	return strings.Contains(serviceName, "shackbus.switch.")
+// belonging to one of the stations we are interested in
+func (w *webserver) isSwitch(serviceName string) bool {
+	station, _, ok := w.parseServiceName(serviceName)
+	if !ok {
+		return false
+	}
+	return w.stations[station]
 }
 
 // watchRegistry is a blocking function which continuously
@@ -301,7 +416,7 @@ func (w *webserver) watchRegistry() {
 			log.Println("watch error:", err)
 		}
 
-		if !isSwitch(res.Service.Name) {
+		if !w.isSwitch(res.Service.Name) {
 			continue
 		}
 
@@ -316,7 +431,7 @@ func (w *webserver) watchRegistry() {
 			w.cache.Unlock()
 
 		case "delete":
-			switchName := nameFromFQSN(res.Service.Name)
+			switchName := w.hubName(res.Service.Name)
 			r, exists := w.Switch(switchName)
 			if !exists {
 				continue
@@ -341,7 +456,7 @@ func (w *webserver) checkTimeout() {
 		w.cache.Lock()
 		for service, timeout := range w.cache.cache {
 			if time.Since(timeout) >= w.cache.ttl {
-				switchName := nameFromFQSN(service)
+				switchName := w.hubName(service)
 				r, exists := w.Switch(switchName)
 				if !exists {
 					continue
@@ -354,3 +469,86 @@ func (w *webserver) checkTimeout() {
 		w.cache.Unlock()
 	}
 }
+
+// attachGrpcSwitch adds a proxy object for the gRPC switch server
+// listening on endpoint. If the server is not reachable, the attempt is
+// repeated until it succeeds. On any other error (e.g. a switch with the
+// same name has already been added), the switch is not attached. Once
+// attached, the proxy object takes care of reconnecting itself.
+// This function is blocking and should be executed in a go routine.
+func (w *webserver) attachGrpcSwitch(endpoint string) {
+
+	for {
+		err := w.addGrpcSwitch(endpoint)
+		if err == nil {
+			return
+		}
+		if !isConnectionError(err) {
+			log.Printf("unable to attach gRPC switch %s: %v; giving up", endpoint, err)
+			return
+		}
+		log.Printf("unable to attach gRPC switch %s: %v", endpoint, err)
+		time.Sleep(time.Second * 5)
+	}
+}
+
+// isConnectionError returns true if the error indicates that the gRPC
+// switch server couldn't be reached (yet).
+func isConnectionError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func (w *webserver) addGrpcSwitch(endpoint string) error {
+
+	conn, err := grpc.NewClient(endpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                time.Second * 20,
+			Timeout:             time.Second * 5,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	doneCh := make(chan struct{})
+
+	done := sbSwitchProxy.DoneCh(doneCh)
+	gc := sbSwitchProxy.GrpcConn(conn)
+	eh := sbSwitchProxy.EventHandler(ev)
+
+	// create new switch proxy object
+	r, err := sbSwitchProxy.New(done, gc, eh)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("unable to create proxy object: %w", err)
+	}
+
+	if err := w.AddSwitch(r); err != nil {
+		r.Close()
+		conn.Close()
+		return fmt.Errorf("unable to add proxy objects: %v", err)
+	}
+
+	w.grpcSwitches.Store(r.Name(), endpoint)
+
+	go func() {
+		<-doneCh
+		w.grpcSwitches.Delete(r.Name())
+		w.RemoveSwitch(r)
+		conn.Close()
+	}()
+
+	return nil
+}
+
+// isGrpcSwitch checks if the switch has been attached through gRPC
+func (w *webserver) isGrpcSwitch(switchName string) bool {
+	_, ok := w.grpcSwitches.Load(switchName)
+	return ok
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dh1tw/remoteSwitch/hub"
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_webserver_hubName(t *testing.T) {
+
+	w := &webserver{
+		station:  "dh1tw",
+		stations: map[string]bool{"dh1tw": true, "dl0abc": true},
+	}
+
+	tests := []struct {
+		name        string
+		serviceName string
+		want        string
+		wantSwitch  bool
+	}{
+		{"own station", "shackbus.dh1tw.switch.6x2_Bandswitch", "6x2 Bandswitch", true},
+		{"other station", "shackbus.dl0abc.switch.stackmatch", "stackmatch@dl0abc", true},
+		{"legacy service name", "shackbus.switch.6x2_Bandswitch", "6x2 Bandswitch", true},
+		{"unknown station", "shackbus.dk0xyz.switch.stackmatch", "stackmatch@dk0xyz", false},
+		{"other service", "go.micro.registry", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.hubName(tt.serviceName); got != tt.want {
+				t.Errorf("hubName() = %v, want %v", got, tt.want)
+			}
+			if got := w.isSwitch(tt.serviceName); got != tt.wantSwitch {
+				t.Errorf("isSwitch() = %v, want %v", got, tt.wantSwitch)
+			}
+		})
+	}
+}
+
+func Test_isConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unavailable", fmt.Errorf("unable to create proxy object: %w",
+			status.Error(codes.Unavailable, "connection refused")), true},
+		{"deadline exceeded", status.Error(codes.DeadlineExceeded, "timeout"), true},
+		{"unimplemented", status.Error(codes.Unimplemented, "unknown service"), false},
+		{"duplicate name", errors.New("the switch's names must be unique"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConnectionError(tt.err); got != tt.want {
+				t.Errorf("isConnectionError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_webserver_attachGrpcSwitch_duplicateName(t *testing.T) {
+
+	gs, _ := startGrpcSwitch(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr := grpc.NewServer()
+	sbSwitch.RegisterSbSwitchServer(svr, gs)
+	go svr.Serve(lis)
+	t.Cleanup(svr.Stop)
+
+	// a switch with the same name has already been added (e.g. through
+	// NATS)
+	dummy := ds.NewDummySwitch(ds.Switch(ds.SwitchConfig{Name: "Antenna Switch"}))
+	if err := dummy.Init(); err != nil {
+		t.Fatal(err)
+	}
+	h, err := hub.NewHub(dummy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &webserver{Hub: h}
+
+	done := make(chan struct{})
+	go func() {
+		w.attachGrpcSwitch(lis.Addr().String())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 3):
+		t.Fatal("attaching a switch with a duplicate name is retried")
+	}
+
+	if w.isGrpcSwitch("Antenna Switch") {
+		t.Error("switch with a duplicate name attached")
+	}
+}
@@ -20,14 +20,33 @@ func GetEA4TXRemoteboxConfig(switchName string) ([]func(*rb.Remotebox), error) {
 		return nil, fmt.Errorf("missing index parameter for switch %s", switchName)
 	}
 
-	if !viper.IsSet(fmt.Sprintf("%s.portname", switchName)) {
+	device, err := getSerialDeviceConfig(switchName)
+	if err != nil {
+		return nil, err
+	}
+
+	if device == nil && !viper.IsSet(fmt.Sprintf("%s.portname", switchName)) {
 		return nil, fmt.Errorf("missing portname parameter for switch %s", switchName)
 	}
 
 	name := rb.Name(viper.GetString(fmt.Sprintf("%s.name", switchName)))
 	index := rb.Index(viper.GetInt(fmt.Sprintf("%s.index", switchName)))
-	portname := rb.Portname(viper.GetString(fmt.Sprintf("%s.portname", switchName)))
 
-	opts := []func(*rb.Remotebox){name, index, portname}
+	opts := []func(*rb.Remotebox){name, index}
+
+	if device != nil {
+		opts = append(opts, rb.Device(*device))
+	} else {
+		opts = append(opts, rb.Portname(viper.GetString(fmt.Sprintf("%s.portname", switchName))))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.reconnect-interval", switchName)) {
+		interval := viper.GetDuration(fmt.Sprintf("%s.reconnect-interval", switchName))
+		if interval <= 0 {
+			return nil, fmt.Errorf("reconnect-interval must be positive")
+		}
+		opts = append(opts, rb.ReconnectInterval(interval))
+	}
+
 	return opts, nil
 }
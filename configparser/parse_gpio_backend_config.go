@@ -0,0 +1,28 @@
+package configparser
+
+import (
+	"fmt"
+
+	"github.com/dh1tw/remoteSwitch/switch/pins"
+	"github.com/spf13/viper"
+)
+
+// getGPIOBackendConfig parses the optional keys which select the backend
+// of a GPIO switch (gpio-backend, gpio-chip, gpio-consumer).
+func getGPIOBackendConfig(switchName string) (pins.BackendConfig, error) {
+
+	bc := pins.BackendConfig{
+		Name:     viper.GetString(fmt.Sprintf("%s.gpio-backend", switchName)),
+		Chip:     viper.GetString(fmt.Sprintf("%s.gpio-chip", switchName)),
+		Consumer: viper.GetString(fmt.Sprintf("%s.gpio-consumer", switchName)),
+	}
+
+	switch bc.Name {
+	case "", pins.Sysfs, pins.GPIOD:
+	default:
+		return bc, fmt.Errorf("invalid gpio-backend %s for switch %s (supported: %s, %s)",
+			bc.Name, switchName, pins.Sysfs, pins.GPIOD)
+	}
+
+	return bc, nil
+}
@@ -0,0 +1,187 @@
+package configparser
+
+import (
+	"fmt"
+
+	lineprotocol "github.com/dh1tw/remoteSwitch/switch/line_protocol"
+	"github.com/spf13/viper"
+)
+
+// GetLineProtocolConfig tries to parse the config file via viper
+// and returns on success an array of functional options.
+func GetLineProtocolConfig(switchName string) ([]func(*lineprotocol.LineProtocol), error) {
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", switchName)) {
+		return nil, fmt.Errorf("missing name parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", switchName)) {
+		return nil, fmt.Errorf("missing index parameter for switch %s", switchName)
+	}
+
+	device, err := getSerialDeviceConfig(switchName)
+	if err != nil {
+		return nil, err
+	}
+
+	if device == nil && !viper.IsSet(fmt.Sprintf("%s.portname", switchName)) {
+		return nil, fmt.Errorf("missing portname parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.set", switchName)) {
+		return nil, fmt.Errorf("missing set parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.ports", switchName)) {
+		return nil, fmt.Errorf("missing ports parameter for switch %s", switchName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", switchName))
+	if len(name) == 0 {
+		return nil, fmt.Errorf("name parameter of switch %s must not be empty", switchName)
+	}
+
+	portname := viper.GetString(fmt.Sprintf("%s.portname", switchName))
+	if device == nil && len(portname) == 0 {
+		return nil, fmt.Errorf("portname parameter of switch %s must not be empty", switchName)
+	}
+
+	ports := viper.GetStringSlice(fmt.Sprintf("%s.ports", switchName))
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports found for switch %s", switchName)
+	}
+
+	sc := lineprotocol.SwitchConfig{
+		Name:      name,
+		Index:     viper.GetInt(fmt.Sprintf("%s.index", switchName)),
+		Exclusive: viper.GetBool(fmt.Sprintf("%s.exclusive", switchName)),
+	}
+
+	for _, port := range ports {
+		p, err := getLineProtocolPortConfig(port)
+		if err != nil {
+			return nil, err
+		}
+		sc.Ports = append(sc.Ports, p)
+	}
+
+	pc := lineprotocol.ProtocolConfig{
+		Set:      viper.GetString(fmt.Sprintf("%s.set", switchName)),
+		Query:    viper.GetString(fmt.Sprintf("%s.query", switchName)),
+		Response: viper.GetString(fmt.Sprintf("%s.response", switchName)),
+		On:       viper.GetString(fmt.Sprintf("%s.on", switchName)),
+		Off:      viper.GetString(fmt.Sprintf("%s.off", switchName)),
+	}
+
+	opts := []func(*lineprotocol.LineProtocol){
+		lineprotocol.Switch(sc),
+		lineprotocol.Protocol(pc),
+		lineprotocol.Portname(portname),
+	}
+
+	if device != nil {
+		opts = append(opts, lineprotocol.Device(*device))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.baudrate", switchName)) {
+		baudrate := viper.GetInt(fmt.Sprintf("%s.baudrate", switchName))
+		opts = append(opts, lineprotocol.Baudrate(baudrate))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.polling-interval", switchName)) {
+		interval := viper.GetDuration(fmt.Sprintf("%s.polling-interval", switchName))
+		opts = append(opts, lineprotocol.PollingInterval(interval))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.timeout", switchName)) {
+		timeout := viper.GetDuration(fmt.Sprintf("%s.timeout", switchName))
+		opts = append(opts, lineprotocol.Timeout(timeout))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.reconnect-interval", switchName)) {
+		interval := viper.GetDuration(fmt.Sprintf("%s.reconnect-interval", switchName))
+		if interval <= 0 {
+			return nil, fmt.Errorf("reconnect-interval must be positive")
+		}
+		opts = append(opts, lineprotocol.ReconnectInterval(interval))
+	}
+
+	return opts, nil
+}
+
+func getLineProtocolPortConfig(portName string) (lineprotocol.PortConfig, error) {
+
+	pc := lineprotocol.PortConfig{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(portName) {
+		return pc, fmt.Errorf("no configuration found for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.name", portName)) {
+		return pc, fmt.Errorf("missing name parameter for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", portName)) {
+		return pc, fmt.Errorf("missing index parameter for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.terminals", portName)) {
+		return pc, fmt.Errorf("missing terminals parameter for port %s", portName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", portName))
+	if len(name) == 0 {
+		return pc, fmt.Errorf("name parameter of port %s must not be empty", portName)
+	}
+
+	terminals := viper.GetStringSlice(fmt.Sprintf("%s.terminals", portName))
+	if len(terminals) == 0 {
+		return pc, fmt.Errorf("no terminals found for port %s", portName)
+	}
+
+	pc.Name = name
+	pc.ID = viper.GetString(fmt.Sprintf("%s.id", portName))
+	pc.Index = viper.GetInt(fmt.Sprintf("%s.index", portName))
+	pc.Exclusive = viper.GetBool(fmt.Sprintf("%s.exclusive", portName))
+	pc.Terminals = make([]lineprotocol.TerminalConfig, 0, len(terminals))
+
+	for _, terminal := range terminals {
+		t, err := getLineProtocolTerminalConfig(terminal)
+		if err != nil {
+			return pc, err
+		}
+		pc.Terminals = append(pc.Terminals, t)
+	}
+
+	return pc, nil
+}
+
+func getLineProtocolTerminalConfig(terminalName string) (lineprotocol.TerminalConfig, error) {
+
+	tc := lineprotocol.TerminalConfig{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", terminalName)) {
+		return tc, fmt.Errorf("missing name parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", terminalName)) {
+		return tc, fmt.Errorf("missing index parameter for terminal %s", terminalName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", terminalName))
+	if len(name) == 0 {
+		return tc, fmt.Errorf("name parameter of terminal %s must not be empty", terminalName)
+	}
+
+	tc.Name = name
+	tc.ID = viper.GetString(fmt.Sprintf("%s.id", terminalName))
+	tc.Index = viper.GetInt(fmt.Sprintf("%s.index", terminalName))
+
+	return tc, nil
+}
@@ -0,0 +1,191 @@
+package configparser
+
+import (
+	"fmt"
+	"strings"
+
+	modbusrelay "github.com/dh1tw/remoteSwitch/switch/modbus_relay"
+	"github.com/spf13/viper"
+)
+
+// GetModbusRelayConfig tries to parse the config file via viper
+// and returns on success an array of functional options.
+func GetModbusRelayConfig(switchName string) ([]func(*modbusrelay.ModbusRelay), error) {
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", switchName)) {
+		return nil, fmt.Errorf("missing name parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", switchName)) {
+		return nil, fmt.Errorf("missing index parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.address", switchName)) {
+		return nil, fmt.Errorf("missing address parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.ports", switchName)) {
+		return nil, fmt.Errorf("missing ports parameter for switch %s", switchName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", switchName))
+	if len(name) == 0 {
+		return nil, fmt.Errorf("name parameter of switch %s must not be empty", switchName)
+	}
+
+	address := viper.GetString(fmt.Sprintf("%s.address", switchName))
+	if len(address) == 0 {
+		return nil, fmt.Errorf("address parameter of switch %s must not be empty", switchName)
+	}
+
+	ports := viper.GetStringSlice(fmt.Sprintf("%s.ports", switchName))
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports found for switch %s", switchName)
+	}
+
+	sc := modbusrelay.SwitchConfig{
+		Name:      name,
+		Index:     viper.GetInt(fmt.Sprintf("%s.index", switchName)),
+		Exclusive: viper.GetBool(fmt.Sprintf("%s.exclusive", switchName)),
+	}
+
+	for _, port := range ports {
+		p, err := getModbusRelayPortConfig(port)
+		if err != nil {
+			return nil, err
+		}
+		sc.Ports = append(sc.Ports, p)
+	}
+
+	opts := []func(*modbusrelay.ModbusRelay){modbusrelay.Switch(sc)}
+
+	mode := strings.ToLower(viper.GetString(fmt.Sprintf("%s.mode", switchName)))
+	switch mode {
+	case "", "tcp":
+		opts = append(opts, modbusrelay.TCP(address))
+	case "rtu":
+		baudrate := 9600
+		if viper.IsSet(fmt.Sprintf("%s.baudrate", switchName)) {
+			baudrate = viper.GetInt(fmt.Sprintf("%s.baudrate", switchName))
+		}
+		parity := strings.ToUpper(viper.GetString(fmt.Sprintf("%s.parity", switchName)))
+		if parity == "" {
+			parity = "N"
+		}
+		if parity != "N" && parity != "E" && parity != "O" {
+			return nil, fmt.Errorf("invalid parity %s for switch %s (must be N, E or O)", parity, switchName)
+		}
+		opts = append(opts, modbusrelay.RTU(address, baudrate, parity[0]))
+	default:
+		return nil, fmt.Errorf("invalid mode %s for switch %s (must be tcp or rtu)", mode, switchName)
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.unit-id", switchName)) {
+		unitID := viper.GetInt(fmt.Sprintf("%s.unit-id", switchName))
+		if unitID < 0 || unitID > 247 {
+			return nil, fmt.Errorf("invalid unit-id %d for switch %s", unitID, switchName)
+		}
+		opts = append(opts, modbusrelay.UnitID(byte(unitID)))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.polling-interval", switchName)) {
+		interval := viper.GetDuration(fmt.Sprintf("%s.polling-interval", switchName))
+		opts = append(opts, modbusrelay.PollingInterval(interval))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.timeout", switchName)) {
+		timeout := viper.GetDuration(fmt.Sprintf("%s.timeout", switchName))
+		if timeout <= 0 {
+			return nil, fmt.Errorf("timeout of switch %s must be positive", switchName)
+		}
+		opts = append(opts, modbusrelay.Timeout(timeout))
+	}
+
+	return opts, nil
+}
+
+func getModbusRelayPortConfig(portName string) (modbusrelay.PortConfig, error) {
+
+	pc := modbusrelay.PortConfig{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(portName) {
+		return pc, fmt.Errorf("no configuration found for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.name", portName)) {
+		return pc, fmt.Errorf("missing name parameter for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", portName)) {
+		return pc, fmt.Errorf("missing index parameter for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.terminals", portName)) {
+		return pc, fmt.Errorf("missing terminals parameter for port %s", portName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", portName))
+	if len(name) == 0 {
+		return pc, fmt.Errorf("name parameter of port %s must not be empty", portName)
+	}
+
+	terminals := viper.GetStringSlice(fmt.Sprintf("%s.terminals", portName))
+	if len(terminals) == 0 {
+		return pc, fmt.Errorf("no terminals found for port %s", portName)
+	}
+
+	pc.Name = name
+	pc.Index = viper.GetInt(fmt.Sprintf("%s.index", portName))
+	pc.Exclusive = viper.GetBool(fmt.Sprintf("%s.exclusive", portName))
+	pc.Terminals = make([]modbusrelay.CoilConfig, 0, len(terminals))
+
+	for _, terminal := range terminals {
+		t, err := getModbusRelayTerminalConfig(terminal)
+		if err != nil {
+			return pc, err
+		}
+		pc.Terminals = append(pc.Terminals, t)
+	}
+
+	return pc, nil
+}
+
+func getModbusRelayTerminalConfig(terminalName string) (modbusrelay.CoilConfig, error) {
+
+	cc := modbusrelay.CoilConfig{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", terminalName)) {
+		return cc, fmt.Errorf("missing name parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", terminalName)) {
+		return cc, fmt.Errorf("missing index parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.coil", terminalName)) {
+		return cc, fmt.Errorf("missing coil parameter for terminal %s", terminalName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", terminalName))
+	if len(name) == 0 {
+		return cc, fmt.Errorf("name parameter of terminal %s must not be empty", terminalName)
+	}
+
+	coil := viper.GetInt(fmt.Sprintf("%s.coil", terminalName))
+	if coil < 0 || coil > 0xFFFF {
+		return cc, fmt.Errorf("invalid coil %d for terminal %s", coil, terminalName)
+	}
+
+	cc.Name = name
+	cc.Coil = uint16(coil)
+	cc.Index = viper.GetInt(fmt.Sprintf("%s.index", terminalName))
+	cc.Inverted = viper.GetBool(fmt.Sprintf("%s.inverted", terminalName))
+
+	return cc, nil
+}
@@ -43,9 +43,15 @@ func GetMPGPIOSwitchConfig(switchName string) (mpGPIO.SwitchConfig, error) {
 		return sc, fmt.Errorf("no ports found for switch %s", switchName)
 	}
 
+	backend, err := getGPIOBackendConfig(switchName)
+	if err != nil {
+		return sc, err
+	}
+
 	sc.Name = name
 	sc.Index = index
 	sc.Exclusive = exclusive
+	sc.Backend = backend
 
 	for _, port := range ports {
 		p, err := getMPGPIOPortConfig(port)
@@ -143,6 +149,17 @@ func getMPGPIOTerminalConfig(terminalName string) (mpGPIO.PinConfig, error) {
 	pc.Pin = pin
 	pc.Index = index
 	pc.Inverted = inverted
+	pc.Type = viper.GetString(fmt.Sprintf("%s.type", terminalName))
+	pc.ResetPin = viper.GetString(fmt.Sprintf("%s.reset-pin", terminalName))
+	pc.SensePin = viper.GetString(fmt.Sprintf("%s.sense-pin", terminalName))
+	pc.SenseInverted = viper.GetBool(fmt.Sprintf("%s.sense-inverted", terminalName))
+
+	if viper.IsSet(fmt.Sprintf("%s.pulse-width", terminalName)) {
+		pc.PulseWidth = viper.GetDuration(fmt.Sprintf("%s.pulse-width", terminalName))
+		if pc.PulseWidth <= 0 {
+			return pc, fmt.Errorf("pulse-width of terminal %s must be positive", terminalName)
+		}
+	}
 
 	return pc, nil
 }
@@ -0,0 +1,48 @@
+package configparser
+
+import (
+	"fmt"
+
+	"github.com/dh1tw/remoteSwitch/switch/ratelimit"
+	"github.com/spf13/viper"
+)
+
+// GetRateLimitConfig tries to parse the rate limits in the section key
+// (e.g. switch.rate-limit) of the config file. It returns nil if the
+// section doesn't exist or no limit has been set.
+func GetRateLimitConfig(key string) ([]func(*ratelimit.Switch), error) {
+
+	interval := viper.GetDuration(fmt.Sprintf("%s.interval", key))
+	terminalInterval := viper.GetDuration(fmt.Sprintf("%s.terminal-interval", key))
+
+	if interval < 0 || terminalInterval < 0 {
+		return nil, fmt.Errorf("rate limit intervals (%s) must not be negative", key)
+	}
+
+	if interval == 0 && terminalInterval == 0 {
+		return nil, nil
+	}
+
+	opts := []func(*ratelimit.Switch){
+		ratelimit.Interval(interval),
+		ratelimit.TerminalInterval(terminalInterval),
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.burst", key)) {
+		burst := viper.GetInt(fmt.Sprintf("%s.burst", key))
+		if burst < 1 {
+			return nil, fmt.Errorf("%s.burst must be at least 1", key)
+		}
+		opts = append(opts, ratelimit.Burst(burst))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.terminal-burst", key)) {
+		burst := viper.GetInt(fmt.Sprintf("%s.terminal-burst", key))
+		if burst < 1 {
+			return nil, fmt.Errorf("%s.terminal-burst must be at least 1", key)
+		}
+		opts = append(opts, ratelimit.TerminalBurst(burst))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,32 @@
+package configparser
+
+import (
+	"fmt"
+
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+	"github.com/spf13/viper"
+)
+
+// getSerialDeviceConfig parses the parameters which select a USB serial
+// device by its properties instead of its portname (usb-vendor-id,
+// usb-product-id, usb-serial and by-id). It returns nil if none of them
+// is set.
+func getSerialDeviceConfig(switchName string) (*serialport.Match, error) {
+
+	m := serialport.Match{
+		VendorID:  viper.GetString(fmt.Sprintf("%s.usb-vendor-id", switchName)),
+		ProductID: viper.GetString(fmt.Sprintf("%s.usb-product-id", switchName)),
+		Serial:    viper.GetString(fmt.Sprintf("%s.usb-serial", switchName)),
+		ByID:      viper.GetString(fmt.Sprintf("%s.by-id", switchName)),
+	}
+
+	if m.IsZero() {
+		return nil, nil
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("switch %s: %v", switchName, err)
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,173 @@
+package configparser
+
+import (
+	"fmt"
+	"strings"
+
+	serialrelay "github.com/dh1tw/remoteSwitch/switch/serial_relay"
+	"github.com/spf13/viper"
+)
+
+// GetSerialRelayConfig tries to parse the config file via viper
+// and returns on success an array of functional options.
+func GetSerialRelayConfig(switchName string) ([]func(*serialrelay.SerialRelay), error) {
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", switchName)) {
+		return nil, fmt.Errorf("missing name parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", switchName)) {
+		return nil, fmt.Errorf("missing index parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.board", switchName)) {
+		return nil, fmt.Errorf("missing board parameter for switch %s", switchName)
+	}
+
+	device, err := getSerialDeviceConfig(switchName)
+	if err != nil {
+		return nil, err
+	}
+
+	if device == nil && !viper.IsSet(fmt.Sprintf("%s.portname", switchName)) {
+		return nil, fmt.Errorf("missing portname parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.ports", switchName)) {
+		return nil, fmt.Errorf("missing ports parameter for switch %s", switchName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", switchName))
+	if len(name) == 0 {
+		return nil, fmt.Errorf("name parameter of switch %s must not be empty", switchName)
+	}
+
+	portname := viper.GetString(fmt.Sprintf("%s.portname", switchName))
+	if device == nil && len(portname) == 0 {
+		return nil, fmt.Errorf("portname parameter of switch %s must not be empty", switchName)
+	}
+
+	ports := viper.GetStringSlice(fmt.Sprintf("%s.ports", switchName))
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports found for switch %s", switchName)
+	}
+
+	sc := serialrelay.SwitchConfig{
+		Name:      name,
+		Index:     viper.GetInt(fmt.Sprintf("%s.index", switchName)),
+		Exclusive: viper.GetBool(fmt.Sprintf("%s.exclusive", switchName)),
+	}
+
+	for _, port := range ports {
+		p, err := getSerialRelayPortConfig(port)
+		if err != nil {
+			return nil, err
+		}
+		sc.Ports = append(sc.Ports, p)
+	}
+
+	board := strings.ToLower(viper.GetString(fmt.Sprintf("%s.board", switchName)))
+
+	opts := []func(*serialrelay.SerialRelay){
+		serialrelay.Switch(sc),
+		serialrelay.Board(board),
+		serialrelay.Portname(portname),
+	}
+
+	if device != nil {
+		opts = append(opts, serialrelay.Device(*device))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.baudrate", switchName)) {
+		baudrate := viper.GetInt(fmt.Sprintf("%s.baudrate", switchName))
+		opts = append(opts, serialrelay.Baudrate(baudrate))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.polling-interval", switchName)) {
+		interval := viper.GetDuration(fmt.Sprintf("%s.polling-interval", switchName))
+		opts = append(opts, serialrelay.PollingInterval(interval))
+	}
+
+	return opts, nil
+}
+
+func getSerialRelayPortConfig(portName string) (serialrelay.PortConfig, error) {
+
+	pc := serialrelay.PortConfig{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(portName) {
+		return pc, fmt.Errorf("no configuration found for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.name", portName)) {
+		return pc, fmt.Errorf("missing name parameter for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", portName)) {
+		return pc, fmt.Errorf("missing index parameter for port %s", portName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.terminals", portName)) {
+		return pc, fmt.Errorf("missing terminals parameter for port %s", portName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", portName))
+	if len(name) == 0 {
+		return pc, fmt.Errorf("name parameter of port %s must not be empty", portName)
+	}
+
+	terminals := viper.GetStringSlice(fmt.Sprintf("%s.terminals", portName))
+	if len(terminals) == 0 {
+		return pc, fmt.Errorf("no terminals found for port %s", portName)
+	}
+
+	pc.Name = name
+	pc.Index = viper.GetInt(fmt.Sprintf("%s.index", portName))
+	pc.Exclusive = viper.GetBool(fmt.Sprintf("%s.exclusive", portName))
+	pc.Terminals = make([]serialrelay.RelayConfig, 0, len(terminals))
+
+	for _, terminal := range terminals {
+		t, err := getSerialRelayTerminalConfig(terminal)
+		if err != nil {
+			return pc, err
+		}
+		pc.Terminals = append(pc.Terminals, t)
+	}
+
+	return pc, nil
+}
+
+func getSerialRelayTerminalConfig(terminalName string) (serialrelay.RelayConfig, error) {
+
+	rc := serialrelay.RelayConfig{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", terminalName)) {
+		return rc, fmt.Errorf("missing name parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", terminalName)) {
+		return rc, fmt.Errorf("missing index parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.relay", terminalName)) {
+		return rc, fmt.Errorf("missing relay parameter for terminal %s", terminalName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", terminalName))
+	if len(name) == 0 {
+		return rc, fmt.Errorf("name parameter of terminal %s must not be empty", terminalName)
+	}
+
+	rc.Name = name
+	rc.Relay = viper.GetInt(fmt.Sprintf("%s.relay", terminalName))
+	rc.Index = viper.GetInt(fmt.Sprintf("%s.index", terminalName))
+	rc.Inverted = viper.GetBool(fmt.Sprintf("%s.inverted", terminalName))
+
+	return rc, nil
+}
@@ -39,8 +39,14 @@ func GetSmGPIOConfig(smName string) (smGPIO.SmConfig, error) {
 		return sc, fmt.Errorf("no combinations found for stackmatch %s", smName)
 	}
 
+	backend, err := getGPIOBackendConfig(smName)
+	if err != nil {
+		return sc, err
+	}
+
 	sc.Name = name
 	sc.Index = index
+	sc.Backend = backend
 
 	for _, combination := range combinations {
 		c, err := getSmGPIOCombinationConfig(combination)
@@ -126,6 +132,8 @@ func getSmGPIOTerminalConfig(terminalName string) (smGPIO.TerminalConfig, error)
 
 	tc.Name = name
 	tc.Index = index
+	tc.SensePin = viper.GetString(fmt.Sprintf("%s.sense-pin", terminalName))
+	tc.SenseInverted = viper.GetBool(fmt.Sprintf("%s.sense-inverted", terminalName))
 
 	return tc, nil
 }
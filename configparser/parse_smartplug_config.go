@@ -0,0 +1,96 @@
+package configparser
+
+import (
+	"fmt"
+
+	"github.com/dh1tw/remoteSwitch/switch/smartplug"
+	"github.com/spf13/viper"
+)
+
+// GetSmartPlugConfig tries to parse the config file via viper
+// and returns on success an array of functional options.
+func GetSmartPlugConfig(switchName string) ([]func(*smartplug.SmartPlug), error) {
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", switchName)) {
+		return nil, fmt.Errorf("missing name parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", switchName)) {
+		return nil, fmt.Errorf("missing index parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.firmware", switchName)) {
+		return nil, fmt.Errorf("missing firmware parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.url", switchName)) {
+		return nil, fmt.Errorf("missing url or ip address for switch %s", switchName)
+	}
+
+	terminalNames := viper.GetStringSlice(fmt.Sprintf("%s.terminals", switchName))
+	if len(terminalNames) == 0 {
+		return nil, fmt.Errorf("no terminals found for device %s", switchName)
+	}
+
+	name := smartplug.Name(viper.GetString(fmt.Sprintf("%s.name", switchName)))
+	index := smartplug.Index(viper.GetInt(fmt.Sprintf("%s.index", switchName)))
+	firmware := smartplug.Firmware(viper.GetString(fmt.Sprintf("%s.firmware", switchName)))
+	username := smartplug.Username(viper.GetString(fmt.Sprintf("%s.username", switchName)))
+	password := smartplug.Password(viper.GetString(fmt.Sprintf("%s.password", switchName)))
+	url := smartplug.URL(viper.GetString(fmt.Sprintf("%s.url", switchName)))
+
+	opts := []func(*smartplug.SmartPlug){name, index, firmware, username, password, url}
+
+	if viper.IsSet(fmt.Sprintf("%s.polling-interval", switchName)) {
+		interval := viper.GetDuration(fmt.Sprintf("%s.polling-interval", switchName))
+		if interval <= 0 {
+			return nil, fmt.Errorf("polling-interval of switch %s must be positive", switchName)
+		}
+		opts = append(opts, smartplug.PollingInterval(interval))
+	}
+
+	terms := []smartplug.Terminal{}
+
+	for _, tName := range terminalNames {
+		t, err := getSmartPlugTerminalConfig(tName)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+
+	opts = append(opts, smartplug.Terminals(terms))
+
+	return opts, nil
+}
+
+func getSmartPlugTerminalConfig(terminalName string) (smartplug.Terminal, error) {
+
+	t := smartplug.Terminal{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", terminalName)) {
+		return t, fmt.Errorf("missing name parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", terminalName)) {
+		return t, fmt.Errorf("missing index parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.outlet", terminalName)) {
+		return t, fmt.Errorf("missing outlet parameter for terminal %s", terminalName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", terminalName))
+	if len(name) == 0 {
+		return t, fmt.Errorf("name parameter of terminal %s must not be empty", terminalName)
+	}
+
+	t.Name = name
+	t.Index = viper.GetInt(fmt.Sprintf("%s.index", terminalName))
+	t.Outlet = viper.GetInt(fmt.Sprintf("%s.outlet", terminalName))
+
+	return t, nil
+}
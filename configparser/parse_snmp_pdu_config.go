@@ -0,0 +1,141 @@
+package configparser
+
+import (
+	"fmt"
+
+	snmppdu "github.com/dh1tw/remoteSwitch/switch/snmp_pdu"
+	"github.com/spf13/viper"
+)
+
+// GetSnmpPduConfig tries to parse the config file via viper
+// and returns on success an array of functional options.
+func GetSnmpPduConfig(switchName string) ([]func(*snmppdu.PDU), error) {
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", switchName)) {
+		return nil, fmt.Errorf("missing name parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", switchName)) {
+		return nil, fmt.Errorf("missing index parameter for switch %s", switchName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.address", switchName)) {
+		return nil, fmt.Errorf("missing address parameter for switch %s", switchName)
+	}
+
+	terminalNames := viper.GetStringSlice(fmt.Sprintf("%s.terminals", switchName))
+	if len(terminalNames) == 0 {
+		return nil, fmt.Errorf("no terminals found for device %s", switchName)
+	}
+
+	name := snmppdu.Name(viper.GetString(fmt.Sprintf("%s.name", switchName)))
+	index := snmppdu.Index(viper.GetInt(fmt.Sprintf("%s.index", switchName)))
+	address := snmppdu.Address(viper.GetString(fmt.Sprintf("%s.address", switchName)))
+
+	opts := []func(*snmppdu.PDU){name, index, address}
+
+	if viper.IsSet(fmt.Sprintf("%s.version", switchName)) {
+		version := viper.GetString(fmt.Sprintf("%s.version", switchName))
+		opts = append(opts, snmppdu.Version(version))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.community", switchName)) {
+		community := viper.GetString(fmt.Sprintf("%s.community", switchName))
+		opts = append(opts, snmppdu.Community(community))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.username", switchName)) {
+		usm := snmppdu.USMConfig{
+			User:         viper.GetString(fmt.Sprintf("%s.username", switchName)),
+			AuthProtocol: viper.GetString(fmt.Sprintf("%s.auth-protocol", switchName)),
+			AuthPassword: viper.GetString(fmt.Sprintf("%s.auth-password", switchName)),
+			PrivProtocol: viper.GetString(fmt.Sprintf("%s.priv-protocol", switchName)),
+			PrivPassword: viper.GetString(fmt.Sprintf("%s.priv-password", switchName)),
+		}
+		opts = append(opts, snmppdu.USM(usm))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.context", switchName)) {
+		context := viper.GetString(fmt.Sprintf("%s.context", switchName))
+		opts = append(opts, snmppdu.Context(context))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.outlet-oid", switchName)) {
+		oid := viper.GetString(fmt.Sprintf("%s.outlet-oid", switchName))
+		opts = append(opts, snmppdu.OutletOID(oid))
+	}
+
+	on, off, reboot := 1, 2, 3
+	if viper.IsSet(fmt.Sprintf("%s.on", switchName)) {
+		on = viper.GetInt(fmt.Sprintf("%s.on", switchName))
+	}
+	if viper.IsSet(fmt.Sprintf("%s.off", switchName)) {
+		off = viper.GetInt(fmt.Sprintf("%s.off", switchName))
+	}
+	if viper.IsSet(fmt.Sprintf("%s.reboot", switchName)) {
+		reboot = viper.GetInt(fmt.Sprintf("%s.reboot", switchName))
+	}
+	opts = append(opts, snmppdu.Values(on, off, reboot))
+
+	if viper.IsSet(fmt.Sprintf("%s.polling-interval", switchName)) {
+		interval := viper.GetDuration(fmt.Sprintf("%s.polling-interval", switchName))
+		if interval <= 0 {
+			return nil, fmt.Errorf("polling-interval of switch %s must be positive", switchName)
+		}
+		opts = append(opts, snmppdu.PollingInterval(interval))
+	}
+
+	if viper.IsSet(fmt.Sprintf("%s.timeout", switchName)) {
+		timeout := viper.GetDuration(fmt.Sprintf("%s.timeout", switchName))
+		if timeout <= 0 {
+			return nil, fmt.Errorf("timeout of switch %s must be positive", switchName)
+		}
+		opts = append(opts, snmppdu.Timeout(timeout))
+	}
+
+	terms := []snmppdu.Terminal{}
+
+	for _, tName := range terminalNames {
+		t, err := getSnmpPduTerminalConfig(tName)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+
+	opts = append(opts, snmppdu.Terminals(terms))
+
+	return opts, nil
+}
+
+func getSnmpPduTerminalConfig(terminalName string) (snmppdu.Terminal, error) {
+
+	t := snmppdu.Terminal{}
+
+	// let's check first if all necessary keys exist in the config file
+	if !viper.IsSet(fmt.Sprintf("%s.name", terminalName)) {
+		return t, fmt.Errorf("missing name parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.index", terminalName)) {
+		return t, fmt.Errorf("missing index parameter for terminal %s", terminalName)
+	}
+
+	if !viper.IsSet(fmt.Sprintf("%s.outlet", terminalName)) {
+		return t, fmt.Errorf("missing outlet parameter for terminal %s", terminalName)
+	}
+
+	// get the values
+	name := viper.GetString(fmt.Sprintf("%s.name", terminalName))
+	if len(name) == 0 {
+		return t, fmt.Errorf("name parameter of terminal %s must not be empty", terminalName)
+	}
+
+	t.Name = name
+	t.Index = viper.GetInt(fmt.Sprintf("%s.index", terminalName))
+	t.Outlet = viper.GetInt(fmt.Sprintf("%s.outlet", terminalName))
+	t.OID = viper.GetString(fmt.Sprintf("%s.oid", terminalName))
+
+	return t, nil
+}
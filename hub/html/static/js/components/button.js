@@ -1,11 +1,15 @@
 var Button = {
-    template: `<button class="btn sw-button" v-bind:class="{'btn-success':state, 'btn-primary':inverted_state}" v-on:click="setPort()" @contextmenu="clickHandler($event)">
-                    {{label}}
+    template: `<button class="btn sw-button" v-bind:class="{'btn-success':state && !mismatch, 'btn-primary':inverted_state && !mismatch, 'btn-warning':mismatch, 'radio':radio}" v-bind:title="mismatch ? 'sensed state differs' : ''" v-on:click="setPort()" @contextmenu="clickHandler($event)">
+                    <i class="fa" v-bind:class="icon"></i> {{label}}
                 </button>`,
     props: {
         label: String,
         state: Boolean,
         port: String,
+        // radio buttons deselect the other terminals of the port
+        radio: Boolean,
+        // the sensed state differs from the commanded state
+        mismatch: Boolean,
     },
     mounted: function(){},
     beforeDestroy: function(){},
@@ -17,6 +21,10 @@ var Button = {
             e.preventDefault();
         },
         setPort: function(){
+            if (this.radio && !this.state) {
+                this.$emit("set-terminal-exclusive", this.port, this.label);
+                return;
+            }
             this.$emit("set-terminal", this.port, this.label, !this.state);
         },
     },
@@ -24,6 +32,12 @@ var Button = {
     computed: {
         inverted_state: function(){
             return !this.state;
+        },
+        icon: function(){
+            if (this.radio) {
+                return this.state ? "fa-dot-circle-o" : "fa-circle-o";
+            }
+            return this.state ? "fa-toggle-on" : "fa-toggle-off";
         }
     }
 };
\ No newline at end of file
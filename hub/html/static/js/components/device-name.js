@@ -1,7 +1,9 @@
 var DeviceName = {
-    template: '<div class="device-name" :style="styleObj"><div class="tag">{{typeLabel}}</div><div class="name">{{name}}</div></div>',
+    template: '<div class="device-name" v-bind:class="{\'offline\': offline}" :style="styleObj" :title="statusMsg"><div class="tag">{{typeLabel}}</div><div class="name">{{name}}</div><div class="station" v-if="station">{{station}}</div></div>',
     props: {
         name: String,
+        station: String,
+        health: Object,
         width: Number,
     },
     mounted: function () {},
@@ -9,8 +11,31 @@ var DeviceName = {
     methods: {},
     computed: {
         typeLabel: function () {
+            if (this.offline) {
+                return "OFFLINE"
+            }
             return "SW"
         },
+        offline: function () {
+            return this.health != null && !this.health.online;
+        },
+        statusMsg: function () {
+            if (!this.health) {
+                return "";
+            }
+            var info = [this.health.model, this.health.firmware].filter(Boolean).join(" ");
+            if (!this.offline) {
+                return info;
+            }
+            var msg = this.health.error || "offline";
+            if (this.health.last_seen) {
+                msg += " (last seen: " + new Date(this.health.last_seen).toLocaleString() + ")";
+            }
+            if (info) {
+                msg = info + ": " + msg;
+            }
+            return msg;
+        },
         styleObj: function() {
             return {
                 "max-width": this.width + 'px',
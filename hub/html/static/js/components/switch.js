@@ -4,12 +4,12 @@ var Switch = {
         'device-name': DeviceName,
     },
     template: `
-        <div class="switch">
-            <device-name :name="name"></device-name>
+        <div class="switch" v-bind:class="{'offline': offline}" :title="exclusiveHint">
+            <device-name :name="name" :station="station" :health="health"></device-name>
             <div v-for="port in ports">
             <div class="port"> Port {{port.name}}
                 <div class="btn-group" role="group" aria-label="..." v-for="terminal in port.terminals">
-                <swbutton :label="terminal.name" :port="port.name" :state="terminal.state" v-on:set-terminal="setTerminal" v-on:set-terminal-exclusive="setTerminalExclusive">
+                <swbutton :label="terminal.name" :port="port.name" :state="terminal.state" :mismatch="terminal.mismatch" :radio="port.exclusive" v-on:set-terminal="setTerminal" v-on:set-terminal-exclusive="setTerminalExclusive">
                 </swbutton>
                 </div>
             </div>
@@ -17,6 +17,9 @@ var Switch = {
         </div>`,
     props: {
         name: String,
+        station: String,
+        health: Object,
+        exclusive: Boolean,
         ports: Array,
     },
     mounted: function () { },
@@ -52,4 +55,15 @@ var Switch = {
         },
     },
     watch: {},
+    computed: {
+        offline: function () {
+            return this.health != null && !this.health.online;
+        },
+        exclusiveHint: function () {
+            if (this.exclusive && this.ports && this.ports.length > 1) {
+                return "a terminal can only be connected to one port at a time";
+            }
+            return "";
+        },
+    },
 }
\ No newline at end of file
@@ -2,11 +2,14 @@ package hub
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/pulse"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -24,7 +27,8 @@ func (hub *Hub) wsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	c := &WsClient{
-		Conn: conn,
+		Conn:    conn,
+		handler: hub.handleWsRequest,
 	}
 
 	hub.RLock()
@@ -130,7 +134,7 @@ func (hub *Hub) portHandler(w http.ResponseWriter, req *http.Request) {
 
 		err := s.SetPort(p)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(setPortStatus(err))
 			w.Write([]byte(fmt.Sprintf("unable to set port %s: %s", p.Name, err)))
 			return
 
@@ -209,7 +213,7 @@ func (hub *Hub) terminalHandler(w http.ResponseWriter, req *http.Request) {
 
 		err := s.SetPort(portReq)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(setPortStatus(err))
 			w.Write([]byte(fmt.Sprintf("unable to set terminal %s on port %s: %s", t.Name, p.Name, err)))
 			return
 		}
@@ -220,6 +224,80 @@ func (hub *Hub) terminalHandler(w http.ResponseWriter, req *http.Request) {
 
 }
 
+func (hub *Hub) pulseHandler(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	vars := mux.Vars(req)
+
+	switch req.Method {
+	case "PUT":
+		pr := PulseRequest{}
+		dec := json.NewDecoder(req.Body)
+
+		if err := dec.Decode(&pr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid json"))
+			return
+		}
+
+		pr.DeviceName = vars["switch"]
+		pr.Port = vars["port"]
+		pr.Terminal = vars["terminal"]
+
+		if status, err := hub.pulse(pr); err != nil {
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// pulse executes the pulse request. In case of an error, the HTTP
+// status code corresponding to the error is returned as well.
+func (hub *Hub) pulse(pr PulseRequest) (int, error) {
+
+	s, ok := hub.Switch(pr.DeviceName)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("unable to find switch")
+	}
+
+	p, ok := s.(sw.Pulser)
+	if !ok {
+		return http.StatusNotImplemented, fmt.Errorf("switch %s doesn't support pulses", s.Name())
+	}
+
+	d := time.Duration(pr.Duration) * time.Millisecond
+	if d <= 0 || d > pulse.MaxDuration {
+		return http.StatusBadRequest, fmt.Errorf("duration must be between 1 and %d ms",
+			pulse.MaxDuration.Milliseconds())
+	}
+
+	t := sw.Terminal{
+		Name:  pr.Terminal,
+		State: pr.State,
+	}
+
+	if err := p.Pulse(pr.Port, t, d); err != nil {
+		return setPortStatus(err), fmt.Errorf("unable to pulse terminal %s on port %s: %s",
+			pr.Terminal, pr.Port, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+// setPortStatus returns the HTTP status code for an error returned
+// by SetPort.
+func setPortStatus(err error) int {
+	if errors.Is(err, sw.ErrRateLimited) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
 func (hub *Hub) serializeSwitches() map[string]sw.Device {
 
 	hub.RLock()
@@ -192,6 +192,7 @@ type Event struct {
 	Name       SwitchEvent `json:"name,omitempty"`
 	DeviceName string      `json:"device_name,omitempty"`
 	Device     sw.Device   `json:"device,omitempty"` //only used for updates
+	Error      string      `json:"error,omitempty"`  //only used for errors
 }
 
 type SwitchEvent string
@@ -200,8 +201,33 @@ const (
 	AddSwitch    SwitchEvent = "add"
 	RemoveSwitch SwitchEvent = "remove"
 	UpdateSwitch SwitchEvent = "update"
+	ErrorSwitch  SwitchEvent = "error"
 )
 
+// handleWsRequest executes a request received from a websocket client.
+// Errors are reported back to the client.
+func (hub *Hub) handleWsRequest(c *WsClient, req PulseRequest) {
+
+	_, err := hub.pulse(req)
+	if err == nil {
+		return
+	}
+
+	ev := Event{
+		Name:       ErrorSwitch,
+		DeviceName: req.DeviceName,
+		Error:      err.Error(),
+	}
+
+	// writes to the websocket are serialized through the hub's lock
+	hub.Lock()
+	defer hub.Unlock()
+
+	if err := c.write(ev); err != nil {
+		log.Printf("error writing to client %v: %v\n", c.RemoteAddr(), err)
+	}
+}
+
 // Broadcast sends a rotator Status struct to all connected clients
 func (hub *Hub) Broadcast(dev sw.Device) {
 
@@ -6,6 +6,7 @@ func (hub *Hub) routes() {
 	hub.router.HandleFunc("/api/v1.0/switch/{switch}", hub.switchHandler).Methods("GET")
 	hub.router.HandleFunc("/api/v1.0/switch/{switch}/port/{port}", hub.portHandler)
 	hub.router.HandleFunc("/api/v1.0/switch/{switch}/port/{port}/terminal/{terminal}", hub.terminalHandler)
+	hub.router.HandleFunc("/api/v1.0/switch/{switch}/port/{port}/terminal/{terminal}/pulse", hub.pulseHandler)
 
 	hub.router.HandleFunc("/ws", hub.wsHandler)
 	hub.router.PathPrefix("/").Handler(hub.fileServer)
@@ -3,6 +3,7 @@ package hub
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 
 	"github.com/gorilla/websocket"
 )
@@ -10,10 +11,24 @@ import (
 //WsClient is a wrapper for clients connected through a Websocket
 type WsClient struct {
 	*websocket.Conn
+	handler func(*WsClient, PulseRequest)
 }
 
-// listen on the websocket. Despite that no data is read, this function
-// is necessary to reply to incoming ping messages.
+// PulseRequest is a request to pulse a terminal for Duration
+// milliseconds. Through the websocket, the request is sent with the
+// name "pulse". Through the REST API, the switch, port and terminal are
+// taken from the URL.
+type PulseRequest struct {
+	Name       string `json:"name,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
+	Port       string `json:"port,omitempty"`
+	Terminal   string `json:"terminal,omitempty"`
+	State      bool   `json:"state"`
+	Duration   int    `json:"duration"`
+}
+
+// listen on the websocket for requests. This function is also
+// necessary to reply to incoming ping messages.
 func (c *WsClient) listen(closer chan<- *WsClient) {
 	defer func() {
 		closer <- c
@@ -21,9 +36,20 @@ func (c *WsClient) listen(closer chan<- *WsClient) {
 
 	for {
 		// in case of an error just return and signal closing down of the ws
-		if _, _, err := c.ReadMessage(); err != nil {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
 			return
 		}
+
+		req := PulseRequest{}
+		if err := json.Unmarshal(msg, &req); err != nil || req.Name != "pulse" {
+			log.Printf("ignoring invalid request from websocket client %v", c.RemoteAddr())
+			continue
+		}
+
+		if c.handler != nil {
+			c.handler(c, req)
+		}
 	}
 }
 
@@ -0,0 +1,459 @@
+package mqttbridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// qos is the MQTT quality of service used for all messages. States and
+// commands must not get lost, so we use 'at least once'.
+const qos = 1
+
+// publishTimeout is the time after which an unacknowledged publication
+// is considered to have failed.
+const publishTimeout = time.Second * 5
+
+// payloads of the availability topics
+const (
+	online  = "online"
+	offline = "offline"
+)
+
+// SwitchLookup provides access to the switches by their name. It is
+// implemented by hub.Hub.
+type SwitchLookup interface {
+	Switch(name string) (sw.Switcher, bool)
+}
+
+// Bridge publishes the state of switches to an MQTT broker and forwards
+// the commands received through MQTT to the switches. The topic tree
+// looks like this:
+//
+//	<prefix>/bridge/availability                     online | offline (LWT)
+//	<prefix>/<switch>/availability                   online | offline
+//	<prefix>/<switch>/state                          device as JSON
+//	<prefix>/<switch>/<port>/state                   {"active":["terminal"]}
+//	<prefix>/<switch>/<port>/set                     terminal to activate (command)
+//	<prefix>/<switch>/<port>/<terminal>/state        {"state":true}
+//	<prefix>/<switch>/<port>/<terminal>/set          ON | OFF (command)
+//
+// All messages except the commands are retained. Optionally, Home
+// Assistant discovery configs are published as well.
+type Bridge struct {
+	sync.Mutex
+	client          mqtt.Client
+	brokerURL       string
+	clientID        string
+	username        string
+	password        string
+	prefix          string
+	discoveryPrefix string // Home Assistant discovery; empty if disabled
+	switches        SwitchLookup
+	devices         map[string]*publishedDevice // key: topic level of the switch
+}
+
+// publishedDevice keeps track of the retained messages which have been
+// published for a switch.
+type publishedDevice struct {
+	device   sw.Device
+	retained map[string][]byte // topic => payload
+}
+
+// terminalState is the payload of a terminal's state topic.
+type terminalState struct {
+	State    bool  `json:"state"`
+	Sensed   *bool `json:"sensed,omitempty"`
+	Mismatch bool  `json:"mismatch,omitempty"`
+}
+
+// portState is the payload of a port's state topic.
+type portState struct {
+	Active []string `json:"active"` // names of the active terminals
+}
+
+// New returns an initialized, but not yet connected MQTT bridge.
+func New(opts ...func(*Bridge)) *Bridge {
+
+	b := &Bridge{
+		brokerURL: "tcp://localhost:1883",
+		clientID:  "remoteSwitch-bridge",
+		prefix:    "remoteswitch",
+		devices:   make(map[string]*publishedDevice),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Connect connects the bridge to the MQTT broker. If the connection
+// gets lost later on, the bridge reconnects automatically and
+// republishes its retained messages. The broker announces the bridge
+// as offline (last will) when the connection breaks.
+func (b *Bridge) Connect() error {
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(b.brokerURL).
+		SetClientID(b.clientID).
+		SetUsername(b.username).
+		SetPassword(b.password).
+		SetWill(b.bridgeAvailabilityTopic(), offline, qos, true).
+		SetAutoReconnect(true).
+		SetConnectTimeout(time.Second * 10).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			log.Println("connection to mqtt broker lost:", err)
+		})
+
+	b.client = mqtt.NewClient(opts)
+
+	t := b.client.Connect()
+	t.Wait()
+	if err := t.Error(); err != nil {
+		return fmt.Errorf("unable to connect to mqtt broker %s: %v", b.brokerURL, err)
+	}
+
+	return nil
+}
+
+// onConnect subscribes to the command topics and (re-)publishes all
+// retained messages, since the broker might have lost them in the
+// meantime (e.g. after a restart).
+func (b *Bridge) onConnect(c mqtt.Client) {
+
+	log.Printf("connected to mqtt broker %s\n", b.brokerURL)
+
+	t := c.SubscribeMultiple(map[string]byte{
+		b.prefix + "/+/+/+/set": qos, // terminals
+		b.prefix + "/+/+/set":   qos, // ports
+	}, b.handleSet)
+	if t.Wait() && t.Error() != nil {
+		log.Println("unable to subscribe to the mqtt command topics:", t.Error())
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.publish(b.bridgeAvailabilityTopic(), []byte(online))
+
+	for _, pd := range b.devices {
+		for topic, payload := range pd.retained {
+			b.publish(topic, payload)
+		}
+	}
+}
+
+// Update publishes the state of a switch. Only the topics whose payload
+// has changed are published. Topics of ports and terminals which don't
+// exist anymore are removed from the broker.
+func (b *Bridge) Update(device sw.Device) {
+	b.Lock()
+	defer b.Unlock()
+
+	name := topicLevel(device.Name)
+
+	pd, ok := b.devices[name]
+	if !ok {
+		pd = &publishedDevice{
+			retained: make(map[string][]byte),
+		}
+		b.devices[name] = pd
+	}
+	pd.device = device
+
+	payloads, err := b.payloads(device)
+	if err != nil {
+		log.Printf("unable to serialize switch '%s': %v\n", device.Name, err)
+		return
+	}
+
+	for topic := range pd.retained {
+		if _, ok := payloads[topic]; ok {
+			continue
+		}
+		// an empty retained message deletes the retained message
+		b.publish(topic, []byte{})
+		delete(pd.retained, topic)
+	}
+
+	for topic, payload := range payloads {
+		if old, ok := pd.retained[topic]; ok && bytes.Equal(old, payload) {
+			continue
+		}
+		b.publish(topic, payload)
+		pd.retained[topic] = payload
+	}
+}
+
+// Remove marks a switch as offline. Its last known state remains
+// on the broker.
+func (b *Bridge) Remove(switchName string) {
+	b.Lock()
+	defer b.Unlock()
+
+	name := topicLevel(switchName)
+	if _, ok := b.devices[name]; !ok {
+		return
+	}
+
+	b.publish(b.availabilityTopic(name), []byte(offline))
+	delete(b.devices, name)
+}
+
+// Names returns the names of all switches published by the bridge.
+func (b *Bridge) Names() []string {
+	b.Lock()
+	defer b.Unlock()
+
+	names := make([]string, 0, len(b.devices))
+	for _, pd := range b.devices {
+		names = append(names, pd.device.Name)
+	}
+	return names
+}
+
+// Close marks the bridge and all its switches as offline and
+// disconnects from the broker.
+func (b *Bridge) Close() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.client == nil {
+		return
+	}
+
+	tokens := []mqtt.Token{}
+
+	for name := range b.devices {
+		tokens = append(tokens, b.client.Publish(b.availabilityTopic(name),
+			qos, true, offline))
+	}
+	tokens = append(tokens, b.client.Publish(b.bridgeAvailabilityTopic(),
+		qos, true, offline))
+
+	for _, t := range tokens {
+		t.WaitTimeout(publishTimeout)
+	}
+
+	b.client.Disconnect(250)
+}
+
+// payloads returns all retained messages of a switch.
+func (b *Bridge) payloads(device sw.Device) (map[string][]byte, error) {
+
+	name := topicLevel(device.Name)
+	payloads := make(map[string][]byte)
+
+	availability := online
+	if device.Health != nil && !device.Health.Online {
+		availability = offline
+	}
+	payloads[b.availabilityTopic(name)] = []byte(availability)
+
+	d, err := json.Marshal(device)
+	if err != nil {
+		return nil, err
+	}
+	payloads[fmt.Sprintf("%s/%s/state", b.prefix, name)] = d
+
+	for _, p := range device.Ports {
+		ps := portState{Active: []string{}}
+		for _, t := range p.Terminals {
+			if t.State {
+				ps.Active = append(ps.Active, t.Name)
+			}
+		}
+		pp, err := json.Marshal(ps)
+		if err != nil {
+			return nil, err
+		}
+		payloads[fmt.Sprintf("%s/%s/%s/state", b.prefix, name, topicLevel(p.Name))] = pp
+
+		for _, t := range p.Terminals {
+			ts, err := json.Marshal(terminalState{
+				State:    t.State,
+				Sensed:   t.Sensed,
+				Mismatch: t.Mismatch,
+			})
+			if err != nil {
+				return nil, err
+			}
+			topic := fmt.Sprintf("%s/%s/%s/%s/state", b.prefix, name,
+				topicLevel(p.Name), topicLevel(t.Name))
+			payloads[topic] = ts
+		}
+	}
+
+	if len(b.discoveryPrefix) > 0 {
+		if err := b.discoveryPayloads(device, payloads); err != nil {
+			return nil, err
+		}
+	}
+
+	return payloads, nil
+}
+
+// handleSet forwards a command received on a terminal's or a port's set
+// topic to the switch.
+func (b *Bridge) handleSet(c mqtt.Client, msg mqtt.Message) {
+
+	// retained commands would be executed again after every reconnect
+	if msg.Retained() {
+		return
+	}
+
+	levels := strings.Split(strings.TrimPrefix(msg.Topic(), b.prefix+"/"), "/")
+
+	var terminalLevel string
+	state := true
+
+	switch len(levels) {
+	case 4:
+		// <switch>/<port>/<terminal>/set with ON / OFF
+		terminalLevel = levels[2]
+		var err error
+		state, err = parseState(msg.Payload())
+		if err != nil {
+			log.Printf("invalid command on %s: %v\n", msg.Topic(), err)
+			return
+		}
+	case 3:
+		// <switch>/<port>/set with the name of the terminal to activate
+		terminalLevel = topicLevel(strings.TrimSpace(string(msg.Payload())))
+	default:
+		return
+	}
+
+	b.Lock()
+	switchName, portName, terminalName, ok := b.resolve(levels[0], levels[1], terminalLevel)
+	b.Unlock()
+	if !ok {
+		log.Printf("unknown terminal %s (%s)\n", msg.Topic(), msg.Payload())
+		return
+	}
+
+	if b.switches == nil {
+		return
+	}
+
+	s, ok := b.switches.Switch(switchName)
+	if !ok {
+		log.Printf("unable to find switch '%s'\n", switchName)
+		return
+	}
+
+	port := sw.Port{
+		Name: portName,
+		Terminals: []sw.Terminal{
+			{Name: terminalName, State: state},
+		},
+	}
+
+	if err := s.SetPort(port); err != nil {
+		log.Printf("unable to set %s/%s of switch '%s': %v\n",
+			portName, terminalName, switchName, err)
+	}
+}
+
+// resolve maps the topic levels of a terminal back to the names of the
+// switch, port and terminal. This method is not threadsafe.
+func (b *Bridge) resolve(switchLevel, portLevel, terminalLevel string) (string, string, string, bool) {
+
+	pd, ok := b.devices[switchLevel]
+	if !ok {
+		return "", "", "", false
+	}
+
+	for _, p := range pd.device.Ports {
+		if topicLevel(p.Name) != portLevel {
+			continue
+		}
+		for _, t := range p.Terminals {
+			if topicLevel(t.Name) == terminalLevel {
+				return pd.device.Name, p.Name, t.Name, true
+			}
+		}
+	}
+
+	return "", "", "", false
+}
+
+// publish publishes a retained message without waiting for the broker's
+// acknowledgement. Errors are logged. Before the bridge has been
+// connected, nothing is published; the retained messages will be
+// published once the connection has been established.
+func (b *Bridge) publish(topic string, payload []byte) {
+	if b.client == nil {
+		return
+	}
+	t := b.client.Publish(topic, qos, true, payload)
+	go func() {
+		if t.WaitTimeout(publishTimeout) && t.Error() != nil {
+			log.Printf("unable to publish %s: %v\n", topic, t.Error())
+		}
+	}()
+}
+
+func (b *Bridge) bridgeAvailabilityTopic() string {
+	return b.prefix + "/bridge/availability"
+}
+
+func (b *Bridge) availabilityTopic(switchLevel string) string {
+	return fmt.Sprintf("%s/%s/availability", b.prefix, switchLevel)
+}
+
+// topicLevel turns a name into a valid MQTT topic level by replacing
+// the separator, the wildcards and whitespace with underscores.
+func topicLevel(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '+', '#', ' ', '\t':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// parseState parses the payload of a command. Accepted are ON / OFF,
+// true / false, 1 / 0 (case insensitive) and {"state": true|false}.
+func parseState(payload []byte) (bool, error) {
+
+	p := strings.TrimSpace(string(payload))
+
+	if strings.HasPrefix(p, "{") {
+		var ts struct {
+			State *bool `json:"state"`
+		}
+		if err := json.Unmarshal([]byte(p), &ts); err != nil {
+			return false, err
+		}
+		if ts.State == nil {
+			return false, fmt.Errorf("missing key 'state'")
+		}
+		return *ts.State, nil
+	}
+
+	switch strings.ToLower(p) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+
+	state, err := strconv.ParseBool(p)
+	if err != nil {
+		return false, fmt.Errorf("invalid state '%s'", p)
+	}
+	return state, nil
+}
@@ -0,0 +1,236 @@
+package mqttbridge
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// startBroker starts an embedded MQTT broker on a free local port and
+// returns its URL.
+func startBroker(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	server := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return "tcp://" + addr
+}
+
+// observer collects the messages published on the broker.
+type observer struct {
+	sync.Mutex
+	client   mqtt.Client
+	messages map[string]string
+	changed  chan struct{}
+}
+
+func newObserver(t *testing.T, url string) *observer {
+	t.Helper()
+
+	o := &observer{
+		messages: make(map[string]string),
+		changed:  make(chan struct{}, 1),
+	}
+
+	opts := mqtt.NewClientOptions().AddBroker(url).SetClientID("observer")
+	o.client = mqtt.NewClient(opts)
+	if tk := o.client.Connect(); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+	t.Cleanup(func() { o.client.Disconnect(0) })
+
+	hdlr := func(c mqtt.Client, msg mqtt.Message) {
+		o.Lock()
+		o.messages[msg.Topic()] = string(msg.Payload())
+		o.Unlock()
+		select {
+		case o.changed <- struct{}{}:
+		default:
+		}
+	}
+	if tk := o.client.Subscribe("remoteswitch/#", qos, hdlr); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+
+	return o
+}
+
+// waitFor waits until the last message received on topic has the
+// expected payload.
+func (o *observer) waitFor(t *testing.T, topic, payload string) {
+	t.Helper()
+
+	timeout := time.After(time.Second * 5)
+	for {
+		o.Lock()
+		got, ok := o.messages[topic]
+		o.Unlock()
+		if ok && got == payload {
+			return
+		}
+		select {
+		case <-o.changed:
+		case <-timeout:
+			t.Fatalf("timeout waiting for %s = %s (got %q)", topic, payload, got)
+		}
+	}
+}
+
+type switches map[string]sw.Switcher
+
+func (s switches) Switch(name string) (sw.Switcher, bool) {
+	swi, ok := s[name]
+	return swi, ok
+}
+
+func TestBridge(t *testing.T) {
+
+	url := startBroker(t)
+	o := newObserver(t, url)
+
+	lookup := switches{}
+	b := New(Broker(url), Switches(lookup))
+
+	sc := ds.SwitchConfig{
+		Name: "Antenna Switch",
+		Ports: []ds.PortConfig{
+			{
+				Name:      "Radio",
+				Exclusive: true,
+				Terminals: []ds.PinConfig{
+					{Name: "Yagi", Index: 0},
+					{Name: "Dipole", Index: 1},
+				},
+			},
+		},
+	}
+
+	dummy := ds.NewDummySwitch(ds.Switch(sc), ds.EventHandler(func(s sw.Switcher, d sw.Device) {
+		b.Update(d)
+	}))
+	if err := dummy.Init(); err != nil {
+		t.Fatal(err)
+	}
+	lookup[dummy.Name()] = dummy
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Update(dummy.Serialize())
+
+	o.waitFor(t, "remoteswitch/bridge/availability", online)
+	o.waitFor(t, "remoteswitch/Antenna_Switch/availability", online)
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/Yagi/state", `{"state":false}`)
+
+	// commands are forwarded to the switch
+	if tk := o.client.Publish("remoteswitch/Antenna_Switch/Radio/Dipole/set", qos, false, "ON"); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/Dipole/state", `{"state":true}`)
+
+	if tk := o.client.Publish("remoteswitch/Antenna_Switch/Radio/Yagi/set", qos, false, `{"state":true}`); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/Yagi/state", `{"state":true}`)
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/Dipole/state", `{"state":false}`)
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/state", `{"active":["Yagi"]}`)
+
+	// a port's set topic activates the terminal given in the payload
+	if tk := o.client.Publish("remoteswitch/Antenna_Switch/Radio/set", qos, false, "Dipole"); tk.Wait() && tk.Error() != nil {
+		t.Fatal(tk.Error())
+	}
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/state", `{"active":["Dipole"]}`)
+
+	// terminals which don't exist anymore are removed from the broker
+	renamed := dummy.Serialize()
+	renamed.Ports[0].Terminals[1].Name = "Vertical"
+	b.Update(renamed)
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/Vertical/state", `{"state":true}`)
+	o.waitFor(t, "remoteswitch/Antenna_Switch/Radio/Dipole/state", "")
+
+	b.Remove("Antenna Switch")
+	o.waitFor(t, "remoteswitch/Antenna_Switch/availability", offline)
+
+	b.Close()
+	o.waitFor(t, "remoteswitch/bridge/availability", offline)
+}
+
+func Test_parseState(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    bool
+		wantErr bool
+	}{
+		{"ON", true, false},
+		{"off", false, false},
+		{" true\n", true, false},
+		{"0", false, false},
+		{`{"state":true}`, true, false},
+		{`{"state":false}`, false, false},
+		{`{"on":true}`, false, true},
+		{`{"state":`, false, true},
+		{"toggle", false, true},
+		{"", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.payload), func(t *testing.T) {
+			got, err := parseState([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseState() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_topicLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Antenna Switch", "Antenna_Switch"},
+		{"80m/40m", "80m_40m"},
+		{"SO2R #1+2", "SO2R__1_2"},
+		{"switch@dl0abc", "switch@dl0abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := topicLevel(tt.name); got != tt.want {
+				t.Errorf("topicLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
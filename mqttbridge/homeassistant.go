@@ -0,0 +1,138 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// haDevice groups the entities of a switch into one Home Assistant device.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SwVersion    string   `json:"sw_version,omitempty"`
+}
+
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+// haEntity is the discovery config of a switch or select entity.
+type haEntity struct {
+	Name             string           `json:"name"`
+	UniqueID         string           `json:"unique_id"`
+	StateTopic       string           `json:"state_topic"`
+	ValueTemplate    string           `json:"value_template"`
+	CommandTopic     string           `json:"command_topic"`
+	PayloadOn        string           `json:"payload_on,omitempty"`
+	PayloadOff       string           `json:"payload_off,omitempty"`
+	Options          []string         `json:"options,omitempty"`
+	Availability     []haAvailability `json:"availability"`
+	AvailabilityMode string           `json:"availability_mode"`
+	Device           haDevice         `json:"device"`
+}
+
+// value templates which extract the state for Home Assistant from our
+// state topics. 'None' resets a select entity to unknown.
+const (
+	haSwitchTemplate = "{{ 'ON' if value_json.state else 'OFF' }}"
+	haSelectTemplate = "{{ value_json.active[0] if value_json.active else 'None' }}"
+)
+
+// discoveryPayloads adds the Home Assistant discovery configs of a switch
+// to payloads. Exclusive ports become a select entity with the terminals
+// as options, the terminals of all other ports become switch entities.
+// All entities of a switch belong to the same device and are only
+// available if both the bridge and the switch are online.
+func (b *Bridge) discoveryPayloads(device sw.Device, payloads map[string][]byte) error {
+
+	name := topicLevel(device.Name)
+	nodeID := "remoteswitch_" + discoveryID(device.Name)
+
+	dev := haDevice{
+		Identifiers:  []string{nodeID},
+		Name:         device.Name,
+		Manufacturer: "remoteSwitch",
+	}
+	if device.Health != nil {
+		dev.Model = device.Health.Model
+		dev.SwVersion = device.Health.Firmware
+	}
+
+	availability := []haAvailability{
+		{Topic: b.bridgeAvailabilityTopic()},
+		{Topic: b.availabilityTopic(name)},
+	}
+
+	add := func(component, objectID string, e haEntity) error {
+		e.UniqueID = nodeID + "_" + objectID
+		e.Availability = availability
+		e.AvailabilityMode = "all"
+		e.Device = dev
+		config, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", b.discoveryPrefix,
+			component, nodeID, objectID)
+		payloads[topic] = config
+		return nil
+	}
+
+	for _, p := range device.Ports {
+		portTopic := fmt.Sprintf("%s/%s/%s", b.prefix, name, topicLevel(p.Name))
+
+		if p.Exclusive {
+			options := make([]string, 0, len(p.Terminals))
+			for _, t := range p.Terminals {
+				options = append(options, t.Name)
+			}
+			e := haEntity{
+				Name:          p.Name,
+				StateTopic:    portTopic + "/state",
+				ValueTemplate: haSelectTemplate,
+				CommandTopic:  portTopic + "/set",
+				Options:       options,
+			}
+			if err := add("select", discoveryID(p.Name), e); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, t := range p.Terminals {
+			terminalTopic := fmt.Sprintf("%s/%s", portTopic, topicLevel(t.Name))
+			e := haEntity{
+				Name:          fmt.Sprintf("%s %s", p.Name, t.Name),
+				StateTopic:    terminalTopic + "/state",
+				ValueTemplate: haSwitchTemplate,
+				CommandTopic:  terminalTopic + "/set",
+				PayloadOn:     "ON",
+				PayloadOff:    "OFF",
+			}
+			objectID := discoveryID(p.Name) + "_" + discoveryID(t.Name)
+			if err := add("switch", objectID, e); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// discoveryID turns a name into a valid node id / object id of the Home
+// Assistant discovery topic, which may only contain [a-zA-Z0-9_-].
+func discoveryID(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,99 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"testing"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+func TestBridge_discoveryPayloads(t *testing.T) {
+
+	device := sw.Device{
+		Name:   "Antenna Switch",
+		Health: &sw.Health{Online: true, Model: "Dummy Switch"},
+		Ports: []sw.Port{
+			{
+				Name:      "Radio 1",
+				Exclusive: true,
+				Terminals: []sw.Terminal{{Name: "Yagi"}, {Name: "Dipole"}},
+			},
+			{
+				Name:      "Amp",
+				Terminals: []sw.Terminal{{Name: "On/Off"}},
+			},
+		},
+	}
+
+	b := New(HomeAssistant("homeassistant"))
+
+	payloads := map[string][]byte{}
+	if err := b.discoveryPayloads(device, payloads); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		topic         string
+		wantState     string
+		wantCommand   string
+		wantOptions   []string
+		wantTemplate  string
+		wantUniqueID  string
+		wantPayloadOn string
+	}{
+		{"exclusive port", "homeassistant/select/remoteswitch_Antenna_Switch/Radio_1/config",
+			"remoteswitch/Antenna_Switch/Radio_1/state", "remoteswitch/Antenna_Switch/Radio_1/set",
+			[]string{"Yagi", "Dipole"}, haSelectTemplate, "remoteswitch_Antenna_Switch_Radio_1", ""},
+		{"terminal", "homeassistant/switch/remoteswitch_Antenna_Switch/Amp_On_Off/config",
+			"remoteswitch/Antenna_Switch/Amp/On_Off/state", "remoteswitch/Antenna_Switch/Amp/On_Off/set",
+			nil, haSwitchTemplate, "remoteswitch_Antenna_Switch_Amp_On_Off", "ON"},
+	}
+
+	if len(payloads) != len(tests) {
+		t.Fatalf("got %d discovery configs, want %d", len(payloads), len(tests))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := payloads[tt.topic]
+			if !ok {
+				t.Fatalf("missing discovery config %s", tt.topic)
+			}
+			var e haEntity
+			if err := json.Unmarshal(p, &e); err != nil {
+				t.Fatal(err)
+			}
+			if e.StateTopic != tt.wantState || e.CommandTopic != tt.wantCommand {
+				t.Errorf("got state / command topic %s / %s, want %s / %s",
+					e.StateTopic, e.CommandTopic, tt.wantState, tt.wantCommand)
+			}
+			if len(e.Options) != len(tt.wantOptions) {
+				t.Fatalf("got options %v, want %v", e.Options, tt.wantOptions)
+			}
+			for i := range e.Options {
+				if e.Options[i] != tt.wantOptions[i] {
+					t.Errorf("got options %v, want %v", e.Options, tt.wantOptions)
+				}
+			}
+			if e.ValueTemplate != tt.wantTemplate {
+				t.Errorf("got value template %s, want %s", e.ValueTemplate, tt.wantTemplate)
+			}
+			if e.UniqueID != tt.wantUniqueID {
+				t.Errorf("got unique id %s, want %s", e.UniqueID, tt.wantUniqueID)
+			}
+			if e.PayloadOn != tt.wantPayloadOn {
+				t.Errorf("got payload_on %s, want %s", e.PayloadOn, tt.wantPayloadOn)
+			}
+			if e.Device.Name != "Antenna Switch" || e.Device.Model != "Dummy Switch" ||
+				e.Device.Identifiers[0] != "remoteswitch_Antenna_Switch" {
+				t.Errorf("unexpected device %+v", e.Device)
+			}
+			if len(e.Availability) != 2 ||
+				e.Availability[1].Topic != "remoteswitch/Antenna_Switch/availability" ||
+				e.AvailabilityMode != "all" {
+				t.Errorf("unexpected availability %+v (%s)", e.Availability, e.AvailabilityMode)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package mqttbridge
+
+// Broker is a functional option to set the URL of the MQTT broker,
+// e.g. tcp://localhost:1883, ssl://broker.example.com:8883 or
+// ws://localhost:9001.
+func Broker(url string) func(*Bridge) {
+	return func(b *Bridge) {
+		b.brokerURL = url
+	}
+}
+
+// ClientID is a functional option to set the MQTT client id. Client ids
+// must be unique on the broker.
+func ClientID(id string) func(*Bridge) {
+	return func(b *Bridge) {
+		b.clientID = id
+	}
+}
+
+// Credentials is a functional option to set the username and password
+// used to authenticate with the MQTT broker.
+func Credentials(username, password string) func(*Bridge) {
+	return func(b *Bridge) {
+		b.username = username
+		b.password = password
+	}
+}
+
+// TopicPrefix is a functional option to set the root of the topic tree
+// under which the switches are published.
+func TopicPrefix(prefix string) func(*Bridge) {
+	return func(b *Bridge) {
+		b.prefix = prefix
+	}
+}
+
+// Switches is a functional option to set the lookup through which the
+// commands received via MQTT are forwarded to the switches.
+func Switches(s SwitchLookup) func(*Bridge) {
+	return func(b *Bridge) {
+		b.switches = s
+	}
+}
+
+// HomeAssistant is a functional option to enable the Home Assistant MQTT
+// discovery. The discovery configs are published under the given
+// discovery prefix (usually 'homeassistant').
+func HomeAssistant(discoveryPrefix string) func(*Bridge) {
+	return func(b *Bridge) {
+		b.discoveryPrefix = discoveryPrefix
+	}
+}
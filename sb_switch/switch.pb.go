@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.27.1
-// 	protoc        v3.17.3
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
 // source: switch.proto
 
 package sb_switch
@@ -11,6 +11,7 @@ import (
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
 	sync "sync"
+	unsafe "unsafe"
 )
 
 const (
@@ -21,20 +22,17 @@ const (
 )
 
 type None struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Test          string                 `protobuf:"bytes,1,opt,name=test,proto3" json:"test,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Test string `protobuf:"bytes,1,opt,name=test,proto3" json:"test,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *None) Reset() {
 	*x = None{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_switch_proto_msgTypes[0]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_switch_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *None) String() string {
@@ -45,7 +43,7 @@ func (*None) ProtoMessage() {}
 
 func (x *None) ProtoReflect() protoreflect.Message {
 	mi := &file_switch_proto_msgTypes[0]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -68,22 +66,23 @@ func (x *None) GetTest() string {
 }
 
 type Terminal struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Index int32                  `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	State bool                   `protobuf:"varint,3,opt,name=state,proto3" json:"state,omitempty"` // commanded state
+	// state read back from the hardware; only set if supported
+	Sensed *bool `protobuf:"varint,4,opt,name=sensed,proto3,oneof" json:"sensed,omitempty"`
+	// set if the sensed state differs from the commanded state
+	Mismatch      bool `protobuf:"varint,5,opt,name=mismatch,proto3" json:"mismatch,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Index int32  `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
-	State bool   `protobuf:"varint,3,opt,name=state,proto3" json:"state,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Terminal) Reset() {
 	*x = Terminal{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_switch_proto_msgTypes[1]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_switch_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *Terminal) String() string {
@@ -94,7 +93,7 @@ func (*Terminal) ProtoMessage() {}
 
 func (x *Terminal) ProtoReflect() protoreflect.Message {
 	mi := &file_switch_proto_msgTypes[1]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -130,21 +129,32 @@ func (x *Terminal) GetState() bool {
 	return false
 }
 
+func (x *Terminal) GetSensed() bool {
+	if x != nil && x.Sensed != nil {
+		return *x.Sensed
+	}
+	return false
+}
+
+func (x *Terminal) GetMismatch() bool {
+	if x != nil {
+		return x.Mismatch
+	}
+	return false
+}
+
 type PortName struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PortName) Reset() {
 	*x = PortName{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_switch_proto_msgTypes[2]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_switch_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *PortName) String() string {
@@ -155,7 +165,7 @@ func (*PortName) ProtoMessage() {}
 
 func (x *PortName) ProtoReflect() protoreflect.Message {
 	mi := &file_switch_proto_msgTypes[2]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -178,21 +188,18 @@ func (x *PortName) GetName() string {
 }
 
 type PortRequest struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Terminals     []*Terminal            `protobuf:"bytes,2,rep,name=terminals,proto3" json:"terminals,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Name      string      `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Terminals []*Terminal `protobuf:"bytes,2,rep,name=terminals,proto3" json:"terminals,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PortRequest) Reset() {
 	*x = PortRequest{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_switch_proto_msgTypes[3]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_switch_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *PortRequest) String() string {
@@ -203,7 +210,7 @@ func (*PortRequest) ProtoMessage() {}
 
 func (x *PortRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_switch_proto_msgTypes[3]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -232,24 +239,89 @@ func (x *PortRequest) GetTerminals() []*Terminal {
 	return nil
 }
 
-type Port struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+type PulseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Port          string                 `protobuf:"bytes,1,opt,name=port,proto3" json:"port,omitempty"`
+	Terminal      string                 `protobuf:"bytes,2,opt,name=terminal,proto3" json:"terminal,omitempty"`
+	State         bool                   `protobuf:"varint,3,opt,name=state,proto3" json:"state,omitempty"`
+	Duration      int32                  `protobuf:"varint,4,opt,name=duration,proto3" json:"duration,omitempty"` // ms
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PulseRequest) Reset() {
+	*x = PulseRequest{}
+	mi := &file_switch_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
 
-	Name      string      `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Index     int32       `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
-	Terminals []*Terminal `protobuf:"bytes,3,rep,name=terminals,proto3" json:"terminals,omitempty"`
-	Exclusive bool        `protobuf:"varint,4,opt,name=exclusive,proto3" json:"exclusive,omitempty"`
+func (x *PulseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func (x *Port) Reset() {
-	*x = Port{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_switch_proto_msgTypes[4]
+func (*PulseRequest) ProtoMessage() {}
+
+func (x *PulseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_switch_proto_msgTypes[4]
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PulseRequest.ProtoReflect.Descriptor instead.
+func (*PulseRequest) Descriptor() ([]byte, []int) {
+	return file_switch_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PulseRequest) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *PulseRequest) GetTerminal() string {
+	if x != nil {
+		return x.Terminal
+	}
+	return ""
+}
+
+func (x *PulseRequest) GetState() bool {
+	if x != nil {
+		return x.State
+	}
+	return false
+}
+
+func (x *PulseRequest) GetDuration() int32 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+type Port struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Index         int32                  `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	Terminals     []*Terminal            `protobuf:"bytes,3,rep,name=terminals,proto3" json:"terminals,omitempty"`
+	Exclusive     bool                   `protobuf:"varint,4,opt,name=exclusive,proto3" json:"exclusive,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Port) Reset() {
+	*x = Port{}
+	mi := &file_switch_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *Port) String() string {
@@ -259,8 +331,8 @@ func (x *Port) String() string {
 func (*Port) ProtoMessage() {}
 
 func (x *Port) ProtoReflect() protoreflect.Message {
-	mi := &file_switch_proto_msgTypes[4]
-	if protoimpl.UnsafeEnabled && x != nil {
+	mi := &file_switch_proto_msgTypes[5]
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -272,7 +344,7 @@ func (x *Port) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Port.ProtoReflect.Descriptor instead.
 func (*Port) Descriptor() ([]byte, []int) {
-	return file_switch_proto_rawDescGZIP(), []int{4}
+	return file_switch_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Port) GetName() string {
@@ -304,23 +376,21 @@ func (x *Port) GetExclusive() bool {
 }
 
 type Device struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Index         int32                  `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
+	Ports         []*Port                `protobuf:"bytes,3,rep,name=ports,proto3" json:"ports,omitempty"`
+	Exclusive     bool                   `protobuf:"varint,4,opt,name=exclusive,proto3" json:"exclusive,omitempty"`
+	Health        *Health                `protobuf:"bytes,5,opt,name=health,proto3" json:"health,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Name      string  `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Index     int32   `protobuf:"varint,2,opt,name=index,proto3" json:"index,omitempty"`
-	Ports     []*Port `protobuf:"bytes,3,rep,name=ports,proto3" json:"ports,omitempty"`
-	Exclusive bool    `protobuf:"varint,4,opt,name=exclusive,proto3" json:"exclusive,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Device) Reset() {
 	*x = Device{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_switch_proto_msgTypes[5]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_switch_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *Device) String() string {
@@ -330,8 +400,8 @@ func (x *Device) String() string {
 func (*Device) ProtoMessage() {}
 
 func (x *Device) ProtoReflect() protoreflect.Message {
-	mi := &file_switch_proto_msgTypes[5]
-	if protoimpl.UnsafeEnabled && x != nil {
+	mi := &file_switch_proto_msgTypes[6]
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -343,7 +413,7 @@ func (x *Device) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Device.ProtoReflect.Descriptor instead.
 func (*Device) Descriptor() ([]byte, []int) {
-	return file_switch_proto_rawDescGZIP(), []int{5}
+	return file_switch_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Device) GetName() string {
@@ -374,94 +444,423 @@ func (x *Device) GetExclusive() bool {
 	return false
 }
 
-var File_switch_proto protoreflect.FileDescriptor
+func (x *Device) GetHealth() *Health {
+	if x != nil {
+		return x.Health
+	}
+	return nil
+}
+
+type Health struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Online        bool                   `protobuf:"varint,1,opt,name=online,proto3" json:"online,omitempty"`
+	LastSeen      int64                  `protobuf:"varint,2,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"` // unix timestamp (ms)
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Model         string                 `protobuf:"bytes,4,opt,name=model,proto3" json:"model,omitempty"`
+	Firmware      string                 `protobuf:"bytes,5,opt,name=firmware,proto3" json:"firmware,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Health) Reset() {
+	*x = Health{}
+	mi := &file_switch_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Health) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Health) ProtoMessage() {}
+
+func (x *Health) ProtoReflect() protoreflect.Message {
+	mi := &file_switch_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Health.ProtoReflect.Descriptor instead.
+func (*Health) Descriptor() ([]byte, []int) {
+	return file_switch_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Health) GetOnline() bool {
+	if x != nil {
+		return x.Online
+	}
+	return false
+}
+
+func (x *Health) GetLastSeen() int64 {
+	if x != nil {
+		return x.LastSeen
+	}
+	return 0
+}
+
+func (x *Health) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Health) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *Health) GetFirmware() string {
+	if x != nil {
+		return x.Firmware
+	}
+	return ""
+}
+
+type Heartbeat struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // unix timestamp (ms)
+	Interval      int32                  `protobuf:"varint,3,opt,name=interval,proto3" json:"interval,omitempty"`   // heartbeat interval (ms)
+	Health        *Health                `protobuf:"bytes,4,opt,name=health,proto3" json:"health,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Heartbeat) Reset() {
+	*x = Heartbeat{}
+	mi := &file_switch_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Heartbeat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Heartbeat) ProtoMessage() {}
+
+func (x *Heartbeat) ProtoReflect() protoreflect.Message {
+	mi := &file_switch_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Heartbeat.ProtoReflect.Descriptor instead.
+func (*Heartbeat) Descriptor() ([]byte, []int) {
+	return file_switch_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Heartbeat) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Heartbeat) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
 
-var file_switch_proto_rawDesc = []byte{
-	0x0a, 0x0c, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f,
-	0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x22,
-	0x1a, 0x0a, 0x04, 0x4e, 0x6f, 0x6e, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x65, 0x73, 0x74, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x65, 0x73, 0x74, 0x22, 0x4a, 0x0a, 0x08, 0x54,
-	0x65, 0x72, 0x6d, 0x69, 0x6e, 0x61, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69,
-	0x6e, 0x64, 0x65, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65,
-	0x78, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
-	0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x22, 0x1e, 0x0a, 0x08, 0x50, 0x6f, 0x72, 0x74, 0x4e,
-	0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x5a, 0x0a, 0x0b, 0x50, 0x6f, 0x72, 0x74, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x37, 0x0a, 0x09, 0x74, 0x65,
-	0x72, 0x6d, 0x69, 0x6e, 0x61, 0x6c, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e,
-	0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x2e,
-	0x54, 0x65, 0x72, 0x6d, 0x69, 0x6e, 0x61, 0x6c, 0x52, 0x09, 0x74, 0x65, 0x72, 0x6d, 0x69, 0x6e,
-	0x61, 0x6c, 0x73, 0x22, 0x87, 0x01, 0x0a, 0x04, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x12, 0x0a, 0x04,
-	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65,
-	0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52,
-	0x05, 0x69, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x37, 0x0a, 0x09, 0x74, 0x65, 0x72, 0x6d, 0x69, 0x6e,
-	0x61, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x73, 0x68, 0x61, 0x63,
-	0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x2e, 0x54, 0x65, 0x72, 0x6d,
-	0x69, 0x6e, 0x61, 0x6c, 0x52, 0x09, 0x74, 0x65, 0x72, 0x6d, 0x69, 0x6e, 0x61, 0x6c, 0x73, 0x12,
-	0x1c, 0x0a, 0x09, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x73, 0x69, 0x76, 0x65, 0x18, 0x04, 0x20, 0x01,
-	0x28, 0x08, 0x52, 0x09, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x73, 0x69, 0x76, 0x65, 0x22, 0x7d, 0x0a,
-	0x06, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69,
-	0x6e, 0x64, 0x65, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65,
-	0x78, 0x12, 0x2b, 0x0a, 0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b,
-	0x32, 0x15, 0x2e, 0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69, 0x74,
-	0x63, 0x68, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x52, 0x05, 0x70, 0x6f, 0x72, 0x74, 0x73, 0x12, 0x1c,
-	0x0a, 0x09, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x73, 0x69, 0x76, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x08, 0x52, 0x09, 0x65, 0x78, 0x63, 0x6c, 0x75, 0x73, 0x69, 0x76, 0x65, 0x32, 0xc4, 0x01, 0x0a,
-	0x08, 0x53, 0x62, 0x53, 0x77, 0x69, 0x74, 0x63, 0x68, 0x12, 0x3b, 0x0a, 0x07, 0x47, 0x65, 0x74,
-	0x50, 0x6f, 0x72, 0x74, 0x12, 0x19, 0x2e, 0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e,
-	0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x4e, 0x61, 0x6d, 0x65, 0x1a,
-	0x15, 0x2e, 0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69, 0x74, 0x63,
-	0x68, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x3e, 0x0a, 0x07, 0x53, 0x65, 0x74, 0x50, 0x6f, 0x72,
-	0x74, 0x12, 0x1c, 0x2e, 0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69,
-	0x74, 0x63, 0x68, 0x2e, 0x50, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
-	0x15, 0x2e, 0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69, 0x74, 0x63,
-	0x68, 0x2e, 0x4e, 0x6f, 0x6e, 0x65, 0x12, 0x3b, 0x0a, 0x09, 0x47, 0x65, 0x74, 0x44, 0x65, 0x76,
-	0x69, 0x63, 0x65, 0x12, 0x15, 0x2e, 0x73, 0x68, 0x61, 0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73,
-	0x77, 0x69, 0x74, 0x63, 0x68, 0x2e, 0x4e, 0x6f, 0x6e, 0x65, 0x1a, 0x17, 0x2e, 0x73, 0x68, 0x61,
-	0x63, 0x6b, 0x62, 0x75, 0x73, 0x2e, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x2e, 0x44, 0x65, 0x76,
-	0x69, 0x63, 0x65, 0x42, 0x0d, 0x5a, 0x0b, 0x2e, 0x2f, 0x73, 0x62, 0x5f, 0x73, 0x77, 0x69, 0x74,
-	0x63, 0x68, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+func (x *Heartbeat) GetInterval() int32 {
+	if x != nil {
+		return x.Interval
+	}
+	return 0
 }
 
+func (x *Heartbeat) GetHealth() *Health {
+	if x != nil {
+		return x.Health
+	}
+	return nil
+}
+
+type TerminalChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Port          string                 `protobuf:"bytes,1,opt,name=port,proto3" json:"port,omitempty"`
+	Terminal      string                 `protobuf:"bytes,2,opt,name=terminal,proto3" json:"terminal,omitempty"`
+	State         bool                   `protobuf:"varint,3,opt,name=state,proto3" json:"state,omitempty"`
+	Sensed        *bool                  `protobuf:"varint,4,opt,name=sensed,proto3,oneof" json:"sensed,omitempty"`
+	Mismatch      bool                   `protobuf:"varint,5,opt,name=mismatch,proto3" json:"mismatch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TerminalChange) Reset() {
+	*x = TerminalChange{}
+	mi := &file_switch_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TerminalChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TerminalChange) ProtoMessage() {}
+
+func (x *TerminalChange) ProtoReflect() protoreflect.Message {
+	mi := &file_switch_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TerminalChange.ProtoReflect.Descriptor instead.
+func (*TerminalChange) Descriptor() ([]byte, []int) {
+	return file_switch_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TerminalChange) GetPort() string {
+	if x != nil {
+		return x.Port
+	}
+	return ""
+}
+
+func (x *TerminalChange) GetTerminal() string {
+	if x != nil {
+		return x.Terminal
+	}
+	return ""
+}
+
+func (x *TerminalChange) GetState() bool {
+	if x != nil {
+		return x.State
+	}
+	return false
+}
+
+func (x *TerminalChange) GetSensed() bool {
+	if x != nil && x.Sensed != nil {
+		return *x.Sensed
+	}
+	return false
+}
+
+func (x *TerminalChange) GetMismatch() bool {
+	if x != nil {
+		return x.Mismatch
+	}
+	return false
+}
+
+type StateUpdate struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Sequence uint64                 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	// full state of the device; sent as the first update of a subscription
+	// or if the change can't be expressed incrementally. A snapshot resets
+	// the state (and sequence) tracked by the client.
+	Snapshot *Device           `protobuf:"bytes,2,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	Changes  []*TerminalChange `protobuf:"bytes,3,rep,name=changes,proto3" json:"changes,omitempty"`
+	// set if the health of the device has changed
+	Health        *Health `protobuf:"bytes,4,opt,name=health,proto3" json:"health,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StateUpdate) Reset() {
+	*x = StateUpdate{}
+	mi := &file_switch_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StateUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StateUpdate) ProtoMessage() {}
+
+func (x *StateUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_switch_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StateUpdate.ProtoReflect.Descriptor instead.
+func (*StateUpdate) Descriptor() ([]byte, []int) {
+	return file_switch_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StateUpdate) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *StateUpdate) GetSnapshot() *Device {
+	if x != nil {
+		return x.Snapshot
+	}
+	return nil
+}
+
+func (x *StateUpdate) GetChanges() []*TerminalChange {
+	if x != nil {
+		return x.Changes
+	}
+	return nil
+}
+
+func (x *StateUpdate) GetHealth() *Health {
+	if x != nil {
+		return x.Health
+	}
+	return nil
+}
+
+var File_switch_proto protoreflect.FileDescriptor
+
+const file_switch_proto_rawDesc = "" +
+	"\n" +
+	"\fswitch.proto\x12\x0fshackbus.switch\"\x1a\n" +
+	"\x04None\x12\x12\n" +
+	"\x04test\x18\x01 \x01(\tR\x04test\"\x8e\x01\n" +
+	"\bTerminal\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05index\x18\x02 \x01(\x05R\x05index\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\bR\x05state\x12\x1b\n" +
+	"\x06sensed\x18\x04 \x01(\bH\x00R\x06sensed\x88\x01\x01\x12\x1a\n" +
+	"\bmismatch\x18\x05 \x01(\bR\bmismatchB\t\n" +
+	"\a_sensed\"\x1e\n" +
+	"\bPortName\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"Z\n" +
+	"\vPortRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x127\n" +
+	"\tterminals\x18\x02 \x03(\v2\x19.shackbus.switch.TerminalR\tterminals\"p\n" +
+	"\fPulseRequest\x12\x12\n" +
+	"\x04port\x18\x01 \x01(\tR\x04port\x12\x1a\n" +
+	"\bterminal\x18\x02 \x01(\tR\bterminal\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\bR\x05state\x12\x1a\n" +
+	"\bduration\x18\x04 \x01(\x05R\bduration\"\x87\x01\n" +
+	"\x04Port\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05index\x18\x02 \x01(\x05R\x05index\x127\n" +
+	"\tterminals\x18\x03 \x03(\v2\x19.shackbus.switch.TerminalR\tterminals\x12\x1c\n" +
+	"\texclusive\x18\x04 \x01(\bR\texclusive\"\xae\x01\n" +
+	"\x06Device\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05index\x18\x02 \x01(\x05R\x05index\x12+\n" +
+	"\x05ports\x18\x03 \x03(\v2\x15.shackbus.switch.PortR\x05ports\x12\x1c\n" +
+	"\texclusive\x18\x04 \x01(\bR\texclusive\x12/\n" +
+	"\x06health\x18\x05 \x01(\v2\x17.shackbus.switch.HealthR\x06health\"\x85\x01\n" +
+	"\x06Health\x12\x16\n" +
+	"\x06online\x18\x01 \x01(\bR\x06online\x12\x1b\n" +
+	"\tlast_seen\x18\x02 \x01(\x03R\blastSeen\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12\x14\n" +
+	"\x05model\x18\x04 \x01(\tR\x05model\x12\x1a\n" +
+	"\bfirmware\x18\x05 \x01(\tR\bfirmware\"\x8a\x01\n" +
+	"\tHeartbeat\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x1a\n" +
+	"\binterval\x18\x03 \x01(\x05R\binterval\x12/\n" +
+	"\x06health\x18\x04 \x01(\v2\x17.shackbus.switch.HealthR\x06health\"\x9a\x01\n" +
+	"\x0eTerminalChange\x12\x12\n" +
+	"\x04port\x18\x01 \x01(\tR\x04port\x12\x1a\n" +
+	"\bterminal\x18\x02 \x01(\tR\bterminal\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\bR\x05state\x12\x1b\n" +
+	"\x06sensed\x18\x04 \x01(\bH\x00R\x06sensed\x88\x01\x01\x12\x1a\n" +
+	"\bmismatch\x18\x05 \x01(\bR\bmismatchB\t\n" +
+	"\a_sensed\"\xca\x01\n" +
+	"\vStateUpdate\x12\x1a\n" +
+	"\bsequence\x18\x01 \x01(\x04R\bsequence\x123\n" +
+	"\bsnapshot\x18\x02 \x01(\v2\x17.shackbus.switch.DeviceR\bsnapshot\x129\n" +
+	"\achanges\x18\x03 \x03(\v2\x1f.shackbus.switch.TerminalChangeR\achanges\x12/\n" +
+	"\x06health\x18\x04 \x01(\v2\x17.shackbus.switch.HealthR\x06health2\x88\x03\n" +
+	"\bSbSwitch\x12;\n" +
+	"\aGetPort\x12\x19.shackbus.switch.PortName\x1a\x15.shackbus.switch.Port\x12>\n" +
+	"\aSetPort\x12\x1c.shackbus.switch.PortRequest\x1a\x15.shackbus.switch.None\x12;\n" +
+	"\tGetDevice\x12\x15.shackbus.switch.None\x1a\x17.shackbus.switch.Device\x12?\n" +
+	"\vWatchDevice\x12\x15.shackbus.switch.None\x1a\x17.shackbus.switch.Device0\x01\x12B\n" +
+	"\tSubscribe\x12\x15.shackbus.switch.None\x1a\x1c.shackbus.switch.StateUpdate0\x01\x12=\n" +
+	"\x05Pulse\x12\x1d.shackbus.switch.PulseRequest\x1a\x15.shackbus.switch.NoneB\rZ\v./sb_switchb\x06proto3"
+
 var (
 	file_switch_proto_rawDescOnce sync.Once
-	file_switch_proto_rawDescData = file_switch_proto_rawDesc
+	file_switch_proto_rawDescData []byte
 )
 
 func file_switch_proto_rawDescGZIP() []byte {
 	file_switch_proto_rawDescOnce.Do(func() {
-		file_switch_proto_rawDescData = protoimpl.X.CompressGZIP(file_switch_proto_rawDescData)
+		file_switch_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_switch_proto_rawDesc), len(file_switch_proto_rawDesc)))
 	})
 	return file_switch_proto_rawDescData
 }
 
-var file_switch_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
-var file_switch_proto_goTypes = []interface{}{
-	(*None)(nil),        // 0: shackbus.switch.None
-	(*Terminal)(nil),    // 1: shackbus.switch.Terminal
-	(*PortName)(nil),    // 2: shackbus.switch.PortName
-	(*PortRequest)(nil), // 3: shackbus.switch.PortRequest
-	(*Port)(nil),        // 4: shackbus.switch.Port
-	(*Device)(nil),      // 5: shackbus.switch.Device
+var file_switch_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_switch_proto_goTypes = []any{
+	(*None)(nil),           // 0: shackbus.switch.None
+	(*Terminal)(nil),       // 1: shackbus.switch.Terminal
+	(*PortName)(nil),       // 2: shackbus.switch.PortName
+	(*PortRequest)(nil),    // 3: shackbus.switch.PortRequest
+	(*PulseRequest)(nil),   // 4: shackbus.switch.PulseRequest
+	(*Port)(nil),           // 5: shackbus.switch.Port
+	(*Device)(nil),         // 6: shackbus.switch.Device
+	(*Health)(nil),         // 7: shackbus.switch.Health
+	(*Heartbeat)(nil),      // 8: shackbus.switch.Heartbeat
+	(*TerminalChange)(nil), // 9: shackbus.switch.TerminalChange
+	(*StateUpdate)(nil),    // 10: shackbus.switch.StateUpdate
 }
 var file_switch_proto_depIdxs = []int32{
-	1, // 0: shackbus.switch.PortRequest.terminals:type_name -> shackbus.switch.Terminal
-	1, // 1: shackbus.switch.Port.terminals:type_name -> shackbus.switch.Terminal
-	4, // 2: shackbus.switch.Device.ports:type_name -> shackbus.switch.Port
-	2, // 3: shackbus.switch.SbSwitch.GetPort:input_type -> shackbus.switch.PortName
-	3, // 4: shackbus.switch.SbSwitch.SetPort:input_type -> shackbus.switch.PortRequest
-	0, // 5: shackbus.switch.SbSwitch.GetDevice:input_type -> shackbus.switch.None
-	4, // 6: shackbus.switch.SbSwitch.GetPort:output_type -> shackbus.switch.Port
-	0, // 7: shackbus.switch.SbSwitch.SetPort:output_type -> shackbus.switch.None
-	5, // 8: shackbus.switch.SbSwitch.GetDevice:output_type -> shackbus.switch.Device
-	6, // [6:9] is the sub-list for method output_type
-	3, // [3:6] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	1,  // 0: shackbus.switch.PortRequest.terminals:type_name -> shackbus.switch.Terminal
+	1,  // 1: shackbus.switch.Port.terminals:type_name -> shackbus.switch.Terminal
+	5,  // 2: shackbus.switch.Device.ports:type_name -> shackbus.switch.Port
+	7,  // 3: shackbus.switch.Device.health:type_name -> shackbus.switch.Health
+	7,  // 4: shackbus.switch.Heartbeat.health:type_name -> shackbus.switch.Health
+	6,  // 5: shackbus.switch.StateUpdate.snapshot:type_name -> shackbus.switch.Device
+	9,  // 6: shackbus.switch.StateUpdate.changes:type_name -> shackbus.switch.TerminalChange
+	7,  // 7: shackbus.switch.StateUpdate.health:type_name -> shackbus.switch.Health
+	2,  // 8: shackbus.switch.SbSwitch.GetPort:input_type -> shackbus.switch.PortName
+	3,  // 9: shackbus.switch.SbSwitch.SetPort:input_type -> shackbus.switch.PortRequest
+	0,  // 10: shackbus.switch.SbSwitch.GetDevice:input_type -> shackbus.switch.None
+	0,  // 11: shackbus.switch.SbSwitch.WatchDevice:input_type -> shackbus.switch.None
+	0,  // 12: shackbus.switch.SbSwitch.Subscribe:input_type -> shackbus.switch.None
+	4,  // 13: shackbus.switch.SbSwitch.Pulse:input_type -> shackbus.switch.PulseRequest
+	5,  // 14: shackbus.switch.SbSwitch.GetPort:output_type -> shackbus.switch.Port
+	0,  // 15: shackbus.switch.SbSwitch.SetPort:output_type -> shackbus.switch.None
+	6,  // 16: shackbus.switch.SbSwitch.GetDevice:output_type -> shackbus.switch.Device
+	6,  // 17: shackbus.switch.SbSwitch.WatchDevice:output_type -> shackbus.switch.Device
+	10, // 18: shackbus.switch.SbSwitch.Subscribe:output_type -> shackbus.switch.StateUpdate
+	0,  // 19: shackbus.switch.SbSwitch.Pulse:output_type -> shackbus.switch.None
+	14, // [14:20] is the sub-list for method output_type
+	8,  // [8:14] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_switch_proto_init() }
@@ -469,87 +868,15 @@ func file_switch_proto_init() {
 	if File_switch_proto != nil {
 		return
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_switch_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*None); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_switch_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Terminal); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_switch_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PortName); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_switch_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PortRequest); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_switch_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Port); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_switch_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Device); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-	}
+	file_switch_proto_msgTypes[1].OneofWrappers = []any{}
+	file_switch_proto_msgTypes[9].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: file_switch_proto_rawDesc,
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_switch_proto_rawDesc), len(file_switch_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -558,7 +885,6 @@ func file_switch_proto_init() {
 		MessageInfos:      file_switch_proto_msgTypes,
 	}.Build()
 	File_switch_proto = out.File
-	file_switch_proto_rawDesc = nil
 	file_switch_proto_goTypes = nil
 	file_switch_proto_depIdxs = nil
 }
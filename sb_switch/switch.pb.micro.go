@@ -5,7 +5,7 @@ package sb_switch
 
 import (
 	fmt "fmt"
-	proto "github.com/golang/protobuf/proto"
+	proto "google.golang.org/protobuf/proto"
 	math "math"
 )
 
@@ -21,12 +21,6 @@ var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the proto package it is being compiled against.
-// A compilation error at this line likely means your copy of the
-// proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
-
 // Reference imports to suppress errors if they are not otherwise used.
 var _ api.Endpoint
 var _ context.Context
@@ -45,6 +39,16 @@ type SbSwitchService interface {
 	GetPort(ctx context.Context, in *PortName, opts ...client.CallOption) (*Port, error)
 	SetPort(ctx context.Context, in *PortRequest, opts ...client.CallOption) (*None, error)
 	GetDevice(ctx context.Context, in *None, opts ...client.CallOption) (*Device, error)
+	// WatchDevice sends the current state of the device and afterwards
+	// every state change until the client cancels the stream.
+	WatchDevice(ctx context.Context, in *None, opts ...client.CallOption) (SbSwitch_WatchDeviceService, error)
+	// Subscribe sends a snapshot of the device followed by the incremental
+	// changes. The sequence numbers of the updates are consecutive, a gap
+	// indicates that an update has been missed.
+	Subscribe(ctx context.Context, in *None, opts ...client.CallOption) (SbSwitch_SubscribeService, error)
+	// Pulse switches a terminal into the requested state and reverts it
+	// after the duration into its previous state.
+	Pulse(ctx context.Context, in *PulseRequest, opts ...client.CallOption) (*None, error)
 }
 
 type sbSwitchService struct {
@@ -89,12 +93,130 @@ func (c *sbSwitchService) GetDevice(ctx context.Context, in *None, opts ...clien
 	return out, nil
 }
 
+func (c *sbSwitchService) WatchDevice(ctx context.Context, in *None, opts ...client.CallOption) (SbSwitch_WatchDeviceService, error) {
+	req := c.c.NewRequest(c.name, "SbSwitch.WatchDevice", &None{})
+	stream, err := c.c.Stream(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(in); err != nil {
+		return nil, err
+	}
+	return &sbSwitchServiceWatchDevice{stream}, nil
+}
+
+type SbSwitch_WatchDeviceService interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Recv() (*Device, error)
+}
+
+type sbSwitchServiceWatchDevice struct {
+	stream client.Stream
+}
+
+func (x *sbSwitchServiceWatchDevice) Close() error {
+	return x.stream.Close()
+}
+
+func (x *sbSwitchServiceWatchDevice) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *sbSwitchServiceWatchDevice) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *sbSwitchServiceWatchDevice) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *sbSwitchServiceWatchDevice) Recv() (*Device, error) {
+	m := new(Device)
+	err := x.stream.Recv(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sbSwitchService) Subscribe(ctx context.Context, in *None, opts ...client.CallOption) (SbSwitch_SubscribeService, error) {
+	req := c.c.NewRequest(c.name, "SbSwitch.Subscribe", &None{})
+	stream, err := c.c.Stream(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(in); err != nil {
+		return nil, err
+	}
+	return &sbSwitchServiceSubscribe{stream}, nil
+}
+
+type SbSwitch_SubscribeService interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Recv() (*StateUpdate, error)
+}
+
+type sbSwitchServiceSubscribe struct {
+	stream client.Stream
+}
+
+func (x *sbSwitchServiceSubscribe) Close() error {
+	return x.stream.Close()
+}
+
+func (x *sbSwitchServiceSubscribe) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *sbSwitchServiceSubscribe) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *sbSwitchServiceSubscribe) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *sbSwitchServiceSubscribe) Recv() (*StateUpdate, error) {
+	m := new(StateUpdate)
+	err := x.stream.Recv(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sbSwitchService) Pulse(ctx context.Context, in *PulseRequest, opts ...client.CallOption) (*None, error) {
+	req := c.c.NewRequest(c.name, "SbSwitch.Pulse", in)
+	out := new(None)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for SbSwitch service
 
 type SbSwitchHandler interface {
 	GetPort(context.Context, *PortName, *Port) error
 	SetPort(context.Context, *PortRequest, *None) error
 	GetDevice(context.Context, *None, *Device) error
+	// WatchDevice sends the current state of the device and afterwards
+	// every state change until the client cancels the stream.
+	WatchDevice(context.Context, *None, SbSwitch_WatchDeviceStream) error
+	// Subscribe sends a snapshot of the device followed by the incremental
+	// changes. The sequence numbers of the updates are consecutive, a gap
+	// indicates that an update has been missed.
+	Subscribe(context.Context, *None, SbSwitch_SubscribeStream) error
+	// Pulse switches a terminal into the requested state and reverts it
+	// after the duration into its previous state.
+	Pulse(context.Context, *PulseRequest, *None) error
 }
 
 func RegisterSbSwitchHandler(s server.Server, hdlr SbSwitchHandler, opts ...server.HandlerOption) error {
@@ -102,6 +224,9 @@ func RegisterSbSwitchHandler(s server.Server, hdlr SbSwitchHandler, opts ...serv
 		GetPort(ctx context.Context, in *PortName, out *Port) error
 		SetPort(ctx context.Context, in *PortRequest, out *None) error
 		GetDevice(ctx context.Context, in *None, out *Device) error
+		WatchDevice(ctx context.Context, stream server.Stream) error
+		Subscribe(ctx context.Context, stream server.Stream) error
+		Pulse(ctx context.Context, in *PulseRequest, out *None) error
 	}
 	type SbSwitch struct {
 		sbSwitch
@@ -125,3 +250,87 @@ func (h *sbSwitchHandler) SetPort(ctx context.Context, in *PortRequest, out *Non
 func (h *sbSwitchHandler) GetDevice(ctx context.Context, in *None, out *Device) error {
 	return h.SbSwitchHandler.GetDevice(ctx, in, out)
 }
+
+func (h *sbSwitchHandler) WatchDevice(ctx context.Context, stream server.Stream) error {
+	m := new(None)
+	if err := stream.Recv(m); err != nil {
+		return err
+	}
+	return h.SbSwitchHandler.WatchDevice(ctx, m, &sbSwitchWatchDeviceStream{stream})
+}
+
+type SbSwitch_WatchDeviceStream interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Send(*Device) error
+}
+
+type sbSwitchWatchDeviceStream struct {
+	stream server.Stream
+}
+
+func (x *sbSwitchWatchDeviceStream) Close() error {
+	return x.stream.Close()
+}
+
+func (x *sbSwitchWatchDeviceStream) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *sbSwitchWatchDeviceStream) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *sbSwitchWatchDeviceStream) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *sbSwitchWatchDeviceStream) Send(m *Device) error {
+	return x.stream.Send(m)
+}
+
+func (h *sbSwitchHandler) Subscribe(ctx context.Context, stream server.Stream) error {
+	m := new(None)
+	if err := stream.Recv(m); err != nil {
+		return err
+	}
+	return h.SbSwitchHandler.Subscribe(ctx, m, &sbSwitchSubscribeStream{stream})
+}
+
+type SbSwitch_SubscribeStream interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Send(*StateUpdate) error
+}
+
+type sbSwitchSubscribeStream struct {
+	stream server.Stream
+}
+
+func (x *sbSwitchSubscribeStream) Close() error {
+	return x.stream.Close()
+}
+
+func (x *sbSwitchSubscribeStream) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *sbSwitchSubscribeStream) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *sbSwitchSubscribeStream) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *sbSwitchSubscribeStream) Send(m *StateUpdate) error {
+	return x.stream.Send(m)
+}
+
+func (h *sbSwitchHandler) Pulse(ctx context.Context, in *PulseRequest, out *None) error {
+	return h.SbSwitchHandler.Pulse(ctx, in, out)
+}
@@ -0,0 +1,332 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: switch.proto
+
+package sb_switch
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SbSwitch_GetPort_FullMethodName     = "/shackbus.switch.SbSwitch/GetPort"
+	SbSwitch_SetPort_FullMethodName     = "/shackbus.switch.SbSwitch/SetPort"
+	SbSwitch_GetDevice_FullMethodName   = "/shackbus.switch.SbSwitch/GetDevice"
+	SbSwitch_WatchDevice_FullMethodName = "/shackbus.switch.SbSwitch/WatchDevice"
+	SbSwitch_Subscribe_FullMethodName   = "/shackbus.switch.SbSwitch/Subscribe"
+	SbSwitch_Pulse_FullMethodName       = "/shackbus.switch.SbSwitch/Pulse"
+)
+
+// SbSwitchClient is the client API for SbSwitch service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SbSwitchClient interface {
+	GetPort(ctx context.Context, in *PortName, opts ...grpc.CallOption) (*Port, error)
+	SetPort(ctx context.Context, in *PortRequest, opts ...grpc.CallOption) (*None, error)
+	GetDevice(ctx context.Context, in *None, opts ...grpc.CallOption) (*Device, error)
+	// WatchDevice sends the current state of the device and afterwards
+	// every state change until the client cancels the stream.
+	WatchDevice(ctx context.Context, in *None, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Device], error)
+	// Subscribe sends a snapshot of the device followed by the incremental
+	// changes. The sequence numbers of the updates are consecutive, a gap
+	// indicates that an update has been missed.
+	Subscribe(ctx context.Context, in *None, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StateUpdate], error)
+	// Pulse switches a terminal into the requested state and reverts it
+	// after the duration into its previous state.
+	Pulse(ctx context.Context, in *PulseRequest, opts ...grpc.CallOption) (*None, error)
+}
+
+type sbSwitchClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSbSwitchClient(cc grpc.ClientConnInterface) SbSwitchClient {
+	return &sbSwitchClient{cc}
+}
+
+func (c *sbSwitchClient) GetPort(ctx context.Context, in *PortName, opts ...grpc.CallOption) (*Port, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Port)
+	err := c.cc.Invoke(ctx, SbSwitch_GetPort_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sbSwitchClient) SetPort(ctx context.Context, in *PortRequest, opts ...grpc.CallOption) (*None, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(None)
+	err := c.cc.Invoke(ctx, SbSwitch_SetPort_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sbSwitchClient) GetDevice(ctx context.Context, in *None, opts ...grpc.CallOption) (*Device, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Device)
+	err := c.cc.Invoke(ctx, SbSwitch_GetDevice_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sbSwitchClient) WatchDevice(ctx context.Context, in *None, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Device], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SbSwitch_ServiceDesc.Streams[0], SbSwitch_WatchDevice_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[None, Device]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SbSwitch_WatchDeviceClient = grpc.ServerStreamingClient[Device]
+
+func (c *sbSwitchClient) Subscribe(ctx context.Context, in *None, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StateUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SbSwitch_ServiceDesc.Streams[1], SbSwitch_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[None, StateUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SbSwitch_SubscribeClient = grpc.ServerStreamingClient[StateUpdate]
+
+func (c *sbSwitchClient) Pulse(ctx context.Context, in *PulseRequest, opts ...grpc.CallOption) (*None, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(None)
+	err := c.cc.Invoke(ctx, SbSwitch_Pulse_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SbSwitchServer is the server API for SbSwitch service.
+// All implementations must embed UnimplementedSbSwitchServer
+// for forward compatibility.
+type SbSwitchServer interface {
+	GetPort(context.Context, *PortName) (*Port, error)
+	SetPort(context.Context, *PortRequest) (*None, error)
+	GetDevice(context.Context, *None) (*Device, error)
+	// WatchDevice sends the current state of the device and afterwards
+	// every state change until the client cancels the stream.
+	WatchDevice(*None, grpc.ServerStreamingServer[Device]) error
+	// Subscribe sends a snapshot of the device followed by the incremental
+	// changes. The sequence numbers of the updates are consecutive, a gap
+	// indicates that an update has been missed.
+	Subscribe(*None, grpc.ServerStreamingServer[StateUpdate]) error
+	// Pulse switches a terminal into the requested state and reverts it
+	// after the duration into its previous state.
+	Pulse(context.Context, *PulseRequest) (*None, error)
+	mustEmbedUnimplementedSbSwitchServer()
+}
+
+// UnimplementedSbSwitchServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSbSwitchServer struct{}
+
+func (UnimplementedSbSwitchServer) GetPort(context.Context, *PortName) (*Port, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPort not implemented")
+}
+func (UnimplementedSbSwitchServer) SetPort(context.Context, *PortRequest) (*None, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPort not implemented")
+}
+func (UnimplementedSbSwitchServer) GetDevice(context.Context, *None) (*Device, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDevice not implemented")
+}
+func (UnimplementedSbSwitchServer) WatchDevice(*None, grpc.ServerStreamingServer[Device]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDevice not implemented")
+}
+func (UnimplementedSbSwitchServer) Subscribe(*None, grpc.ServerStreamingServer[StateUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedSbSwitchServer) Pulse(context.Context, *PulseRequest) (*None, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pulse not implemented")
+}
+func (UnimplementedSbSwitchServer) mustEmbedUnimplementedSbSwitchServer() {}
+func (UnimplementedSbSwitchServer) testEmbeddedByValue()                  {}
+
+// UnsafeSbSwitchServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SbSwitchServer will
+// result in compilation errors.
+type UnsafeSbSwitchServer interface {
+	mustEmbedUnimplementedSbSwitchServer()
+}
+
+func RegisterSbSwitchServer(s grpc.ServiceRegistrar, srv SbSwitchServer) {
+	// If the following call pancis, it indicates UnimplementedSbSwitchServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SbSwitch_ServiceDesc, srv)
+}
+
+func _SbSwitch_GetPort_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PortName)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SbSwitchServer).GetPort(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SbSwitch_GetPort_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SbSwitchServer).GetPort(ctx, req.(*PortName))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SbSwitch_SetPort_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PortRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SbSwitchServer).SetPort(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SbSwitch_SetPort_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SbSwitchServer).SetPort(ctx, req.(*PortRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SbSwitch_GetDevice_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(None)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SbSwitchServer).GetDevice(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SbSwitch_GetDevice_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SbSwitchServer).GetDevice(ctx, req.(*None))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SbSwitch_WatchDevice_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(None)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SbSwitchServer).WatchDevice(m, &grpc.GenericServerStream[None, Device]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SbSwitch_WatchDeviceServer = grpc.ServerStreamingServer[Device]
+
+func _SbSwitch_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(None)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SbSwitchServer).Subscribe(m, &grpc.GenericServerStream[None, StateUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SbSwitch_SubscribeServer = grpc.ServerStreamingServer[StateUpdate]
+
+func _SbSwitch_Pulse_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PulseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SbSwitchServer).Pulse(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SbSwitch_Pulse_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SbSwitchServer).Pulse(ctx, req.(*PulseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SbSwitch_ServiceDesc is the grpc.ServiceDesc for SbSwitch service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SbSwitch_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shackbus.switch.SbSwitch",
+	HandlerType: (*SbSwitchServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPort",
+			Handler:    _SbSwitch_GetPort_Handler,
+		},
+		{
+			MethodName: "SetPort",
+			Handler:    _SbSwitch_SetPort_Handler,
+		},
+		{
+			MethodName: "GetDevice",
+			Handler:    _SbSwitch_GetDevice_Handler,
+		},
+		{
+			MethodName: "Pulse",
+			Handler:    _SbSwitch_Pulse_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchDevice",
+			Handler:       _SbSwitch_WatchDevice_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _SbSwitch_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "switch.proto",
+}
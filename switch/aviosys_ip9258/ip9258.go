@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,6 +28,8 @@ type IP9258 struct {
 	rawurl               string
 	url                  string //includes username & password
 	terminalStatePattern *regexp.Regexp
+	lastSeen             time.Time
+	lastError            string
 	eventHandler         func(sw.Switcher, sw.Device)
 	closer               sync.Once
 	stopPolling          chan struct{}
@@ -87,6 +90,7 @@ func (d *IP9258) Init() error {
 	if err := d.updateTerminals(resp); err != nil {
 		return err
 	}
+	d.lastSeen = time.Now()
 
 	d.pollingTicker = time.NewTicker(d.pollingInterval)
 	d.stopPolling = make(chan struct{})
@@ -119,12 +123,22 @@ func (d *IP9258) poll() {
 		select {
 		case <-d.pollingTicker.C:
 			d.Lock()
+			wasOnline := d.health().Online
 			res, err := d.queryTerminalStatus()
+			if err == nil {
+				err = d.updateTerminals(res)
+			}
 			if err != nil {
 				log.Println(err)
+				d.lastError = err.Error()
+			} else {
+				d.lastSeen = time.Now()
+				d.lastError = ""
 			}
-			if err := d.updateTerminals(res); err != nil {
-				log.Println(err)
+			// notify the listener when the device went offline or
+			// came back online
+			if wasOnline != d.health().Online && d.eventHandler != nil {
+				go d.eventHandler(d, d.serialize())
 			}
 			d.Unlock()
 		case <-d.stopPolling:
@@ -133,6 +147,27 @@ func (d *IP9258) poll() {
 	}
 }
 
+// Health returns the health of the connection to the IP9258. The
+// IP9258 is considered offline if the last poll failed or if it hasn't
+// been polled successfully within the last three polling intervals.
+func (d *IP9258) Health() sw.Health {
+	d.RLock()
+	defer d.RUnlock()
+	return d.health()
+}
+
+// health returns the health of the connection to the IP9258. This
+// method is not threadsafe.
+func (d *IP9258) health() sw.Health {
+	return sw.Health{
+		Online: len(d.lastError) == 0 &&
+			time.Since(d.lastSeen) <= 3*d.pollingInterval,
+		LastSeen: d.lastSeen,
+		Error:    d.lastError,
+		Model:    "Aviosys IP9258",
+	}
+}
+
 // Name returns the Name of this Dummy Switch
 func (d *IP9258) Name() string {
 	d.RLock()
@@ -159,6 +194,41 @@ func (d *IP9258) SetPort(portRequest sw.Port) error {
 	return nil
 }
 
+// Pulse switches the terminal into the requested state and reverts it
+// after the duration d. The timing is handled by the IP9258 itself
+// through its power cycle command, which works with a resolution of
+// seconds. Durations are therefore rounded to full seconds.
+func (d *IP9258) Pulse(portName string, terminal sw.Terminal, dur time.Duration) error {
+	d.Lock()
+	defer d.Unlock()
+
+	t, err := d.getTerminal(terminal.Name)
+	if err != nil {
+		return err
+	}
+
+	if t.state == terminal.State {
+		return nil
+	}
+
+	delay := int(dur.Round(time.Second) / time.Second)
+	if delay < 1 {
+		delay = 1
+	}
+
+	if err := d.cycleTerminal(t.Outlet, delay); err != nil {
+		return err
+	}
+
+	// the revert will be picked up by polling
+	t.state = terminal.State
+	if d.eventHandler != nil {
+		go d.eventHandler(d, d.serialize())
+	}
+
+	return nil
+}
+
 // GetPort returns switch.Port struct containing the current state of
 // the port. Portname is ignored since this device will only ever
 // contain one port.
@@ -208,9 +278,12 @@ func (d *IP9258) Serialize() sw.Device {
 // is not threadsafe.
 func (d *IP9258) serialize() sw.Device {
 
+	health := d.health()
+
 	device := sw.Device{
-		Name:  d.name,
-		Index: d.index,
+		Name:   d.name,
+		Index:  d.index,
+		Health: &health,
 		Ports: []sw.Port{
 			d.getPort(),
 		},
@@ -293,6 +366,38 @@ func (s *IP9258) setTerminal(terminal int, newstate bool) error {
 	return s.updateTerminals(string(body))
 }
 
+// cycleTerminal wraps an HTTP call to toggle a particular terminal of
+// the IP9258 and to toggle it back after delay seconds.
+func (s *IP9258) cycleTerminal(terminal int, delay int) error {
+
+	url := fmt.Sprintf("%v/set.cmd?cmd=setpowercycle+p6%d=1+delay=%d", s.url, terminal, delay)
+
+	client := http.Client{
+		Timeout: 3 * time.Second,
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: unable to cycle terminal of ip9258", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(string(body), "BADPARAM") {
+		return fmt.Errorf("ip9258 rejected power cycle of terminal %d", terminal)
+	}
+
+	return nil
+}
+
 // updateTerminals parses the string returned by the IP9258 containing the status
 // of one or more terminals. This method will update the internal state and fire
 // the eventhandler in case the state of at least one terminal has changed.
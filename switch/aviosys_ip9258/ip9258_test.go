@@ -8,7 +8,6 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
@@ -153,7 +152,6 @@ func getTerminalStatePattern() *regexp.Regexp {
 func TestIP9258_updateTerminals(t *testing.T) {
 
 	type fields struct {
-		RWMutex              sync.RWMutex
 		terminals            map[int]*Terminal
 		terminalStatePattern *regexp.Regexp
 		eventHandler         func(sw.Switcher, sw.Device)
@@ -227,6 +225,14 @@ func handleDefaultRequest(rw http.ResponseWriter, req *http.Request) {
 		rw.Write([]byte("<html>p61=1</html>"))
 		return
 		// invalid state '2'
+		// power cycling terminal 1 for 5 seconds
+	} else if strings.Contains(url, "set.cmd?cmd=setpowercycle+p61=1+delay=5") {
+		rw.Write([]byte("<html>p61 cycle ok</html>"))
+		return
+		// power cycling terminal 2 for 1 second
+	} else if strings.Contains(url, "set.cmd?cmd=setpowercycle+p62=1+delay=1") {
+		rw.Write([]byte("<html>p62 cycle ok</html>"))
+		return
 	} else if strings.Contains(url, "set.cmd?cmd=setpower+p62=2") {
 		rw.Write([]byte("<html>HTTPCMD_BADPARAM</html>"))
 		return
@@ -375,7 +381,6 @@ func TestIP9258_getTerminal(t *testing.T) {
 	t2 := &Terminal{Name: "term2", state: true}
 
 	type fields struct {
-		RWMutex   sync.RWMutex
 		terminals map[int]*Terminal
 	}
 	type args struct {
@@ -432,6 +437,11 @@ func TestIP9258_serialize(t *testing.T) {
 	dev := sw.Device{
 		Name:  "IP9258 Web Switch",
 		Index: 5,
+		// the device has never been polled, so it must be offline
+		Health: &sw.Health{
+			Online: false,
+			Model:  "Aviosys IP9258",
+		},
 		Ports: []sw.Port{
 			sw.Port{
 				Name:  "PS",
@@ -651,6 +661,56 @@ func TestIP9258_SetPort(t *testing.T) {
 	}
 }
 
+func TestIP9258_Pulse(t *testing.T) {
+	tests := []struct {
+		name        string
+		terminal    sw.Terminal
+		duration    time.Duration
+		serverParms string
+		wantState   bool
+		wantErr     bool
+	}{
+		{"power cycle terminal 1", sw.Terminal{Name: "term1", State: false},
+			time.Second * 5, "default", false, false},
+		{"duration is rounded to full seconds", sw.Terminal{Name: "term2", State: true},
+			time.Millisecond * 300, "default", true, false},
+		{"terminal already in the requested state", sw.Terminal{Name: "term1", State: true},
+			time.Second * 5, "401", true, false},
+		{"non-existing terminal", sw.Terminal{Name: "term5", State: true},
+			time.Second * 5, "default", false, true},
+		{"invalid credentials", sw.Terminal{Name: "term1", State: false},
+			time.Second * 5, "401", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			server := ip9258Mock(tt.serverParms)
+			defer server.Close()
+
+			d := &IP9258{
+				terminals: map[int]*Terminal{
+					1: &Terminal{Name: "term1", Outlet: 1, Index: 1, state: true},
+					2: &Terminal{Name: "term2", Outlet: 2, Index: 2, state: false},
+				},
+				url:                  server.URL,
+				terminalStatePattern: getTerminalStatePattern(),
+			}
+
+			err := d.Pulse("PS", tt.terminal, tt.duration)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IP9258.Pulse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			term, _ := d.getTerminal(tt.terminal.Name)
+			if term.state != tt.wantState {
+				t.Errorf("IP9258.Pulse() state = %v, want %v", term.state, tt.wantState)
+			}
+		})
+	}
+}
+
 func TestIP9258_Close(t *testing.T) {
 	d := &IP9258{
 		pollingTicker: time.NewTicker(time.Second * 5),
@@ -676,3 +736,36 @@ func TestIP9258_Close(t *testing.T) {
 	// 	t.Fatalf("close method executed twice")
 	// }
 }
+
+func TestIP9258_health(t *testing.T) {
+	type fields struct {
+		lastSeen  time.Time
+		lastError string
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		wantOnline bool
+	}{
+		{"recently polled", fields{lastSeen: time.Now()}, true},
+		{"never polled", fields{}, false},
+		{"last poll too long ago", fields{lastSeen: time.Now().Add(-time.Second * 10)}, false},
+		{"last poll failed", fields{lastSeen: time.Now(), lastError: "timeout"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &IP9258{
+				pollingInterval: time.Second * 3,
+				lastSeen:        tt.fields.lastSeen,
+				lastError:       tt.fields.lastError,
+			}
+			got := d.health()
+			if got.Online != tt.wantOnline {
+				t.Errorf("IP9258.health().Online = %v, want %v", got.Online, tt.wantOnline)
+			}
+			if got.Error != tt.fields.lastError {
+				t.Errorf("IP9258.health().Error = %v, want %v", got.Error, tt.fields.lastError)
+			}
+		})
+	}
+}
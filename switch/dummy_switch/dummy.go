@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 
 	sw "github.com/dh1tw/remoteSwitch/switch"
 )
@@ -194,6 +195,7 @@ func (p *port) serialize() sw.Port {
 	swPort := sw.Port{
 		Name:      p.name,
 		Index:     p.index,
+		Exclusive: p.exclusive,
 		Terminals: []sw.Terminal{},
 	}
 
@@ -214,14 +216,28 @@ func (p *port) serialize() sw.Port {
 	return swPort
 }
 
+// Health returns the health of this Dummy switch. Since the
+// Dummy switch has no hardware, it is always online.
+func (d *DummySwitch) Health() sw.Health {
+	return sw.Health{
+		Online:   true,
+		LastSeen: time.Now(),
+		Model:    "Dummy Switch",
+	}
+}
+
 // serialize returns a switch.Device struct containing the current
 // state and configuration of this Dummy switch. This method
 // is not threadsafe.
 func (d *DummySwitch) serialize() sw.Device {
 
+	health := d.Health()
+
 	dev := sw.Device{
-		Name:  d.name,
-		Index: d.index,
+		Name:      d.name,
+		Index:     d.index,
+		Exclusive: d.exclusive,
+		Health:    &health,
 	}
 
 	// serialize all ports
@@ -1,6 +1,11 @@
 package remotebox
 
-import sw "github.com/dh1tw/remoteSwitch/switch"
+import (
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+)
 
 // Name is a functional option to set the name of this device.
 func Name(name string) func(*Remotebox) {
@@ -25,6 +30,17 @@ func Portname(pn string) func(*Remotebox) {
 	}
 }
 
+// Device is a functional option to select the serial port by the
+// properties of the USB device (e.g. its serial number) instead of its
+// portname, which depends on the order in which the USB serial devices
+// have been enumerated. The port is looked up during Init and on every
+// reconnect.
+func Device(m serialport.Match) func(*Remotebox) {
+	return func(r *Remotebox) {
+		r.spMatch = m
+	}
+}
+
 // EventHandler sets a callback function through which the bandswitch
 // will report Events
 func EventHandler(h func(sw.Switcher, sw.Device)) func(*Remotebox) {
@@ -34,9 +50,20 @@ func EventHandler(h func(sw.Switcher, sw.Device)) func(*Remotebox) {
 }
 
 // ErrorCh is a functional option allows you to pass a channel to the remotebox.
-// The channel will be closed when an internal error occures.
+// The channel will be closed when an internal error occures. A lost
+// connection is not such an error, since the Remotebox reconnects
+// automatically; but finding another model after reconnecting is.
 func ErrorCh(ch chan struct{}) func(*Remotebox) {
 	return func(r *Remotebox) {
 		r.errorCh = ch
 	}
 }
+
+// ReconnectInterval is a functional option to set the delay before the
+// first attempt to reconnect to the Remotebox after the connection has
+// been lost. The delay doubles with each failed attempt.
+func ReconnectInterval(d time.Duration) func(*Remotebox) {
+	return func(r *Remotebox) {
+		r.reconnectInterval = d
+	}
+}
@@ -1,19 +1,392 @@
 package remotebox
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/internal/switchtest"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
 )
 
-func TestSerialCommunication(t *testing.T) {
+// newTestRemotebox initializes a Remotebox connected to portname (e.g.
+// the address of a simulator).
+func newTestRemotebox(t *testing.T, portname string, opts ...func(*Remotebox)) (*Remotebox, chan sw.Device, error) {
+	t.Helper()
+
+	handler, events := switchtest.Events()
+
+	opts = append([]func(*Remotebox){
+		Portname(portname),
+		EventHandler(handler),
+	}, opts...)
+
+	r := New(opts...)
+	if err := r.Init(); err != nil {
+		return nil, nil, err
+	}
+	t.Cleanup(r.Close)
+
+	return r, events, nil
+}
+
+// listen starts serving the simulator on a random TCP port and returns
+// its address.
+func listen(t *testing.T, sim *Simulator) string {
+	t.Helper()
+
+	addr, err := sim.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	return addr
+}
+
+// selected returns the names of the selected terminals of a port.
+func selected(t *testing.T, r *Remotebox, portName string) []string {
+	t.Helper()
+
+	p, err := r.GetPort(portName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, term := range p.Terminals {
+		if term.State {
+			names = append(names, term.Name)
+		}
+	}
+	return names
+}
+
+func TestRemotebox_simulator(t *testing.T) {
+
+	for _, model := range Models() {
+		for _, fw := range Firmwares() {
+			t.Run(model+"/"+fw, func(t *testing.T) {
+
+				sim, err := NewSimulator(model, fw)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				r, events, err := newTestRemotebox(t, listen(t, sim))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				h := r.Health()
+				if !h.Online || h.Firmware != fw ||
+					h.Model != "EA4TX Remotebox "+model {
+					t.Errorf("health = %+v", h)
+				}
+
+				dev := r.Serialize()
+				config := rbConfigs[sim.model]
+				terminals := len(config.ants)
+				if len(dev.Ports) != config.ports {
+					t.Fatalf("%d ports, want %d", len(dev.Ports), config.ports)
+				}
+
+				for i, p := range dev.Ports {
+					if want := fmt.Sprintf("%s%d", config.prefix, i+1); p.Name != want {
+						t.Errorf("port %s, want %s", p.Name, want)
+					}
+					if len(p.Terminals) != terminals {
+						t.Fatalf("port %s: %d terminals, want %d", p.Name, len(p.Terminals), terminals)
+					}
+
+					// the first terminal is selected by the simulator
+					switchtest.Eventually(t, func() bool {
+						s := selected(t, r, p.Name)
+						return len(s) == 1 && s[0] == p.Terminals[0].Name
+					})
+
+					// select the last terminal (covers the terminals A-C
+					// of the 2x12)
+					last := p.Terminals[terminals-1].Name
+					if err := r.SetPort(sw.Port{Name: p.Name, Terminals: []sw.Terminal{{Name: last, State: true}}}); err != nil {
+						t.Fatal(err)
+					}
+					switchtest.Eventually(t, func() bool { return sim.Selected(i+1) == terminals })
+					switchtest.Eventually(t, func() bool {
+						s := selected(t, r, p.Name)
+						return len(s) == 1 && s[0] == last
+					})
+				}
+
+				// changed on the front panel
+				for len(events) > 0 {
+					<-events
+				}
+				sim.Select(1, 2)
+				select {
+				case d := <-events:
+					if !d.Ports[0].Terminals[1].State {
+						t.Errorf("event doesn't contain the change: %v", d.Ports[0])
+					}
+				case <-time.After(time.Second):
+					t.Fatal("no event after external change")
+				}
+			})
+		}
+	}
+}
+
+func TestRemotebox_ser2net(t *testing.T) {
+
+	sim, err := NewSimulator("1x6", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetBanner("ser2net port 7000 device /dev/ttyACM0 [9600 N81]")
+
+	r, _, err := newTestRemotebox(t, listen(t, sim))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := r.Health(); h.Model != "EA4TX Remotebox 1x6" {
+		t.Errorf("model = %s", h.Model)
+	}
+}
+
+// a closed TCP connection is detected immediately and not only by the
+// watchdog
+func TestRemotebox_connectionClosed(t *testing.T) {
+
+	sim, err := NewSimulator("2x8", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listen(t, sim)
+
+	r, _, err := newTestRemotebox(t, addr, ReconnectInterval(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sim.Close()
 
-	spPort := Portname("/dev/tty.usbmodem000011")
+	switchtest.Eventually(t, func() bool {
+		h := r.Health()
+		return !h.Online && strings.Contains(h.Error, "read error")
+	})
+}
+
+func TestRemotebox_reconnect(t *testing.T) {
+
+	sim, err := NewSimulator("2x8", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listen(t, sim)
+
+	errorCh := make(chan struct{})
+	r, events, err := newTestRemotebox(t, addr, ErrorCh(errorCh),
+		ReconnectInterval(time.Millisecond*10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the Remotebox doesn't respond anymore (e.g. lost its power)
+	sim.SetOffline(true)
+
+	switchtest.Eventually(t, func() bool {
+		h := r.Health()
+		return !h.Online && len(h.Error) > 0
+	})
+
+	offline := false
+	for len(events) > 0 && !offline {
+		d := <-events
+		offline = !d.Health.Online
+	}
+	if !offline {
+		t.Error("lost communication not reported through an event")
+	}
+
+	// the serial server drops the connection and comes back
+	sim.SetOffline(false)
+	sim.Close()
+	if _, err := sim.Listen(addr); err != nil {
+		t.Fatal(err)
+	}
+
+	switchtest.Eventually(t, func() bool { return r.Health().Online })
+
+	sim.Select(1, 5)
+	switchtest.Eventually(t, func() bool {
+		s := selected(t, r, "SW1")
+		return len(s) == 1 && s[0] == "ANT5"
+	})
+
+	if err := r.SetPort(sw.Port{Name: "SW2", Terminals: []sw.Terminal{{Name: "ANT8", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	switchtest.Eventually(t, func() bool { return sim.Selected(2) == 8 })
+
+	select {
+	case <-errorCh:
+		t.Fatal("errorCh closed after reconnecting")
+	default:
+	}
+
+	// another model is connected to the serial server
+	sim.Close()
+	other, err := NewSimulator("1x6", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Listen(addr); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+
+	select {
+	case <-errorCh:
+	case <-time.After(time.Second * 2):
+		t.Fatal("model change not detected")
+	}
+
+	if h := r.Health(); h.Online || !strings.Contains(h.Error, "model changed") {
+		t.Errorf("health = %+v, want offline with model change", h)
+	}
+}
+
+func TestRemotebox_antennaNames(t *testing.T) {
+
+	sim, err := NewSimulator("4sq", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"N", "E", "", "W"} {
+		if err := sim.SetAntennaName(i+1, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sim.SetAntennaName(2, "NORTH"); err == nil {
+		t.Error("expected an error for a name with more than 4 characters")
+	}
+
+	r, _, err := newTestRemotebox(t, listen(t, sim))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the terminals are named like the antennas on the LCD; blank names
+	// are replaced, since the terminals are addressed by their names
+	want := []string{"N   ", "E   ", "ANT3", "W   "}
+	p, err := r.GetPort("SQ1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Terminals) != len(want) {
+		t.Fatalf("%d terminals, want %d", len(p.Terminals), len(want))
+	}
+	for i, term := range p.Terminals {
+		if term.Name != want[i] {
+			t.Errorf("terminal %d = %q, want %q", i+1, term.Name, want[i])
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+
+	sim, err := NewSimulator("2x12", "1.3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := listen(t, sim)
+
+	model, fw, err := Probe(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model != "EA4TX Remotebox 2x12" || fw != "1.3d" {
+		t.Errorf("Probe() = %s, %s", model, fw)
+	}
+
+	sim.Close()
+	if _, _, err := Probe(addr); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestRemotebox_device(t *testing.T) {
+
+	sim, err := NewSimulator("1x6", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the USB device takes precedence over the portname
+	_, _, err = newTestRemotebox(t, listen(t, sim),
+		Device(serialport.Match{Serial: "no-such-remotebox"}))
+	if err == nil {
+		t.Error("expected an error, since the USB device doesn't exist")
+	}
+}
+
+func TestNewSimulator(t *testing.T) {
+	if _, err := NewSimulator("3x3", "1.3g"); err == nil {
+		t.Error("expected an error for an unknown model")
+	}
+	if _, err := NewSimulator("4sq+", "1.3g"); err == nil {
+		t.Error("expected an error, since the 4SQ+ isn't supported")
+	}
+	if _, err := NewSimulator("4SQ", ""); err == nil {
+		t.Error("expected an error for a missing firmware")
+	}
+	if _, err := NewSimulator("4SQ", "1.3g"); err != nil {
+		t.Error(err)
+	}
+}
 
-	rb := New(spPort)
+func TestRemotebox_parseMsg4SQ(t *testing.T) {
 
-	rb.Name()
+	r := New()
+	if err := r.createPorts(rb4sq, "1.3g", map[string]byte{}); err == nil {
+		t.Fatal("expected an error for a missing config")
+	}
 
-	// c := make(chan os.Signal, 1)
-	// signal.Notify(c, os.Interrupt)
+	eMap := map[string]byte{}
+	for _, ant := range rbConfigs[rb4sq].ants {
+		for _, addr := range rbAnts[ant] {
+			eMap[addr] = 'A' + byte(ant)
+		}
+	}
+	if err := r.createPorts(rb4sq, "1.3g", eMap); err != nil {
+		t.Fatal(err)
+	}
 
-	// <-c
+	tests := []struct {
+		msg     string
+		wantErr bool
+		want    int // selected terminal (starting with 1), 0 if none
+	}{
+		{"SQ1: 3;", false, 3},
+		{"SQ1: 4;", false, 4},
+		{"SQ1: 0;", false, 0},
+		{"SQ1: 5;", true, 0},
+		{"SQ1: -1;", true, 0},
+		{"SQ2: 1;", true, 0},
+	}
+	for _, tt := range tests {
+		err := r.parseMsg(tt.msg)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseMsg(%s) error = %v, wantErr %v", tt.msg, err, tt.wantErr)
+		}
+		for i, term := range r.ports["SQ1"].terminalsList {
+			if term.state != (i+1 == tt.want) {
+				t.Errorf("parseMsg(%s): terminal %s = %v", tt.msg, term.name, term.state)
+			}
+		}
+	}
 }
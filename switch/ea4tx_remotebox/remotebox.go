@@ -4,6 +4,7 @@ package remotebox
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,7 +15,7 @@ import (
 	"time"
 
 	sw "github.com/dh1tw/remoteSwitch/switch"
-	"github.com/tarm/serial"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
 )
 
 type rbModel int
@@ -136,20 +137,23 @@ type Remotebox struct {
 	firmwareVersion   string
 	ports             map[string]*port
 	portsList         []*port
-	sp                io.ReadWriteCloser
+	sp                io.ReadWriteCloser // guarded by spWrite
 	spPortname        string
+	spMatch           serialport.Match
 	spBaudrate        int
 	spReader          *bufio.Reader
 	spRead            sync.Mutex
 	spWrite           sync.Mutex
 	spPollingInterval time.Duration
-	spPollingTicker   *time.Ticker
 	spWatchdogTs      time.Time
+	reconnectInterval time.Duration
+	lastError         string
 	eventHandler      func(sw.Switcher, sw.Device)
 	closeCh           chan struct{}
 	errorCh           chan struct{}
 	starter           sync.Once
 	closer            sync.Once
+	failer            sync.Once
 }
 
 func New(opts ...func(*Remotebox)) *Remotebox {
@@ -162,6 +166,7 @@ func New(opts ...func(*Remotebox)) *Remotebox {
 		spPollingInterval: time.Millisecond * 100,
 		spPortname:        "/dev/ttyACM0",
 		spBaudrate:        9600, //doesn't really matter
+		reconnectInterval: time.Second,
 		closeCh:           make(chan struct{}),
 		errorCh:           make(chan struct{}),
 	}
@@ -175,80 +180,184 @@ func New(opts ...func(*Remotebox)) *Remotebox {
 
 func (r *Remotebox) Init() error {
 
-	if strings.Contains(r.spPortname, ":") {
-		tcpConn, err := net.Dial("tcp", r.spPortname)
-		if err != nil {
-			return err
-		}
-		r.sp = tcpConn
-	} else {
-		spConfig := &serial.Config{
-			Name:        r.spPortname,
-			Baud:        r.spBaudrate,
-			ReadTimeout: time.Second,
-			Parity:      serial.ParityNone,
-			Size:        8,
-			StopBits:    1,
-		}
-		sp, err := serial.OpenPort(spConfig)
-		if err != nil {
-			return err
-		}
-		r.sp = sp
+	model, fwVersion, eMap, err := r.connect()
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	r.model = model
+	r.firmwareVersion = fwVersion
+	r.spWatchdogTs = time.Now()
+	r.Unlock()
+
+	log.Printf("found ea4tx remotebox model: %s, firmware: %s", model, fwVersion)
+
+	if err := r.createPorts(model, fwVersion, eMap); err != nil {
+		r.closePort()
+		return err
+	}
+
+	go r.start()
+
+	return nil
+}
+
+// connectTimeout is the time within which the Remotebox has to send its
+// device information and configuration after the connection has been
+// established.
+const connectTimeout = time.Second * 5
+
+// connect opens the serial port (or the TCP connection to the serial
+// server) and reads the model, the firmware version and the configuration
+// of the Remotebox. The port is closed again on error.
+func (r *Remotebox) connect() (rbModel, string, map[string]byte, error) {
+
+	sp, err := r.openPort()
+	if err != nil {
+		return rbUnknown, "", nil, err
+	}
+
+	// reads from a TCP connection don't time out; a serial server without
+	// a Remotebox behind it must not block forever
+	if conn, ok := sp.(net.Conn); ok {
+		conn.SetReadDeadline(time.Now().Add(connectTimeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	model, fwVersion, eMap, err := r.readDevice()
+	if err != nil {
+		r.closePort()
+		return rbUnknown, "", nil, err
 	}
 
-	r.spReader = bufio.NewReader(r.sp)
+	return model, fwVersion, eMap, nil
+}
+
+// openPort opens the serial port (or the TCP connection to the serial
+// server). USB devices selected by their properties are looked up each
+// time the port is opened.
+func (r *Remotebox) openPort() (io.ReadWriteCloser, error) {
+
+	sp, err := serialport.Open(serialport.Config{
+		Name:        r.spPortname,
+		Match:       r.spMatch,
+		Baudrate:    r.spBaudrate,
+		ReadTimeout: time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.spWrite.Lock()
+	select {
+	case <-r.closeCh:
+		r.spWrite.Unlock()
+		sp.Close()
+		return nil, fmt.Errorf("remotebox has been closed")
+	default:
+	}
+	r.sp = sp
+	r.spWrite.Unlock()
+
+	r.spRead.Lock()
+	r.spReader = bufio.NewReader(sp)
+	r.spRead.Unlock()
+
+	return sp, nil
+}
+
+// Probe checks if a Remotebox is connected to the serial port (or the
+// serial server) and returns its model (e.g. "EA4TX Remotebox 2x12") and
+// firmware version.
+func Probe(portname string) (string, string, error) {
+
+	r := New(Portname(portname))
+	defer r.Close()
+
+	sp, err := r.openPort()
+	if err != nil {
+		return "", "", err
+	}
+
+	if conn, ok := sp.(net.Conn); ok {
+		conn.SetReadDeadline(time.Now().Add(connectTimeout))
+	}
 
 	deviceInfo, err := r.getDeviceInfo()
 	if err != nil {
-		log.Panic(err)
+		return "", "", err
 	}
 
 	model, fwVersion, err := parseDeviceInfo(deviceInfo)
 	if err != nil {
-		log.Panic(err)
+		return "", "", err
 	}
-
 	r.model = model
-	r.firmwareVersion = fwVersion
 
-	config, err := r.getConfig()
+	return r.modelName(), fwVersion, nil
+}
+
+// readDevice reads the model, the firmware version and the configuration
+// of the Remotebox.
+func (r *Remotebox) readDevice() (rbModel, string, map[string]byte, error) {
+
+	deviceInfo, err := r.getDeviceInfo()
 	if err != nil {
-		log.Panic(err)
+		return rbUnknown, "", nil, err
 	}
 
-	eMap, err := parseConfig(config)
+	model, fwVersion, err := parseDeviceInfo(deviceInfo)
 	if err != nil {
-		log.Panic(err)
+		return rbUnknown, "", nil, err
 	}
 
-	log.Printf("found ea4tx remotebox model: %s, firmware: %s", r.model, r.firmwareVersion)
-
-	err = r.createPorts(model, fwVersion, eMap)
+	config, err := r.getConfig()
 	if err != nil {
-		log.Panic(err)
+		return rbUnknown, "", nil, err
 	}
 
-	go r.start()
+	eMap, err := parseConfig(config)
+	if err != nil {
+		return rbUnknown, "", nil, err
+	}
 
-	return nil
+	return model, fwVersion, eMap, nil
 }
 
-func (r *Remotebox) Close() {
-	r.Lock()
-	r.spRead.Lock()
+// closePort closes the serial port. A pending read returns with an error.
+func (r *Remotebox) closePort() {
 	r.spWrite.Lock()
-	defer r.Unlock()
 	defer r.spWrite.Unlock()
-	defer r.spRead.Unlock()
 
-	if r.spPollingTicker != nil {
-		r.spPollingTicker.Stop()
+	if r.sp != nil {
+		r.sp.Close()
+		r.sp = nil
 	}
-	// makes sure that the serial port and the event loop just gets closed once
+}
+
+func (r *Remotebox) Close() {
+	// makes sure that the serial port and the event loop just gets closed
+	// once. The port is closed without waiting for a pending read, since
+	// reads from a TCP connection don't time out.
 	r.closer.Do(func() {
 		close(r.closeCh)
-		r.sp.Close()
+		r.closePort()
+	})
+}
+
+// fail records a fatal error and signals it by closing the errorCh. If
+// the Remotebox has been closed in the meantime, the error is ignored.
+func (r *Remotebox) fail(err error) {
+	select {
+	case <-r.closeCh:
+		return
+	default:
+	}
+
+	r.setError(err)
+	r.failer.Do(func() {
+		close(r.errorCh)
 	})
 }
 
@@ -271,6 +380,43 @@ func (r *Remotebox) checkWatchdog() bool {
 	return false
 }
 
+// setError records the last error which occurred on the connection
+// to the Remotebox.
+func (r *Remotebox) setError(err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.lastError = err.Error()
+}
+
+// Health returns the health of the connection to the Remotebox.
+func (r *Remotebox) Health() sw.Health {
+	r.RLock()
+	defer r.RUnlock()
+	return r.health()
+}
+
+// health returns the health of the connection to the Remotebox. This
+// method is not threadsafe.
+func (r *Remotebox) health() sw.Health {
+	return sw.Health{
+		Online: len(r.lastError) == 0 && !r.spWatchdogTs.IsZero() &&
+			time.Since(r.spWatchdogTs) <= 5*r.spPollingInterval,
+		LastSeen: r.spWatchdogTs,
+		Error:    r.lastError,
+		Model:    r.modelName(),
+		Firmware: r.firmwareVersion,
+	}
+}
+
+// modelName returns a human readable name of the Remotebox model
+// (e.g. "EA4TX Remotebox 2x12"). This method is not threadsafe.
+func (r *Remotebox) modelName() string {
+	if r.model == rbUnknown {
+		return "EA4TX Remotebox"
+	}
+	return "EA4TX Remotebox " + strings.TrimPrefix(r.model.String(), "rb")
+}
+
 // getDeviceInfo reads the device information (model and firmware)
 // from the remotebox
 func (r *Remotebox) getDeviceInfo() ([]string, error) {
@@ -292,6 +438,12 @@ retry:
 		goto retry
 	}
 
+	// firmware versions < 1.3g send an empty line instead of the model,
+	// so the version has already been received
+	if strings.HasPrefix(line1, "Ver") {
+		return []string{line1, ""}, nil
+	}
+
 	line2, err := r.read()
 	if err != nil {
 		// buf in firmware versions < 1.3g. The do not send the
@@ -390,7 +542,7 @@ func (r *Remotebox) getConfig() (string, error) {
 	for i := 0; i <= 15; i++ {
 		c, err := r.read()
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF && !serialport.IsNetwork(r.spPortname) {
 				continue
 			}
 			return "", err
@@ -401,43 +553,129 @@ func (r *Remotebox) getConfig() (string, error) {
 	return config, nil
 }
 
-// Start the main event loop for the serial port.
-// It will query the remotebox for the current state of the port(s)
-// with the pollingrate defined during initialization.
-// If an error occures, the errorCh will be closed.
-// Consequently the communication will be shut down and the object
-// prepared for garbage collection.
-func (r *Remotebox) start() {
-	defer r.Close()
+// port returns a description of the serial port for log messages.
+func (r *Remotebox) port() string {
+	if !r.spMatch.IsZero() {
+		return r.spMatch.String()
+	}
+	return r.spPortname
+}
 
-	r.Lock()
-	r.spPollingTicker = time.NewTicker(r.spPollingInterval)
-	r.spWatchdogTs = time.Now()
-	r.Unlock()
+// errModelChanged is returned if another Remotebox model has been found
+// after a reconnect. The ports of the switch can't change at runtime.
+var errModelChanged = errors.New("remotebox model changed")
 
-	// start async polling
-	go r.poll()
+// start is the main event loop. It polls the Remotebox for the current
+// state of the port(s) and processes its messages. If the connection
+// fails (e.g. the USB cable has been unplugged or the serial server
+// dropped the connection), the Remotebox is reported offline and the
+// connection is re-established with an increasing delay. Only if a
+// different model is found after reconnecting, the errorCh will be closed.
+func (r *Remotebox) start() {
 
 	for {
+		err := r.serve()
+
 		select {
-		// when closing has been signaled, stop reading
-		// from the serial port by exiting this function
 		case <-r.closeCh:
 			return
 		default:
 		}
 
+		log.Printf("connection lost with %s on %s: %v", r.Name(), r.port(), err)
+		r.closePort()
+		r.setError(err)
+		r.notify()
+
+		reconnected := serialport.Reconnect(r.closeCh, r.reconnectInterval, func() error {
+			err := r.reconnect()
+			switch {
+			case errors.Is(err, errModelChanged):
+				log.Printf("unable to reconnect to %s: %v", r.Name(), err)
+				r.fail(err)
+				r.Close()
+			case err != nil:
+				r.setError(fmt.Errorf("unable to reconnect: %v", err))
+			}
+			return err
+		})
+		if !reconnected {
+			return
+		}
+
+		log.Printf("reconnected to %s on %s", r.Name(), r.port())
+		r.notify()
+	}
+}
+
+// reconnect re-establishes the connection to the Remotebox and verifies
+// that the model hasn't changed.
+func (r *Remotebox) reconnect() error {
+
+	model, fwVersion, _, err := r.connect()
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if model != r.model {
+		r.closePort()
+		return fmt.Errorf("%w from %s to %s", errModelChanged, r.model, model)
+	}
+
+	r.firmwareVersion = fwVersion
+	r.spWatchdogTs = time.Now()
+	r.lastError = ""
+
+	return nil
+}
+
+// serve polls the Remotebox and reads its messages until the connection
+// fails or the Remotebox is closed.
+func (r *Remotebox) serve() error {
+
+	r.resetWatchdog()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	pollErr := make(chan error, 1)
+
+	// the polling has to be stopped before the port can be reopened
+	defer wg.Wait()
+	defer close(done)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := r.poll(done); err != nil {
+			pollErr <- err
+			// abort the pending read
+			r.closePort()
+		}
+	}()
+
+	for {
 		// this is a blocking function which will run timeout
 		// when no data is received (ReadTimeout)
 		msg, err := r.read()
+
+		select {
+		case err := <-pollErr:
+			return err
+		case <-r.closeCh:
+			return nil
+		default:
+		}
+
 		if err != nil {
-			if err == io.EOF {
+			// a serial port returns EOF when the read timed out, while a
+			// TCP connection to a serial server has been closed
+			if err == io.EOF && !serialport.IsNetwork(r.spPortname) {
 				continue
 			}
-			fmt.Printf("serial port read error (%s on %s): %s\n",
-				r.name, r.spPortname, err)
-			close(r.errorCh)
-			return // exit
+			return fmt.Errorf("serial port read error: %v", err)
 		}
 		r.resetWatchdog()
 		if err := r.parseMsg(msg); err != nil {
@@ -446,30 +684,42 @@ func (r *Remotebox) start() {
 	}
 }
 
-// poll the Remotebox for the current state
-func (r *Remotebox) poll() {
-	defer r.Close()
+// poll the Remotebox for the current state and check the watchdog until
+// done is closed or the Remotebox is closed.
+func (r *Remotebox) poll(done <-chan struct{}) error {
+
+	ticker := time.NewTicker(r.spPollingInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case <-r.spPollingTicker.C:
+		case <-ticker.C:
 			if err := r.query(); err != nil {
-				fmt.Println("serial port write error:", err)
-				close(r.errorCh)
-				return
+				return fmt.Errorf("serial port write error: %v", err)
 			}
 			if r.checkWatchdog() {
-				fmt.Println("communication lost with remotebox")
-				close(r.errorCh)
-				return
+				return fmt.Errorf("communication lost with remotebox")
 			}
+		case <-done:
+			return nil
 		// when closing has been signaled, stop polling and return
 		case <-r.closeCh:
-			return
+			return nil
 		}
 	}
 }
 
+// notify reports the current state and health of the Remotebox through
+// the event handler.
+func (r *Remotebox) notify() {
+	r.RLock()
+	defer r.RUnlock()
+
+	if r.eventHandler != nil {
+		go r.eventHandler(r, r.serialize())
+	}
+}
+
 // read from the Remotebox through this wrapper function
 func (r *Remotebox) read() (string, error) {
 	r.spRead.Lock()
@@ -503,6 +753,9 @@ func (r *Remotebox) query() error {
 func (r *Remotebox) write(data []byte) (int, error) {
 	r.spWrite.Lock()
 	defer r.spWrite.Unlock()
+	if r.sp == nil {
+		return 0, fmt.Errorf("not connected to remotebox")
+	}
 	return r.sp.Write(data)
 }
 
@@ -579,25 +832,20 @@ func (r *Remotebox) parseMsg(msg string) error {
 			return fmt.Errorf("terminals do not exist for port %s", portMsg)
 		}
 
-		if state > len(p.terminalsList) {
+		// the state is the number of the selected direction; 0 means
+		// that no direction is selected
+		if state < 0 || state > len(p.terminalsList) {
 			return fmt.Errorf("message content does not match with remotebox model")
 		}
 
-		// check if something has changed
-		if p.terminalsList[state-1].state {
-			return nil
-		}
-
-		// set all terminals to false
-		for i := 0; i < len(p.terminalsList); i++ {
-			p.terminalsList[i].state = false
+		for i, t := range p.terminalsList {
+			newstate := i == state-1
+			if t.state != newstate {
+				t.state = newstate
+				stateChanged = true
+			}
 		}
 
-		// set the newly selected terminal
-		p.terminalsList[state-1].state = true
-
-		stateChanged = true
-
 	default:
 		// ignore
 	}
@@ -673,6 +921,14 @@ func (r *Remotebox) createPorts(model rbModel, fw string, eMap map[string]byte)
 			if err != nil {
 				return err
 			}
+			// the terminals are addressed by their names, therefore
+			// blank and duplicate names are made unique
+			if len(strings.TrimSpace(tName)) == 0 {
+				tName = fmt.Sprintf("ANT%d", j+1)
+			}
+			if _, ok := p.terminals[tName]; ok {
+				tName = fmt.Sprintf("%s(%d)", strings.TrimSpace(tName), j+1)
+			}
 			t := &terminal{
 				index: j + 1,
 				name:  tName,
@@ -742,12 +998,12 @@ func (r *Remotebox) SetPort(req sw.Port) error {
 	// ensure that the requested terminal exists
 	for n, t := range req.Terminals {
 		rbTerminal, ok := p.terminals[t.Name]
-		// copy the index of the terminal as it is not supplied with the
-		// RPC request
-		req.Terminals[n].Index = rbTerminal.index
 		if !ok {
 			return fmt.Errorf("%s is an invalid terminal", t.Name)
 		}
+		// copy the index of the terminal as it is not supplied with the
+		// RPC request
+		req.Terminals[n].Index = rbTerminal.index
 	}
 
 	for _, t := range req.Terminals {
@@ -767,7 +1023,9 @@ func (r *Remotebox) SetPort(req sw.Port) error {
 		default:
 			cmd = fmt.Sprintf("%s%d1\n", cmd, t.Index)
 		}
-		r.write([]byte(cmd))
+		if _, err := r.write([]byte(cmd)); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -798,9 +1056,12 @@ func (p *port) String() string {
 // is not threadsafe.
 func (r *Remotebox) serialize() sw.Device {
 
+	health := r.health()
+
 	dev := sw.Device{
-		Name:  r.name,
-		Index: r.index,
+		Name:   r.name,
+		Index:  r.index,
+		Health: &health,
 	}
 
 	// serialize all ports
@@ -815,9 +1076,11 @@ func (r *Remotebox) serialize() sw.Device {
 // serialize returns a switch.Port struct containing the current
 // state and configuration of this port. This method is not threadsafe.
 func (p *port) serialize() sw.Port {
+	// a port of the Remotebox is always connected to exactly one antenna
 	swPort := sw.Port{
 		Name:      p.name,
 		Index:     p.index,
+		Exclusive: true,
 		Terminals: []sw.Terminal{},
 	}
 
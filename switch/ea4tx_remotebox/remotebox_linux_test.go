@@ -0,0 +1,105 @@
+//go:build linux
+
+package remotebox
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/internal/switchtest"
+)
+
+// servePty serves the simulator on a pseudo terminal and returns the
+// name of the serial port for the driver.
+func servePty(t *testing.T, sim *Simulator) string {
+	t.Helper()
+
+	master, portname := switchtest.OpenPty(t)
+
+	var closed bool
+	var mu sync.Mutex
+
+	go func() {
+		for {
+			// reading from the master fails while the slave isn't
+			// opened by the driver
+			sim.Serve(master)
+			mu.Lock()
+			done := closed
+			mu.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}()
+
+	t.Cleanup(func() {
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+		master.Close()
+	})
+
+	return portname
+}
+
+func TestRemotebox_pty(t *testing.T) {
+
+	sim, err := NewSimulator("2x6", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Select(2, 3)
+
+	r, events, err := newTestRemotebox(t, servePty(t, sim))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switchtest.Eventually(t, func() bool {
+		s := selected(t, r, "SW2")
+		return len(s) == 1 && s[0] == "ANT3"
+	})
+
+	if err := r.SetPort(sw.Port{Name: "SW1", Terminals: []sw.Terminal{{Name: "ANT6", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	switchtest.Eventually(t, func() bool { return sim.Selected(1) == 6 })
+
+	// changed on the front panel
+	for len(events) > 0 {
+		<-events
+	}
+	sim.Select(2, 1)
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Fatal("no event after external change")
+	}
+}
+
+func TestProbe_pty(t *testing.T) {
+
+	sim, err := NewSimulator("4sq", "1.3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	portname := servePty(t, sim)
+
+	model, _, err := Probe(portname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model != "EA4TX Remotebox 4sq" {
+		t.Errorf("model = %s", model)
+	}
+
+	// another device which doesn't respond; the probe must not block
+	sim.SetOffline(true)
+	if _, _, err := Probe(portname); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,398 @@
+package remotebox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// oldFirmwares are the firmware versions which send an empty line instead
+// of the model in response to the device info request.
+var oldFirmwares = []string{"1.2l", "1.2p", "1.3b", "1.3d"}
+
+// nameLength is the amount of characters of an antenna name. The names
+// are shown on the LCD of the Remotebox.
+const nameLength = 4
+
+// Firmwares returns the firmware versions whose behaviour is simulated.
+// Other versions behave like the latest one.
+func Firmwares() []string {
+	return append(append([]string{}, oldFirmwares...), "1.3g")
+}
+
+// Models returns the names of the Remotebox models which can be
+// simulated (e.g. "2x12" or "4sq").
+func Models() []string {
+	models := []string{}
+	for m := rb1x6; m <= rb4sq; m++ {
+		models = append(models, m.shortName())
+	}
+	return models
+}
+
+func isOldFirmware(firmware string) bool {
+	for _, fw := range oldFirmwares {
+		if strings.EqualFold(firmware, fw) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortName returns the name of the model without the prefix (e.g.
+// "2x12" or "4sq").
+func (m rbModel) shortName() string {
+	return strings.TrimPrefix(m.String(), "rb")
+}
+
+// Simulator emulates the serial line protocol of a Remotebox. It serves
+// the protocol on any io.ReadWriter (e.g. the master side of a pseudo
+// terminal) or on a TCP socket, like a Remotebox behind a serial server.
+// The simulator is meant for tests and for demos without hardware.
+type Simulator struct {
+	sync.Mutex
+	model    rbModel
+	firmware string
+	memory   [256]byte
+	// selected terminal (starting with 1) of each port; 0 if none
+	selected []int
+	offline  bool
+	banner   string
+	logf     func(format string, v ...interface{})
+	lis      net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+// NewSimulator returns a simulator of the Remotebox model (see Models)
+// running the given firmware version (e.g. "1.3g"). The antennas are
+// named ANT1, ANT2, ..., AN10, AN11, ... and the first terminal of each
+// port is selected.
+func NewSimulator(model, firmware string) (*Simulator, error) {
+
+	rbm := rbUnknown
+	for m := rb1x6; m <= rb4sq; m++ {
+		if strings.EqualFold(m.shortName(), model) {
+			rbm = m
+		}
+	}
+	if rbm == rbUnknown {
+		return nil, fmt.Errorf("unknown remotebox model %s (supported: %s)",
+			model, strings.Join(Models(), ", "))
+	}
+
+	if len(firmware) == 0 {
+		return nil, fmt.Errorf("firmware version missing")
+	}
+
+	s := &Simulator{
+		model:    rbm,
+		firmware: strings.ToLower(firmware),
+		selected: make([]int, rbConfigs[rbm].ports),
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	for i := range s.memory {
+		s.memory[i] = ' '
+	}
+
+	for i := range rbConfigs[rbm].ants {
+		name := fmt.Sprintf("ANT%d", i+1)
+		if len(name) > nameLength {
+			name = fmt.Sprintf("AN%d", i+1)
+		}
+		s.setName(rbAnt(i), name)
+	}
+
+	for i := range s.selected {
+		s.selected[i] = 1
+	}
+
+	return s, nil
+}
+
+// SetLogger sets a function through which the simulator logs the
+// commands which change its state (e.g. log.Printf).
+func (s *Simulator) SetLogger(logf func(format string, v ...interface{})) {
+	s.Lock()
+	defer s.Unlock()
+	s.logf = logf
+}
+
+// SetBanner sets a line which is sent to each TCP client after it has
+// connected, like the banner of ser2net.
+func (s *Simulator) SetBanner(banner string) {
+	s.Lock()
+	defer s.Unlock()
+	s.banner = banner
+}
+
+// SetOffline makes the simulator ignore all commands (e.g. to simulate a
+// Remotebox which has lost its power) until it is set online again.
+func (s *Simulator) SetOffline(offline bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.offline = offline
+}
+
+// SetAntennaName stores the name of an antenna (starting with 1) in the
+// configuration of the simulated Remotebox. Names have up to 4 characters.
+func (s *Simulator) SetAntennaName(ant int, name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if ant < 1 || ant > len(rbConfigs[s.model].ants) {
+		return fmt.Errorf("remotebox %s has no antenna %d", s.model.shortName(), ant)
+	}
+
+	lcdName, err := toLcdName(name)
+	if err != nil {
+		return err
+	}
+
+	s.setName(rbAnt(ant-1), lcdName)
+
+	return nil
+}
+
+// AntennaName returns the name of an antenna (starting with 1) stored in
+// the configuration of the simulated Remotebox.
+func (s *Simulator) AntennaName(ant int) string {
+	s.Lock()
+	defer s.Unlock()
+
+	name := ""
+	for _, addr := range rbAnts[rbAnt(ant-1)] {
+		a, _ := strconv.ParseUint(addr, 16, 8)
+		name += string(s.memory[a])
+	}
+	return name
+}
+
+// setName stores the name in the configuration. This method is not
+// threadsafe.
+func (s *Simulator) setName(ant rbAnt, name string) {
+	name = fmt.Sprintf("%-*s", nameLength, name)
+	for i, addr := range rbAnts[ant] {
+		a, _ := strconv.ParseUint(addr, 16, 8)
+		s.memory[a] = name[i]
+	}
+}
+
+// toLcdName checks if the name can be shown on the LCD of the Remotebox
+// and pads it with spaces to the length of the names stored in the
+// Remotebox.
+func toLcdName(name string) (string, error) {
+
+	if len(name) > nameLength {
+		return "", fmt.Errorf("antenna name %q is longer than %d characters", name, nameLength)
+	}
+
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] > 0x7E {
+			return "", fmt.Errorf("antenna name %q contains unsupported characters", name)
+		}
+	}
+
+	return fmt.Sprintf("%-*s", nameLength, name), nil
+}
+
+// Select selects a terminal of a port (both starting with 1), e.g. to
+// simulate a change on the front panel of the Remotebox. On 4SQ
+// controllers the terminals are the directions; 0 deselects all terminals.
+func (s *Simulator) Select(port, terminal int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if port < 1 || port > len(s.selected) {
+		return fmt.Errorf("remotebox %s has no port %d", s.model.shortName(), port)
+	}
+
+	if terminal < 0 || terminal > len(rbConfigs[s.model].ants) {
+		return fmt.Errorf("remotebox %s has no terminal %d", s.model.shortName(), terminal)
+	}
+
+	s.selected[port-1] = terminal
+
+	return nil
+}
+
+// Selected returns the selected terminal of a port (both starting with
+// 1).
+func (s *Simulator) Selected(port int) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.selected[port-1]
+}
+
+// Listen starts serving the simulated Remotebox on a TCP socket on
+// address (e.g. "127.0.0.1:0" for a random port) and returns the address
+// it is listening on.
+func (s *Simulator) Listen(address string) (string, error) {
+
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", err
+	}
+
+	s.Lock()
+	s.lis = lis
+	s.Unlock()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			s.Lock()
+			s.conns[conn] = struct{}{}
+			banner := s.banner
+			s.Unlock()
+
+			go func() {
+				if len(banner) == 0 || writeLine(conn, banner) == nil {
+					s.Serve(conn)
+				}
+				s.Lock()
+				delete(s.conns, conn)
+				s.Unlock()
+				conn.Close()
+			}()
+		}
+	}()
+
+	return lis.Addr().String(), nil
+}
+
+// Close stops listening and closes all TCP connections.
+func (s *Simulator) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Close()
+}
+
+// Serve executes the commands read from rw until reading fails.
+func (s *Simulator) Serve(rw io.ReadWriter) error {
+
+	r := bufio.NewReader(rw)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		resp := s.execute(strings.TrimSpace(line))
+		if len(resp) == 0 {
+			continue
+		}
+
+		if _, err := io.WriteString(rw, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func writeLine(w io.Writer, line string) error {
+	_, err := io.WriteString(w, line+"\r\n")
+	return err
+}
+
+// execute executes a command and returns the response. Unknown commands
+// are ignored.
+func (s *Simulator) execute(cmd string) string {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.offline {
+		return ""
+	}
+
+	config := rbConfigs[s.model]
+
+	switch {
+	case cmd == "O":
+		return s.deviceInfo()
+
+	case cmd == "FI":
+		// 16 lines with 16 address:content tuples each
+		resp := ""
+		for i := 0; i < 16; i++ {
+			for j := 0; j < 16; j++ {
+				resp += fmt.Sprintf("%02X:%02X ", i*16+j, s.memory[i*16+j])
+			}
+			resp += "\r\n"
+		}
+		return resp
+
+	case cmd == "S":
+		// e.g. "SW1: 0,1,0,0,0,0;" or "SQ1: 3;"
+		resp := ""
+		for i, sel := range s.selected {
+			if s.model == rb4sq {
+				resp += fmt.Sprintf("%s%d: %d;\r\n", config.prefix, i+1, sel)
+				continue
+			}
+			states := make([]string, len(config.ants))
+			for j := range states {
+				states[j] = "0"
+				if j+1 == sel {
+					states[j] = "1"
+				}
+			}
+			resp += fmt.Sprintf("%s%d: %s;\r\n", config.prefix, i+1, strings.Join(states, ","))
+		}
+		return resp
+
+	case len(cmd) == 4 && cmd[1] == 'R' && cmd[3] == '1':
+		// e.g. "1R31" or "2RB1" (terminals 10-12 are A-C)
+		port := int(cmd[0] - '0')
+		terminal, err := strconv.ParseUint(cmd[2:3], 16, 8)
+		if err == nil && port >= 1 && port <= len(s.selected) &&
+			terminal >= 1 && int(terminal) <= len(config.ants) {
+			s.selected[port-1] = int(terminal)
+			s.log("port %d: terminal %d selected", port, terminal)
+		}
+	}
+
+	return ""
+}
+
+// log logs through the logger, if set. This method is not threadsafe.
+func (s *Simulator) log(format string, v ...interface{}) {
+	if s.logf != nil {
+		s.logf(format, v...)
+	}
+}
+
+// deviceInfo returns the response to the "O" command (e.g. "EA4TX AS2x12"
+// and "Ver1.3g Firm:510"). The model is identified by the first digit of
+// the firmware number. Older firmware versions send an empty line instead
+// of the model. This method is not threadsafe.
+func (s *Simulator) deviceInfo() string {
+
+	version := fmt.Sprintf("Ver%s Firm:%d10\r\n", s.firmware, rbConfigs[s.model].modelID)
+
+	if isOldFirmware(s.firmware) {
+		return "\r\n" + version
+	}
+
+	name := "AS" + s.model.shortName()
+	if s.model == rb4sq {
+		name = strings.ToUpper(s.model.shortName())
+	}
+
+	return fmt.Sprintf("EA4TX %s\r\n", name) + version
+}
@@ -0,0 +1,37 @@
+package switchtest
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// OpenPty opens a pseudo terminal. A simulator serves the master side,
+// while the driver opens the slave like a USB serial port. The test is
+// skipped if pseudo terminals are not available.
+func OpenPty(t testing.TB) (*os.File, string) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("pseudo terminals not available: %v", err)
+	}
+
+	var unlock int32
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(),
+		syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); e != 0 {
+		master.Close()
+		t.Fatalf("unable to unlock pty: %v", e)
+	}
+
+	var n uint32
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(),
+		syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); e != 0 {
+		master.Close()
+		t.Fatalf("unable to get pty number: %v", e)
+	}
+
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
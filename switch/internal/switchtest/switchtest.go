@@ -0,0 +1,63 @@
+// Package switchtest provides helpers for the tests of the switch drivers.
+package switchtest
+
+import (
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// Initializer is a Switcher which has to be initialized before it can be
+// used (e.g. because it connects to its hardware).
+type Initializer interface {
+	sw.Switcher
+	Init() error
+}
+
+// Events returns an event handler for a switch and the channel to which
+// it forwards the devices.
+func Events() (func(sw.Switcher, sw.Device), chan sw.Device) {
+	events := make(chan sw.Device, 100)
+	return func(s sw.Switcher, d sw.Device) { events <- d }, events
+}
+
+// Init initializes the switch s and closes it when the test finishes.
+func Init(t testing.TB, s Initializer) {
+	t.Helper()
+
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+}
+
+// TerminalState returns the state of a terminal of the switch s.
+func TerminalState(t testing.TB, s sw.Switcher, portName, terminalName string) bool {
+	t.Helper()
+
+	p, err := s.GetPort(portName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, term := range p.Terminals {
+		if term.Name == terminalName {
+			return term.State
+		}
+	}
+	t.Fatalf("terminal %s not found on port %s", terminalName, portName)
+	return false
+}
+
+// Eventually waits until cond returns true.
+func Eventually(t testing.TB, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 2)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
@@ -0,0 +1,778 @@
+// Package lineprotocol implements a switch for devices with a simple line
+// based text protocol, like the many homebrew antenna switches built
+// around an Arduino or ESP8266. The commands and the format of the
+// responses are described in the config file, so that new devices can be
+// integrated without writing Go.
+package lineprotocol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+)
+
+// LineProtocol contains the state and configuration of a device which is
+// controlled through a line based text protocol over a serial port or TCP.
+type LineProtocol struct {
+	sync.Mutex
+	name              string
+	index             int
+	exclusive         bool
+	ports             map[string]*port
+	switchConfig      SwitchConfig
+	protocol          ProtocolConfig
+	response          *regexp.Regexp
+	eventHandler      func(sw.Switcher, sw.Device)
+	spConfig          serialport.Config
+	sp                io.ReadWriteCloser // guarded by spWrite
+	spReader          *bufio.Reader
+	spWrite           sync.Mutex
+	pollingInterval   time.Duration
+	reconnectInterval time.Duration
+	timeout           time.Duration
+	watchdogTs        time.Time
+	responseCh        chan struct{} // signals the first valid response
+	initialized       bool
+	lastSeen          time.Time
+	lastError         string
+	closeCh           chan struct{}
+	closer            sync.Once
+}
+
+// port represents a set of terminals. This struct holds the
+// configuration and state of the port.
+type port struct {
+	name      string
+	id        string
+	terminals map[string]*terminal
+	exclusive bool
+	index     int
+}
+
+// terminal represents a particular output of the device. This struct
+// holds the configuration and state of the terminal.
+type terminal struct {
+	name  string
+	id    string
+	state bool
+	index int
+}
+
+// NewLineProtocol is the constructor for a line protocol switch.
+// The constructor takes functional arguments for configuring the switch.
+func NewLineProtocol(options ...func(*LineProtocol)) *LineProtocol {
+
+	l := &LineProtocol{
+		name:  "My Arduino Switch",
+		ports: make(map[string]*port),
+		spConfig: serialport.Config{
+			Name:        "/dev/ttyUSB0",
+			Baudrate:    9600,
+			ReadTimeout: time.Millisecond * 100,
+		},
+		pollingInterval:   time.Second,
+		reconnectInterval: time.Second,
+		timeout:           time.Second * 3,
+		responseCh:        make(chan struct{}),
+		closeCh:           make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(l)
+	}
+
+	return l
+}
+
+// Init validates the protocol, opens the connection to the device and,
+// if the device can be queried, waits for its first response.
+func (l *LineProtocol) Init() error {
+
+	if err := l.validateProtocol(); err != nil {
+		return err
+	}
+
+	l.name = l.switchConfig.Name
+	l.index = l.switchConfig.Index
+	l.exclusive = l.switchConfig.Exclusive
+
+	for _, pConfig := range l.switchConfig.Ports {
+		if _, portNameExists := l.ports[pConfig.Name]; portNameExists {
+			return fmt.Errorf("portname %s already exists", pConfig.Name)
+		}
+		p := &port{
+			name:      pConfig.Name,
+			id:        pConfig.ID,
+			terminals: make(map[string]*terminal),
+			exclusive: pConfig.Exclusive,
+			index:     pConfig.Index,
+		}
+		if len(p.id) == 0 {
+			p.id = p.name
+		}
+
+		for _, tConfig := range pConfig.Terminals {
+			if _, ok := p.terminals[tConfig.Name]; ok {
+				return fmt.Errorf("terminal %s already exists on port %s",
+					tConfig.Name, pConfig.Name)
+			}
+			t := &terminal{
+				name:  tConfig.Name,
+				id:    tConfig.ID,
+				index: tConfig.Index,
+			}
+			if len(t.id) == 0 {
+				t.id = t.name
+			}
+			p.terminals[tConfig.Name] = t
+		}
+
+		l.ports[pConfig.Name] = p
+	}
+
+	if len(l.ports) == 0 {
+		return fmt.Errorf("no ports configured")
+	}
+
+	if err := l.connect(); err != nil {
+		return err
+	}
+
+	go l.start()
+
+	if len(l.protocol.Query) == 0 {
+		// the state of the device is unknown; all terminals are
+		// assumed to be off
+		l.Lock()
+		l.initialized = true
+		l.lastSeen = time.Now()
+		l.Unlock()
+		return nil
+	}
+
+	if err := l.query(); err != nil {
+		l.Close()
+		return fmt.Errorf("unable to query %s: %v", l.name, err)
+	}
+
+	select {
+	case <-l.responseCh:
+	case <-time.After(l.timeout):
+		l.Close()
+		return fmt.Errorf("no valid response from %s within %v", l.name, l.timeout)
+	}
+
+	l.Lock()
+	l.initialized = true
+	l.watchdogTs = time.Now()
+	l.Unlock()
+
+	return nil
+}
+
+// connect opens the serial port or the TCP connection to the device.
+func (l *LineProtocol) connect() error {
+
+	sp, err := serialport.Open(l.spConfig)
+	if err != nil {
+		return err
+	}
+
+	l.spWrite.Lock()
+	defer l.spWrite.Unlock()
+
+	select {
+	case <-l.closeCh:
+		sp.Close()
+		return fmt.Errorf("%s has been closed", l.name)
+	default:
+	}
+
+	l.sp = sp
+	l.spReader = bufio.NewReader(sp)
+
+	return nil
+}
+
+// closePort closes the connection to the device. A pending read returns
+// with an error.
+func (l *LineProtocol) closePort() {
+	l.spWrite.Lock()
+	defer l.spWrite.Unlock()
+
+	if l.sp != nil {
+		l.sp.Close()
+		l.sp = nil
+	}
+}
+
+// validateProtocol checks the protocol and compiles the response regex.
+func (l *LineProtocol) validateProtocol() error {
+
+	p := &l.protocol
+
+	if len(p.On) == 0 {
+		p.On = "1"
+	}
+	if len(p.Off) == 0 {
+		p.Off = "0"
+	}
+	if p.On == p.Off {
+		return fmt.Errorf("on and off must be different")
+	}
+
+	if len(p.Set) == 0 {
+		return fmt.Errorf("missing set command")
+	}
+
+	if len(p.Response) == 0 {
+		if len(p.Query) > 0 {
+			return fmt.Errorf("a response regex is required if the device is queried")
+		}
+		return nil
+	}
+
+	re, err := regexp.Compile(p.Response)
+	if err != nil {
+		return fmt.Errorf("invalid response regex: %v", err)
+	}
+
+	if re.SubexpIndex("terminal") < 0 {
+		return fmt.Errorf("response regex %s lacks the group (?P<terminal>...)", p.Response)
+	}
+
+	l.response = re
+
+	return nil
+}
+
+// Name returns the Name of this switch.
+func (l *LineProtocol) Name() string {
+	l.Lock()
+	defer l.Unlock()
+	return l.name
+}
+
+// SetPort sets the Terminals of a particular Port. The portRequest
+// can contain n terminals.
+func (l *LineProtocol) SetPort(portRequest sw.Port) error {
+	l.Lock()
+	defer l.Unlock()
+
+	// ensure that the requested port exists
+	p, ok := l.ports[portRequest.Name]
+	if !ok {
+		return fmt.Errorf("%s is an invalid port", portRequest.Name)
+	}
+
+	// ensure that the requested terminal exists
+	for _, t := range portRequest.Terminals {
+		if _, ok := p.terminals[t.Name]; !ok {
+			return fmt.Errorf("%s is an invalid terminal", t.Name)
+		}
+	}
+
+	// if LineProtocol.exclusive is true, a particular terminal can only
+	// be active on one port
+	if l.exclusive {
+		for prtName, prt := range l.ports {
+
+			// only check the remaining ports
+			if prtName == portRequest.Name {
+				continue
+			}
+
+			for _, t := range portRequest.Terminals {
+				if r, found := prt.terminals[t.Name]; found && r.state && t.State {
+					return fmt.Errorf("terminal %s in use by port %s",
+						t.Name, prtName)
+				}
+			}
+		}
+	}
+
+	// if port.exclusive is enabled, only one terminal can be active
+	// on this port.
+	if p.exclusive {
+		activate := make(map[string]bool)
+		for _, t := range portRequest.Terminals {
+			if t.State {
+				activate[t.Name] = true
+			}
+		}
+
+		// deactivate all other terminals on this port; terminals which
+		// are requested to be active are not touched to avoid chattering
+		for _, t := range p.terminals {
+			if !t.state || activate[t.name] {
+				continue
+			}
+			if err := l.setState(p, t, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, t := range portRequest.Terminals {
+		if err := l.setState(p, p.terminals[t.Name], t.State); err != nil {
+			return err
+		}
+	}
+
+	if len(l.protocol.Query) == 0 {
+		l.lastSeen = time.Now()
+	} else if err := l.query(); err != nil {
+		// confirm the new state immediately
+		l.lastError = err.Error()
+		return err
+	}
+
+	if l.eventHandler != nil {
+		device := l.serialize()
+		go l.eventHandler(l, device)
+	}
+
+	return nil
+}
+
+// setState sends the set command for a terminal to the device. This
+// method is not threadsafe.
+func (l *LineProtocol) setState(p *port, t *terminal, state bool) error {
+
+	s := l.protocol.Off
+	if state {
+		s = l.protocol.On
+	}
+
+	cmd := strings.NewReplacer(
+		"{port}", p.id,
+		"{terminal}", t.id,
+		"{state}", s,
+	).Replace(l.protocol.Set)
+
+	if _, err := l.write([]byte(cmd)); err != nil {
+		l.lastError = err.Error()
+		return err
+	}
+
+	t.state = state
+
+	return nil
+}
+
+// GetPort returns switch.Port struct containing the current state of
+// the requested port.
+func (l *LineProtocol) GetPort(portName string) (sw.Port, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	p, ok := l.ports[portName]
+	if !ok {
+		return sw.Port{}, fmt.Errorf("%s in an invalid port", portName)
+	}
+
+	return p.serialize(), nil
+}
+
+// Serialize returns a switch.Device struct containing the current
+// state and configuration of this switch.
+func (l *LineProtocol) Serialize() sw.Device {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.serialize()
+}
+
+// serialize returns a switch.Port struct containing the current
+// state and configuration of this port. This method
+// is not threadsafe.
+func (p *port) serialize() sw.Port {
+	swPort := sw.Port{
+		Name:      p.name,
+		Index:     p.index,
+		Exclusive: p.exclusive,
+		Terminals: []sw.Terminal{},
+	}
+
+	for _, r := range p.terminals {
+		t := sw.Terminal{
+			Name:  r.name,
+			Index: r.index,
+			State: r.state,
+		}
+		swPort.Terminals = append(swPort.Terminals, t)
+	}
+
+	// sort the Terminals by index
+	sort.Slice(swPort.Terminals, func(i, j int) bool {
+		return swPort.Terminals[i].Index < swPort.Terminals[j].Index
+	})
+
+	return swPort
+}
+
+// Health returns the health of the connection to the device. Devices
+// which can be queried are considered online as long as they respond;
+// all other devices as long as the commands can be sent.
+func (l *LineProtocol) Health() sw.Health {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.health()
+}
+
+// health returns the health of the connection to the device. This
+// method is not threadsafe.
+func (l *LineProtocol) health() sw.Health {
+
+	online := l.initialized && len(l.lastError) == 0
+	lastSeen := l.lastSeen
+
+	if len(l.protocol.Query) > 0 {
+		online = online && time.Since(l.watchdogTs) <= 5*l.pollingInterval
+		lastSeen = l.watchdogTs
+	}
+
+	return sw.Health{
+		Online:   online,
+		LastSeen: lastSeen,
+		Error:    l.lastError,
+		Model:    "Line Protocol",
+	}
+}
+
+// serialize returns a switch.Device struct containing the current
+// state and configuration of this switch. This method
+// is not threadsafe.
+func (l *LineProtocol) serialize() sw.Device {
+
+	health := l.health()
+
+	dev := sw.Device{
+		Name:      l.name,
+		Index:     l.index,
+		Exclusive: l.exclusive,
+		Health:    &health,
+	}
+
+	// serialize all ports
+	for _, p := range l.ports {
+		swPort := p.serialize()
+		dev.Ports = append(dev.Ports, swPort)
+	}
+
+	// sort the ports by index
+	sort.Slice(dev.Ports, func(i, j int) bool {
+		return dev.Ports[i].Index < dev.Ports[j].Index
+	})
+
+	return dev
+}
+
+// start reads the lines received from the device and polls it until the
+// switch is closed. If the connection fails (e.g. the device has been
+// unplugged), the device is reported offline and the connection is
+// re-established with an increasing delay.
+func (l *LineProtocol) start() {
+
+	for {
+		err := l.serve()
+
+		select {
+		case <-l.closeCh:
+			return
+		default:
+		}
+
+		log.Printf("line protocol %s: %v", l.Name(), err)
+		l.closePort()
+
+		l.Lock()
+		l.lastError = err.Error()
+		if l.initialized && l.eventHandler != nil {
+			device := l.serialize()
+			go l.eventHandler(l, device)
+		}
+		l.Unlock()
+
+		if !serialport.Reconnect(l.closeCh, l.reconnectInterval, l.reconnect) {
+			return
+		}
+
+		log.Printf("line protocol %s: reconnected", l.Name())
+	}
+}
+
+// reconnect re-establishes the connection to the device. Devices which
+// are queried are online again with their first valid response, all
+// other devices as soon as the connection is open.
+func (l *LineProtocol) reconnect() error {
+
+	if err := l.connect(); err != nil {
+		l.Lock()
+		l.lastError = fmt.Sprintf("unable to reconnect: %v", err)
+		l.Unlock()
+		return err
+	}
+
+	if len(l.protocol.Query) > 0 {
+		if err := l.query(); err != nil {
+			l.closePort()
+			return err
+		}
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.lastError = ""
+	l.lastSeen = time.Now()
+	if l.initialized && l.eventHandler != nil {
+		device := l.serialize()
+		go l.eventHandler(l, device)
+	}
+
+	return nil
+}
+
+// serve reads the lines received from the device and polls it until the
+// connection fails or the switch is closed.
+func (l *LineProtocol) serve() error {
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	pollErr := make(chan error, 1)
+
+	// the polling has to be stopped before the port can be reopened
+	defer wg.Wait()
+	defer close(done)
+
+	if len(l.protocol.Query) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.poll(done); err != nil {
+				pollErr <- err
+				// abort the pending read
+				l.closePort()
+			}
+		}()
+	}
+
+	for {
+		msg, err := l.read()
+
+		select {
+		case err := <-pollErr:
+			return err
+		case <-l.closeCh:
+			return nil
+		default:
+		}
+
+		if err != nil {
+			return fmt.Errorf("read error: %v", err)
+		}
+		l.parseMsg(msg)
+	}
+}
+
+// poll queries the device for its state and checks the watchdog until
+// done is closed or the switch is closed.
+func (l *LineProtocol) poll(done <-chan struct{}) error {
+
+	started := time.Now()
+	ticker := time.NewTicker(l.pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.query(); err != nil {
+				return fmt.Errorf("write error: %v", err)
+			}
+			if l.checkWatchdog(started) {
+				return fmt.Errorf("communication lost with device")
+			}
+		case <-done:
+			return nil
+		// when closing has been signaled, stop polling and return
+		case <-l.closeCh:
+			return nil
+		}
+	}
+}
+
+// checkWatchdog returns true if no valid response has been received
+// since the polling started for more than 5x the polling interval.
+func (l *LineProtocol) checkWatchdog(started time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	last := l.watchdogTs
+	if last.Before(started) {
+		last = started
+	}
+	return time.Since(last) > 5*l.pollingInterval
+}
+
+// read returns the next non-empty line received from the device. Serial
+// ports return io.EOF after their read timeout; this is not an error.
+func (l *LineProtocol) read() (string, error) {
+
+	isConn := serialport.IsNetwork(l.spConfig.Name)
+	msg := ""
+
+	for {
+		chunk, err := l.spReader.ReadString('\n')
+		msg += chunk
+		if err == io.EOF && !isConn {
+			select {
+			case <-l.closeCh:
+				return "", err
+			default:
+			}
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		msg = strings.TrimRight(msg, "\r\n")
+		if len(msg) > 0 {
+			return msg, nil
+		}
+	}
+}
+
+// query sends the Query command to the device.
+func (l *LineProtocol) query() error {
+	_, err := l.write([]byte(l.protocol.Query))
+	return err
+}
+
+// all functions write to the device through this wrapper function
+func (l *LineProtocol) write(data []byte) (int, error) {
+	l.spWrite.Lock()
+	defer l.spWrite.Unlock()
+	if l.sp == nil {
+		return 0, fmt.Errorf("not connected to %s", l.name)
+	}
+	return l.sp.Write(data)
+}
+
+// parseMsg matches a line received from the device against the response
+// regex and updates the state of the terminals. Lines which don't match
+// (e.g. debug output) are ignored.
+func (l *LineProtocol) parseMsg(msg string) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.response == nil {
+		return
+	}
+
+	matches := l.response.FindAllStringSubmatch(msg, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	changed := false
+	for _, m := range matches {
+		if l.applyMatch(m) {
+			changed = true
+		}
+	}
+
+	l.watchdogTs = time.Now()
+	l.lastSeen = l.watchdogTs
+	if len(l.lastError) > 0 {
+		l.lastError = ""
+		changed = true
+	}
+
+	if !l.initialized {
+		close(l.responseCh)
+		l.initialized = true
+		return
+	}
+
+	if changed && l.eventHandler != nil {
+		device := l.serialize()
+		go l.eventHandler(l, device)
+	}
+}
+
+// applyMatch applies a match of the response regex to the terminals and
+// returns true if the state of a terminal has changed. This method is
+// not threadsafe.
+func (l *LineProtocol) applyMatch(m []string) bool {
+
+	group := func(name string) (string, bool) {
+		i := l.response.SubexpIndex(name)
+		if i < 0 {
+			return "", false
+		}
+		return m[i], true
+	}
+
+	terminalID, _ := group("terminal")
+	portID, hasPort := group("port")
+	stateStr, hasState := group("state")
+
+	state := true
+	if hasState {
+		switch stateStr {
+		case l.protocol.On:
+		case l.protocol.Off:
+			state = false
+		default:
+			return false
+		}
+	}
+
+	changed := false
+
+	for _, p := range l.ports {
+		if hasPort && p.id != portID {
+			continue
+		}
+		for _, t := range p.terminals {
+			var newState bool
+			switch {
+			case t.id == terminalID:
+				newState = state
+			case !hasState:
+				// the match reports the selected terminal of the port
+				newState = false
+			default:
+				continue
+			}
+			if t.state != newState {
+				t.state = newState
+				changed = true
+			}
+		}
+	}
+
+	return changed
+}
+
+// Close stops polling and closes the connection to the device. The state
+// of the device is not modified.
+func (l *LineProtocol) Close() {
+	l.closer.Do(func() {
+		close(l.closeCh)
+		l.closePort()
+	})
+}
@@ -0,0 +1,441 @@
+package lineprotocol
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/internal/switchtest"
+)
+
+// fakeDevice emulates an Arduino with 4 relays on a TCP port. It
+// understands the commands "R<n>=<0|1>" and "S?", which is answered
+// with "S 1=0 2=1 3=0 4=0".
+type fakeDevice struct {
+	sync.Mutex
+	ln       net.Listener
+	conns    []net.Conn
+	relays   [4]bool
+	commands []string
+	silent   bool
+}
+
+func newFakeDevice(t *testing.T) *fakeDevice {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakeDevice{ln: ln}
+	t.Cleanup(d.close)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			d.Lock()
+			d.conns = append(d.conns, conn)
+			d.Unlock()
+			go d.serve(conn)
+		}
+	}()
+
+	return d
+}
+
+func (d *fakeDevice) addr() string {
+	return d.ln.Addr().String()
+}
+
+func (d *fakeDevice) serve(conn net.Conn) {
+
+	r := bufio.NewScanner(conn)
+	for r.Scan() {
+		cmd := r.Text()
+
+		d.Lock()
+		d.commands = append(d.commands, cmd)
+		silent := d.silent
+
+		var relay, state int
+		if n, _ := fmt.Sscanf(cmd, "R%d=%d", &relay, &state); n == 2 && relay >= 1 && relay <= 4 {
+			d.relays[relay-1] = state == 1
+		}
+		status := d.status()
+		d.Unlock()
+
+		if cmd == "S?" && !silent {
+			fmt.Fprintf(conn, "debug: query received\r\n%s\r\n", status)
+		}
+	}
+}
+
+// status returns the status line of the device. Must be called with the
+// lock held.
+func (d *fakeDevice) status() string {
+	s := "S"
+	for i, r := range d.relays {
+		state := 0
+		if r {
+			state = 1
+		}
+		s += fmt.Sprintf(" %d=%d", i+1, state)
+	}
+	return s
+}
+
+// setRelay changes a relay like the button on the front panel.
+func (d *fakeDevice) setRelay(n int, state bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.relays[n-1] = state
+}
+
+func (d *fakeDevice) setSilent(silent bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.silent = silent
+}
+
+// setCommands returns the set commands received so far and clears them.
+func (d *fakeDevice) setCommands() []string {
+	d.Lock()
+	defer d.Unlock()
+
+	cmds := []string{}
+	for _, c := range d.commands {
+		if strings.HasPrefix(c, "R") {
+			cmds = append(cmds, c)
+		}
+	}
+	d.commands = nil
+	return cmds
+}
+
+func (d *fakeDevice) close() {
+	d.ln.Close()
+	d.Lock()
+	defer d.Unlock()
+	for _, c := range d.conns {
+		c.Close()
+	}
+}
+
+var testConfig = SwitchConfig{
+	Name: "Arduino",
+	Ports: []PortConfig{
+		{
+			Name:      "Antenna",
+			Exclusive: true,
+			Terminals: []TerminalConfig{
+				{Name: "Yagi", ID: "1", Index: 0},
+				{Name: "Dipole", ID: "2", Index: 1},
+				{Name: "Vertical", ID: "3", Index: 2},
+			},
+		},
+		{
+			Name: "Aux",
+			Terminals: []TerminalConfig{
+				{Name: "Preamp", ID: "4", Index: 0},
+			},
+		},
+	},
+}
+
+var testProtocol = ProtocolConfig{
+	Set:      "R{terminal}={state}\n",
+	Query:    "S?\n",
+	Response: `(?P<terminal>\d)=(?P<state>[01])`,
+}
+
+func newTestSwitch(t *testing.T, portname string, opts ...func(*LineProtocol)) (*LineProtocol, chan sw.Device) {
+	t.Helper()
+
+	handler, events := switchtest.Events()
+
+	opts = append([]func(*LineProtocol){
+		Switch(testConfig),
+		Protocol(testProtocol),
+		Portname(portname),
+		PollingInterval(time.Millisecond * 20),
+		Timeout(time.Millisecond * 200),
+		EventHandler(handler),
+	}, opts...)
+
+	l := NewLineProtocol(opts...)
+	switchtest.Init(t, l)
+
+	return l, events
+}
+
+func TestLineProtocol_validateProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol ProtocolConfig
+		wantErr  bool
+	}{
+		{"valid", testProtocol, false},
+		{"set only", ProtocolConfig{Set: "R{terminal}={state}\n"}, false},
+		{"response without query", ProtocolConfig{Set: "R{terminal}={state}\n", Response: `(?P<terminal>\d)=(?P<state>[01])`}, false},
+		{"missing set", ProtocolConfig{Query: "S?\n", Response: `(?P<terminal>\d)`}, true},
+		{"query without response", ProtocolConfig{Set: "R{terminal}={state}\n", Query: "S?\n"}, true},
+		{"invalid regex", ProtocolConfig{Set: "R{terminal}={state}\n", Query: "S?\n", Response: `(?P<terminal>\d`}, true},
+		{"missing terminal group", ProtocolConfig{Set: "R{terminal}={state}\n", Query: "S?\n", Response: `(\d)=([01])`}, true},
+		{"on equals off", ProtocolConfig{Set: "R{terminal}={state}\n", On: "X", Off: "X"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLineProtocol(Protocol(tt.protocol))
+			if err := l.validateProtocol(); (err != nil) != tt.wantErr {
+				t.Errorf("validateProtocol() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLineProtocol_Init(t *testing.T) {
+
+	dev := newFakeDevice(t)
+
+	silentDev := newFakeDevice(t)
+	silentDev.setSilent(true)
+
+	tests := []struct {
+		name    string
+		opts    []func(*LineProtocol)
+		wantErr bool
+	}{
+		{"valid", []func(*LineProtocol){Switch(testConfig), Protocol(testProtocol), Portname(dev.addr())}, false},
+		{"no ports", []func(*LineProtocol){Protocol(testProtocol), Portname(dev.addr())}, true},
+		{"terminal exists twice", []func(*LineProtocol){Protocol(testProtocol), Portname(dev.addr()), Switch(SwitchConfig{
+			Name: "Switch",
+			Ports: []PortConfig{{Name: "A", Terminals: []TerminalConfig{
+				{Name: "Yagi", ID: "1"},
+				{Name: "Yagi", ID: "2"},
+			}}},
+		})}, true},
+		{"invalid protocol", []func(*LineProtocol){Switch(testConfig), Protocol(ProtocolConfig{}), Portname(dev.addr())}, true},
+		{"device not responding", []func(*LineProtocol){Switch(testConfig), Protocol(testProtocol),
+			Portname(silentDev.addr()), Timeout(time.Millisecond * 50)}, true},
+		{"device not reachable", []func(*LineProtocol){Switch(testConfig), Protocol(testProtocol),
+			Portname("127.0.0.1:1")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLineProtocol(tt.opts...)
+			defer l.Close()
+			if err := l.Init(); (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLineProtocol_applyMatch(t *testing.T) {
+
+	config := SwitchConfig{
+		Name: "Switch",
+		Ports: []PortConfig{
+			{Name: "A", ID: "a", Terminals: []TerminalConfig{{Name: "1"}, {Name: "2"}}},
+			{Name: "B", ID: "b", Terminals: []TerminalConfig{{Name: "1"}, {Name: "2"}}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		response    string
+		msg         string
+		wantChanged bool
+		want        map[string][]bool // terminal states 1, 2 by port
+	}{
+		{"state on all ports", `(?P<terminal>\d)=(?P<state>[01])`, "1=0 2=1", true,
+			map[string][]bool{"A": {false, true}, "B": {false, true}}},
+		{"state on one port", `(?P<port>[ab])(?P<terminal>\d)=(?P<state>[01])`, "a2=1", true,
+			map[string][]bool{"A": {false, true}, "B": {false, false}}},
+		{"selection", `(?P<port>[ab]):(?P<terminal>\d)`, "b:2", true,
+			map[string][]bool{"A": {false, false}, "B": {false, true}}},
+		{"invalid state", `(?P<terminal>\d)=(?P<state>\w)`, "1=X", false,
+			map[string][]bool{"A": {false, false}, "B": {false, false}}},
+		{"unknown terminal", `(?P<terminal>\d)=(?P<state>[01])`, "7=1", false,
+			map[string][]bool{"A": {false, false}, "B": {false, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLineProtocol(Switch(config), Protocol(ProtocolConfig{
+				Set:      "{port}{terminal}={state}\n",
+				Response: tt.response,
+			}))
+			if err := l.validateProtocol(); err != nil {
+				t.Fatal(err)
+			}
+			for _, pc := range config.Ports {
+				p := &port{name: pc.Name, id: pc.ID, terminals: map[string]*terminal{}}
+				for _, tc := range pc.Terminals {
+					p.terminals[tc.Name] = &terminal{name: tc.Name, id: tc.Name}
+				}
+				l.ports[pc.Name] = p
+			}
+
+			changed := false
+			for _, m := range l.response.FindAllStringSubmatch(tt.msg, -1) {
+				if l.applyMatch(m) {
+					changed = true
+				}
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("applyMatch() = %v, want %v", changed, tt.wantChanged)
+			}
+
+			for portName, want := range tt.want {
+				p := l.ports[portName]
+				got := []bool{p.terminals["1"].state, p.terminals["2"].state}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("port %s = %v, want %v", portName, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLineProtocol_SetPort(t *testing.T) {
+
+	dev := newFakeDevice(t)
+	dev.setRelay(2, true)
+
+	l, _ := newTestSwitch(t, dev.addr())
+
+	// the initial state has been read from the device
+	if !switchtest.TerminalState(t, l, "Antenna", "Dipole") {
+		t.Fatal("Dipole should be active")
+	}
+
+	tests := []struct {
+		name    string
+		req     sw.Port
+		want    []string
+		wantErr bool
+	}{
+		{"select yagi", sw.Port{Name: "Antenna", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}},
+			[]string{"R2=0", "R1=1"}, false},
+		{"select yagi again", sw.Port{Name: "Antenna", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}},
+			[]string{"R1=1"}, false},
+		{"preamp on", sw.Port{Name: "Aux", Terminals: []sw.Terminal{{Name: "Preamp", State: true}}},
+			[]string{"R4=1"}, false},
+		{"invalid port", sw.Port{Name: "Rotator"}, []string{}, true},
+		{"invalid terminal", sw.Port{Name: "Antenna", Terminals: []sw.Terminal{{Name: "Loop", State: true}}},
+			[]string{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev.setCommands()
+			if err := l.SetPort(tt.req); (err != nil) != tt.wantErr {
+				t.Fatalf("SetPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// the query which follows the commands has been received
+			// once the device answered
+			time.Sleep(time.Millisecond * 20)
+			if got := dev.setCommands(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if switchtest.TerminalState(t, l, "Antenna", "Dipole") || !switchtest.TerminalState(t, l, "Antenna", "Yagi") {
+		t.Error("Yagi should be the only active antenna")
+	}
+}
+
+func TestLineProtocol_externalChange(t *testing.T) {
+
+	dev := newFakeDevice(t)
+	l, events := newTestSwitch(t, dev.addr())
+
+	// changed with the button on the device
+	dev.setRelay(3, true)
+
+	switchtest.Eventually(t, func() bool { return switchtest.TerminalState(t, l, "Antenna", "Vertical") })
+
+	select {
+	case d := <-events:
+		if !d.Health.Online {
+			t.Error("device should be online")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+}
+
+func TestLineProtocol_reconnect(t *testing.T) {
+
+	dev := newFakeDevice(t)
+
+	l, events := newTestSwitch(t, dev.addr(), ReconnectInterval(time.Millisecond*10))
+
+	if h := l.Health(); !h.Online {
+		t.Fatalf("device should be online: %+v", h)
+	}
+
+	dev.setSilent(true)
+
+	switchtest.Eventually(t, func() bool {
+		h := l.Health()
+		return !h.Online && len(h.Error) > 0
+	})
+
+	offline := false
+	for len(events) > 0 && !offline {
+		d := <-events
+		offline = !d.Health.Online
+	}
+	if !offline {
+		t.Error("lost connection not reported through an event")
+	}
+
+	dev.setSilent(false)
+
+	switchtest.Eventually(t, func() bool { return l.Health().Online })
+
+	dev.Lock()
+	conns := len(dev.conns)
+	dev.Unlock()
+	if conns < 2 {
+		t.Errorf("%d connections, the connection should have been re-established", conns)
+	}
+
+	// changed with the button on the device
+	dev.setRelay(3, true)
+	switchtest.Eventually(t, func() bool { return switchtest.TerminalState(t, l, "Antenna", "Vertical") })
+}
+
+func TestLineProtocol_withoutQuery(t *testing.T) {
+
+	dev := newFakeDevice(t)
+
+	l, _ := newTestSwitch(t, dev.addr(), Protocol(ProtocolConfig{
+		Set: "R{terminal}={state}\n",
+	}))
+
+	req := sw.Port{Name: "Antenna", Terminals: []sw.Terminal{{Name: "Dipole", State: true}}}
+	if err := l.SetPort(req); err != nil {
+		t.Fatal(err)
+	}
+
+	switchtest.Eventually(t, func() bool { return len(dev.setCommands()) > 0 })
+
+	if !switchtest.TerminalState(t, l, "Antenna", "Dipole") {
+		t.Error("Dipole should be active")
+	}
+	if h := l.Health(); !h.Online {
+		t.Errorf("device should be online: %+v", h)
+	}
+}
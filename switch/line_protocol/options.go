@@ -0,0 +1,134 @@
+package lineprotocol
+
+import (
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+)
+
+// Switch is a functional option to set the switch's configuration.
+func Switch(sc SwitchConfig) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.switchConfig = sc
+	}
+}
+
+// SwitchConfig describes a switch which is a collection of ports.
+type SwitchConfig struct {
+	Name      string
+	Index     int
+	Exclusive bool
+	Ports     []PortConfig
+}
+
+// PortConfig describes a port which is a collection of terminals. The ID
+// is the identifier of the port in the protocol; it defaults to the Name.
+type PortConfig struct {
+	Name      string
+	ID        string
+	Index     int
+	Exclusive bool
+	Terminals []TerminalConfig
+}
+
+// TerminalConfig describes a terminal. The ID is the identifier of the
+// terminal in the protocol (e.g. the number of a relay); it defaults to
+// the Name.
+type TerminalConfig struct {
+	Name  string
+	ID    string
+	Index int
+}
+
+// ProtocolConfig describes the line based text protocol of the device.
+type ProtocolConfig struct {
+	// Set is the template of the command which sets a terminal (e.g.
+	// "R{terminal}={state}\n"). The placeholders {port}, {terminal} and
+	// {state} are replaced by the ID of the port, the ID of the terminal
+	// and On or Off.
+	Set string
+	// Query is the command which requests the state of the terminals
+	// (e.g. "S?\n"). If empty, the device is not polled and the state of
+	// the terminals is derived from the commands sent to the device.
+	Query string
+	// Response is a regular expression which is matched against each
+	// line received from the device. It must contain the named group
+	// "terminal" and may contain the groups "state" and "port". Without
+	// a "state" group, a match selects the terminal and deselects all
+	// other terminals of the port. A line may contain several matches.
+	// Devices which aren't queried can still report changes (e.g. made
+	// with a button) with lines matching the regex.
+	Response string
+	// On and Off represent the states of a terminal in the commands and
+	// responses (default: "1" and "0").
+	On  string
+	Off string
+}
+
+// Protocol is a functional option to set the protocol of the device.
+func Protocol(p ProtocolConfig) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.protocol = p
+	}
+}
+
+// Portname is a functional option to set the serial port to which the
+// device is connected. Portnames in the form host:port are opened as a
+// TCP connection (e.g. to an ESP8266 or a serial server).
+func Portname(portname string) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.spConfig.Name = portname
+	}
+}
+
+// Device is a functional option to select the serial port by the
+// properties of the USB device (e.g. its serial number) instead of its
+// portname, which depends on the order in which the USB serial devices
+// have been enumerated. The port is looked up on every (re)connect.
+func Device(m serialport.Match) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.spConfig.Match = m
+	}
+}
+
+// Baudrate is a functional option to set the baudrate of the serial port.
+func Baudrate(baudrate int) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.spConfig.Baudrate = baudrate
+	}
+}
+
+// PollingInterval is a functional option to set the interval in which
+// the Query command is sent to the device. The connection is considered
+// lost if no valid response has been received for 5 polling intervals.
+func PollingInterval(d time.Duration) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.pollingInterval = d
+	}
+}
+
+// Timeout is a functional option to set the time Init waits for the
+// first response of the device.
+func Timeout(d time.Duration) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.timeout = d
+	}
+}
+
+// EventHandler sets a callback function through which the switch
+// will report Events
+func EventHandler(h func(sw.Switcher, sw.Device)) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.eventHandler = h
+	}
+}
+
+// ReconnectInterval is a functional option to set the delay before the
+// first attempt to reconnect to the device after the connection has been
+// lost. The delay doubles with each failed attempt.
+func ReconnectInterval(d time.Duration) func(*LineProtocol) {
+	return func(l *LineProtocol) {
+		l.reconnectInterval = d
+	}
+}
@@ -0,0 +1,326 @@
+package modbusrelay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+)
+
+// Modbus function codes used by the driver
+const (
+	fcReadCoils          = 0x01
+	fcWriteSingleCoil    = 0x05
+	fcWriteMultipleCoils = 0x0F
+)
+
+// Modbus exception codes
+const (
+	exIllegalFunction    = 0x01
+	exIllegalDataAddress = 0x02
+	exIllegalDataValue   = 0x03
+)
+
+// ModbusError is returned if the device responded with an exception.
+type ModbusError struct {
+	FunctionCode  byte
+	ExceptionCode byte
+}
+
+func (e *ModbusError) Error() string {
+	return fmt.Sprintf("modbus exception %d on function %d", e.ExceptionCode, e.FunctionCode)
+}
+
+// transport sends a request PDU (function code + data) to a unit and
+// returns the response PDU. Broken connections are closed and
+// re-established with the next request.
+type transport interface {
+	send(unitID byte, pdu []byte) ([]byte, error)
+	close() error
+}
+
+// readCoils reads quantity coils starting at address.
+func readCoils(t transport, unitID byte, address, quantity uint16) ([]bool, error) {
+
+	req := make([]byte, 5)
+	req[0] = fcReadCoils
+	binary.BigEndian.PutUint16(req[1:], address)
+	binary.BigEndian.PutUint16(req[3:], quantity)
+
+	resp, err := request(t, unitID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	byteCount := (int(quantity) + 7) / 8
+	if len(resp) != 2+byteCount || int(resp[1]) != byteCount {
+		return nil, fmt.Errorf("invalid response length %d for %d coils", len(resp), quantity)
+	}
+
+	return unpackCoils(resp[2:], int(quantity)), nil
+}
+
+// writeCoil sets a single coil.
+func writeCoil(t transport, unitID byte, address uint16, state bool) error {
+
+	req := make([]byte, 5)
+	req[0] = fcWriteSingleCoil
+	binary.BigEndian.PutUint16(req[1:], address)
+	if state {
+		binary.BigEndian.PutUint16(req[3:], 0xFF00)
+	}
+
+	resp, err := request(t, unitID, req)
+	if err != nil {
+		return err
+	}
+
+	// the response echoes the request
+	if len(resp) != len(req) || string(resp) != string(req) {
+		return fmt.Errorf("invalid response to write coil %d", address)
+	}
+
+	return nil
+}
+
+// request sends the request PDU and checks the response for exceptions.
+func request(t transport, unitID byte, req []byte) ([]byte, error) {
+
+	resp, err := t.send(unitID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("empty response")
+	}
+
+	if resp[0] == req[0]|0x80 {
+		if len(resp) != 2 {
+			return nil, fmt.Errorf("invalid exception response")
+		}
+		return nil, &ModbusError{FunctionCode: req[0], ExceptionCode: resp[1]}
+	}
+
+	if resp[0] != req[0] {
+		return nil, fmt.Errorf("unexpected function code %d in response", resp[0])
+	}
+
+	return resp, nil
+}
+
+func packCoils(coils []bool) []byte {
+	b := make([]byte, (len(coils)+7)/8)
+	for i, c := range coils {
+		if c {
+			b[i/8] |= 1 << (uint(i) % 8)
+		}
+	}
+	return b
+}
+
+func unpackCoils(b []byte, quantity int) []bool {
+	coils := make([]bool, quantity)
+	for i := range coils {
+		coils[i] = b[i/8]&(1<<(uint(i)%8)) != 0
+	}
+	return coils
+}
+
+// crc16 calculates the Modbus RTU checksum.
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// retry returns true if a request which failed on a previously opened
+// connection should be repeated once on a new connection. This is the
+// case if the connection has been closed by the peer (e.g. after a
+// restart of the device). Timeouts are not repeated since the device
+// most likely won't respond either.
+func retry(err error) bool {
+	return !errors.Is(err, serialport.ErrTimeout)
+}
+
+// tcpTransport implements Modbus TCP (MBAP header).
+type tcpTransport struct {
+	address       string
+	timeout       time.Duration
+	conn          net.Conn
+	transactionID uint16
+}
+
+func (t *tcpTransport) send(unitID byte, pdu []byte) ([]byte, error) {
+
+	reused := t.conn != nil
+
+	if t.conn == nil {
+		conn, err := net.DialTimeout("tcp", t.address, t.timeout)
+		if err != nil {
+			return nil, err
+		}
+		t.conn = conn
+	}
+
+	resp, err := t.exchange(unitID, pdu)
+	if err != nil {
+		// the stream might be out of sync; start over with a new connection
+		t.close()
+		if reused && retry(err) {
+			return t.send(unitID, pdu)
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (t *tcpTransport) exchange(unitID byte, pdu []byte) ([]byte, error) {
+
+	t.transactionID++
+
+	adu := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(adu[0:], t.transactionID)
+	binary.BigEndian.PutUint16(adu[2:], 0) // protocol id
+	binary.BigEndian.PutUint16(adu[4:], uint16(len(pdu)+1))
+	adu[6] = unitID
+	copy(adu[7:], pdu)
+
+	t.conn.SetWriteDeadline(time.Now().Add(t.timeout))
+	if _, err := t.conn.Write(adu); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if err := serialport.ReadFull(t.conn, header, t.timeout); err != nil {
+		return nil, err
+	}
+
+	if id := binary.BigEndian.Uint16(header[0:]); id != t.transactionID {
+		return nil, fmt.Errorf("unexpected transaction id %d, expected %d", id, t.transactionID)
+	}
+
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("invalid length %d in response", length)
+	}
+
+	resp := make([]byte, length-1)
+	if err := serialport.ReadFull(t.conn, resp, t.timeout); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (t *tcpTransport) close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// rtuTransport implements Modbus RTU on a serial port or on a serial
+// server on the network.
+type rtuTransport struct {
+	config  serialport.Config
+	timeout time.Duration
+	port    io.ReadWriteCloser
+}
+
+func (t *rtuTransport) send(unitID byte, pdu []byte) ([]byte, error) {
+
+	reused := t.port != nil
+
+	if t.port == nil {
+		port, err := serialport.Open(t.config)
+		if err != nil {
+			return nil, err
+		}
+		t.port = port
+	}
+
+	resp, err := t.exchange(unitID, pdu)
+	if err != nil {
+		t.close()
+		if reused && retry(err) {
+			return t.send(unitID, pdu)
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (t *rtuTransport) exchange(unitID byte, pdu []byte) ([]byte, error) {
+
+	adu := make([]byte, 0, len(pdu)+3)
+	adu = append(adu, unitID)
+	adu = append(adu, pdu...)
+	adu = binary.LittleEndian.AppendUint16(adu, crc16(adu))
+
+	if _, err := t.port.Write(adu); err != nil {
+		return nil, err
+	}
+
+	// unit id, function code and the first data byte
+	resp := make([]byte, 3)
+	if err := serialport.ReadFull(t.port, resp, t.timeout); err != nil {
+		return nil, err
+	}
+
+	if resp[0] != unitID {
+		return nil, fmt.Errorf("response from unexpected unit %d", resp[0])
+	}
+
+	// the remaining length depends on the function code
+	var remaining int
+	switch {
+	case resp[1]&0x80 != 0:
+		remaining = 2 // exception code (already read) + crc
+	case resp[1] == fcReadCoils:
+		remaining = int(resp[2]) + 2
+	case resp[1] == fcWriteSingleCoil, resp[1] == fcWriteMultipleCoils:
+		remaining = 3 + 2
+	default:
+		return nil, fmt.Errorf("unexpected function code %d in response", resp[1])
+	}
+
+	rest := make([]byte, remaining)
+	if err := serialport.ReadFull(t.port, rest, t.timeout); err != nil {
+		return nil, err
+	}
+	resp = append(resp, rest...)
+
+	n := len(resp) - 2
+	if crc16(resp[:n]) != binary.LittleEndian.Uint16(resp[n:]) {
+		return nil, fmt.Errorf("invalid crc in response")
+	}
+
+	return resp[1:n], nil
+}
+
+func (t *rtuTransport) close() error {
+	if t.port == nil {
+		return nil
+	}
+	err := t.port.Close()
+	t.port = nil
+	return err
+}
@@ -0,0 +1,449 @@
+package modbusrelay
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// ModbusRelay contains the state and configuration of a relay board
+// which is controlled through Modbus TCP or Modbus RTU. Each terminal
+// is mapped to a coil of the board.
+type ModbusRelay struct {
+	sync.Mutex
+	name            string
+	index           int
+	exclusive       bool
+	ports           map[string]*port
+	switchConfig    SwitchConfig
+	eventHandler    func(sw.Switcher, sw.Device)
+	transport       transport
+	bus             sync.Mutex // serializes the requests on the transport
+	model           string
+	unitID          byte
+	pollingInterval time.Duration
+	timeout         time.Duration
+	firstCoil       uint16
+	coilCount       uint16
+	initialized     bool
+	lastSeen        time.Time
+	lastError       string
+	closeCh         chan struct{}
+	closeOnce       sync.Once
+}
+
+// port represents a set of terminals (coils). This struct holds the
+// configuration and state of the port.
+type port struct {
+	name      string
+	terminals map[string]*terminal
+	exclusive bool
+	index     int
+}
+
+// terminal represents a particular coil. This struct holds the
+// configuration and the (logical) state of the terminal.
+type terminal struct {
+	name     string
+	coil     uint16
+	inverted bool
+	state    bool
+	index    int
+}
+
+// NewModbusRelay is the constructor for a Modbus relay board.
+// The constructor takes functional arguments for configuring the switch.
+func NewModbusRelay(options ...func(*ModbusRelay)) *ModbusRelay {
+
+	m := &ModbusRelay{
+		name:            "My Modbus Relay",
+		ports:           make(map[string]*port),
+		model:           "Modbus TCP",
+		unitID:          1,
+		pollingInterval: time.Second,
+		timeout:         time.Second,
+		closeCh:         make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(m)
+	}
+
+	return m
+}
+
+// Init initializes the relay board and reads the current state of the
+// coils. The state of the relays is not modified. An error is returned
+// if the board can not be reached.
+func (m *ModbusRelay) Init() error {
+
+	if m.transport == nil {
+		return fmt.Errorf("no modbus transport (tcp or rtu) configured")
+	}
+
+	switch t := m.transport.(type) {
+	case *tcpTransport:
+		t.timeout = m.timeout
+	case *rtuTransport:
+		t.timeout = m.timeout
+	}
+
+	m.name = m.switchConfig.Name
+	m.index = m.switchConfig.Index
+	m.exclusive = m.switchConfig.Exclusive
+
+	coils := make(map[uint16]string)
+	first, last := -1, -1
+
+	for _, pConfig := range m.switchConfig.Ports {
+		if _, portNameExists := m.ports[pConfig.Name]; portNameExists {
+			return fmt.Errorf("portname %s already exists", pConfig.Name)
+		}
+		p := &port{
+			name:      pConfig.Name,
+			terminals: make(map[string]*terminal),
+			exclusive: pConfig.Exclusive,
+			index:     pConfig.Index,
+		}
+
+		for _, cConfig := range pConfig.Terminals {
+			if _, ok := p.terminals[cConfig.Name]; ok {
+				return fmt.Errorf("terminal %s already exists on port %s",
+					cConfig.Name, pConfig.Name)
+			}
+			// the same coil may only be used by the same terminal on
+			// different ports (e.g. a shared antenna)
+			if name, ok := coils[cConfig.Coil]; ok && name != cConfig.Name {
+				return fmt.Errorf("coil %d already used by terminal %s",
+					cConfig.Coil, name)
+			}
+			coils[cConfig.Coil] = cConfig.Name
+
+			p.terminals[cConfig.Name] = &terminal{
+				name:     cConfig.Name,
+				coil:     cConfig.Coil,
+				inverted: cConfig.Inverted,
+				index:    cConfig.Index,
+			}
+
+			if first < 0 || int(cConfig.Coil) < first {
+				first = int(cConfig.Coil)
+			}
+			if int(cConfig.Coil) > last {
+				last = int(cConfig.Coil)
+			}
+		}
+
+		m.ports[pConfig.Name] = p
+	}
+
+	if first < 0 {
+		return fmt.Errorf("no coils configured")
+	}
+
+	m.firstCoil = uint16(first)
+	m.coilCount = uint16(last - first + 1)
+
+	if err := m.update(); err != nil {
+		return fmt.Errorf("unable to read coils from %s: %v", m.name, err)
+	}
+
+	m.Lock()
+	m.initialized = true
+	m.Unlock()
+
+	if m.pollingInterval > 0 {
+		go m.poll()
+	}
+
+	return nil
+}
+
+// Name returns the Name of this Modbus relay board.
+func (m *ModbusRelay) Name() string {
+	m.Lock()
+	defer m.Unlock()
+	return m.name
+}
+
+// SetPort sets the Terminals of a particular Port. The portRequest
+// can contain n terminals.
+func (m *ModbusRelay) SetPort(portRequest sw.Port) error {
+	m.bus.Lock()
+	defer m.bus.Unlock()
+	m.Lock()
+	defer m.Unlock()
+
+	// ensure that the requested port exists
+	p, ok := m.ports[portRequest.Name]
+	if !ok {
+		return fmt.Errorf("%s is an invalid port", portRequest.Name)
+	}
+
+	// ensure that the requested terminal exists
+	for _, t := range portRequest.Terminals {
+		if _, ok := p.terminals[t.Name]; !ok {
+			return fmt.Errorf("%s is an invalid terminal", t.Name)
+		}
+	}
+
+	// if ModbusRelay.exclusive is true, a particular terminal can only
+	// be active on one port
+	if m.exclusive {
+		for prtName, prt := range m.ports {
+
+			// only check the remaining ports
+			if prtName == portRequest.Name {
+				continue
+			}
+
+			for _, t := range portRequest.Terminals {
+				if r, found := prt.terminals[t.Name]; found && r.state {
+					return fmt.Errorf("terminal %s in use by port %s",
+						t.Name, prtName)
+				}
+			}
+		}
+	}
+
+	// if port.exclusive is enabled, only one terminal can be active
+	// on this port.
+	if p.exclusive {
+		activate := make(map[string]bool)
+		for _, t := range portRequest.Terminals {
+			if t.State {
+				activate[t.Name] = true
+			}
+		}
+
+		// deactivate all other relays on this port; relays which are
+		// requested to be active are not touched to avoid chattering
+		for _, r := range p.terminals {
+			if !r.state || activate[r.name] {
+				continue
+			}
+			if err := m.setState(r, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	// set state of the terminal
+	for _, t := range portRequest.Terminals {
+		if err := m.setState(p.terminals[t.Name], t.State); err != nil {
+			return err
+		}
+	}
+
+	m.lastSeen = time.Now()
+	m.lastError = ""
+
+	if m.eventHandler != nil {
+		device := m.serialize()
+		go m.eventHandler(m, device)
+	}
+
+	return nil
+}
+
+// setState writes the coil of a terminal. The same coil might be shared
+// by several ports, so the state of all terminals using the coil
+// is updated. This method is not threadsafe.
+func (m *ModbusRelay) setState(r *terminal, state bool) error {
+
+	if err := writeCoil(m.transport, m.unitID, r.coil, state != r.inverted); err != nil {
+		m.lastError = err.Error()
+		return err
+	}
+
+	for _, p := range m.ports {
+		for _, t := range p.terminals {
+			if t.coil == r.coil {
+				t.state = state
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetPort returns switch.Port struct containing the current state of
+// the requested port.
+func (m *ModbusRelay) GetPort(portName string) (sw.Port, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	p, ok := m.ports[portName]
+	if !ok {
+		return sw.Port{}, fmt.Errorf("%s in an invalid port", portName)
+	}
+
+	return p.serialize(), nil
+}
+
+// Serialize returns a switch.Device struct containing the current
+// state and configuration of this Modbus relay board.
+func (m *ModbusRelay) Serialize() sw.Device {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.serialize()
+}
+
+// serialize returns a switch.Port struct containing the current
+// state and configuration of this port. This method
+// is not threadsafe.
+func (p *port) serialize() sw.Port {
+	swPort := sw.Port{
+		Name:      p.name,
+		Index:     p.index,
+		Exclusive: p.exclusive,
+		Terminals: []sw.Terminal{},
+	}
+
+	for _, r := range p.terminals {
+		t := sw.Terminal{
+			Name:  r.name,
+			Index: r.index,
+			State: r.state,
+		}
+		swPort.Terminals = append(swPort.Terminals, t)
+	}
+
+	// sort the Terminals by index
+	sort.Slice(swPort.Terminals, func(i, j int) bool {
+		return swPort.Terminals[i].Index < swPort.Terminals[j].Index
+	})
+
+	return swPort
+}
+
+// Health returns the health of this Modbus relay board. The board is
+// considered online as long as the last request succeeded.
+func (m *ModbusRelay) Health() sw.Health {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.health()
+}
+
+// health returns the health of this Modbus relay board. This method
+// is not threadsafe.
+func (m *ModbusRelay) health() sw.Health {
+	return sw.Health{
+		Online:   m.initialized && len(m.lastError) == 0,
+		LastSeen: m.lastSeen,
+		Error:    m.lastError,
+		Model:    m.model,
+	}
+}
+
+// serialize returns a switch.Device struct containing the current
+// state and configuration of this Modbus relay board. This method
+// is not threadsafe.
+func (m *ModbusRelay) serialize() sw.Device {
+
+	health := m.health()
+
+	dev := sw.Device{
+		Name:      m.name,
+		Index:     m.index,
+		Exclusive: m.exclusive,
+		Health:    &health,
+	}
+
+	// serialize all ports
+	for _, p := range m.ports {
+		swPort := p.serialize()
+		dev.Ports = append(dev.Ports, swPort)
+	}
+
+	// sort the ports by index
+	sort.Slice(dev.Ports, func(i, j int) bool {
+		return dev.Ports[i].Index < dev.Ports[j].Index
+	})
+
+	return dev
+}
+
+// poll reads the coils periodically until the switch is closed.
+func (m *ModbusRelay) poll() {
+
+	ticker := time.NewTicker(m.pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.closeCh:
+			return
+		case <-ticker.C:
+			m.update()
+		}
+	}
+}
+
+// update reads the coils from the board and updates the state of the
+// terminals. This detects changes made by other Modbus masters or by the
+// buttons on the board. The event handler is called if the state or
+// the health of the switch has changed.
+func (m *ModbusRelay) update() error {
+	m.bus.Lock()
+	defer m.bus.Unlock()
+
+	coils, err := readCoils(m.transport, m.unitID, m.firstCoil, m.coilCount)
+
+	m.Lock()
+	defer m.Unlock()
+
+	changed := false
+
+	if err != nil {
+		if m.lastError != err.Error() {
+			log.Printf("modbus relay %s: %v", m.name, err)
+			m.lastError = err.Error()
+			changed = true
+		}
+	} else {
+		if m.lastError != "" {
+			log.Printf("modbus relay %s: connection restored", m.name)
+			m.lastError = ""
+			changed = true
+		}
+		m.lastSeen = time.Now()
+
+		for _, p := range m.ports {
+			for _, t := range p.terminals {
+				state := coils[t.coil-m.firstCoil] != t.inverted
+				if state != t.state {
+					t.state = state
+					changed = true
+				}
+			}
+		}
+	}
+
+	if changed && m.initialized && m.eventHandler != nil {
+		device := m.serialize()
+		go m.eventHandler(m, device)
+	}
+
+	return err
+}
+
+// Close stops polling and closes the connection to the relay board.
+// The state of the relays is not modified.
+func (m *ModbusRelay) Close() {
+	m.closeOnce.Do(func() {
+		close(m.closeCh)
+	})
+
+	m.bus.Lock()
+	defer m.bus.Unlock()
+	if m.transport != nil {
+		m.transport.close()
+	}
+}
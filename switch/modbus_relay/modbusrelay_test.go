@@ -0,0 +1,293 @@
+package modbusrelay
+
+import (
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/internal/switchtest"
+)
+
+var testConfig = SwitchConfig{
+	Name:      "Antenna Switch",
+	Exclusive: true,
+	Ports: []PortConfig{
+		{
+			Name:      "A",
+			Index:     0,
+			Exclusive: true,
+			Terminals: []CoilConfig{
+				{Name: "Yagi", Coil: 0, Index: 0},
+				{Name: "Dipole", Coil: 1, Index: 1},
+				{Name: "Vertical", Coil: 2, Index: 2, Inverted: true},
+			},
+		},
+		{
+			Name:  "B",
+			Index: 1,
+			Terminals: []CoilConfig{
+				{Name: "Yagi", Coil: 4, Index: 0},
+				{Name: "Dipole", Coil: 5, Index: 1},
+			},
+		},
+	},
+}
+
+func newTestRelay(t *testing.T, sim *Simulator, opts ...func(*ModbusRelay)) (*ModbusRelay, chan sw.Device) {
+	t.Helper()
+
+	handler, events := switchtest.Events()
+
+	opts = append([]func(*ModbusRelay){
+		Switch(testConfig),
+		TCP(sim.Addr()),
+		PollingInterval(time.Millisecond * 20),
+		Timeout(time.Millisecond * 200),
+		EventHandler(handler),
+	}, opts...)
+
+	m := NewModbusRelay(opts...)
+	switchtest.Init(t, m)
+
+	return m, events
+}
+
+func newTestSimulator(t *testing.T, rtu bool) *Simulator {
+	t.Helper()
+
+	newSim := NewSimulator
+	if rtu {
+		newSim = NewRTUSimulator
+	}
+
+	sim, err := newSim("127.0.0.1:0", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sim.Close() })
+
+	// the inverted coil of "Vertical" is released by default
+	sim.SetCoil(2, true)
+
+	return sim
+}
+
+func TestModbusRelay_SetPort(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		requests  []sw.Port
+		wantErr   bool
+		wantCoils []bool
+	}{
+		{"activate terminal",
+			[]sw.Port{{Name: "A", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}}},
+			false, []bool{true, false, true, false, false, false, false, false}},
+		{"inverted terminal",
+			[]sw.Port{{Name: "A", Terminals: []sw.Terminal{{Name: "Vertical", State: true}}}},
+			false, []bool{false, false, false, false, false, false, false, false}},
+		{"exclusive port",
+			[]sw.Port{
+				{Name: "A", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}},
+				{Name: "A", Terminals: []sw.Terminal{{Name: "Dipole", State: true}}},
+			},
+			false, []bool{false, true, true, false, false, false, false, false}},
+		{"non exclusive port",
+			[]sw.Port{
+				{Name: "B", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}},
+				{Name: "B", Terminals: []sw.Terminal{{Name: "Dipole", State: true}}},
+			},
+			false, []bool{false, false, true, false, true, true, false, false}},
+		{"terminal in use by other port",
+			[]sw.Port{
+				{Name: "A", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}},
+				{Name: "B", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}},
+			},
+			true, []bool{true, false, true, false, false, false, false, false}},
+		{"invalid port",
+			[]sw.Port{{Name: "C", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}}},
+			true, []bool{false, false, true, false, false, false, false, false}},
+		{"invalid terminal",
+			[]sw.Port{{Name: "A", Terminals: []sw.Terminal{{Name: "Beam", State: true}}}},
+			true, []bool{false, false, true, false, false, false, false, false}},
+	}
+
+	for _, rtu := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if rtu {
+				name += " (rtu)"
+			}
+			t.Run(name, func(t *testing.T) {
+				sim := newTestSimulator(t, rtu)
+				var m *ModbusRelay
+				if rtu {
+					m, _ = newTestRelay(t, sim, RTU(sim.Addr(), 9600, 'N'))
+				} else {
+					m, _ = newTestRelay(t, sim)
+				}
+
+				var err error
+				for _, req := range tt.requests {
+					if err = m.SetPort(req); err != nil {
+						break
+					}
+				}
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("SetPort() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				for i, want := range tt.wantCoils {
+					if got := sim.Coil(i); got != want {
+						t.Errorf("coil %d = %v, want %v", i, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestModbusRelay_externalChange(t *testing.T) {
+
+	sim := newTestSimulator(t, false)
+	m, events := newTestRelay(t, sim)
+
+	if switchtest.TerminalState(t, m, "A", "Vertical") {
+		t.Fatal("Vertical should be inactive after Init")
+	}
+
+	// a relay switched by another Modbus master
+	sim.SetCoil(1, true)
+
+	switchtest.Eventually(t, func() bool { return switchtest.TerminalState(t, m, "A", "Dipole") })
+
+	select {
+	case dev := <-events:
+		if len(dev.Ports) != 2 {
+			t.Errorf("expected 2 ports in event, got %d", len(dev.Ports))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event after external change")
+	}
+}
+
+func TestModbusRelay_reconnect(t *testing.T) {
+
+	sim := newTestSimulator(t, false)
+	m, _ := newTestRelay(t, sim)
+
+	sim.Disconnect()
+
+	// the broken connection is detected and re-established by the poller
+	switchtest.Eventually(t, func() bool {
+		h := m.Health()
+		return h.Online && h.Model == "Modbus TCP"
+	})
+
+	err := m.SetPort(sw.Port{Name: "A", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sim.Coil(0) {
+		t.Error("coil 0 not set after reconnect")
+	}
+}
+
+func TestModbusRelay_offline(t *testing.T) {
+
+	sim := newTestSimulator(t, false)
+	m, events := newTestRelay(t, sim)
+
+	sim.Close()
+
+	switchtest.Eventually(t, func() bool { return !m.Health().Online })
+
+	var dev sw.Device
+	switchtest.Eventually(t, func() bool {
+		select {
+		case dev = <-events:
+		default:
+		}
+		return dev.Health != nil && !dev.Health.Online
+	})
+
+	err := m.SetPort(sw.Port{Name: "A", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}})
+	if err == nil {
+		t.Fatal("expected error when the relay board is offline")
+	}
+}
+
+func TestModbusRelay_Init(t *testing.T) {
+
+	sim := newTestSimulator(t, false)
+
+	tests := []struct {
+		name    string
+		opts    []func(*ModbusRelay)
+		wantErr bool
+	}{
+		{"valid", []func(*ModbusRelay){Switch(testConfig), TCP(sim.Addr())}, false},
+		{"no transport", []func(*ModbusRelay){Switch(testConfig)}, true},
+		{"no coils", []func(*ModbusRelay){TCP(sim.Addr())}, true},
+		{"coil out of range", []func(*ModbusRelay){TCP(sim.Addr()), Switch(SwitchConfig{
+			Name: "Switch",
+			Ports: []PortConfig{{Name: "A", Terminals: []CoilConfig{
+				{Name: "Yagi", Coil: 8},
+			}}},
+		})}, true},
+		{"coil used twice", []func(*ModbusRelay){TCP(sim.Addr()), Switch(SwitchConfig{
+			Name: "Switch",
+			Ports: []PortConfig{{Name: "A", Terminals: []CoilConfig{
+				{Name: "Yagi", Coil: 0},
+				{Name: "Dipole", Coil: 0},
+			}}},
+		})}, true},
+		{"board not reachable", []func(*ModbusRelay){Switch(testConfig), TCP("127.0.0.1:1"),
+			Timeout(time.Millisecond * 100)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewModbusRelay(tt.opts...)
+			defer m.Close()
+			if err := m.Init(); (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_readCoils_exception(t *testing.T) {
+
+	sim := newTestSimulator(t, false)
+	tr := &tcpTransport{address: sim.Addr(), timeout: time.Second}
+	defer tr.close()
+
+	_, err := readCoils(tr, 1, 6, 4)
+	mbErr, ok := err.(*ModbusError)
+	if !ok {
+		t.Fatalf("expected ModbusError, got %v", err)
+	}
+	if mbErr.ExceptionCode != exIllegalDataAddress {
+		t.Errorf("exception code = %d, want %d", mbErr.ExceptionCode, exIllegalDataAddress)
+	}
+}
+
+func Test_crc16(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want uint16
+	}{
+		// read coils 0-7 from unit 1; 01 01 00 00 00 08 3D CC
+		{"read coils", []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x08}, 0xCC3D},
+		// write coil 0 on unit 1; 01 05 00 00 FF 00 8C 3A
+		{"write coil", []byte{0x01, 0x05, 0x00, 0x00, 0xFF, 0x00}, 0x3A8C},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crc16(tt.data); got != tt.want {
+				t.Errorf("crc16() = %#04x, want %#04x", got, tt.want)
+			}
+		})
+	}
+}
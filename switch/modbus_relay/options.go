@@ -0,0 +1,98 @@
+package modbusrelay
+
+import (
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+)
+
+// Switch is a functional option to set the switch's configuration.
+func Switch(sc SwitchConfig) func(*ModbusRelay) {
+	return func(m *ModbusRelay) {
+		m.switchConfig = sc
+	}
+}
+
+// SwitchConfig describes a switch which is a collection of ports.
+type SwitchConfig struct {
+	Name      string
+	Index     int
+	Exclusive bool
+	Ports     []PortConfig
+}
+
+// PortConfig describes a port which is a collection of coils (relays).
+type PortConfig struct {
+	Name      string
+	Index     int
+	Exclusive bool
+	Terminals []CoilConfig
+}
+
+// CoilConfig describes a coil which drives a relay. Coil addresses
+// start at 0.
+type CoilConfig struct {
+	Name     string
+	Coil     uint16
+	Inverted bool
+	Index    int
+}
+
+// TCP is a functional option to connect to the relay board through
+// Modbus TCP on address (host:port).
+func TCP(address string) func(*ModbusRelay) {
+	return func(m *ModbusRelay) {
+		m.transport = &tcpTransport{address: address}
+		m.model = "Modbus TCP"
+	}
+}
+
+// RTU is a functional option to connect to the relay board through
+// Modbus RTU. The portname can either be a serial port or the address
+// (host:port) of a serial server.
+func RTU(portname string, baudrate int, parity byte) func(*ModbusRelay) {
+	return func(m *ModbusRelay) {
+		m.transport = &rtuTransport{
+			config: serialport.Config{
+				Name:        portname,
+				Baudrate:    baudrate,
+				Parity:      parity,
+				ReadTimeout: time.Millisecond * 100,
+			},
+		}
+		m.model = "Modbus RTU"
+	}
+}
+
+// UnitID is a functional option to set the Modbus unit id (slave
+// address) of the relay board.
+func UnitID(id byte) func(*ModbusRelay) {
+	return func(m *ModbusRelay) {
+		m.unitID = id
+	}
+}
+
+// PollingInterval is a functional option to set the interval in which
+// the coils are read to detect changes made by other Modbus masters.
+func PollingInterval(d time.Duration) func(*ModbusRelay) {
+	return func(m *ModbusRelay) {
+		m.pollingInterval = d
+	}
+}
+
+// Timeout is a functional option to set the time after which a request
+// without response is considered to have failed.
+func Timeout(d time.Duration) func(*ModbusRelay) {
+	return func(m *ModbusRelay) {
+		m.timeout = d
+	}
+}
+
+// EventHandler sets a callback function through which the switch
+// will report Events
+func EventHandler(h func(sw.Switcher, sw.Device)) func(*ModbusRelay) {
+	return func(m *ModbusRelay) {
+		m.eventHandler = h
+	}
+}
@@ -0,0 +1,255 @@
+package modbusrelay
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Simulator is an in-process Modbus server simulating a relay board with
+// a number of coils. It serves Modbus TCP, or Modbus RTU frames on a TCP
+// socket (like a relay board behind a serial server). The simulator is
+// meant for tests and for trying out configurations without hardware.
+type Simulator struct {
+	sync.Mutex
+	lis      net.Listener
+	rtu      bool
+	coils    []bool
+	requests int
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// NewSimulator starts a Modbus TCP simulator with the given amount of
+// coils on address (e.g. "127.0.0.1:0" for a random port).
+func NewSimulator(address string, coils int) (*Simulator, error) {
+	return newSimulator(address, coils, false)
+}
+
+// NewRTUSimulator starts a simulator which speaks Modbus RTU on a TCP
+// socket on address.
+func NewRTUSimulator(address string, coils int) (*Simulator, error) {
+	return newSimulator(address, coils, true)
+}
+
+func newSimulator(address string, coils int, rtu bool) (*Simulator, error) {
+
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		lis:   lis,
+		rtu:   rtu,
+		coils: make([]bool, coils),
+		conns: make(map[net.Conn]struct{}),
+	}
+
+	go s.serve()
+
+	return s, nil
+}
+
+// Addr returns the address the simulator is listening on.
+func (s *Simulator) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// Coil returns the state of a coil.
+func (s *Simulator) Coil(address int) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.coils[address]
+}
+
+// SetCoil sets the state of a coil, e.g. to simulate a relay which has
+// been switched by another Modbus master.
+func (s *Simulator) SetCoil(address int, state bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.coils[address] = state
+}
+
+// Requests returns the amount of requests served so far.
+func (s *Simulator) Requests() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.requests
+}
+
+// Disconnect closes all client connections, e.g. to simulate a network
+// problem. The simulator keeps accepting new connections.
+func (s *Simulator) Disconnect() {
+	s.Lock()
+	defer s.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close stops the simulator.
+func (s *Simulator) Close() error {
+	s.Lock()
+	s.closed = true
+	s.Unlock()
+	s.Disconnect()
+	return s.lis.Close()
+}
+
+func (s *Simulator) serve() {
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		s.Lock()
+		if s.closed {
+			s.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.Unlock()
+
+		go func() {
+			if s.rtu {
+				s.serveRTU(conn)
+			} else {
+				s.serveTCP(conn)
+			}
+			s.Lock()
+			delete(s.conns, conn)
+			s.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (s *Simulator) serveTCP(conn net.Conn) {
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		resp := s.handle(pdu)
+
+		adu := make([]byte, 7, 7+len(resp))
+		copy(adu, header[:4])
+		binary.BigEndian.PutUint16(adu[4:], uint16(len(resp)+1))
+		adu[6] = header[6]
+		adu = append(adu, resp...)
+		if _, err := conn.Write(adu); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Simulator) serveRTU(conn net.Conn) {
+	for {
+		// unit id + function code + 4 bytes which all supported
+		// requests have in common
+		req := make([]byte, 6)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		remaining := 2 // crc
+		if req[1] == fcWriteMultipleCoils {
+			// byte count + coil values
+			b := make([]byte, 1)
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return
+			}
+			req = append(req, b[0])
+			remaining += int(b[0])
+		}
+
+		rest := make([]byte, remaining)
+		if _, err := io.ReadFull(conn, rest); err != nil {
+			return
+		}
+		req = append(req, rest...)
+
+		n := len(req) - 2
+		if crc16(req[:n]) != binary.LittleEndian.Uint16(req[n:]) {
+			// devices don't respond to corrupted frames
+			continue
+		}
+
+		resp := append([]byte{req[0]}, s.handle(req[1:n])...)
+		resp = binary.LittleEndian.AppendUint16(resp, crc16(resp))
+
+		// inter frame delay
+		time.Sleep(time.Millisecond * 2)
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle executes a request PDU and returns the response PDU.
+func (s *Simulator) handle(pdu []byte) []byte {
+	s.Lock()
+	defer s.Unlock()
+
+	s.requests++
+
+	exception := func(code byte) []byte {
+		return []byte{pdu[0] | 0x80, code}
+	}
+
+	if len(pdu) < 5 {
+		return exception(exIllegalDataValue)
+	}
+
+	address := int(binary.BigEndian.Uint16(pdu[1:]))
+	value := binary.BigEndian.Uint16(pdu[3:])
+
+	switch pdu[0] {
+	case fcReadCoils:
+		quantity := int(value)
+		if quantity < 1 || quantity > 2000 {
+			return exception(exIllegalDataValue)
+		}
+		if address+quantity > len(s.coils) {
+			return exception(exIllegalDataAddress)
+		}
+		data := packCoils(s.coils[address : address+quantity])
+		return append([]byte{fcReadCoils, byte(len(data))}, data...)
+
+	case fcWriteSingleCoil:
+		if value != 0xFF00 && value != 0x0000 {
+			return exception(exIllegalDataValue)
+		}
+		if address >= len(s.coils) {
+			return exception(exIllegalDataAddress)
+		}
+		s.coils[address] = value == 0xFF00
+		return pdu[:5]
+
+	case fcWriteMultipleCoils:
+		quantity := int(value)
+		if len(pdu) < 6 || len(pdu[6:]) != (quantity+7)/8 {
+			return exception(exIllegalDataValue)
+		}
+		if address+quantity > len(s.coils) {
+			return exception(exIllegalDataAddress)
+		}
+		copy(s.coils[address:], unpackCoils(pdu[6:], quantity))
+		return pdu[:5]
+	}
+
+	return exception(exIllegalFunction)
+}
@@ -2,14 +2,13 @@ package MultiPurposeSwitchGPIO
 
 import (
 	"fmt"
+	"log"
 	"sort"
-	"strings"
 	"sync"
+	"time"
 
 	sw "github.com/dh1tw/remoteSwitch/switch"
-	"periph.io/x/conn/v3/gpio"
-	"periph.io/x/conn/v3/gpio/gpioreg"
-	"periph.io/x/host/v3"
+	"github.com/dh1tw/remoteSwitch/switch/pins"
 )
 
 // MPSwitchGPIO contains the state and configuration of a
@@ -21,9 +20,19 @@ type MPSwitchGPIO struct {
 	exclusive    bool
 	ports        map[string]*port
 	switchConfig SwitchConfig
+	backend      pins.Backend
 	eventHandler func(sw.Switcher, sw.Device)
+	initialized  bool
+	lastSeen     time.Time
+	lastError    string
+	stop         chan struct{} // closed by Close to stop the sense watchers
+	pinWrite     sync.Mutex    // serializes the writes to the pins
 }
 
+// senseInterval is the interval in which the sense pins are read if no
+// edge has been detected.
+const senseInterval = time.Second
+
 // port represents a set of terminals (GPIO pins). This struct holds the
 // configuration and state of the port.
 type port struct {
@@ -34,14 +43,29 @@ type port struct {
 	index           int
 }
 
-// terminal represents a particular GPIO pin. This struct holds the
-// configuration and state of the terminal.
+// terminal represents a particular GPIO pin (of the host or of an I2C
+// port expander). Latching terminals use a second pin for the reset
+// coil and an optional sense pin to read the state back. This struct
+// holds the configuration and state of the terminal.
 type terminal struct {
-	name     string
-	inverted bool
-	state    bool
-	pin      gpio.PinOut
-	index    int
+	name          string
+	typ           string
+	inverted      bool
+	state         bool
+	pin           pins.Pin
+	resetPin      pins.Pin
+	pulseWidth    time.Duration
+	sensePin      pins.InPin
+	senseInverted bool
+	sensed        bool
+	senseError    string
+	index         int
+}
+
+// request is the requested state of a terminal.
+type request struct {
+	t     *terminal
+	state bool
 }
 
 // NewMPSwitchGPIO is the constructor for a Multi Purpose GPIO switch.
@@ -65,22 +89,17 @@ func NewMPSwitchGPIO(options ...func(*MPSwitchGPIO)) *MPSwitchGPIO {
 // If your platform does not support GPIO, an error will be returned.
 func (g *MPSwitchGPIO) Init() error {
 
-	hostState, err := host.Init()
-	if err != nil {
-		return err
-	}
-
-	// check if sysfs-gpio driver has been loaded
-	gpioDriverLoaded := false
-	for _, driver := range hostState.Loaded {
-		if driver.String() == "sysfs-gpio" {
-			gpioDriverLoaded = true
+	if g.backend == nil {
+		b, err := pins.NewBackend(g.switchConfig.Backend)
+		if err != nil {
+			return err
 		}
+		g.backend = b
 	}
 
-	if !gpioDriverLoaded {
-		return fmt.Errorf("sysfs-gpio driver was not loaded; try running as root")
-	}
+	// all terminals are switched off at once
+	requests := []request{}
+	sensed := []*terminal{}
 
 	g.name = g.switchConfig.Name
 	g.index = g.switchConfig.Index
@@ -99,30 +118,141 @@ func (g *MPSwitchGPIO) Init() error {
 		}
 
 		for _, pinConfig := range pConfig.Terminals {
+			pin, err := pins.ByName(g.backend, pinConfig.Pin)
+			if err != nil {
+				return err
+			}
+
 			r := &terminal{
-				name:     pinConfig.Name,
-				inverted: pinConfig.Inverted,
-				index:    pinConfig.Index,
-				pin:      gpioreg.ByName(strings.ToUpper(pinConfig.Pin)),
+				name:       pinConfig.Name,
+				typ:        pinConfig.Type,
+				inverted:   pinConfig.Inverted,
+				index:      pinConfig.Index,
+				pin:        pin,
+				pulseWidth: pinConfig.PulseWidth,
 			}
 
-			//TBD Handle pin "None" / Empty to disable all relays
+			if len(r.typ) == 0 {
+				r.typ = Level
+			}
 
-			if r.pin == nil {
-				return fmt.Errorf("failed to find pin %s", pinConfig.Pin)
+			if r.pulseWidth <= 0 {
+				r.pulseWidth = DefaultPulseWidth
 			}
 
-			if err := r.setState(false); err != nil {
-				return err
+			switch r.typ {
+			case Level, Pulse:
+				if len(pinConfig.ResetPin) > 0 {
+					return fmt.Errorf("terminal %s: reset pin is only supported by %s terminals",
+						r.name, Latching)
+				}
+			case Latching:
+				if len(pinConfig.ResetPin) == 0 {
+					return fmt.Errorf("terminal %s: %s terminals require a reset pin",
+						r.name, Latching)
+				}
+				resetPin, err := pins.ByName(g.backend, pinConfig.ResetPin)
+				if err != nil {
+					return err
+				}
+				r.resetPin = resetPin
+			default:
+				return fmt.Errorf("terminal %s: unknown type %s (supported: %s, %s, %s)",
+					r.name, r.typ, Level, Pulse, Latching)
+			}
+
+			if len(pinConfig.SensePin) > 0 {
+				sensePin, err := pins.InByName(g.backend, pinConfig.SensePin)
+				if err != nil {
+					return err
+				}
+				r.sensePin = sensePin
+				r.senseInverted = pinConfig.SenseInverted
+				sensed = append(sensed, r)
 			}
+
+			//TBD Handle pin "None" / Empty to disable all relays
+
+			requests = append(requests, request{r, false})
 			p.terminals[pinConfig.Name] = r
 		}
 
 		g.ports[pConfig.Name] = p
 	}
+
+	// latching relays are reset, so that their state is known
+	if err := apply(requests); err != nil {
+		return err
+	}
+	commit(requests)
+
+	g.stop = make(chan struct{})
+	for _, r := range sensed {
+		level, err := r.sensePin.Read()
+		if err != nil {
+			return fmt.Errorf("terminal %s: unable to read sense pin %s: %v",
+				r.name, r.sensePin, err)
+		}
+		r.sensed = level != r.senseInverted
+	}
+
+	// the watchers are started once all sense pins have been read, so
+	// that no event is emitted during Init
+	for _, r := range sensed {
+		r := r
+		go pins.Watch(r.sensePin, senseInterval, g.stop, func(level bool, err error) {
+			g.sense(r, level, err)
+		})
+	}
+
+	g.initialized = true
+	g.lastSeen = time.Now()
+
 	return nil
 }
 
+// sense is called by the watcher of a sense pin. If the sensed state of
+// the terminal has changed (e.g. it has been switched manually or a relay
+// failed) or the pin can't be read, an event is emitted.
+func (g *MPSwitchGPIO) sense(r *terminal, level bool, err error) {
+	g.Lock()
+	defer g.Unlock()
+
+	// the switch has been closed in the meantime
+	if g.stop == nil {
+		return
+	}
+
+	senseError := ""
+	if err != nil {
+		senseError = fmt.Sprintf("terminal %s: unable to read sense pin %s: %v",
+			r.name, r.sensePin, err)
+		if senseError != r.senseError {
+			log.Println(senseError)
+		}
+	}
+
+	sensed := r.sensed
+	if err == nil {
+		sensed = level != r.senseInverted
+	}
+
+	if sensed == r.sensed && senseError == r.senseError {
+		return
+	}
+
+	r.sensed = sensed
+	r.senseError = senseError
+	if err == nil {
+		g.lastSeen = time.Now()
+	}
+
+	if g.eventHandler != nil {
+		device := g.serialize()
+		go g.eventHandler(g, device)
+	}
+}
+
 // Name returns the Name of this Multi Purpose GPIO Switch
 func (g *MPSwitchGPIO) Name() string {
 	g.Lock()
@@ -131,22 +261,77 @@ func (g *MPSwitchGPIO) Name() string {
 }
 
 // SetPort sets the Terminals of a particular Port. The portRequest
-// can contain n termials.
+// can contain n termials. The switch isn't locked while the pins are
+// written, since the coils of Pulse and Latching terminals are held for
+// their pulse width; instead the requests are serialized through
+// pinWrite.
 func (g *MPSwitchGPIO) SetPort(portRequest sw.Port) error {
+	g.pinWrite.Lock()
+	defer g.pinWrite.Unlock()
+
+	g.Lock()
+	p, requests, err := g.requests(portRequest)
+	g.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = apply(requests)
+
 	g.Lock()
 	defer g.Unlock()
 
+	if err != nil {
+		g.lastError = err.Error()
+		return err
+	}
+
+	commit(requests)
+
+	if p.exclusive {
+		for rName := range p.activeTerminals {
+			// remove from the map of active relays
+			delete(p.activeTerminals, rName)
+		}
+	}
+
+	for _, t := range portRequest.Terminals {
+		if t.State && p.terminals[t.Name].typ != Pulse {
+			// add to the map of active terminals
+			p.activeTerminals[t.Name] = p.terminals[t.Name]
+			continue
+		}
+
+		// when false, remove from map of active terminals
+		delete(p.activeTerminals, t.Name)
+	}
+
+	g.lastSeen = time.Now()
+	g.lastError = ""
+
+	if g.eventHandler != nil {
+		device := g.serialize()
+		go g.eventHandler(g, device)
+	}
+
+	return nil
+}
+
+// requests validates the portRequest and returns the port and the
+// requested states of its terminals. This method is not threadsafe.
+func (g *MPSwitchGPIO) requests(portRequest sw.Port) (*port, []request, error) {
+
 	// ensure that the requested port exists
 	p, ok := g.ports[portRequest.Name]
 	if !ok {
-		return fmt.Errorf("%s is an invalid port", portRequest.Name)
+		return nil, nil, fmt.Errorf("%s is an invalid port", portRequest.Name)
 	}
 
 	// ensure that the requested terminal exists
 	for _, t := range portRequest.Terminals {
 		_, ok := p.terminals[t.Name]
 		if !ok {
-			return fmt.Errorf("%s is an invalid terminal", t.Name)
+			return nil, nil, fmt.Errorf("%s is an invalid terminal", t.Name)
 		}
 	}
 
@@ -163,52 +348,39 @@ func (g *MPSwitchGPIO) SetPort(portRequest sw.Port) error {
 
 			for _, t := range portRequest.Terminals {
 				if _, found := prt.activeTerminals[t.Name]; found {
-					return fmt.Errorf("terminal %s in use by port %s",
+					return nil, nil, fmt.Errorf("terminal %s in use by port %s",
 						t.Name, prtName)
 				}
 			}
 		}
 	}
 
+	// all pins are set at once, so that pins of the same I2C port
+	// expander are written in a single bus transaction
+	requests := []request{}
+
 	// if port.exclusive is enabled, only one terminal can be active
-	// on this port.
+	// on this port; therefore deactivate all relays on this port first.
+	// The requested terminals are skipped, so that a relay which is
+	// selected again doesn't chatter.
 	if p.exclusive {
-		// deactivate all relays on this port
+		requested := make(map[string]bool, len(portRequest.Terminals))
+		for _, t := range portRequest.Terminals {
+			requested[t.Name] = true
+		}
 		for rName, r := range p.activeTerminals {
-
-			if err := r.setState(false); err != nil {
-				return err
+			if requested[rName] {
+				continue
 			}
-			// remove from the map of active relays
-			delete(p.activeTerminals, rName)
+			requests = append(requests, request{r, false})
 		}
 	}
 
-	// set state of the terminal
 	for _, t := range portRequest.Terminals {
-		r := p.terminals[t.Name]
-
-		if err := r.setState(t.State); err != nil {
-			return err
-		}
-
-		if t.State {
-			// add to the map of active terminals
-			p.activeTerminals[t.Name] = r
-			continue
-		}
-
-		// when false, remove from map of active terminals
-		delete(p.activeTerminals, t.Name)
-
+		requests = append(requests, request{p.terminals[t.Name], t.State})
 	}
 
-	if g.eventHandler != nil {
-		device := g.serialize()
-		go g.eventHandler(g, device)
-	}
-
-	return nil
+	return p, requests, nil
 }
 
 // GetPort returns switch.Port struct containing the current state of
@@ -241,6 +413,7 @@ func (p *port) serialize() sw.Port {
 	swPort := sw.Port{
 		Name:      p.name,
 		Index:     p.index,
+		Exclusive: p.exclusive,
 		Terminals: []sw.Terminal{},
 	}
 
@@ -248,7 +421,14 @@ func (p *port) serialize() sw.Port {
 		t := sw.Terminal{
 			Name:  r.name,
 			Index: r.index,
-			State: r.getState(),
+			State: r.state,
+		}
+		if r.sensePin != nil {
+			sensed := r.sensed
+			t.Sensed = &sensed
+			// Pulse terminals only trigger an action; their sensed state
+			// can't be compared with the commanded state
+			t.Mismatch = r.typ != Pulse && sensed != r.state
 		}
 		swPort.Terminals = append(swPort.Terminals, t)
 	}
@@ -261,14 +441,47 @@ func (p *port) serialize() sw.Port {
 	return swPort
 }
 
+// Health returns the health of this MultiPurpose GPIO switch. The switch
+// is considered online once it has been initialized and as long as the
+// last write to the GPIO pins succeeded and the sense pins can be read.
+func (g *MPSwitchGPIO) Health() sw.Health {
+	g.Lock()
+	defer g.Unlock()
+
+	return g.health()
+}
+
+// health returns the health of this MultiPurpose GPIO switch. This method
+// is not threadsafe.
+func (g *MPSwitchGPIO) health() sw.Health {
+	errMsg := g.lastError
+	for _, p := range g.ports {
+		for _, r := range p.terminals {
+			if len(errMsg) == 0 {
+				errMsg = r.senseError
+			}
+		}
+	}
+	return sw.Health{
+		Online:   g.initialized && len(errMsg) == 0,
+		LastSeen: g.lastSeen,
+		Error:    errMsg,
+		Model:    "GPIO",
+	}
+}
+
 // serialize returns a switch.Device struct containing the current
 // state and configuration of this MultiPurpose GPIO switch. This method
 // is not threadsafe.
 func (g *MPSwitchGPIO) serialize() sw.Device {
 
+	health := g.health()
+
 	dev := sw.Device{
-		Name:  g.name,
-		Index: g.index,
+		Name:      g.name,
+		Index:     g.index,
+		Exclusive: g.exclusive,
+		Health:    &health,
 	}
 
 	// serialize all ports
@@ -285,40 +498,108 @@ func (g *MPSwitchGPIO) serialize() sw.Device {
 	return dev
 }
 
-// setState is a convenience function for setting the relay. It is necessary in
-// case the logic is inverted.
-func (r *terminal) setState(state bool) error {
+// apply switches the terminals into the requested states. The pins of
+// Level terminals and the coils of Pulse and Latching terminals are
+// activated at once. The coils are released after their pulse width.
+// The state of the terminals is not updated (see commit).
+func apply(requests []request) error {
 
-	newState := state
-	if r.inverted {
-		newState = !newState
+	changes := []pins.Change{}
+	releases := map[time.Duration][]pins.Change{}
+	widths := []time.Duration{}
+
+	release := func(r *terminal, pin pins.Pin) {
+		if _, ok := releases[r.pulseWidth]; !ok {
+			widths = append(widths, r.pulseWidth)
+		}
+		releases[r.pulseWidth] = append(releases[r.pulseWidth], r.change(pin, false))
 	}
 
-	if err := r.pin.Out(gpio.Level(newState)); err != nil {
-		return err
+	for _, req := range requests {
+		r := req.t
+		switch r.typ {
+		case Pulse:
+			changes = append(changes, r.change(r.pin, req.state))
+			if req.state {
+				release(r, r.pin)
+			}
+		case Latching:
+			// the opposite coil must never be active at the same time
+			coil, opposite := r.pin, r.resetPin
+			if !req.state {
+				coil, opposite = r.resetPin, r.pin
+			}
+			changes = append(changes, r.change(opposite, false), r.change(coil, true))
+			release(r, coil)
+		default:
+			changes = append(changes, r.change(r.pin, req.state))
+		}
 	}
 
-	r.state = newState
+	err := pins.Out(changes...)
 
-	return nil
+	// the coils are released even if not all of them could be activated
+	sort.Slice(widths, func(i, j int) bool { return widths[i] < widths[j] })
+	var elapsed time.Duration
+	for _, w := range widths {
+		time.Sleep(w - elapsed)
+		elapsed = w
+		if rerr := pins.Out(releases[w]...); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+
+	return err
 }
 
-// getState returns the current state of a terminal / GPIO pin.
-func (r *terminal) getState() bool {
+// commit updates the (commanded) state of the terminals once the pins
+// have been set. This method is not threadsafe.
+func commit(requests []request) {
+	for _, req := range requests {
+		// momentary buttons are released again
+		req.t.state = req.state && req.t.typ != Pulse
+	}
+}
+
+// change returns the change of one of the terminal's pins for the
+// requested state. It is necessary in case the logic is inverted.
+func (r *terminal) change(pin pins.Pin, state bool) pins.Change {
+
+	newState := state
 	if r.inverted {
-		return !r.state
+		newState = !newState
 	}
-	return r.state
+
+	return pins.Change{Pin: pin, Level: newState}
 }
 
-// Close shutsdown the switch and sets all GPIO ports to false.
+// Close shutsdown the switch, sets all GPIO ports to false and releases
+// the pins.
 func (g *MPSwitchGPIO) Close() {
+	g.pinWrite.Lock()
+	defer g.pinWrite.Unlock()
+
 	g.Lock()
-	defer g.Unlock()
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
 
+	requests := []request{}
 	for _, p := range g.ports {
 		for _, r := range p.terminals {
-			r.setState(false)
+			requests = append(requests, request{r, false})
 		}
 	}
+	g.Unlock()
+
+	if err := apply(requests); err == nil {
+		g.Lock()
+		commit(requests)
+		g.Unlock()
+	}
+
+	if g.backend != nil {
+		g.backend.Close()
+	}
 }
@@ -1,7 +1,16 @@
 package MultiPurposeSwitchGPIO
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/pins"
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/i2c/i2ctest"
 )
 
 var configA = PortConfig{
@@ -98,48 +107,549 @@ var configB = PortConfig{
 
 func TestGPIOInitialization(t *testing.T) {
 
-	// rfSwitch := NewGpioSwitch(Port(configA), Port(configB))
-	// if err := rfSwitch.Init(); err != nil {
-	// 	t.Fatal(err)
-	// }
-
-	// time.Sleep(time.Second)
-
-	// a, _ := rfSwitch.GetPort("A")
-	// b, _ := rfSwitch.GetPort("B")
-	// t.Logf("a: %s, b: %s", a, b)
-
-	// if err := rfSwitch.SetPort("A", "20m"); err != nil {
-	// 	t.Fatal(err)
-	// }
-	// a, _ = rfSwitch.GetPort("A")
-	// b, _ = rfSwitch.GetPort("B")
-	// t.Logf("a: %s, b: %s", a, b)
-	// time.Sleep(time.Millisecond * 500)
-
-	// if err := rfSwitch.SetPort("A", "40m"); err != nil {
-	// 	t.Fatal(err)
-	// }
-	// a, _ = rfSwitch.GetPort("A")
-	// b, _ = rfSwitch.GetPort("B")
-	// t.Logf("a: %s, b: %s", a, b)
-
-	// if err := rfSwitch.SetPort("B", "20m"); err != nil {
-	// 	t.Fatal(err)
-	// }
-	// a, _ = rfSwitch.GetPort("A")
-	// b, _ = rfSwitch.GetPort("B")
-	// t.Logf("a: %s, b: %s", a, b)
-
-	// time.Sleep(time.Millisecond * 500)
-	// if err := rfSwitch.SetPort("A", "20m"); err != nil {
-	// 	t.Fatal(err)
-	// }
-	// a, _ = rfSwitch.GetPort("A")
-	// b, _ = rfSwitch.GetPort("B")
-	// t.Logf("a: %s, b: %s", a, b)
-
-	// time.Sleep(time.Millisecond * 500)
-
-	// rfSwitch.Close()
+	fake := pins.NewFake()
+
+	g := NewMPSwitchGPIO(Backend(fake), Switch(SwitchConfig{
+		Name:      "8x2 Bandswitch",
+		Exclusive: true,
+		Ports:     []PortConfig{configA, configB},
+	}))
+
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// all relays are switched off in the configured order; since the
+	// pins are inverted, they are set to high
+	want := []pins.Write{}
+	for _, pc := range []PortConfig{configA, configB} {
+		for _, tc := range pc.Terminals {
+			want = append(want, pins.Write{Pin: tc.Pin, Level: true})
+		}
+	}
+
+	if got := fake.Writes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Init() writes = %v, want %v", got, want)
+	}
+
+	for _, p := range g.Serialize().Ports {
+		for _, term := range p.Terminals {
+			if term.State {
+				t.Errorf("terminal %s of port %s active after Init", term.Name, p.Name)
+			}
+		}
+	}
+}
+
+var sequenceConfig = SwitchConfig{
+	Name:      "Bandswitch",
+	Exclusive: true,
+	Ports: []PortConfig{
+		{
+			Name:      "A",
+			Exclusive: true,
+			Terminals: []PinConfig{
+				{Name: "80m", Pin: "GPIO1"},
+				{Name: "40m", Pin: "GPIO2", Index: 1, Inverted: true},
+			},
+		},
+		{
+			Name:      "B",
+			Index:     1,
+			Exclusive: true,
+			Terminals: []PinConfig{
+				{Name: "80m", Pin: "GPIO3"},
+				{Name: "40m", Pin: "GPIO4", Index: 1},
+			},
+		},
+		{
+			Name:  "Aux",
+			Index: 2,
+			Terminals: []PinConfig{
+				{Name: "amp", Pin: "GPIO5"},
+				{Name: "fan", Pin: "GPIO6", Index: 1, Inverted: true},
+			},
+		},
+	},
+}
+
+func TestMPSwitchGPIO_SetPort(t *testing.T) {
+
+	fake := pins.NewFake()
+
+	g := NewMPSwitchGPIO(Backend(fake), Switch(sequenceConfig))
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	on := func(name string) sw.Terminal { return sw.Terminal{Name: name, State: true} }
+	off := func(name string) sw.Terminal { return sw.Terminal{Name: name, State: false} }
+	w := func(pin string, level bool) pins.Write { return pins.Write{Pin: pin, Level: level} }
+
+	tests := []struct {
+		name       string
+		port       string
+		terminals  []sw.Terminal
+		wantErr    bool
+		wantWrites []pins.Write
+	}{
+		{"select terminal", "A", []sw.Terminal{on("80m")}, false,
+			[]pins.Write{w("GPIO1", true)}},
+		{"break before make on exclusive port", "A", []sw.Terminal{on("40m")}, false,
+			[]pins.Write{w("GPIO1", false), w("GPIO2", false)}},
+		{"select active terminal again", "A", []sw.Terminal{on("40m")}, false,
+			[]pins.Write{w("GPIO2", false)}},
+		{"terminal in use by other port", "B", []sw.Terminal{on("40m")}, true,
+			[]pins.Write{}},
+		{"terminal released by other port", "B", []sw.Terminal{on("80m")}, false,
+			[]pins.Write{w("GPIO3", true)}},
+		{"several terminals on non exclusive port", "Aux", []sw.Terminal{on("amp"), on("fan")}, false,
+			[]pins.Write{w("GPIO5", true), w("GPIO6", false)}},
+		{"deactivate inverted terminal", "Aux", []sw.Terminal{off("fan")}, false,
+			[]pins.Write{w("GPIO6", true)}},
+		{"deselect terminal", "A", []sw.Terminal{off("40m")}, false,
+			[]pins.Write{w("GPIO2", true)}},
+		{"unknown port", "C", []sw.Terminal{on("80m")}, true,
+			[]pins.Write{}},
+		{"unknown terminal", "A", []sw.Terminal{on("20m")}, true,
+			[]pins.Write{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.ClearWrites()
+			err := g.SetPort(sw.Port{Name: tt.port, Terminals: tt.terminals})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := fake.Writes(); !reflect.DeepEqual(got, tt.wantWrites) {
+				t.Errorf("SetPort() writes = %v, want %v", got, tt.wantWrites)
+			}
+		})
+	}
+
+	want := map[string][]bool{
+		"A":   {false, false},
+		"B":   {true, false},
+		"Aux": {true, false},
+	}
+	for portName, states := range want {
+		p, err := g.GetPort(portName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, state := range states {
+			if p.Terminals[i].State != state {
+				t.Errorf("port %s: terminal %s = %v, want %v", portName,
+					p.Terminals[i].Name, p.Terminals[i].State, state)
+			}
+		}
+	}
+}
+
+func TestMPSwitchGPIO_expander(t *testing.T) {
+
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			// read OLAT and IODIR
+			{Addr: 0x20, W: []byte{0x14}, R: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x00}, R: []byte{0xFF, 0xFF}},
+			// GPA0 - GPA3 become outputs
+			{Addr: 0x20, W: []byte{0x00, 0xFE, 0xFF}},
+			{Addr: 0x20, W: []byte{0x00, 0xFC, 0xFF}},
+			{Addr: 0x20, W: []byte{0x00, 0xF8, 0xFF}},
+			{Addr: 0x20, W: []byte{0x00, 0xF0, 0xFF}},
+			// Init deactivates all relays (40m on port B is inverted)
+			{Addr: 0x20, W: []byte{0x14, 0x08, 0x00}},
+			// A: 80m
+			{Addr: 0x20, W: []byte{0x14, 0x09, 0x00}},
+			// A: 40m; 80m is deactivated in the same transaction
+			{Addr: 0x20, W: []byte{0x14, 0x0A, 0x00}},
+			// B: 80m
+			{Addr: 0x20, W: []byte{0x14, 0x0E, 0x00}},
+		},
+		DontPanic: true,
+	}
+
+	err := i2creg.Register("mpswitchtest", nil, -1, func() (i2c.BusCloser, error) { return bus, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i2creg.Unregister("mpswitchtest")
+
+	g := NewMPSwitchGPIO(Backend(pins.NewFake()), Switch(SwitchConfig{
+		Name:      "Bandswitch",
+		Exclusive: true,
+		Ports: []PortConfig{
+			{
+				Name:      "A",
+				Exclusive: true,
+				Terminals: []PinConfig{
+					{Name: "80m", Pin: "mcp23017@mpswitchtest/0x20:GPA0"},
+					{Name: "40m", Pin: "mcp23017@mpswitchtest/0x20:GPA1", Index: 1},
+				},
+			},
+			{
+				Name:      "B",
+				Index:     1,
+				Exclusive: true,
+				Terminals: []PinConfig{
+					{Name: "80m", Pin: "mcp23017@mpswitchtest/0x20:GPA2"},
+					{Name: "40m", Pin: "mcp23017@mpswitchtest/0x20:GPA3", Index: 1, Inverted: true},
+				},
+			},
+		},
+	}))
+
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []struct {
+		port     string
+		terminal string
+		wantErr  bool
+	}{
+		{"A", "80m", false},
+		{"A", "40m", false},
+		{"B", "40m", true}, // in use by port A
+		{"B", "80m", false},
+	}
+	for _, r := range requests {
+		err := g.SetPort(sw.Port{Name: r.port, Terminals: []sw.Terminal{{Name: r.terminal, State: true}}})
+		if (err != nil) != r.wantErr {
+			t.Fatalf("SetPort(%s, %s) error = %v, wantErr %v", r.port, r.terminal, err, r.wantErr)
+		}
+	}
+
+	if bus.Count != len(bus.Ops) {
+		t.Errorf("%d of %d transactions executed", bus.Count, len(bus.Ops))
+	}
+
+	if h := g.Health(); !h.Online {
+		t.Errorf("switch offline: %s", h.Error)
+	}
+}
+
+func TestMPSwitchGPIO_fake(t *testing.T) {
+
+	fake := pins.NewFake()
+
+	g := NewMPSwitchGPIO(Backend(fake), Switch(SwitchConfig{
+		Name:      "Bandswitch",
+		Exclusive: true,
+		Ports:     []PortConfig{configA, configB},
+	}))
+
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// all pins are inverted; the relays are off after Init
+	for _, pin := range []string{"GPIO3", "GPIO19", "GPIO7", "GPIO11"} {
+		if !fake.Level(pin) {
+			t.Errorf("%s should be high after Init", pin)
+		}
+	}
+
+	if err := g.SetPort(sw.Port{Name: "A", Terminals: []sw.Terminal{{Name: "Port1A", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Level("GPIO3") {
+		t.Error("GPIO3 should be low")
+	}
+
+	err := g.SetPort(sw.Port{Name: "A", Terminals: []sw.Terminal{{Name: "Unknown", State: true}}})
+	if err == nil {
+		t.Error("expected error for unknown terminal")
+	}
+
+	fake.SetError(fmt.Errorf("broken"))
+	if err := g.SetPort(sw.Port{Name: "B", Terminals: []sw.Terminal{{Name: "Port1B", State: true}}}); err == nil {
+		t.Fatal("expected error")
+	}
+	if g.Health().Online {
+		t.Error("switch should be offline after a failed write")
+	}
+	fake.SetError(nil)
+
+	g.Close()
+	if !fake.Closed() {
+		t.Error("backend not closed")
+	}
+}
+
+var typesConfig = SwitchConfig{
+	Name: "Shack",
+	Ports: []PortConfig{
+		{
+			Name: "Rotator",
+			Terminals: []PinConfig{
+				{Name: "CW", Pin: "GPIO1", Type: Pulse, PulseWidth: time.Millisecond},
+				{Name: "CCW", Pin: "GPIO2", Index: 1, Type: Pulse, Inverted: true, PulseWidth: time.Millisecond * 2},
+			},
+		},
+		{
+			Name:      "Antenna",
+			Index:     1,
+			Exclusive: true,
+			Terminals: []PinConfig{
+				{Name: "Yagi", Pin: "GPIO3", ResetPin: "GPIO4", Type: Latching, PulseWidth: time.Millisecond},
+				{Name: "Dipole", Pin: "GPIO5", ResetPin: "GPIO6", Index: 1, Type: Latching, PulseWidth: time.Millisecond},
+				{Name: "Dummy", Pin: "GPIO7", Index: 2},
+			},
+		},
+	},
+}
+
+func TestMPSwitchGPIO_terminalTypes(t *testing.T) {
+
+	fake := pins.NewFake()
+
+	g := NewMPSwitchGPIO(Backend(fake), Switch(typesConfig))
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := func(pin string, level bool) pins.Write { return pins.Write{Pin: pin, Level: level} }
+
+	// the latching relays are reset during Init
+	wantInit := []pins.Write{
+		w("GPIO1", false), w("GPIO2", true),
+		w("GPIO3", false), w("GPIO4", true),
+		w("GPIO5", false), w("GPIO6", true),
+		w("GPIO7", false),
+		w("GPIO4", false), w("GPIO6", false),
+	}
+	if got := fake.Writes(); !reflect.DeepEqual(got, wantInit) {
+		t.Errorf("Init() writes = %v, want %v", got, wantInit)
+	}
+
+	tests := []struct {
+		name       string
+		port       string
+		terminals  []sw.Terminal
+		wantWrites []pins.Write
+		wantStates []bool
+	}{
+		{"press momentary button", "Rotator", []sw.Terminal{{Name: "CW", State: true}},
+			[]pins.Write{w("GPIO1", true), w("GPIO1", false)},
+			[]bool{false, false}},
+		{"press inverted buttons with different widths", "Rotator",
+			[]sw.Terminal{{Name: "CCW", State: true}, {Name: "CW", State: true}},
+			[]pins.Write{w("GPIO2", false), w("GPIO1", true), w("GPIO1", false), w("GPIO2", true)},
+			[]bool{false, false}},
+		{"set latching relay", "Antenna", []sw.Terminal{{Name: "Yagi", State: true}},
+			[]pins.Write{w("GPIO4", false), w("GPIO3", true), w("GPIO3", false)},
+			[]bool{true, false, false}},
+		{"exclusive port resets latching relay", "Antenna", []sw.Terminal{{Name: "Dipole", State: true}},
+			[]pins.Write{
+				w("GPIO3", false), w("GPIO4", true),
+				w("GPIO6", false), w("GPIO5", true),
+				w("GPIO4", false), w("GPIO5", false),
+			},
+			[]bool{false, true, false}},
+		{"level terminal on exclusive port", "Antenna", []sw.Terminal{{Name: "Dummy", State: true}},
+			[]pins.Write{w("GPIO5", false), w("GPIO6", true), w("GPIO7", true), w("GPIO6", false)},
+			[]bool{false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.ClearWrites()
+			if err := g.SetPort(sw.Port{Name: tt.port, Terminals: tt.terminals}); err != nil {
+				t.Fatal(err)
+			}
+			if got := fake.Writes(); !reflect.DeepEqual(got, tt.wantWrites) {
+				t.Errorf("SetPort() writes = %v, want %v", got, tt.wantWrites)
+			}
+			p, err := g.GetPort(tt.port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, state := range tt.wantStates {
+				if p.Terminals[i].State != state {
+					t.Errorf("terminal %s = %v, want %v", p.Terminals[i].Name,
+						p.Terminals[i].State, state)
+				}
+			}
+		})
+	}
+
+	// the tracked state isn't changed if the relay couldn't be switched
+	fake.SetError(fmt.Errorf("broken"))
+	if err := g.SetPort(sw.Port{Name: "Antenna", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}}); err == nil {
+		t.Fatal("expected error")
+	}
+	fake.SetError(nil)
+	p, _ := g.GetPort("Antenna")
+	if p.Terminals[0].State {
+		t.Error("state of Yagi changed after a failed write")
+	}
+}
+
+func TestMPSwitchGPIO_pulseUnlocked(t *testing.T) {
+
+	fake := pins.NewFake()
+
+	g := NewMPSwitchGPIO(Backend(fake), Switch(SwitchConfig{
+		Name: "Shack",
+		Ports: []PortConfig{
+			{
+				Name: "Rotator",
+				Terminals: []PinConfig{
+					{Name: "CW", Pin: "GPIO1", Type: Pulse, PulseWidth: time.Millisecond * 300},
+					{Name: "CCW", Pin: "GPIO2", Index: 1, Type: Pulse, PulseWidth: time.Millisecond * 300},
+				},
+			},
+		},
+	}))
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 2)
+	press := func(name string) {
+		done <- g.SetPort(sw.Port{Name: "Rotator", Terminals: []sw.Terminal{{Name: name, State: true}}})
+	}
+
+	go press("CW")
+	go press("CCW")
+
+	// the switch can be read while the button is pressed
+	time.Sleep(time.Millisecond * 50)
+	start := time.Now()
+	g.Serialize()
+	if _, err := g.GetPort("Rotator"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Millisecond*100 {
+		t.Errorf("switch locked for %v during the pulse", d)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the pulses are not interleaved
+	w := func(pin string, level bool) pins.Write { return pins.Write{Pin: pin, Level: level} }
+	writes := fake.Writes()[2:]
+	want1 := []pins.Write{w("GPIO1", true), w("GPIO1", false), w("GPIO2", true), w("GPIO2", false)}
+	want2 := []pins.Write{w("GPIO2", true), w("GPIO2", false), w("GPIO1", true), w("GPIO1", false)}
+	if !reflect.DeepEqual(writes, want1) && !reflect.DeepEqual(writes, want2) {
+		t.Errorf("writes = %v, want the pulses one after the other", writes)
+	}
+}
+
+func TestMPSwitchGPIO_invalidTerminalTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		pc   PinConfig
+	}{
+		{"unknown type", PinConfig{Name: "t", Pin: "GPIO1", Type: "toggle"}},
+		{"latching without reset pin", PinConfig{Name: "t", Pin: "GPIO1", Type: Latching}},
+		{"reset pin for level terminal", PinConfig{Name: "t", Pin: "GPIO1", ResetPin: "GPIO2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewMPSwitchGPIO(Backend(pins.NewFake()), Switch(SwitchConfig{
+				Name:  "Switch",
+				Ports: []PortConfig{{Name: "A", Terminals: []PinConfig{tt.pc}}},
+			}))
+			if err := g.Init(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMPSwitchGPIO_sensePins(t *testing.T) {
+
+	fake := pins.NewFake()
+	events := make(chan sw.Device, 10)
+
+	g := NewMPSwitchGPIO(Backend(fake), Switch(SwitchConfig{
+		Name: "Shack",
+		Ports: []PortConfig{
+			{
+				Name: "Antenna",
+				Terminals: []PinConfig{
+					{Name: "Yagi", Pin: "GPIO1", SensePin: "GPIO11"},
+					{Name: "Dipole", Pin: "GPIO2", Index: 1, SensePin: "GPIO12", SenseInverted: true},
+					{Name: "Dummy", Pin: "GPIO3", Index: 2},
+				},
+			},
+		},
+	}), EventHandler(func(s sw.Switcher, d sw.Device) { events <- d }))
+
+	// the dipole relay is already on (inverted sense pin)
+	fake.SetLevel("GPIO11", false)
+	fake.SetLevel("GPIO12", false)
+
+	if err := g.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	type want struct {
+		state, sensed, mismatch bool
+	}
+
+	check := func(t *testing.T, p sw.Port, wants []want) {
+		t.Helper()
+		for i, w := range wants {
+			term := p.Terminals[i]
+			if term.State != w.state || term.Sensed == nil ||
+				*term.Sensed != w.sensed || term.Mismatch != w.mismatch {
+				t.Errorf("terminal %s = %+v, want %+v", term.Name, term, w)
+			}
+		}
+		if dummy := p.Terminals[2]; dummy.Sensed != nil || dummy.Mismatch {
+			t.Errorf("terminal without sense pin = %+v", dummy)
+		}
+	}
+
+	event := func(t *testing.T) sw.Port {
+		t.Helper()
+		select {
+		case d := <-events:
+			return d.Ports[0]
+		case <-time.After(time.Second):
+			t.Fatal("no event received")
+		}
+		return sw.Port{}
+	}
+
+	p, _ := g.GetPort("Antenna")
+	check(t, p, []want{{false, false, false}, {false, true, true}})
+
+	// relay switched manually
+	fake.SetLevel("GPIO11", true)
+	check(t, event(t), []want{{false, true, true}, {false, true, true}})
+
+	// the commanded state matches now the sensed state
+	if err := g.SetPort(sw.Port{Name: "Antenna", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	check(t, event(t), []want{{true, true, false}, {false, true, true}})
+
+	// relay contact released
+	fake.SetLevel("GPIO12", true)
+	check(t, event(t), []want{{true, true, false}, {false, false, false}})
+
+	// sense pin can't be read
+	fake.SetError(fmt.Errorf("broken"))
+	fake.SetLevel("GPIO11", false)
+	d := <-events
+	if d.Health == nil || d.Health.Online {
+		t.Errorf("health = %+v, want offline", d.Health)
+	}
+	fake.SetError(nil)
+	d = <-events
+	if !d.Health.Online {
+		t.Errorf("health = %+v, want online", d.Health)
+	}
+	check(t, d.Ports[0], []want{{true, false, true}, {false, false, false}})
 }
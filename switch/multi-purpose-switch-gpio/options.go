@@ -1,6 +1,11 @@
 package MultiPurposeSwitchGPIO
 
-import sw "github.com/dh1tw/remoteSwitch/switch"
+import (
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/pins"
+)
 
 // Switch is a functional option to set the switch's configuration.
 func Switch(sc SwitchConfig) func(*MPSwitchGPIO) {
@@ -15,6 +20,17 @@ type SwitchConfig struct {
 	Index     int
 	Exclusive bool
 	Ports     []PortConfig
+	// Backend selects the backend which provides the GPIO pins
+	Backend pins.BackendConfig
+}
+
+// Backend is a functional option to set the backend which provides the
+// GPIO pins. It takes precedence over the backend in the SwitchConfig
+// (e.g. to inject a pins.Fake in tests).
+func Backend(b pins.Backend) func(*MPSwitchGPIO) {
+	return func(g *MPSwitchGPIO) {
+		g.backend = b
+	}
 }
 
 // PortConfig describes a port which is a collection of gpio pins. This struct
@@ -32,8 +48,40 @@ type PinConfig struct {
 	Pin      string
 	Inverted bool
 	Index    int
+	// Type of the terminal: Level (default), Pulse or Latching
+	Type string
+	// ResetPin is the pin of the reset coil of a Latching terminal. Pin
+	// drives the set coil.
+	ResetPin string
+	// PulseWidth is the duration of the pulses of Pulse and Latching
+	// terminals (default: DefaultPulseWidth)
+	PulseWidth time.Duration
+	// SensePin is an optional input pin through which the state of the
+	// terminal is read back (e.g. an auxiliary contact of the relay).
+	SensePin string
+	// SenseInverted inverts the logic of the SensePin
+	SenseInverted bool
 }
 
+// Terminal types
+const (
+	// Level terminals keep their pin active as long as they are on.
+	Level = "level"
+	// Pulse terminals (e.g. momentary buttons) activate their pin for
+	// the pulse width when they are switched on. They are always
+	// reported as off.
+	Pulse = "pulse"
+	// Latching terminals drive a dual-coil latching (bistable) relay.
+	// The set or reset coil is activated for the pulse width. Unless the
+	// relay is read back through a sense pin, its state is tracked by
+	// the switch.
+	Latching = "latching"
+)
+
+// DefaultPulseWidth is the pulse width of Pulse and Latching terminals
+// if none has been configured.
+const DefaultPulseWidth = time.Millisecond * 100
+
 // EventHandler sets a callback function through which the bandswitch
 // will report Events
 func EventHandler(h func(sw.Switcher, sw.Device)) func(*MPSwitchGPIO) {
@@ -0,0 +1,295 @@
+package pins
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+)
+
+// chip describes an I2C port expander.
+type chip struct {
+	name string
+	// pins contains the names of the pins, indexed by their number
+	pins []string
+	// registers is true for chips with direction and output latch
+	// registers (MCP230xx). The other chips (PCF857x) are quasi
+	// bidirectional and are written and read without a register address.
+	registers bool
+	iodir     byte
+	olat      byte
+}
+
+var chips = map[string]chip{
+	"mcp23008": {
+		name:      "mcp23008",
+		pins:      pinNames("GP", 0, 8),
+		registers: true,
+		iodir:     0x00,
+		olat:      0x0A,
+	},
+	"mcp23017": {
+		name:      "mcp23017",
+		pins:      append(pinNames("GPA", 0, 8), pinNames("GPB", 0, 8)...),
+		registers: true,
+		iodir:     0x00, // IODIRA, IODIRB follows (IOCON.BANK = 0)
+		olat:      0x14, // OLATA, OLATB follows
+	},
+	"pcf8574": {
+		name: "pcf8574",
+		pins: pinNames("P", 0, 8),
+	},
+	"pcf8575": {
+		name: "pcf8575",
+		pins: append(pinNames("P0", 0, 8), pinNames("P1", 0, 8)...),
+	},
+}
+
+func pinNames(prefix string, first, n int) []string {
+	names := make([]string, 0, n)
+	for i := first; i < first+n; i++ {
+		names = append(names, fmt.Sprintf("%s%d", prefix, i))
+	}
+	return names
+}
+
+// bytes returns the amount of bytes needed for the state of all pins.
+func (c chip) bytes() int {
+	return (len(c.pins) + 7) / 8
+}
+
+// Expander is an I2C port expander. Supported are the MCP23008, MCP23017,
+// PCF8574 and PCF8575. The Expander keeps a copy of the output latch, so
+// that several pins can be changed in a single bus transaction.
+type Expander struct {
+	sync.Mutex
+	dev   *i2c.Dev
+	chip  chip
+	latch uint16
+	dir   uint16 // MCP230xx only; a set bit marks an input
+}
+
+// NewExpander returns the port expander of type chip (e.g. "mcp23017")
+// at address on the bus. The current state of the outputs is read from
+// the device, so that pins which are not used by remoteSwitch are not
+// modified.
+func NewExpander(bus i2c.Bus, chipName string, address uint16) (*Expander, error) {
+
+	c, ok := chips[strings.ToLower(chipName)]
+	if !ok {
+		return nil, fmt.Errorf("unknown port expander %s (supported: mcp23008, mcp23017, pcf8574, pcf8575)", chipName)
+	}
+
+	e := &Expander{
+		dev:  &i2c.Dev{Bus: bus, Addr: address},
+		chip: c,
+	}
+
+	if !c.registers {
+		buf := make([]byte, c.bytes())
+		if err := e.dev.Tx(nil, buf); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %v", e, err)
+		}
+		e.latch = decode(buf)
+		return e, nil
+	}
+
+	buf := make([]byte, c.bytes())
+	if err := e.dev.Tx([]byte{c.olat}, buf); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", e, err)
+	}
+	e.latch = decode(buf)
+
+	if err := e.dev.Tx([]byte{c.iodir}, buf); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", e, err)
+	}
+	e.dir = decode(buf)
+
+	return e, nil
+}
+
+func (e *Expander) String() string {
+	return fmt.Sprintf("%s@%#02x", e.chip.name, e.dev.Addr)
+}
+
+// Pin returns the pin with the given name (e.g. "GPA3" on a MCP23017 or
+// "P3" on a PCF8574) and configures it as an output.
+func (e *Expander) Pin(name string) (*ExpanderPin, error) {
+	e.Lock()
+	defer e.Unlock()
+
+	for n, pName := range e.chip.pins {
+		if !strings.EqualFold(pName, name) {
+			continue
+		}
+
+		if e.chip.registers && e.dir&(1<<uint(n)) != 0 {
+			dir := e.dir &^ (1 << uint(n))
+			if err := e.dev.Tx(append([]byte{e.chip.iodir}, e.encode(dir)...), nil); err != nil {
+				return nil, fmt.Errorf("unable to configure %s:%s as output: %v", e, pName, err)
+			}
+			e.dir = dir
+		}
+
+		return &ExpanderPin{expander: e, number: n, name: pName}, nil
+	}
+
+	return nil, fmt.Errorf("%s has no pin %s (valid pins: %s)", e.chip.name, name,
+		strings.Join(e.chip.pins, ", "))
+}
+
+// OutMany sets the levels of several pins with a single bus transaction.
+func (e *Expander) OutMany(levels map[int]bool) error {
+	e.Lock()
+	defer e.Unlock()
+
+	latch := e.latch
+	for n, level := range levels {
+		if level {
+			latch |= 1 << uint(n)
+		} else {
+			latch &^= 1 << uint(n)
+		}
+	}
+
+	w := e.encode(latch)
+	if e.chip.registers {
+		w = append([]byte{e.chip.olat}, w...)
+	}
+
+	if err := e.dev.Tx(w, nil); err != nil {
+		return fmt.Errorf("unable to write %s: %v", e, err)
+	}
+
+	e.latch = latch
+
+	return nil
+}
+
+// encode returns the bytes of the chip's register(s) for a bit mask.
+func (e *Expander) encode(v uint16) []byte {
+	b := []byte{byte(v)}
+	if e.chip.bytes() == 2 {
+		b = append(b, byte(v>>8))
+	}
+	return b
+}
+
+func decode(b []byte) uint16 {
+	v := uint16(b[0])
+	if len(b) == 2 {
+		v |= uint16(b[1]) << 8
+	}
+	return v
+}
+
+// ExpanderPin is an output pin of an Expander. It implements GroupPin.
+type ExpanderPin struct {
+	expander *Expander
+	number   int
+	name     string
+}
+
+func (p *ExpanderPin) String() string {
+	return fmt.Sprintf("%s:%s", p.expander, p.name)
+}
+
+// Out sets the level of the pin.
+func (p *ExpanderPin) Out(level bool) error {
+	return p.expander.OutMany(map[int]bool{p.number: level})
+}
+
+// Group returns the expander and the number of the pin.
+func (p *ExpanderPin) Group() (Group, int) {
+	return p.expander, p.number
+}
+
+var (
+	expandersMu sync.Mutex
+	expanders   = map[string]*Expander{}
+	buses       = map[string]i2c.BusCloser{}
+)
+
+// expanderSpec is the parsed name of an expander pin.
+type expanderSpec struct {
+	chip    string
+	bus     string // empty for the default bus
+	address uint16
+	pin     string
+}
+
+// parseExpanderPin parses pin names in the form chip@[bus/]address:pin,
+// e.g. "mcp23017@0x20:GPA3" or "pcf8574@I2C1/0x27:P0". The bus name is
+// looked up in periph's I2C registry (e.g. "I2C1" or "/dev/i2c-1").
+func parseExpanderPin(name string) (expanderSpec, error) {
+
+	s := expanderSpec{}
+
+	at := strings.Index(name, "@")
+	colon := strings.LastIndex(name, ":")
+	if at < 1 || colon < at || colon == len(name)-1 {
+		return s, fmt.Errorf("invalid expander pin %s (expected chip@[bus/]address:pin)", name)
+	}
+
+	s.chip = strings.ToLower(name[:at])
+	s.pin = name[colon+1:]
+
+	addr := name[at+1 : colon]
+	if slash := strings.LastIndex(addr, "/"); slash >= 0 {
+		s.bus = addr[:slash]
+		addr = addr[slash+1:]
+	}
+
+	a, err := strconv.ParseUint(addr, 0, 16)
+	if err != nil || a > 0x7F {
+		return s, fmt.Errorf("invalid I2C address %s in pin %s", addr, name)
+	}
+	s.address = uint16(a)
+
+	return s, nil
+}
+
+// expanderPinByName returns the pin of an expander. Expanders are
+// created once and shared by all their pins.
+func expanderPinByName(name string) (Pin, error) {
+
+	s, err := parseExpanderPin(name)
+	if err != nil {
+		return nil, err
+	}
+
+	expandersMu.Lock()
+	defer expandersMu.Unlock()
+
+	bus, ok := buses[s.bus]
+	if !ok {
+		bus, err = i2creg.Open(s.bus)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open I2C bus for pin %s: %v", name, err)
+		}
+		buses[s.bus] = bus
+	}
+
+	// the same bus can be referred to by different names (e.g. "" for
+	// the default bus)
+	key := fmt.Sprintf("%s/%#02x", bus, s.address)
+
+	e, ok := expanders[key]
+	if !ok {
+		e, err = NewExpander(bus, s.chip, s.address)
+		if err != nil {
+			return nil, err
+		}
+		expanders[key] = e
+	}
+
+	if e.chip.name != s.chip {
+		return nil, fmt.Errorf("pin %s: device at address %#02x is configured as %s",
+			name, s.address, e.chip.name)
+	}
+
+	return e.Pin(s.pin)
+}
@@ -0,0 +1,273 @@
+package pins
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake is a Backend with in-memory pins. It accepts any pin name. A Fake
+// created with NewFake records all writes, so that tests of the GPIO
+// switches can assert the sequence in which the relays are switched. A
+// Fake created with NewSimulated logs the level changes instead and is
+// used to run the GPIO switches without hardware.
+type Fake struct {
+	sync.Mutex
+	pins   map[string]*FakePin
+	writes []Write
+	record bool
+	logf   func(format string, v ...interface{})
+	err    error
+	closed bool
+	done   chan struct{} // closed by Close
+}
+
+// Write is a level written to a pin of a Fake backend.
+type Write struct {
+	Pin   string
+	Level bool
+}
+
+func (w Write) String() string {
+	if w.Level {
+		return w.Pin + "=1"
+	}
+	return w.Pin + "=0"
+}
+
+// NewFake returns a Fake backend without pins which records all writes.
+func NewFake() *Fake {
+	return &Fake{
+		pins:   make(map[string]*FakePin),
+		record: true,
+		done:   make(chan struct{}),
+	}
+}
+
+// Simulated is a Fake backend which simulates all pins, including the
+// pins of I2C port expanders (see ExpanderBackend).
+type Simulated struct {
+	*Fake
+}
+
+// NewSimulated returns a backend which simulates all pins, including
+// the pins of I2C port expanders. Instead of recording the writes, each
+// level change is logged through logf (e.g. log.Printf).
+func NewSimulated(logf func(format string, v ...interface{})) *Simulated {
+	return &Simulated{
+		Fake: &Fake{
+			pins: make(map[string]*FakePin),
+			logf: logf,
+			done: make(chan struct{}),
+		},
+	}
+}
+
+// ExpanderPin returns the simulated pin of an I2C port expander.
+func (s *Simulated) ExpanderPin(name string) (Pin, error) {
+	return s.Pin(name)
+}
+
+// ExpanderIn returns the simulated pin of an I2C port expander as an
+// input pin.
+func (s *Simulated) ExpanderIn(name string) (InPin, error) {
+	return s.In(name)
+}
+
+// Pin returns the pin with the given name. The pin is created with a low
+// level on the first call.
+func (f *Fake) Pin(name string) (Pin, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if !strings.Contains(name, "@") {
+		name = strings.ToUpper(name)
+	}
+
+	return f.pin(name), nil
+}
+
+// In returns the pin with the given name as an input pin. Its level can
+// be changed with SetLevel to simulate an external change.
+func (f *Fake) In(name string) (InPin, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if !strings.Contains(name, "@") {
+		name = strings.ToUpper(name)
+	}
+
+	return f.pin(name), nil
+}
+
+// pin returns the pin with the given (normalized) name and creates it if
+// necessary. This method is not threadsafe.
+func (f *Fake) pin(name string) *FakePin {
+
+	p, ok := f.pins[name]
+	if !ok {
+		p = &FakePin{fake: f, name: name, edges: make(chan struct{}, 1)}
+		f.pins[name] = p
+	}
+
+	return p
+}
+
+// SetLevel sets the level of the pin with the given name without
+// recording a write, e.g. to simulate a change of an input pin.
+func (f *Fake) SetLevel(name string, level bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	if !strings.Contains(name, "@") {
+		name = strings.ToUpper(name)
+	}
+
+	f.pin(name).set(level)
+}
+
+// Level returns the level of the pin with the given name. Pins which
+// have not been requested are low.
+func (f *Fake) Level(name string) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	if !strings.Contains(name, "@") {
+		name = strings.ToUpper(name)
+	}
+
+	p, ok := f.pins[name]
+	if !ok {
+		return false
+	}
+	return p.level
+}
+
+// Writes returns the recorded writes in the order they have been
+// executed. Writes which don't change the level of a pin are included.
+func (f *Fake) Writes() []Write {
+	f.Lock()
+	defer f.Unlock()
+
+	w := make([]Write, len(f.writes))
+	copy(w, f.writes)
+	return w
+}
+
+// ClearWrites deletes the recorded writes (e.g. after the switch has
+// been initialized).
+func (f *Fake) ClearWrites() {
+	f.Lock()
+	defer f.Unlock()
+	f.writes = nil
+}
+
+// SetError makes all subsequent writes fail with err (e.g. to simulate a
+// broken connection). Writes succeed again after SetError(nil).
+func (f *Fake) SetError(err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.err = err
+}
+
+// Closed returns true if the backend has been closed.
+func (f *Fake) Closed() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.closed
+}
+
+// Close marks the backend as closed.
+func (f *Fake) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	if !f.closed {
+		close(f.done)
+	}
+	f.closed = true
+	return nil
+}
+
+// FakePin is a pin of the Fake backend. It can be used as output and
+// as input pin.
+type FakePin struct {
+	fake  *Fake
+	name  string
+	level bool
+	edges chan struct{}
+}
+
+func (p *FakePin) String() string {
+	return p.name
+}
+
+// Out sets the level of the pin.
+func (p *FakePin) Out(level bool) error {
+	f := p.fake
+	f.Lock()
+	defer f.Unlock()
+
+	if f.err != nil {
+		return fmt.Errorf("unable to set pin %s: %v", p.name, f.err)
+	}
+
+	if f.record {
+		f.writes = append(f.writes, Write{Pin: p.name, Level: level})
+	}
+
+	if f.logf != nil && p.level != level {
+		f.logf("simulated pin %s", Write{Pin: p.name, Level: level})
+	}
+
+	p.set(level)
+
+	return nil
+}
+
+// set changes the level of the pin and signals the edge to a waiting
+// WaitForEdge. This method is not threadsafe.
+func (p *FakePin) set(level bool) {
+	if p.level == level {
+		return
+	}
+	p.level = level
+	select {
+	case p.edges <- struct{}{}:
+	default:
+	}
+}
+
+// Read returns the level of the pin.
+func (p *FakePin) Read() (bool, error) {
+	f := p.fake
+	f.Lock()
+	defer f.Unlock()
+
+	if f.err != nil {
+		return false, fmt.Errorf("unable to read pin %s: %v", p.name, f.err)
+	}
+
+	return p.level, nil
+}
+
+// WaitForEdge waits until the level of the pin changes, the timeout
+// expires or the backend is closed. A negative timeout waits forever.
+func (p *FakePin) WaitForEdge(timeout time.Duration) bool {
+
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	select {
+	case <-p.edges:
+		return true
+	case <-expired:
+		return false
+	case <-p.fake.done:
+		return false
+	}
+}
@@ -0,0 +1,448 @@
+//go:build linux
+
+package pins
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The structs and ioctls below mirror version 2 of the GPIO character
+// device uAPI (linux/gpio.h, Linux >= 5.10).
+
+const (
+	gpioMaxNameSize       = 32
+	gpioV2LinesMax        = 64
+	gpioV2AttrsMax        = 10
+	gpioV2FlagInput       = 1 << 2
+	gpioV2FlagOutput      = 1 << 3
+	gpioV2FlagEdgeRising  = 1 << 4
+	gpioV2FlagEdgeFalling = 1 << 5
+	gpioV2AttrValues      = 2  // GPIO_V2_LINE_ATTR_ID_OUTPUT_VALUES
+	gpioV2LineEventSize   = 48 // sizeof(struct gpio_v2_line_event)
+)
+
+type gpiochipInfo struct {
+	name  [gpioMaxNameSize]byte
+	label [gpioMaxNameSize]byte
+	lines uint32
+}
+
+type gpioV2LineAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64 // flags, values or debounce period
+}
+
+type gpioV2LineConfigAttribute struct {
+	attr gpioV2LineAttribute
+	mask uint64
+}
+
+type gpioV2LineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [gpioV2AttrsMax]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	offsets         [gpioV2LinesMax]uint32
+	consumer        [gpioMaxNameSize]byte
+	config          gpioV2LineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type gpioV2LineValues struct {
+	bits uint64
+	mask uint64
+}
+
+type gpioV2LineInfo struct {
+	name     [gpioMaxNameSize]byte
+	consumer [gpioMaxNameSize]byte
+	offset   uint32
+	numAttrs uint32
+	flags    uint64
+	attrs    [gpioV2AttrsMax]gpioV2LineAttribute
+	padding  [4]uint32
+}
+
+// ioc returns the number of a GPIO ioctl, like the _IOC macro.
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 0xB4<<8 | nr
+}
+
+var (
+	gpioGetChipInfoIoctl     = ioc(2, 0x01, unsafe.Sizeof(gpiochipInfo{}))
+	gpioV2GetLineInfoIoctl   = ioc(3, 0x05, unsafe.Sizeof(gpioV2LineInfo{}))
+	gpioV2GetLineIoctl       = ioc(3, 0x07, unsafe.Sizeof(gpioV2LineRequest{}))
+	gpioV2LineGetValuesIoctl = ioc(3, 0x0E, unsafe.Sizeof(gpioV2LineValues{}))
+	gpioV2LineSetValuesIoctl = ioc(3, 0x0F, unsafe.Sizeof(gpioV2LineValues{}))
+)
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// cString returns the string of a NUL terminated byte array.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// gpiod is the Backend for the GPIO character device of the Linux
+// kernel. All pins of a switch are requested together, so that they can
+// be set atomically. The lines are requested with the first write, so
+// that they immediately get the correct levels.
+type gpiod struct {
+	sync.Mutex
+	path     string
+	consumer string
+	chip     *os.File
+	lines    []uint32 // offsets of the pins on the chip
+	pins     []*gpiodPin
+	values   uint64   // bit n contains the level of lines[n]
+	req      *os.File // nil until the lines have been requested
+	inputs   []*gpiodInPin
+}
+
+func newGPIOD(chip, consumer string) (Backend, error) {
+
+	path := chip
+	if !strings.HasPrefix(path, "/") {
+		path = "/dev/" + chip
+	}
+
+	// the consumer label is NUL terminated
+	if len(consumer) >= gpioMaxNameSize {
+		consumer = consumer[:gpioMaxNameSize-1]
+	}
+
+	g := &gpiod{
+		path:     path,
+		consumer: consumer,
+	}
+
+	return g, nil
+}
+
+// Pin returns the line with the given name (e.g. "GPIO17" on a Raspberry
+// Pi) or offset (e.g. "17") on the chip.
+func (g *gpiod) Pin(name string) (Pin, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	if err := g.open(); err != nil {
+		return nil, err
+	}
+
+	offset, err := g.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, in := range g.inputs {
+		if in.offset == offset {
+			return nil, fmt.Errorf("pin %s is already used as input", name)
+		}
+	}
+
+	for n, l := range g.lines {
+		if l == offset {
+			return g.pins[n], nil
+		}
+	}
+
+	if len(g.lines) == gpioV2LinesMax {
+		return nil, fmt.Errorf("unable to request pin %s; a switch can use at most %d lines of %s",
+			name, gpioV2LinesMax, g.path)
+	}
+
+	p := &gpiodPin{
+		backend: g,
+		number:  len(g.lines),
+		name:    fmt.Sprintf("%s/%s", strings.TrimPrefix(g.path, "/dev/"), name),
+	}
+
+	g.lines = append(g.lines, offset)
+	g.pins = append(g.pins, p)
+
+	// the lines are requested again with the next write
+	if g.req != nil {
+		g.req.Close()
+		g.req = nil
+	}
+
+	return p, nil
+}
+
+// In requests the line with the given name or offset on the chip as
+// input with edge detection. Each input is requested on its own, so
+// that the outputs are not affected.
+func (g *gpiod) In(name string) (InPin, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	if err := g.open(); err != nil {
+		return nil, err
+	}
+
+	offset, err := g.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range g.lines {
+		if l == offset {
+			return nil, fmt.Errorf("pin %s is already used as output", name)
+		}
+	}
+
+	req := gpioV2LineRequest{numLines: 1}
+	req.offsets[0] = offset
+	copy(req.consumer[:], g.consumer)
+	req.config.flags = gpioV2FlagInput | gpioV2FlagEdgeRising | gpioV2FlagEdgeFalling
+
+	if err := ioctl(g.chip.Fd(), gpioV2GetLineIoctl, unsafe.Pointer(&req)); err != nil {
+		if err == syscall.EBUSY {
+			return nil, fmt.Errorf("unable to request pin %s of gpio chip %s: in use by another application", name, g.path)
+		}
+		return nil, fmt.Errorf("unable to request pin %s of gpio chip %s: %v", name, g.path, err)
+	}
+
+	// a non-blocking file is handled by the runtime's poller, so that
+	// the edge events can be read with a deadline
+	if err := syscall.SetNonblock(int(req.fd), true); err != nil {
+		syscall.Close(int(req.fd))
+		return nil, err
+	}
+
+	p := &gpiodInPin{
+		file:   os.NewFile(uintptr(req.fd), g.path+" "+name),
+		offset: offset,
+		name:   fmt.Sprintf("%s/%s", strings.TrimPrefix(g.path, "/dev/"), name),
+	}
+	g.inputs = append(g.inputs, p)
+
+	return p, nil
+}
+
+// open opens the chip if necessary. This method is not threadsafe.
+func (g *gpiod) open() error {
+
+	if g.chip != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(g.path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open gpio chip: %v", err)
+	}
+	g.chip = f
+
+	return nil
+}
+
+// lookup returns the offset of a line on the chip.
+func (g *gpiod) lookup(name string) (uint32, error) {
+
+	info := gpiochipInfo{}
+	if err := ioctl(g.chip.Fd(), gpioGetChipInfoIoctl, unsafe.Pointer(&info)); err != nil {
+		return 0, fmt.Errorf("unable to read gpio chip %s: %v", g.path, err)
+	}
+
+	if offset, err := strconv.ParseUint(name, 10, 32); err == nil {
+		if offset >= uint64(info.lines) {
+			return 0, fmt.Errorf("gpio chip %s has only %d lines", g.path, info.lines)
+		}
+		return uint32(offset), nil
+	}
+
+	for offset := uint32(0); offset < info.lines; offset++ {
+		li := gpioV2LineInfo{offset: offset}
+		if err := ioctl(g.chip.Fd(), gpioV2GetLineInfoIoctl, unsafe.Pointer(&li)); err != nil {
+			return 0, fmt.Errorf("unable to read line %d of gpio chip %s: %v", offset, g.path, err)
+		}
+		if strings.EqualFold(cString(li.name[:]), name) {
+			return offset, nil
+		}
+	}
+
+	return 0, fmt.Errorf("failed to find pin %s on gpio chip %s", name, g.path)
+}
+
+// OutMany sets the levels of several pins atomically.
+func (g *gpiod) OutMany(levels map[int]bool) error {
+	g.Lock()
+	defer g.Unlock()
+
+	values := g.values
+	for n, level := range levels {
+		if level {
+			values |= 1 << uint(n)
+		} else {
+			values &^= 1 << uint(n)
+		}
+	}
+
+	mask := uint64(1)<<uint(len(g.lines)) - 1
+	if len(g.lines) == gpioV2LinesMax {
+		mask = ^uint64(0)
+	}
+
+	if g.req == nil {
+		if err := g.request(values, mask); err != nil {
+			return err
+		}
+		g.values = values
+		return nil
+	}
+
+	v := gpioV2LineValues{bits: values, mask: mask}
+	if err := ioctl(g.req.Fd(), gpioV2LineSetValuesIoctl, unsafe.Pointer(&v)); err != nil {
+		return fmt.Errorf("unable to set lines of gpio chip %s: %v", g.path, err)
+	}
+
+	g.values = values
+
+	return nil
+}
+
+// request requests all lines as outputs with the given levels.
+func (g *gpiod) request(values, mask uint64) error {
+
+	req := gpioV2LineRequest{numLines: uint32(len(g.lines))}
+	copy(req.offsets[:], g.lines)
+	copy(req.consumer[:], g.consumer)
+
+	req.config.flags = gpioV2FlagOutput
+	req.config.numAttrs = 1
+	req.config.attrs[0].attr.id = gpioV2AttrValues
+	req.config.attrs[0].attr.value = values
+	req.config.attrs[0].mask = mask
+
+	if err := ioctl(g.chip.Fd(), gpioV2GetLineIoctl, unsafe.Pointer(&req)); err != nil {
+		if err == syscall.EBUSY {
+			return fmt.Errorf("unable to request lines of gpio chip %s: in use by another application", g.path)
+		}
+		return fmt.Errorf("unable to request lines of gpio chip %s: %v", g.path, err)
+	}
+
+	g.req = os.NewFile(uintptr(req.fd), g.path+" lines")
+
+	return nil
+}
+
+// Close releases the lines and closes the chip.
+func (g *gpiod) Close() error {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.req != nil {
+		g.req.Close()
+		g.req = nil
+	}
+
+	for _, in := range g.inputs {
+		in.file.Close()
+	}
+	g.inputs = nil
+
+	if g.chip == nil {
+		return nil
+	}
+
+	err := g.chip.Close()
+	g.chip = nil
+
+	return err
+}
+
+// gpiodPin is a line of a GPIO chip. It implements GroupPin.
+type gpiodPin struct {
+	backend *gpiod
+	number  int
+	name    string
+}
+
+func (p *gpiodPin) String() string {
+	return p.name
+}
+
+func (p *gpiodPin) Out(level bool) error {
+	return p.backend.OutMany(map[int]bool{p.number: level})
+}
+
+func (p *gpiodPin) Group() (Group, int) {
+	return p.backend, p.number
+}
+
+// gpiodInPin is a line of a GPIO chip which has been requested as input
+// with edge detection.
+type gpiodInPin struct {
+	file   *os.File
+	offset uint32
+	name   string
+}
+
+func (p *gpiodInPin) String() string {
+	return p.name
+}
+
+func (p *gpiodInPin) Read() (bool, error) {
+
+	// File.Fd would switch the file back into blocking mode
+	rc, err := p.file.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+
+	v := gpioV2LineValues{mask: 1}
+	var ioctlErr error
+	if err := rc.Control(func(fd uintptr) {
+		ioctlErr = ioctl(fd, gpioV2LineGetValuesIoctl, unsafe.Pointer(&v))
+	}); err != nil {
+		return false, err
+	}
+	if ioctlErr != nil {
+		return false, fmt.Errorf("unable to read pin %s: %v", p.name, ioctlErr)
+	}
+
+	return v.bits&1 == 1, nil
+}
+
+// WaitForEdge reads the edge events of the line. A negative timeout
+// waits forever.
+func (p *gpiodInPin) WaitForEdge(timeout time.Duration) bool {
+
+	deadline := time.Time{}
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := p.file.SetReadDeadline(deadline); err != nil {
+		return false
+	}
+
+	buf := make([]byte, gpioV2LineEventSize*16)
+	n, err := p.file.Read(buf)
+
+	return err == nil && n >= gpioV2LineEventSize
+}
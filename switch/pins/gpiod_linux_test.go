@@ -0,0 +1,97 @@
+//go:build linux
+
+package pins
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+)
+
+// the structs must have the same size as in linux/gpio.h
+func Test_gpiodStructSizes(t *testing.T) {
+	tests := []struct {
+		name string
+		got  uintptr
+		want uintptr
+	}{
+		{"gpiochip_info", unsafe.Sizeof(gpiochipInfo{}), 68},
+		{"gpio_v2_line_attribute", unsafe.Sizeof(gpioV2LineAttribute{}), 16},
+		{"gpio_v2_line_config", unsafe.Sizeof(gpioV2LineConfig{}), 272},
+		{"gpio_v2_line_request", unsafe.Sizeof(gpioV2LineRequest{}), 592},
+		{"gpio_v2_line_values", unsafe.Sizeof(gpioV2LineValues{}), 16},
+		{"gpio_v2_line_info", unsafe.Sizeof(gpioV2LineInfo{}), 256},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("sizeof(%s) = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func Test_gpiodIoctls(t *testing.T) {
+	tests := []struct {
+		name string
+		got  uintptr
+		want uintptr
+	}{
+		{"GPIO_GET_CHIPINFO_IOCTL", gpioGetChipInfoIoctl, 0x8044B401},
+		{"GPIO_V2_GET_LINEINFO_IOCTL", gpioV2GetLineInfoIoctl, 0xC100B405},
+		{"GPIO_V2_GET_LINE_IOCTL", gpioV2GetLineIoctl, 0xC250B407},
+		{"GPIO_V2_LINE_GET_VALUES_IOCTL", gpioV2LineGetValuesIoctl, 0xC010B40E},
+		{"GPIO_V2_LINE_SET_VALUES_IOCTL", gpioV2LineSetValuesIoctl, 0xC010B40F},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %#x, want %#x", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestGPIOD(t *testing.T) {
+
+	// requires a GPIO chip, e.g. provided by the gpio-sim kernel module
+	chip := os.Getenv("REMOTESWITCH_TEST_GPIOCHIP")
+	if len(chip) == 0 {
+		t.Skip("REMOTESWITCH_TEST_GPIOCHIP not set")
+	}
+
+	b, err := NewBackend(BackendConfig{Name: GPIOD, Chip: chip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	p0, err := b.Pin("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1, err := b.Pin("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Out(Change{p0, true}, Change{p1, false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Out(Change{p0, false}, Change{p1, true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Pin("not-existing"); err == nil {
+		t.Error("expected error for unknown line")
+	}
+}
+
+func TestGPIOD_noChip(t *testing.T) {
+
+	b, err := NewBackend(BackendConfig{Name: GPIOD, Chip: "/dev/gpiochip-not-existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if _, err := b.Pin("GPIO17"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package pins
+
+import "fmt"
+
+func newGPIOD(chip, consumer string) (Backend, error) {
+	return nil, fmt.Errorf("the gpiod backend is only supported on Linux")
+}
@@ -0,0 +1,325 @@
+// Package pins provides the output pins which drive the relays of the
+// GPIO based switches. A pin is either a GPIO pin of the host (e.g.
+// "GPIO3") or a pin of an I2C port expander (e.g. "mcp23017@0x20:GPA3").
+// The GPIO pins of the host are provided by a Backend, which is selected
+// per switch.
+package pins
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/host/v3"
+)
+
+// Pin is an output pin.
+type Pin interface {
+	fmt.Stringer
+	// Out sets the level of the pin.
+	Out(level bool) error
+}
+
+// InPin is an input pin, e.g. to sense the state of a relay through an
+// auxiliary contact.
+type InPin interface {
+	fmt.Stringer
+	// Read returns the level of the pin.
+	Read() (bool, error)
+	// WaitForEdge waits until the level of the pin changes or the
+	// timeout expires. It returns false if the timeout expired or the
+	// pin has been released.
+	WaitForEdge(timeout time.Duration) bool
+}
+
+// Group is implemented by devices which can change several of their pins
+// in a single transaction (e.g. I2C port expanders).
+type Group interface {
+	// OutMany sets the levels of several pins. The key of the map is the
+	// number of the pin on the device.
+	OutMany(levels map[int]bool) error
+}
+
+// GroupPin is a Pin which belongs to a Group.
+type GroupPin interface {
+	Pin
+	// Group returns the device of the pin and the pin's number on it.
+	Group() (Group, int)
+}
+
+// Change describes the new level of a pin.
+type Change struct {
+	Pin   Pin
+	Level bool
+}
+
+// Out applies several changes. Changes of pins which belong to the same
+// Group are written in a single transaction; if a pin is changed more
+// than once, the last change wins. All other pins are set one by one in
+// the given order before the groups are written.
+func Out(changes ...Change) error {
+
+	groups := []Group{}
+	levels := map[Group]map[int]bool{}
+
+	for _, c := range changes {
+		if gp, ok := c.Pin.(GroupPin); ok {
+			g, n := gp.Group()
+			if _, ok := levels[g]; !ok {
+				groups = append(groups, g)
+				levels[g] = map[int]bool{}
+			}
+			levels[g][n] = c.Level
+			continue
+		}
+		if err := c.Pin.Out(c.Level); err != nil {
+			return fmt.Errorf("unable to set pin %s: %v", c.Pin, err)
+		}
+	}
+
+	for _, g := range groups {
+		if err := g.OutMany(levels[g]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Backend provides the GPIO pins of the host.
+type Backend interface {
+	// Pin returns the output pin with the given name.
+	Pin(name string) (Pin, error)
+	// In returns the input pin with the given name. Edges are detected
+	// in both directions.
+	In(name string) (InPin, error)
+	// Close releases all pins of the backend.
+	Close() error
+}
+
+// ExpanderBackend is implemented by backends which provide the pins of
+// I2C port expanders themselves (e.g. a simulated backend). For all other
+// backends, the expanders are accessed through the I2C bus of the host.
+type ExpanderBackend interface {
+	// ExpanderPin returns the output pin of an I2C port expander.
+	ExpanderPin(name string) (Pin, error)
+	// ExpanderIn returns the input pin of an I2C port expander.
+	ExpanderIn(name string) (InPin, error)
+}
+
+// Supported backends
+const (
+	// Sysfs accesses the pins through periph.io and the deprecated sysfs
+	// GPIO interface of the Linux kernel.
+	Sysfs = "sysfs"
+	// GPIOD accesses the pins through the GPIO character device
+	// (/dev/gpiochipN) of the Linux kernel.
+	GPIOD = "gpiod"
+)
+
+// BackendConfig selects and configures the backend of a switch.
+type BackendConfig struct {
+	// Name of the backend (default: Sysfs)
+	Name string
+	// Chip is the GPIO chip used by the GPIOD backend (default: gpiochip0)
+	Chip string
+	// Consumer is the label of the lines requested by the GPIOD backend
+	// (default: remoteSwitch)
+	Consumer string
+}
+
+// NewBackend returns the backend described by the config. The pins are
+// not accessed before they are requested with Pin.
+func NewBackend(c BackendConfig) (Backend, error) {
+	switch c.Name {
+	case "", Sysfs:
+		return &sysfs{}, nil
+	case GPIOD:
+		chip := c.Chip
+		if len(chip) == 0 {
+			chip = "gpiochip0"
+		}
+		consumer := c.Consumer
+		if len(consumer) == 0 {
+			consumer = "remoteSwitch"
+		}
+		return newGPIOD(chip, consumer)
+	default:
+		return nil, fmt.Errorf("unknown gpio backend %s (supported: %s, %s)", c.Name, Sysfs, GPIOD)
+	}
+}
+
+// ByName returns the pin with the given name. Names in the form
+// chip@[bus/]address:pin refer to pins of I2C port expanders (see
+// ExpanderPin), all other names to GPIO pins of the host (e.g. "GPIO3")
+// which are provided by the backend. Backends which implement
+// ExpanderBackend (e.g. NewSimulated) provide the expander pins, too.
+// Pins of the same expander share the device, so that they can be set
+// in one transaction with Out.
+func ByName(b Backend, name string) (Pin, error) {
+
+	if strings.Contains(name, "@") {
+		if eb, ok := b.(ExpanderBackend); ok {
+			return eb.ExpanderPin(name)
+		}
+		if err := initHost(); err != nil {
+			return nil, err
+		}
+		return expanderPinByName(name)
+	}
+
+	return b.Pin(name)
+}
+
+// InByName returns the input pin with the given name. Only GPIO pins of
+// the host can be used as inputs; the pins of I2C port expanders are
+// only supported by backends which implement ExpanderBackend.
+func InByName(b Backend, name string) (InPin, error) {
+
+	if strings.Contains(name, "@") {
+		if eb, ok := b.(ExpanderBackend); ok {
+			return eb.ExpanderIn(name)
+		}
+		return nil, fmt.Errorf("pin %s: pins of I2C port expanders can't be used as inputs", name)
+	}
+
+	return b.In(name)
+}
+
+// Watch calls fn with the level of the input pin initially and after
+// every edge until stop is closed. Since an edge might be missed (e.g.
+// while the level is read), the level is also read if no edge has been
+// detected within the interval. Read errors are reported through fn as
+// well. This function is blocking and should be executed in its own go
+// routine.
+func Watch(p InPin, interval time.Duration, stop <-chan struct{}, fn func(level bool, err error)) {
+	for {
+		level, err := p.Read()
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		fn(level, err)
+
+		if err != nil {
+			// don't spin on a broken pin
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+			continue
+		}
+
+		p.WaitForEdge(interval)
+	}
+}
+
+var (
+	hostOnce sync.Once
+	hostErr  error
+	hostGPIO bool // true if the sysfs-gpio driver has been loaded
+)
+
+// initHost initializes the periph.io drivers of the host.
+func initHost() error {
+	hostOnce.Do(func() {
+		hostState, err := host.Init()
+		if err != nil {
+			hostErr = err
+			return
+		}
+		for _, driver := range hostState.Loaded {
+			if driver.String() == "sysfs-gpio" {
+				hostGPIO = true
+			}
+		}
+	})
+	return hostErr
+}
+
+// sysfs is the Backend for the pins registered in periph.io's gpioreg.
+type sysfs struct{}
+
+func (b *sysfs) Pin(name string) (Pin, error) {
+
+	p, err := b.byName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostPin{p}, nil
+}
+
+func (b *sysfs) In(name string) (InPin, error) {
+
+	p, err := b.byName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.In(gpio.PullNoChange, gpio.BothEdges); err != nil {
+		return nil, fmt.Errorf("unable to configure pin %s as input: %v", name, err)
+	}
+
+	return &hostInPin{p}, nil
+}
+
+// byName returns the pin registered in periph.io's gpioreg.
+func (b *sysfs) byName(name string) (gpio.PinIO, error) {
+
+	if err := initHost(); err != nil {
+		return nil, err
+	}
+
+	if !hostGPIO {
+		return nil, fmt.Errorf("sysfs-gpio driver was not loaded; try running as root or use the gpiod backend")
+	}
+
+	p := gpioreg.ByName(strings.ToUpper(name))
+	if p == nil {
+		return nil, fmt.Errorf("failed to find pin %s", name)
+	}
+
+	return p, nil
+}
+
+func (b *sysfs) Close() error {
+	return nil
+}
+
+// hostPin is a GPIO pin registered in periph.io's gpioreg.
+type hostPin struct {
+	pin gpio.PinOut
+}
+
+func (p *hostPin) String() string {
+	return p.pin.Name()
+}
+
+func (p *hostPin) Out(level bool) error {
+	return p.pin.Out(gpio.Level(level))
+}
+
+// hostInPin is a GPIO input pin registered in periph.io's gpioreg.
+type hostInPin struct {
+	pin gpio.PinIn
+}
+
+func (p *hostInPin) String() string {
+	return p.pin.Name()
+}
+
+func (p *hostInPin) Read() (bool, error) {
+	return p.pin.Read() == gpio.High, nil
+}
+
+func (p *hostInPin) WaitForEdge(timeout time.Duration) bool {
+	return p.pin.WaitForEdge(timeout)
+}
@@ -0,0 +1,427 @@
+package pins
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
+	"periph.io/x/conn/v3/i2c/i2ctest"
+)
+
+func Test_parseExpanderPin(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin     string
+		want    expanderSpec
+		wantErr bool
+	}{
+		{"default bus", "mcp23017@0x20:GPA3", expanderSpec{"mcp23017", "", 0x20, "GPA3"}, false},
+		{"upper case chip", "PCF8574@0x27:P0", expanderSpec{"pcf8574", "", 0x27, "P0"}, false},
+		{"decimal address", "pcf8574@39:P7", expanderSpec{"pcf8574", "", 0x27, "P7"}, false},
+		{"bus name", "mcp23008@I2C1/0x21:GP1", expanderSpec{"mcp23008", "I2C1", 0x21, "GP1"}, false},
+		{"bus path", "pcf8575@/dev/i2c-1/0x20:P17", expanderSpec{"pcf8575", "/dev/i2c-1", 0x20, "P17"}, false},
+		{"no chip", "@0x20:GPA3", expanderSpec{}, true},
+		{"no pin", "mcp23017@0x20", expanderSpec{}, true},
+		{"empty pin", "mcp23017@0x20:", expanderSpec{}, true},
+		{"invalid address", "mcp23017@0xZZ:GPA3", expanderSpec{}, true},
+		{"address out of range", "mcp23017@0x80:GPA3", expanderSpec{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpanderPin(tt.pin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExpanderPin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExpanderPin() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewExpander(t *testing.T) {
+	tests := []struct {
+		name      string
+		chip      string
+		ops       []i2ctest.IO
+		wantLatch uint16
+		wantDir   uint16
+		wantErr   bool
+	}{
+		{"mcp23017", "mcp23017", []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x14}, R: []byte{0x01, 0x80}},
+			{Addr: 0x20, W: []byte{0x00}, R: []byte{0xFF, 0x7F}},
+		}, 0x8001, 0x7FFF, false},
+		{"mcp23008", "mcp23008", []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x0A}, R: []byte{0x02}},
+			{Addr: 0x20, W: []byte{0x00}, R: []byte{0xFF}},
+		}, 0x02, 0xFF, false},
+		{"pcf8574", "pcf8574", []i2ctest.IO{
+			{Addr: 0x20, R: []byte{0xF0}},
+		}, 0xF0, 0, false},
+		{"pcf8575", "pcf8575", []i2ctest.IO{
+			{Addr: 0x20, R: []byte{0x0F, 0xF0}},
+		}, 0xF00F, 0, false},
+		{"unknown chip", "tca9555", nil, 0, 0, true},
+		{"device not responding", "pcf8574", nil, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := &i2ctest.Playback{Ops: tt.ops, DontPanic: true}
+			e, err := NewExpander(bus, tt.chip, 0x20)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewExpander() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if e.latch != tt.wantLatch || e.dir != tt.wantDir {
+				t.Errorf("latch = %#04x, dir = %#04x, want %#04x, %#04x",
+					e.latch, e.dir, tt.wantLatch, tt.wantDir)
+			}
+			if err := bus.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestExpander_Pin(t *testing.T) {
+
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x14}, R: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x00}, R: []byte{0xFF, 0xFF}},
+			// GPB1 becomes an output
+			{Addr: 0x20, W: []byte{0x00, 0xFF, 0xFD}},
+		},
+		DontPanic: true,
+	}
+
+	e, err := NewExpander(bus, "mcp23017", 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := e.Pin("gpb1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "mcp23017@0x20:GPB1" {
+		t.Errorf("String() = %s", p)
+	}
+
+	// already an output; no transaction
+	if _, err := e.Pin("GPB1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Pin("P0"); err == nil {
+		t.Error("expected error for unknown pin")
+	}
+
+	if err := bus.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// fakePin records the levels it has been set to.
+type fakePin struct {
+	name   string
+	levels []bool
+}
+
+func (p *fakePin) String() string { return p.name }
+
+func (p *fakePin) Out(level bool) error {
+	p.levels = append(p.levels, level)
+	return nil
+}
+
+func TestOut(t *testing.T) {
+
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x27, R: []byte{0x01}},
+			// P0 off, P3 on; a single write
+			{Addr: 0x27, W: []byte{0x08}},
+		},
+		DontPanic: true,
+	}
+
+	e, err := NewExpander(bus, "pcf8574", 0x27)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p0, _ := e.Pin("P0")
+	p3, _ := e.Pin("P3")
+	host := &fakePin{name: "GPIO4"}
+
+	err = Out(
+		Change{p0, false},
+		Change{host, false},
+		Change{p3, false},
+		Change{host, true},
+		Change{p3, true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(host.levels, []bool{false, true}) {
+		t.Errorf("host pin levels = %v", host.levels)
+	}
+
+	if err := bus.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOut_error(t *testing.T) {
+
+	bus := &i2ctest.Playback{
+		Ops:       []i2ctest.IO{{Addr: 0x27, R: []byte{0x01}}},
+		DontPanic: true,
+	}
+
+	e, err := NewExpander(bus, "pcf8574", 0x27)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p0, _ := e.Pin("P0")
+
+	if err := Out(Change{p0, false}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// the latch must not be updated if the write failed
+	if e.latch != 0x01 {
+		t.Errorf("latch = %#02x, want 0x01", e.latch)
+	}
+}
+
+func TestByName_expander(t *testing.T) {
+
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x14}, R: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x00}, R: []byte{0xFF, 0xFF}},
+			{Addr: 0x20, W: []byte{0x00, 0xFE, 0xFF}},
+			{Addr: 0x20, W: []byte{0x00, 0xFC, 0xFF}},
+		},
+		DontPanic: true,
+	}
+
+	err := i2creg.Register("pinstest", nil, -1, func() (i2c.BusCloser, error) { return bus, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i2creg.Unregister("pinstest")
+
+	// both pins share the same expander
+	for i, name := range []string{"mcp23017@pinstest/0x20:GPA0", "MCP23017@pinstest/32:GPA1"} {
+		p, err := ByName(NewFake(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := p.String(), fmt.Sprintf("mcp23017@0x20:GPA%d", i); got != want {
+			t.Errorf("String() = %s, want %s", got, want)
+		}
+	}
+
+	if _, err := ByName(NewFake(), "pcf8574@pinstest/0x20:P0"); err == nil {
+		t.Error("expected error for a different chip on the same address")
+	}
+
+	if _, err := ByName(NewFake(), "mcp23017@unknown/0x20:GPA0"); err == nil {
+		t.Error("expected error for unknown bus")
+	}
+
+	if bus.Count != len(bus.Ops) {
+		t.Errorf("%d of %d transactions executed", bus.Count, len(bus.Ops))
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  BackendConfig
+		wantErr bool
+	}{
+		{"default", BackendConfig{}, false},
+		{"sysfs", BackendConfig{Name: Sysfs}, false},
+		{"unknown", BackendConfig{Name: "pigpio"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBackend(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if b != nil {
+				b.Close()
+			}
+		})
+	}
+}
+
+func TestFake(t *testing.T) {
+
+	f := NewFake()
+
+	p, err := ByName(f, "gpio3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Out(true); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Level("GPIO3") {
+		t.Error("GPIO3 should be high")
+	}
+
+	q, _ := ByName(f, "GPIO4")
+	if err := Out(Change{q, true}, Change{p, true}, Change{q, false}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Write{{"GPIO3", true}, {"GPIO4", true}, {"GPIO3", true}, {"GPIO4", false}}
+	if got := f.Writes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Writes() = %v, want %v", got, want)
+	}
+
+	f.ClearWrites()
+
+	f.SetError(fmt.Errorf("broken"))
+	if err := Out(Change{p, false}); err == nil {
+		t.Error("expected error")
+	}
+	if !f.Level("GPIO3") {
+		t.Error("level of GPIO3 changed by a failed write")
+	}
+
+	f.Close()
+	if !f.Closed() {
+		t.Error("backend not closed")
+	}
+}
+
+func TestNewSimulated(t *testing.T) {
+
+	logged := []string{}
+	f := NewSimulated(func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	})
+
+	// expander pins are simulated, too
+	p, err := ByName(f, "mcp23017@0x20:GPA3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, level := range []bool{true, true, false} {
+		if err := p.Out(level); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"simulated pin mcp23017@0x20:GPA3=1", "simulated pin mcp23017@0x20:GPA3=0"}
+	if !reflect.DeepEqual(logged, want) {
+		t.Errorf("logged %v, want %v", logged, want)
+	}
+
+	if len(f.Writes()) != 0 {
+		t.Error("simulated backend should not record writes")
+	}
+
+	// the expanders of a Fake backend are accessed through the I2C bus
+	if _, ok := Backend(NewFake()).(ExpanderBackend); ok {
+		t.Error("Fake backend should not provide expander pins")
+	}
+}
+
+func TestInByName(t *testing.T) {
+
+	f := NewFake()
+
+	in, err := InByName(f, "gpio7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if in.WaitForEdge(time.Millisecond) {
+		t.Error("edge detected without a change")
+	}
+
+	f.SetLevel("GPIO7", true)
+	if !in.WaitForEdge(time.Second) {
+		t.Error("edge not detected")
+	}
+	if level, err := in.Read(); err != nil || !level {
+		t.Errorf("Read() = %v, %v; want true", level, err)
+	}
+
+	if len(f.Writes()) != 0 {
+		t.Error("SetLevel should not record writes")
+	}
+
+	if _, err := InByName(f, "mcp23017@0x20:GPA3"); err == nil {
+		t.Error("expected error for an expander pin")
+	}
+
+	// a closed backend releases waiting pins
+	done := make(chan bool)
+	go func() { done <- in.WaitForEdge(-1) }()
+	f.Close()
+	if <-done {
+		t.Error("edge detected after Close")
+	}
+}
+
+func TestWatch(t *testing.T) {
+
+	f := NewFake()
+	in, _ := f.In("GPIO7")
+
+	levels := make(chan bool, 10)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		Watch(in, time.Hour, stop, func(level bool, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			levels <- level
+		})
+		close(done)
+	}()
+
+	want := []bool{false, true, false}
+	for i, level := range want {
+		if i > 0 {
+			f.SetLevel("GPIO7", level)
+		}
+		select {
+		case got := <-levels:
+			if got != level {
+				t.Errorf("level %d = %v, want %v", i, got, level)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("level %d not reported", i)
+		}
+	}
+
+	close(stop)
+	f.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Watch didn't return")
+	}
+}
@@ -0,0 +1,226 @@
+package pulse
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// MaxDuration is the longest pulse which is accepted.
+const MaxDuration = time.Hour
+
+// Switch wraps a Switcher and provides pulses (a terminal is switched
+// into a state and reverted after a given duration). If the wrapped
+// Switcher implements sw.Pulser, the pulses are forwarded to it so that
+// the hardware takes care of the timing. Otherwise (or if the wrapped
+// Switcher returns sw.ErrPulseNotSupported) the pulse is emulated by
+// setting the terminal and reverting it through a timer.
+//
+// On exclusive ports, activating a terminal deactivates the other
+// terminals of the port. Therefore the revert of an emulated pulse on an
+// exclusive port restores the terminal which has been active before.
+//
+// A pending revert is canceled if the terminal (or on exclusive ports, any
+// terminal of the port) is set explicitly in the meantime. When the switch is closed, pending reverts are executed
+// immediately so that no terminal is left in its pulsed state.
+type Switch struct {
+	sync.Mutex
+	sw.Switcher
+	pending map[string]*revert // key: port/terminal or port (exclusive ports)
+	closed  bool
+}
+
+// revert is a pending revert of an emulated pulse.
+type revert struct {
+	timer     *time.Timer
+	port      string
+	terminals []sw.Terminal // the states to be restored
+}
+
+// New wraps the Switcher s and returns a Switcher which implements
+// sw.Pulser, and sw.HealthReporter if s does. The returned Switcher
+// has to be wrapped by the rate limiter (see package ratelimit), not
+// vice versa, so that the reverts of emulated pulses are not limited.
+func New(s sw.Switcher) sw.Switcher {
+
+	ps := &Switch{
+		Switcher: s,
+		pending:  make(map[string]*revert),
+	}
+
+	hr, _ := s.(sw.HealthReporter)
+
+	return sw.Compose(ps, hr, ps)
+}
+
+// Pulse switches the terminal of the port into the requested state and
+// reverts it after the duration d into its previous state. Pulsing a
+// terminal which is already pulsed into the same state extends the
+// pulse.
+func (s *Switch) Pulse(portName string, terminal sw.Terminal, d time.Duration) error {
+
+	if d <= 0 || d > MaxDuration {
+		return fmt.Errorf("invalid pulse duration %v (must be between 0 and %v)", d, MaxDuration)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("switch %s is closed", s.Name())
+	}
+
+	if p, ok := s.Switcher.(sw.Pulser); ok {
+		err := p.Pulse(portName, terminal, d)
+		if !errors.Is(err, sw.ErrPulseNotSupported) {
+			return err
+		}
+	}
+
+	port, err := s.Switcher.GetPort(portName)
+	if err != nil {
+		return err
+	}
+
+	state, ok := terminalState(port, terminal.Name)
+	if !ok {
+		return fmt.Errorf("terminal %s does not exist on port %s", terminal.Name, portName)
+	}
+
+	key := portName + "/" + terminal.Name
+	restore := []sw.Terminal{{Name: terminal.Name, State: state}}
+
+	if port.Exclusive {
+		key = portName
+		restore = exclusiveState(port, terminal.Name)
+	}
+
+	// the port returns into the state it had before the first pulse
+	if r, ok := s.pending[key]; ok {
+		r.timer.Stop()
+		delete(s.pending, key)
+		restore = r.terminals
+		if st, ok := terminalState(sw.Port{Terminals: restore}, terminal.Name); ok {
+			state = st
+		} else {
+			// on exclusive ports, an other terminal has been active
+			state = false
+		}
+		// pulsing into the state before the first pulse ends the pulse
+		if state == terminal.State {
+			s.execute(r)
+			return nil
+		}
+	}
+
+	if state == terminal.State {
+		return nil
+	}
+
+	req := sw.Port{
+		Name:      portName,
+		Terminals: []sw.Terminal{{Name: terminal.Name, State: terminal.State}},
+	}
+
+	if err := s.Switcher.SetPort(req); err != nil {
+		return err
+	}
+
+	r := &revert{
+		port:      portName,
+		terminals: restore,
+	}
+	r.timer = time.AfterFunc(d, func() { s.revert(key, r) })
+	s.pending[key] = r
+
+	return nil
+}
+
+// revert switches the terminal back into its previous state unless the
+// revert has been canceled in the meantime.
+func (s *Switch) revert(key string, r *revert) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.pending[key] != r {
+		return
+	}
+	delete(s.pending, key)
+
+	s.execute(r)
+}
+
+// execute restores the terminal states stored in the revert. This
+// method is not threadsafe.
+func (s *Switch) execute(r *revert) {
+	req := sw.Port{
+		Name:      r.port,
+		Terminals: r.terminals,
+	}
+	if err := s.Switcher.SetPort(req); err != nil {
+		log.Printf("unable to revert port %s: %v", r.port, err)
+	}
+}
+
+// SetPort forwards the request to the wrapped Switcher. Pending reverts
+// of the requested terminals (or of the requested exclusive port) are
+// canceled.
+func (s *Switch) SetPort(port sw.Port) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if r, ok := s.pending[port.Name]; ok {
+		r.timer.Stop()
+		delete(s.pending, port.Name)
+	}
+
+	for _, t := range port.Terminals {
+		key := port.Name + "/" + t.Name
+		if r, ok := s.pending[key]; ok {
+			r.timer.Stop()
+			delete(s.pending, key)
+		}
+	}
+
+	return s.Switcher.SetPort(port)
+}
+
+// Close reverts all pending pulses and closes the wrapped Switcher.
+func (s *Switch) Close() {
+	s.Lock()
+	s.closed = true
+	for key, r := range s.pending {
+		r.timer.Stop()
+		delete(s.pending, key)
+		s.execute(r)
+	}
+	s.Unlock()
+
+	s.Switcher.Close()
+}
+
+// exclusiveState returns the request which restores the current state of
+// the exclusive port p after terminalName has been pulsed: the terminal
+// which is currently active is activated again. If no terminal is active,
+// terminalName is deactivated.
+func exclusiveState(p sw.Port, terminalName string) []sw.Terminal {
+	for _, t := range p.Terminals {
+		if t.State {
+			return []sw.Terminal{{Name: t.Name, State: true}}
+		}
+	}
+	return []sw.Terminal{{Name: terminalName, State: false}}
+}
+
+func terminalState(p sw.Port, terminalName string) (bool, bool) {
+	for _, t := range p.Terminals {
+		if t.Name == terminalName {
+			return t.State, true
+		}
+	}
+	return false, false
+}
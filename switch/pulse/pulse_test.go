@@ -0,0 +1,356 @@
+package pulse
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
+)
+
+func newDummy(t *testing.T) *ds.DummySwitch {
+	t.Helper()
+
+	sc := ds.SwitchConfig{
+		Name: "Power Switch",
+		Ports: []ds.PortConfig{
+			{
+				Name: "PS",
+				Terminals: []ds.PinConfig{
+					{Name: "Router", Index: 0},
+					{Name: "Radio", Index: 1},
+				},
+			},
+		},
+	}
+
+	dummy := ds.NewDummySwitch(ds.Switch(sc))
+	if err := dummy.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return dummy
+}
+
+func state(t *testing.T, s sw.Switcher, terminal string) bool {
+	t.Helper()
+
+	p, err := s.GetPort("PS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, ok := terminalState(p, terminal)
+	if !ok {
+		t.Fatalf("terminal %s not found", terminal)
+	}
+	return st
+}
+
+func set(t *testing.T, s sw.Switcher, terminal string, st bool) {
+	t.Helper()
+
+	req := sw.Port{
+		Name:      "PS",
+		Terminals: []sw.Terminal{{Name: terminal, State: st}},
+	}
+	if err := s.SetPort(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSwitch_Pulse(t *testing.T) {
+
+	const d = time.Millisecond * 50
+
+	tests := []struct {
+		name string
+		// executed with the router switched on
+		run func(t *testing.T, s sw.Switcher, p sw.Pulser)
+		// state of the router after the pulse has expired
+		want bool
+	}{
+		{"power cycle", func(t *testing.T, s sw.Switcher, p sw.Pulser) {
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: false}, d); err != nil {
+				t.Fatal(err)
+			}
+			if state(t, s, "Router") {
+				t.Error("router has not been switched off")
+			}
+		}, true},
+		{"terminal already in the requested state", func(t *testing.T, s sw.Switcher, p sw.Pulser) {
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: true}, d); err != nil {
+				t.Fatal(err)
+			}
+			// must not be reverted
+			set(t, s, "Router", false)
+		}, false},
+		{"explicit request cancels the revert", func(t *testing.T, s sw.Switcher, p sw.Pulser) {
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: false}, d); err != nil {
+				t.Fatal(err)
+			}
+			set(t, s, "Router", false)
+		}, false},
+		{"requests for other terminals don't cancel the revert", func(t *testing.T, s sw.Switcher, p sw.Pulser) {
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: false}, d); err != nil {
+				t.Fatal(err)
+			}
+			set(t, s, "Radio", true)
+		}, true},
+		{"pulse into the original state ends the pulse", func(t *testing.T, s sw.Switcher, p sw.Pulser) {
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: false}, d); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: true}, d); err != nil {
+				t.Fatal(err)
+			}
+			if !state(t, s, "Router") {
+				t.Error("router has not been switched on again")
+			}
+		}, true},
+		{"repeated pulse reverts into the original state", func(t *testing.T, s sw.Switcher, p sw.Pulser) {
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: false}, d); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Pulse("PS", sw.Terminal{Name: "Router", State: false}, d); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(newDummy(t))
+			defer s.Close()
+
+			set(t, s, "Router", true)
+
+			tt.run(t, s, s.(sw.Pulser))
+
+			time.Sleep(d * 3)
+
+			if got := state(t, s, "Router"); got != tt.want {
+				t.Errorf("router state = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwitch_Pulse_exclusive(t *testing.T) {
+
+	const d = time.Millisecond * 50
+
+	newExclusive := func(t *testing.T) sw.Switcher {
+		t.Helper()
+		sc := ds.SwitchConfig{
+			Name: "Antenna Switch",
+			Ports: []ds.PortConfig{
+				{
+					Name:      "Radio",
+					Exclusive: true,
+					Terminals: []ds.PinConfig{
+						{Name: "Yagi", Index: 0},
+						{Name: "Dipole", Index: 1},
+						{Name: "Dummyload", Index: 2},
+					},
+				},
+			},
+		}
+		dummy := ds.NewDummySwitch(ds.Switch(sc))
+		if err := dummy.Init(); err != nil {
+			t.Fatal(err)
+		}
+		return New(dummy)
+	}
+
+	active := func(t *testing.T, s sw.Switcher) string {
+		t.Helper()
+		p, err := s.GetPort("Radio")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, term := range p.Terminals {
+			if term.State {
+				return term.Name
+			}
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name string
+		// active terminal before the pulses
+		initial string
+		pulses  []sw.Terminal
+		// active terminal during and after the pulses
+		during string
+		want   string
+	}{
+		{"previous terminal is restored", "Yagi",
+			[]sw.Terminal{{Name: "Dummyload", State: true}}, "Dummyload", "Yagi"},
+		{"no terminal was active", "",
+			[]sw.Terminal{{Name: "Dummyload", State: true}}, "Dummyload", ""},
+		{"active terminal is pulsed off", "Yagi",
+			[]sw.Terminal{{Name: "Yagi", State: false}}, "", "Yagi"},
+		{"pulses of several terminals restore the original terminal", "Yagi",
+			[]sw.Terminal{{Name: "Dummyload", State: true}, {Name: "Dipole", State: true}}, "Dipole", "Yagi"},
+		{"pulse into the original state ends the pulse", "Yagi",
+			[]sw.Terminal{{Name: "Dummyload", State: true}, {Name: "Yagi", State: true}}, "Yagi", "Yagi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newExclusive(t)
+			defer s.Close()
+
+			if tt.initial != "" {
+				req := sw.Port{Name: "Radio", Terminals: []sw.Terminal{{Name: tt.initial, State: true}}}
+				if err := s.SetPort(req); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, pulse := range tt.pulses {
+				if err := s.(sw.Pulser).Pulse("Radio", pulse, d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := active(t, s); got != tt.during {
+				t.Errorf("active terminal during the pulse = %q, want %q", got, tt.during)
+			}
+
+			time.Sleep(d * 3)
+
+			if got := active(t, s); got != tt.want {
+				t.Errorf("active terminal = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// an explicit request cancels the revert of the port
+	s := newExclusive(t)
+	defer s.Close()
+	if err := s.SetPort(sw.Port{Name: "Radio", Terminals: []sw.Terminal{{Name: "Yagi", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.(sw.Pulser).Pulse("Radio", sw.Terminal{Name: "Dummyload", State: true}, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPort(sw.Port{Name: "Radio", Terminals: []sw.Terminal{{Name: "Dipole", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(d * 3)
+	if got := active(t, s); got != "Dipole" {
+		t.Errorf("active terminal = %q, want Dipole", got)
+	}
+}
+
+func TestSwitch_Pulse_invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     string
+		terminal string
+		d        time.Duration
+	}{
+		{"zero duration", "PS", "Router", 0},
+		{"negative duration", "PS", "Router", -time.Second},
+		{"duration too long", "PS", "Router", MaxDuration + time.Millisecond},
+		{"unknown terminal", "PS", "Amplifier", time.Second},
+		{"unknown port", "Antennas", "Router", time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(newDummy(t))
+			defer s.Close()
+
+			err := s.(sw.Pulser).Pulse(tt.port, sw.Terminal{Name: tt.terminal, State: true}, tt.d)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestSwitch_Close(t *testing.T) {
+
+	s := New(newDummy(t))
+
+	if err := s.(sw.Pulser).Pulse("PS", sw.Terminal{Name: "Router", State: true}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+
+	if state(t, s, "Router") {
+		t.Error("pending pulse has not been reverted")
+	}
+
+	if err := s.(sw.Pulser).Pulse("PS", sw.Terminal{Name: "Router", State: true}, time.Minute); err == nil {
+		t.Error("expected an error for a closed switch")
+	}
+}
+
+// nativePulser records the pulses it has been asked for. Pulses which
+// switch a terminal on are not supported.
+type nativePulser struct {
+	*ds.DummySwitch
+	pulses []time.Duration
+}
+
+func (n *nativePulser) Pulse(portName string, terminal sw.Terminal, d time.Duration) error {
+	n.pulses = append(n.pulses, d)
+	if terminal.State {
+		return fmt.Errorf("%w: only power cycles", sw.ErrPulseNotSupported)
+	}
+	return nil
+}
+
+func TestSwitch_Pulse_native(t *testing.T) {
+
+	native := &nativePulser{DummySwitch: newDummy(t)}
+	s := New(native)
+	defer s.Close()
+
+	set(t, s, "Router", true)
+
+	if err := s.(sw.Pulser).Pulse("PS", sw.Terminal{Name: "Router", State: false}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(native.pulses) != 1 || native.pulses[0] != time.Second {
+		t.Errorf("pulse has not been forwarded: %v", native.pulses)
+	}
+
+	if !state(t, s, "Router") {
+		t.Error("pulse has been emulated")
+	}
+
+	// pulses which are not supported by the hardware are emulated
+	if err := s.(sw.Pulser).Pulse("PS", sw.Terminal{Name: "Radio", State: true}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(native.pulses) != 2 {
+		t.Errorf("pulse has not been forwarded: %v", native.pulses)
+	}
+
+	if !state(t, s, "Radio") {
+		t.Error("pulse has not been emulated")
+	}
+}
+
+// noHealth hides the HealthReporter implementation of the wrapped switch.
+type noHealth struct {
+	sw.Switcher
+}
+
+func TestNew_HealthReporter(t *testing.T) {
+
+	dummy := newDummy(t)
+
+	if _, ok := New(dummy).(sw.HealthReporter); !ok {
+		t.Error("wrapper hides the HealthReporter of the switch")
+	}
+
+	if _, ok := New(noHealth{dummy}).(sw.HealthReporter); ok {
+		t.Error("wrapper implements HealthReporter for a switch without health")
+	}
+}
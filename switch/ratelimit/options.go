@@ -0,0 +1,36 @@
+package ratelimit
+
+import "time"
+
+// Interval is a functional option to set the minimum interval between
+// two requests which change the state of the switch.
+func Interval(d time.Duration) func(*Switch) {
+	return func(s *Switch) {
+		s.interval = d
+	}
+}
+
+// Burst is a functional option to set the amount of requests which may
+// be executed in a row before the interval of the switch is enforced.
+func Burst(n int) func(*Switch) {
+	return func(s *Switch) {
+		s.burst = n
+	}
+}
+
+// TerminalInterval is a functional option to set the minimum interval
+// between two state changes of the same terminal.
+func TerminalInterval(d time.Duration) func(*Switch) {
+	return func(s *Switch) {
+		s.terminalInterval = d
+	}
+}
+
+// TerminalBurst is a functional option to set the amount of state changes
+// of a terminal which may be executed in a row before its interval is
+// enforced.
+func TerminalBurst(n int) func(*Switch) {
+	return func(s *Switch) {
+		s.terminalBurst = n
+	}
+}
@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"golang.org/x/time/rate"
+)
+
+// Switch wraps a Switcher and limits the rate in which its state can be
+// changed. This protects the relays from chattering if a client (e.g. a
+// stuck key or a misbehaving script) floods the switch with requests.
+// Two limits can be configured, each as a minimum interval with a
+// burst allowance:
+//
+//   - per switch: requests which change at least one terminal
+//   - per terminal: state changes of the same terminal
+//
+// Requests which don't change the state of the switch are never limited.
+// Limited requests are rejected with an error wrapping sw.ErrRateLimited.
+type Switch struct {
+	sync.Mutex
+	sw.Switcher
+	interval         time.Duration
+	burst            int
+	terminalInterval time.Duration
+	terminalBurst    int
+	limiter          *rate.Limiter
+	terminals        map[string]*rate.Limiter // key: port/terminal
+	now              func() time.Time
+}
+
+// New wraps the Switcher s with the rate limits provided through the
+// functional options. If no limit has been set, the returned Switcher
+// doesn't limit any requests. The returned Switcher implements
+// sw.HealthReporter and (rate limited) sw.Pulser only if s does.
+// Switchers with emulated pulses (see package pulse) must be wrapped
+// before they are rate limited, so that the reverts are not limited.
+func New(s sw.Switcher, opts ...func(*Switch)) sw.Switcher {
+
+	rs := &Switch{
+		Switcher:      s,
+		burst:         1,
+		terminalBurst: 1,
+		terminals:     make(map[string]*rate.Limiter),
+		now:           time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(rs)
+	}
+
+	if rs.interval > 0 {
+		rs.limiter = newLimiter(rs.interval, rs.burst)
+	}
+
+	// only the optional interfaces of s are exposed
+	hr, _ := s.(sw.HealthReporter)
+	var p sw.Pulser
+	if _, ok := s.(sw.Pulser); ok {
+		p = rs
+	}
+
+	return sw.Compose(rs, hr, p)
+}
+
+func newLimiter(interval time.Duration, burst int) *rate.Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Every(interval), burst)
+}
+
+// SetPort forwards the request to the wrapped Switcher if none of the
+// limits has been exceeded.
+func (s *Switch) SetPort(port sw.Port) error {
+	s.Lock()
+	defer s.Unlock()
+
+	current, err := s.Switcher.GetPort(port.Name)
+	if err != nil {
+		// the switch will report the invalid request
+		return s.Switcher.SetPort(port)
+	}
+
+	if err := s.reserve(port.Name, current, port.Terminals); err != nil {
+		return err
+	}
+
+	return s.Switcher.SetPort(port)
+}
+
+// Pulse forwards the pulse to the wrapped Switcher if none of the limits
+// has been exceeded. A pulse counts as a single change; reverting the
+// terminal is not limited.
+func (s *Switch) Pulse(portName string, terminal sw.Terminal, d time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	p, ok := s.Switcher.(sw.Pulser)
+	if !ok {
+		return fmt.Errorf("switch %s doesn't support pulses", s.Name())
+	}
+
+	current, err := s.Switcher.GetPort(portName)
+	if err != nil {
+		// the switch will report the invalid request
+		return p.Pulse(portName, terminal, d)
+	}
+
+	if err := s.reserve(portName, current, []sw.Terminal{terminal}); err != nil {
+		return err
+	}
+
+	return p.Pulse(portName, terminal, d)
+}
+
+// reserve takes the tokens for the terminals of the port which will
+// change their state (see changedTerminals). All limits have to be met; otherwise the tokens which have
+// already been taken are returned and an error wrapping
+// sw.ErrRateLimited is returned. This method is not threadsafe.
+func (s *Switch) reserve(portName string, current sw.Port, terminals []sw.Terminal) error {
+
+	now := s.now()
+	reservations := []*rate.Reservation{}
+
+	reserve := func(l *rate.Limiter, what string) error {
+		r := l.ReserveN(now, 1)
+		if r.OK() && r.DelayFrom(now) == 0 {
+			reservations = append(reservations, r)
+			return nil
+		}
+		delay := r.DelayFrom(now)
+		r.CancelAt(now)
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		return fmt.Errorf("%w: %s can't be changed for another %v",
+			sw.ErrRateLimited, what, delay.Round(time.Millisecond))
+	}
+
+	changes := changedTerminals(current, terminals)
+
+	for _, name := range changes {
+
+		if s.terminalInterval <= 0 {
+			break
+		}
+
+		key := portName + "/" + name
+		l, ok := s.terminals[key]
+		if !ok {
+			l = newLimiter(s.terminalInterval, s.terminalBurst)
+			s.terminals[key] = l
+		}
+
+		if err := reserve(l, "terminal "+key); err != nil {
+			return err
+		}
+	}
+
+	if len(changes) > 0 && s.limiter != nil {
+		if err := reserve(s.limiter, "switch "+s.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changedTerminals returns the names of the terminals of the port which
+// will change their state with the requested terminals. On exclusive
+// ports, the switches turn off all active terminals which are not part
+// of the request, so these are changed as well.
+func changedTerminals(current sw.Port, terminals []sw.Terminal) []string {
+
+	requested := make(map[string]bool, len(terminals))
+	for _, t := range terminals {
+		requested[t.Name] = t.State
+	}
+
+	changes := []string{}
+	for _, t := range current.Terminals {
+		state, ok := requested[t.Name]
+		if !ok {
+			if !current.Exclusive || !t.State {
+				continue
+			}
+			// implicitly switched off
+			state = false
+		}
+		if state != t.State {
+			changes = append(changes, t.Name)
+		}
+	}
+
+	return changes
+}
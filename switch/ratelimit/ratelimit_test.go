@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	ds "github.com/dh1tw/remoteSwitch/switch/dummy_switch"
+	"github.com/dh1tw/remoteSwitch/switch/pulse"
+)
+
+// newDummy returns a switch with the port "Radio" and the terminals
+// "Yagi" and "Dipole".
+func newDummy(t *testing.T, exclusive bool) *ds.DummySwitch {
+	t.Helper()
+
+	sc := ds.SwitchConfig{
+		Name: "Antenna Switch",
+		Ports: []ds.PortConfig{
+			{
+				Name:      "Radio",
+				Exclusive: exclusive,
+				Terminals: []ds.PinConfig{
+					{Name: "Yagi", Index: 0},
+					{Name: "Dipole", Index: 1},
+				},
+			},
+		},
+	}
+
+	dummy := ds.NewDummySwitch(ds.Switch(sc))
+	if err := dummy.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return dummy
+}
+
+type request struct {
+	at       time.Duration // since the start of the test
+	terminal string
+	state    bool
+	wantErr  bool
+}
+
+func TestSwitch_SetPort(t *testing.T) {
+	tests := []struct {
+		name      string
+		exclusive bool
+		opts      []func(*Switch)
+		requests  []request
+	}{
+		{"no limits", false, nil, []request{
+			{0, "Yagi", true, false},
+			{0, "Yagi", false, false},
+			{0, "Yagi", true, false},
+		}},
+		{"terminal interval", false, []func(*Switch){TerminalInterval(time.Second)}, []request{
+			{0, "Yagi", true, false},
+			{time.Millisecond * 500, "Yagi", false, true},
+			// other terminals are not affected
+			{time.Millisecond * 500, "Dipole", true, false},
+			{time.Second, "Yagi", false, false},
+		}},
+		{"terminal burst", false, []func(*Switch){TerminalInterval(time.Second), TerminalBurst(2)}, []request{
+			{0, "Yagi", true, false},
+			{0, "Yagi", false, false},
+			{0, "Yagi", true, true},
+			{time.Second, "Yagi", true, false},
+		}},
+		{"requests without change are not limited", false, []func(*Switch){TerminalInterval(time.Second)}, []request{
+			{0, "Yagi", true, false},
+			{0, "Yagi", true, false},
+			{0, "Yagi", true, false},
+		}},
+		{"switch interval", false, []func(*Switch){Interval(time.Second), Burst(2)}, []request{
+			{0, "Yagi", true, false},
+			{0, "Dipole", true, false},
+			{0, "Yagi", false, true},
+			{time.Millisecond * 500, "Yagi", false, true},
+			{time.Second, "Yagi", false, false},
+		}},
+		{"tokens are returned if another limit is exceeded", false,
+			[]func(*Switch){Interval(time.Second), TerminalInterval(time.Second * 10)}, []request{
+				{0, "Yagi", true, false},
+				// the switch limit is exceeded; Dipole's token is returned
+				{time.Millisecond * 500, "Dipole", true, true},
+				{time.Second, "Dipole", true, false},
+			}},
+		{"implicit switch-off on exclusive ports", true, []func(*Switch){TerminalInterval(time.Second)}, []request{
+			{0, "Yagi", true, false},
+			// switching on the Dipole would switch off the Yagi
+			{time.Millisecond * 500, "Dipole", true, true},
+			{time.Second, "Dipole", true, false},
+			// switching on the Yagi would switch off the Dipole
+			{time.Millisecond * 1500, "Yagi", true, true},
+			{time.Second * 2, "Yagi", true, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dummy := newDummy(t, tt.exclusive)
+
+			start := time.Now()
+			var now time.Time
+
+			opts := append(tt.opts, func(s *Switch) {
+				s.now = func() time.Time { return now }
+			})
+			s := New(dummy, opts...)
+
+			for i, r := range tt.requests {
+				now = start.Add(r.at)
+				port := sw.Port{
+					Name:      "Radio",
+					Terminals: []sw.Terminal{{Name: r.terminal, State: r.state}},
+				}
+				err := s.SetPort(port)
+				if (err != nil) != r.wantErr {
+					t.Fatalf("request %d: SetPort() error = %v, wantErr %v", i, err, r.wantErr)
+				}
+				if err != nil && !errors.Is(err, sw.ErrRateLimited) {
+					t.Fatalf("request %d: expected ErrRateLimited, got %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSwitch_Pulse(t *testing.T) {
+
+	start := time.Now()
+	now := start
+
+	ps := pulse.New(newDummy(t, false))
+	s := New(ps, TerminalInterval(time.Second), func(s *Switch) {
+		s.now = func() time.Time { return now }
+	})
+	defer s.Close()
+
+	p, ok := s.(sw.Pulser)
+	if !ok {
+		t.Fatal("wrapper hides the Pulser of the switch")
+	}
+
+	yagi := sw.Terminal{Name: "Yagi", State: true}
+
+	if err := p.Pulse("Radio", yagi, time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+
+	// the revert is not limited
+	time.Sleep(time.Millisecond * 50)
+	port, _ := s.GetPort("Radio")
+	if st, _ := terminalState(port, "Yagi"); st {
+		t.Fatal("pulse has not been reverted")
+	}
+
+	now = start.Add(time.Millisecond * 500)
+	if err := p.Pulse("Radio", yagi, time.Millisecond*10); !errors.Is(err, sw.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	now = start.Add(time.Second)
+	if err := p.Pulse("Radio", yagi, time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := New(noHealth{newDummy(t, false)}).(*Switch).Pulse("Radio", yagi, time.Second); err == nil {
+		t.Error("expected an error for a switch without pulse support")
+	}
+}
+
+func terminalState(p sw.Port, terminalName string) (bool, bool) {
+	for _, t := range p.Terminals {
+		if t.Name == terminalName {
+			return t.State, true
+		}
+	}
+	return false, false
+}
+
+// noHealth hides the HealthReporter implementation of the wrapped switch.
+type noHealth struct {
+	sw.Switcher
+}
+
+func TestNew_HealthReporter(t *testing.T) {
+
+	dummy := newDummy(t, false)
+
+	if _, ok := New(dummy).(sw.HealthReporter); !ok {
+		t.Error("wrapper hides the HealthReporter of the switch")
+	}
+
+	if _, ok := New(noHealth{dummy}).(sw.HealthReporter); ok {
+		t.Error("wrapper implements HealthReporter for a switch without health")
+	}
+}
+
+func TestNew_Pulser(t *testing.T) {
+
+	dummy := newDummy(t, false)
+
+	if _, ok := New(dummy).(sw.Pulser); ok {
+		t.Error("wrapper implements Pulser for a switch without pulse support")
+	}
+
+	s := New(pulse.New(dummy))
+	if _, ok := s.(sw.Pulser); !ok {
+		t.Error("wrapper hides the Pulser of the switch")
+	}
+	if _, ok := s.(sw.HealthReporter); !ok {
+		t.Error("wrapper hides the HealthReporter of the switch")
+	}
+}
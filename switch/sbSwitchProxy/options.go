@@ -2,7 +2,9 @@ package sbSwitchProxy
 
 import (
 	"github.com/asim/go-micro/v3/client"
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
 	sw "github.com/dh1tw/remoteSwitch/switch"
+	"google.golang.org/grpc"
 )
 
 func Client(cli client.Client) func(*SbSwitchProxy) {
@@ -11,6 +13,15 @@ func Client(cli client.Client) func(*SbSwitchProxy) {
 	}
 }
 
+// GrpcConn is a functional option to reach the remote switch directly
+// through a gRPC connection instead of go-micro. The connection is owned
+// by the caller and must be closed after the proxy has been closed.
+func GrpcConn(conn grpc.ClientConnInterface) func(*SbSwitchProxy) {
+	return func(s *SbSwitchProxy) {
+		s.gcli = sbSwitch.NewSbSwitchClient(conn)
+	}
+}
+
 // DoneCh is a functional option allows you to pass a channel to the proxy object.
 // This channel will be closed by this object. It serves as a notification that
 // the object can be deleted.
@@ -26,6 +37,24 @@ func Name(name string) func(*SbSwitchProxy) {
 	}
 }
 
+// Alias is a functional option to set the name under which the proxy
+// object exposes the remote switch. This is useful if switches with the
+// same name from different stations are aggregated. If not set, the
+// name of the remote switch will be used.
+func Alias(name string) func(*SbSwitchProxy) {
+	return func(s *SbSwitchProxy) {
+		s.alias = name
+	}
+}
+
+// Station is a functional option to set the station (callsign) to
+// which the remote switch belongs.
+func Station(station string) func(*SbSwitchProxy) {
+	return func(s *SbSwitchProxy) {
+		s.station = station
+	}
+}
+
 func ServiceName(name string) func(*SbSwitchProxy) {
 	return func(s *SbSwitchProxy) {
 		s.serviceName = name
@@ -3,26 +3,60 @@ package sbSwitchProxy
 import (
 	"context"
 	"fmt"
+	"log"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/asim/go-micro/v3/broker"
 	"github.com/asim/go-micro/v3/client"
+	microErrors "github.com/asim/go-micro/v3/errors"
 	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
 	sw "github.com/dh1tw/remoteSwitch/switch"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
 
+// heartbeatTolerance is the amount of heartbeat intervals after which
+// a remote switch is considered to be offline if no heartbeat has
+// been received.
+const heartbeatTolerance = 3
+
+// minHeartbeatInterval is the lower limit of the heartbeat interval
+// announced by the remote switch. Heartbeats are checked once a second,
+// and without a limit, a heartbeat without (or with a negative) interval
+// would mark the switch offline right away.
+const minHeartbeatInterval = time.Second
+
+// subscribeRetryInterval is the interval in which the proxy tries to
+// re-establish a broken subscription.
+const subscribeRetryInterval = time.Second * 2
+
 type SbSwitchProxy struct {
 	sync.RWMutex
-	cli          client.Client
-	scli         sbSwitch.SbSwitchService
-	eventHandler func(sw.Switcher, sw.Device)
-	device       sw.Device
-	doneCh       chan struct{}
-	doneOnce     sync.Once
-	subscriber   broker.Subscriber
-	serviceName  string
+	cli               client.Client
+	scli              sbSwitch.SbSwitchService
+	gcli              sbSwitch.SbSwitchClient
+	eventHandler      func(sw.Switcher, sw.Device)
+	device            sw.Device
+	doneCh            chan struct{}
+	doneOnce          sync.Once
+	closeCh           chan struct{}
+	closeOnce         sync.Once
+	subscriber        broker.Subscriber
+	hbSubscriber      broker.Subscriber
+	lastHeartbeat     time.Time
+	heartbeatInterval time.Duration
+	stale             bool
+	sequence          uint64 // sequence number of the last applied update
+	synced            bool   // a snapshot has been received on the current subscription
+	legacy            bool   // remote switch doesn't support the Subscribe RPC
+	resubscribe       context.CancelFunc
+	serviceName       string
+	station           string
+	alias             string
 }
 
 func New(opts ...func(*SbSwitchProxy)) (*SbSwitchProxy, error) {
@@ -33,13 +67,24 @@ func New(opts ...func(*SbSwitchProxy)) (*SbSwitchProxy, error) {
 			Index: 0,
 			Ports: []sw.Port{},
 		},
-		serviceName: "shackbus.switch.mySwitch",
+		serviceName: "shackbus.mystation.switch.mySwitch",
+		closeCh:     make(chan struct{}),
 	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	// when connected through gRPC, there is no broker. The proxy
+	// relies only on the Subscribe stream.
+	if s.gcli != nil {
+		if err := s.getInfo(); err != nil {
+			return nil, err
+		}
+		go s.subscribe()
+		return s, nil
+	}
+
 	s.scli = sbSwitch.NewSbSwitchService(s.serviceName, s.cli)
 
 	if err := s.getInfo(); err != nil {
@@ -51,15 +96,35 @@ func New(opts ...func(*SbSwitchProxy)) (*SbSwitchProxy, error) {
 		return nil, err
 	}
 
-	sub, err := br.Subscribe(s.serviceName+".state", s.updateHandler)
+	hbSub, err := br.Subscribe(s.serviceName+".heartbeat", s.heartbeatHandler)
 	if err != nil {
 		return nil, err
 	}
-	s.subscriber = sub
+	s.hbSubscriber = hbSub
+
+	go s.checkHeartbeat()
+	go s.subscribe()
 
 	return s, nil
 }
 
+// subscribeLegacy subscribes to the state topic of remote switches which
+// don't support the Subscribe RPC yet.
+func (s *SbSwitchProxy) subscribeLegacy() error {
+
+	sub, err := s.cli.Options().Broker.Subscribe(s.serviceName+".state", s.updateHandler)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.subscriber = sub
+	s.legacy = true
+
+	return nil
+}
+
 // the doneCh must be closed through this function to avoid
 // multiple times closing this channel. Closing the doneCh signals the
 // application that this object can be disposed
@@ -77,69 +142,252 @@ func (s *SbSwitchProxy) updateHandler(p broker.Event) error {
 	s.Lock()
 	defer s.Unlock()
 
-	s.device.Ports = []sw.Port{}
+	s.device.Ports = sbPortsToPorts(sbDevice.GetPorts())
+	s.updateHealth(sbDevice.GetHealth())
 
-	for _, sbPort := range sbDevice.GetPorts() {
+	if s.eventHandler != nil {
+		go s.eventHandler(s, s.serialize())
+	}
 
-		port := sw.Port{
-			Name:      sbPort.GetName(),
-			Index:     int(sbPort.GetIndex()),
-			Terminals: []sw.Terminal{},
+	return nil
+}
+
+// heartbeatHandler processes the heartbeats received from the remote
+// switch. If the switch had been marked as stale before, the state of
+// the switch will be refreshed.
+func (s *SbSwitchProxy) heartbeatHandler(p broker.Event) error {
+
+	hb := sbSwitch.Heartbeat{}
+	if err := proto.Unmarshal(p.Message().Body, &hb); err != nil {
+		return err
+	}
+
+	health := sbHealthToHealth(hb.GetHealth())
+
+	s.Lock()
+	defer s.Unlock()
+
+	wasStale := s.stale
+	s.stale = false
+	s.lastHeartbeat = time.Now()
+	s.heartbeatInterval = time.Duration(hb.GetInterval()) * time.Millisecond
+	if s.heartbeatInterval < minHeartbeatInterval {
+		s.heartbeatInterval = minHeartbeatInterval
+	}
+
+	changed := wasStale || s.device.Health == nil ||
+		s.device.Health.Online != health.Online ||
+		s.device.Health.Error != health.Error ||
+		s.device.Health.Model != health.Model ||
+		s.device.Health.Firmware != health.Firmware
+
+	s.device.Health = &health
+
+	// we might have missed state updates while the switch was stale
+	if wasStale {
+		log.Printf("heartbeat received again from '%s'", s.device.Name)
+		if s.legacy {
+			go s.refresh()
+		} else {
+			s.resync()
 		}
+	}
 
-		for _, sbTerminal := range sbPort.GetTerminals() {
-			t := sw.Terminal{
-				Name:  sbTerminal.GetName(),
-				Index: int(sbTerminal.GetIndex()),
-				State: sbTerminal.GetState(),
-			}
-			port.Terminals = append(port.Terminals, t)
+	if changed && s.eventHandler != nil {
+		go s.eventHandler(s, s.serialize())
+	}
+
+	return nil
+}
+
+// checkHeartbeat checks every second if heartbeats are still received
+// from the remote switch. If no heartbeat has been received within
+// heartbeatTolerance intervals, the switch is marked as offline, however
+// it will not be removed. Switches which have never sent a heartbeat
+// (e.g. older versions) are never marked as offline.
+// This function is blocking and should be executed in a go routine.
+func (s *SbSwitchProxy) checkHeartbeat() {
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
 		}
 
-		s.device.Ports = append(s.device.Ports, port)
+		s.Lock()
+		if s.heartbeatMissed(time.Now()) {
+
+			log.Printf("no heartbeat received from '%s' since %s",
+				s.device.Name, s.lastHeartbeat.Format(time.RFC3339))
+
+			s.markStale(s.lastHeartbeat, "no heartbeat received")
+		}
+		s.Unlock()
 	}
+}
+
+// heartbeatMissed returns true if the remote switch has stopped sending
+// heartbeats. This method is not threadsafe.
+func (s *SbSwitchProxy) heartbeatMissed(now time.Time) bool {
+	return !s.lastHeartbeat.IsZero() && !s.stale &&
+		now.Sub(s.lastHeartbeat) > heartbeatTolerance*s.heartbeatInterval
+}
 
+// markStale marks the remote switch as offline since we can't
+// communicate with it anymore. This method is not threadsafe.
+func (s *SbSwitchProxy) markStale(lastSeen time.Time, reason string) {
+
+	s.stale = true
+	health := sw.Health{
+		Online:   false,
+		LastSeen: lastSeen,
+		Error:    reason,
+	}
+	// keep the device information
+	if s.device.Health != nil {
+		health.Model = s.device.Health.Model
+		health.Firmware = s.device.Health.Firmware
+	}
+	s.device.Health = &health
 	if s.eventHandler != nil {
 		go s.eventHandler(s, s.serialize())
 	}
+}
 
-	return nil
+// refresh queries the remote switch for its current state and notifies
+// the event handler.
+func (s *SbSwitchProxy) refresh() {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	device, err := s.getDevice(ctx)
+	if err != nil {
+		log.Printf("unable to refresh '%s': %v", s.Name(), err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.device.Ports = sbPortsToPorts(device.GetPorts())
+	s.updateHealth(device.GetHealth())
+
+	if s.eventHandler != nil {
+		go s.eventHandler(s, s.serialize())
+	}
 }
 
 func (s *SbSwitchProxy) getInfo() error {
 
-	device, err := s.scli.GetDevice(context.Background(), &sbSwitch.None{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	device, err := s.getDevice(ctx)
 	if err != nil {
 		return err
 	}
 
 	s.device.Name = device.GetName()
 	s.device.Index = int(device.GetIndex())
-	ports := device.GetPorts()
-	for _, port := range ports {
-		p := sw.Port{
-			Name:  port.GetName(),
-			Index: int(port.GetIndex()),
+	s.device.Exclusive = device.GetExclusive()
+	s.device.Ports = sbPortsToPorts(device.GetPorts())
+	s.updateHealth(device.GetHealth())
+
+	return nil
+}
+
+// getDevice requests the device from the remote switch through the
+// transport (go-micro or gRPC) the proxy has been created with.
+func (s *SbSwitchProxy) getDevice(ctx context.Context) (*sbSwitch.Device, error) {
+	if s.gcli != nil {
+		return s.gcli.GetDevice(ctx, &sbSwitch.None{})
+	}
+	return s.scli.GetDevice(ctx, &sbSwitch.None{})
+}
+
+// updateHealth sets the health reported by the remote switch as part
+// of its device. Older switches don't report their health. While the
+// switch is stale, the health determined locally takes precedence.
+// This method is not threadsafe.
+func (s *SbSwitchProxy) updateHealth(sbHealth *sbSwitch.Health) {
+	if sbHealth == nil || s.stale {
+		return
+	}
+	health := sbHealthToHealth(sbHealth)
+	s.device.Health = &health
+}
+
+// sbPortsToPorts converts the ports received from the remote switch
+// into their switch.Port counterparts.
+func sbPortsToPorts(sbPorts []*sbSwitch.Port) []sw.Port {
+
+	ports := []sw.Port{}
+
+	for _, sbPort := range sbPorts {
+
+		port := sw.Port{
+			Name:      sbPort.GetName(),
+			Index:     int(sbPort.GetIndex()),
+			Exclusive: sbPort.GetExclusive(),
+			Terminals: []sw.Terminal{},
 		}
 
-		terminals := port.GetTerminals()
-		for _, terminal := range terminals {
+		for _, sbTerminal := range sbPort.GetTerminals() {
 			t := sw.Terminal{
-				Name:  terminal.GetName(),
-				Index: int(terminal.GetIndex()),
-				State: terminal.GetState(),
+				Name:     sbTerminal.GetName(),
+				Index:    int(sbTerminal.GetIndex()),
+				State:    sbTerminal.GetState(),
+				Sensed:   optionalBool(sbTerminal.Sensed),
+				Mismatch: sbTerminal.GetMismatch(),
 			}
-			p.Terminals = append(p.Terminals, t)
+			port.Terminals = append(port.Terminals, t)
 		}
-		s.device.Ports = append(s.device.Ports, p)
+
+		ports = append(ports, port)
 	}
 
-	return nil
+	return ports
+}
+
+// optionalBool returns a copy of an optional bool received from the
+// remote switch.
+func optionalBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	return &c
+}
+
+// sbHealthToHealth converts the health received from the remote switch
+// into a switch.Health struct.
+func sbHealthToHealth(sbHealth *sbSwitch.Health) sw.Health {
+
+	health := sw.Health{
+		Online:   sbHealth.GetOnline(),
+		Error:    sbHealth.GetError(),
+		Model:    sbHealth.GetModel(),
+		Firmware: sbHealth.GetFirmware(),
+	}
+
+	if sbHealth.GetLastSeen() > 0 {
+		health.LastSeen = time.UnixMilli(sbHealth.GetLastSeen())
+	}
+
+	return health
 }
 
 func (s *SbSwitchProxy) Name() string {
 	s.RLock()
 	defer s.RUnlock()
+	if len(s.alias) > 0 {
+		return s.alias
+	}
 	return s.device.Name
 }
 
@@ -174,11 +422,61 @@ func (s *SbSwitchProxy) SetPort(port sw.Port) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
+
+	if s.gcli != nil {
+		_, err := s.gcli.SetPort(ctx, sbPortReq)
+		if status.Code(err) == codes.ResourceExhausted {
+			return rateLimited(status.Convert(err).Message())
+		}
+		return err
+	}
+
 	_, err := s.scli.SetPort(ctx, sbPortReq)
+	// the error is transported as its json representation
+	if merr := microErrors.FromError(err); merr != nil && merr.Code == http.StatusTooManyRequests {
+		return rateLimited(merr.Detail)
+	}
+
+	return err
+}
+
+// Pulse forwards the pulse to the remote switch which takes care of
+// reverting the terminal.
+func (s *SbSwitchProxy) Pulse(portName string, terminal sw.Terminal, d time.Duration) error {
+
+	req := &sbSwitch.PulseRequest{
+		Port:     portName,
+		Terminal: terminal.Name,
+		State:    terminal.State,
+		Duration: int32(d / time.Millisecond),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if s.gcli != nil {
+		_, err := s.gcli.Pulse(ctx, req)
+		if status.Code(err) == codes.ResourceExhausted {
+			return rateLimited(status.Convert(err).Message())
+		}
+		return err
+	}
+
+	_, err := s.scli.Pulse(ctx, req)
+	if merr := microErrors.FromError(err); merr != nil && merr.Code == http.StatusTooManyRequests {
+		return rateLimited(merr.Detail)
+	}
 
 	return err
 }
 
+// rateLimited turns the message of a request which has been rejected by
+// the remote switch back into an error wrapping sw.ErrRateLimited.
+func rateLimited(msg string) error {
+	msg = strings.TrimPrefix(msg, sw.ErrRateLimited.Error()+": ")
+	return fmt.Errorf("%w: %s", sw.ErrRateLimited, msg)
+}
+
 func (s *SbSwitchProxy) Serialize() sw.Device {
 	s.RLock()
 	defer s.RUnlock()
@@ -186,12 +484,28 @@ func (s *SbSwitchProxy) Serialize() sw.Device {
 }
 
 func (s *SbSwitchProxy) serialize() sw.Device {
-	return s.device
+	dev := s.device
+	if len(s.alias) > 0 {
+		dev.Name = s.alias
+	}
+	dev.Station = s.station
+	if s.device.Health != nil {
+		health := *s.device.Health
+		dev.Health = &health
+	}
+	return dev
 }
 
 func (s *SbSwitchProxy) Close() {
-	if s.subscriber != nil {
-		s.subscriber.Unsubscribe()
+	s.RLock()
+	sub := s.subscriber
+	s.RUnlock()
+	if sub != nil {
+		sub.Unsubscribe()
+	}
+	if s.hbSubscriber != nil {
+		s.hbSubscriber.Unsubscribe()
 	}
+	s.closeOnce.Do(func() { close(s.closeCh) })
 	s.closeDone()
 }
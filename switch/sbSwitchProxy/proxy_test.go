@@ -0,0 +1,62 @@
+package sbSwitchProxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asim/go-micro/v3/broker"
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+	"google.golang.org/protobuf/proto"
+)
+
+// heartbeatEvent is a broker.Event carrying a heartbeat.
+type heartbeatEvent struct {
+	msg *broker.Message
+}
+
+func (e heartbeatEvent) Topic() string            { return "heartbeat" }
+func (e heartbeatEvent) Message() *broker.Message { return e.msg }
+func (e heartbeatEvent) Ack() error               { return nil }
+func (e heartbeatEvent) Error() error             { return nil }
+
+func TestSbSwitchProxy_heartbeatHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		interval     int32 // ms
+		wantInterval time.Duration
+	}{
+		{"interval", 5000, time.Second * 5},
+		{"zero interval", 0, minHeartbeatInterval},
+		{"negative interval", -1000, minHeartbeatInterval},
+		{"interval below the minimum", 10, minHeartbeatInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			body, err := proto.Marshal(&sbSwitch.Heartbeat{
+				Interval: tt.interval,
+				Health:   &sbSwitch.Health{Online: true},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &SbSwitchProxy{}
+			if err := s.heartbeatHandler(heartbeatEvent{&broker.Message{Body: body}}); err != nil {
+				t.Fatal(err)
+			}
+
+			if s.heartbeatInterval != tt.wantInterval {
+				t.Errorf("heartbeat interval = %v, want %v", s.heartbeatInterval, tt.wantInterval)
+			}
+
+			// the switch stays online until the heartbeats are missed
+			if s.heartbeatMissed(s.lastHeartbeat.Add(time.Millisecond * 500)) {
+				t.Error("heartbeat missed right after it has been received")
+			}
+			if !s.heartbeatMissed(s.lastHeartbeat.Add(heartbeatTolerance*tt.wantInterval + time.Millisecond)) {
+				t.Error("missed heartbeats not detected")
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package sbSwitchProxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/asim/go-micro/v3/client"
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// streamTimeout limits the lifetime of a Subscribe stream through
+// go-micro. The go-micro server can't detect clients which disappeared
+// without closing their stream, so the stream will be terminated by the
+// server after this timeout and we resubscribe.
+const streamTimeout = time.Minute * 10
+
+// errOutOfSync indicates that an update could not be applied since an
+// update has been missed or it doesn't match the state of the proxy.
+var errOutOfSync = errors.New("out of sync")
+
+// updateStream is implemented by the Subscribe streams of go-micro
+// and gRPC.
+type updateStream interface {
+	Recv() (*sbSwitch.StateUpdate, error)
+}
+
+// subscribe keeps a Subscribe stream to the remote switch open until the
+// proxy is closed. The stream starts with a snapshot of the switch,
+// followed by incremental updates with consecutive sequence numbers.
+// Whenever an update has been missed, the stream is re-established
+// which provides us again with a snapshot. This guarantees that the
+// proxy never diverges from the state of the remote switch.
+// This function is blocking and should be executed in a go routine.
+func (s *SbSwitchProxy) subscribe() {
+
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		s.Lock()
+		s.synced = false
+		s.resubscribe = cancel
+		s.Unlock()
+
+		go func() {
+			select {
+			case <-s.closeCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		received, err := s.recvUpdates(ctx)
+		resync := ctx.Err() != nil
+		cancel()
+
+		select {
+		case <-s.closeCh:
+			return
+		default:
+		}
+
+		switch {
+		// resync has been requested or the server terminated the stream
+		case resync, errors.Is(err, io.EOF):
+			continue
+
+		case errors.Is(err, errOutOfSync):
+			log.Printf("resubscribing to '%s': %v", s.Name(), err)
+			continue
+
+		// remote switches which don't support the Subscribe RPC yet
+		case s.gcli == nil && !received &&
+			strings.Contains(err.Error(), "can't find method"):
+			if err := s.subscribeLegacy(); err != nil {
+				log.Printf("unable to subscribe to '%s': %v", s.Name(), err)
+				break
+			}
+			// we might have missed an update in the meantime
+			s.refresh()
+			return
+		}
+
+		s.Lock()
+		// don't flood the log while the switch is known to be offline
+		if !s.stale {
+			log.Printf("subscription to '%s' failed: %v", s.device.Name, err)
+			// without a broker, there are no heartbeats. So a broken
+			// stream is our only indication that the switch is offline.
+			if s.gcli != nil {
+				s.markStale(s.lastHeartbeat, "connection lost")
+			}
+		}
+		s.Unlock()
+
+		select {
+		case <-s.closeCh:
+			return
+		case <-time.After(subscribeRetryInterval):
+		}
+	}
+}
+
+// resync terminates the current subscription. The subscription will be
+// re-established immediately, starting with a snapshot. This method is
+// not threadsafe.
+func (s *SbSwitchProxy) resync() {
+	if s.resubscribe != nil {
+		s.resubscribe()
+	}
+}
+
+// openSubscription calls the Subscribe RPC through the transport (go-micro
+// or gRPC) the proxy has been created with.
+func (s *SbSwitchProxy) openSubscription(ctx context.Context) (updateStream, error) {
+	if s.gcli != nil {
+		return s.gcli.Subscribe(ctx, &sbSwitch.None{})
+	}
+	return s.scli.Subscribe(ctx, &sbSwitch.None{}, client.WithStreamTimeout(streamTimeout))
+}
+
+// recvUpdates opens a Subscribe stream and applies the received updates
+// until the stream breaks or the proxy gets out of sync. It reports if
+// at least one update has been received.
+func (s *SbSwitchProxy) recvUpdates(ctx context.Context) (bool, error) {
+
+	stream, err := s.openSubscription(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// go-micro streams don't observe the context, they have to be
+	// closed explicitly
+	if c, ok := stream.(io.Closer); ok {
+		go func() {
+			<-ctx.Done()
+			c.Close()
+		}()
+	}
+
+	received := false
+
+	for {
+		update, err := stream.Recv()
+		if ctx.Err() != nil {
+			return received, ctx.Err()
+		}
+		if err != nil {
+			return received, err
+		}
+		received = true
+
+		s.Lock()
+		err = s.applyUpdate(update)
+		s.Unlock()
+		if err != nil {
+			return received, err
+		}
+	}
+}
+
+// applyUpdate applies an update received through the Subscribe stream.
+// This method is not threadsafe.
+func (s *SbSwitchProxy) applyUpdate(update *sbSwitch.StateUpdate) error {
+
+	// without a broker, every message counts as a sign of life
+	if s.gcli != nil {
+		s.lastHeartbeat = time.Now()
+	}
+
+	if snapshot := update.GetSnapshot(); snapshot != nil {
+		if s.gcli != nil && s.stale {
+			log.Printf("connection to '%s' re-established", s.device.Name)
+			s.stale = false
+		}
+		s.device.Name = snapshot.GetName()
+		s.device.Index = int(snapshot.GetIndex())
+		s.device.Exclusive = snapshot.GetExclusive()
+		s.device.Ports = sbPortsToPorts(snapshot.GetPorts())
+		s.updateHealth(snapshot.GetHealth())
+		s.sequence = update.GetSequence()
+		s.synced = true
+
+		if s.eventHandler != nil {
+			go s.eventHandler(s, s.serialize())
+		}
+		return nil
+	}
+
+	if !s.synced {
+		return fmt.Errorf("%w: update received before snapshot", errOutOfSync)
+	}
+
+	// the server sends periodically an empty update with the current
+	// sequence number to keep the stream alive
+	if update.GetSequence() == s.sequence && len(update.GetChanges()) == 0 &&
+		update.GetHealth() == nil {
+		return nil
+	}
+
+	if update.GetSequence() != s.sequence+1 {
+		return fmt.Errorf("%w: got update %d, expected %d", errOutOfSync,
+			update.GetSequence(), s.sequence+1)
+	}
+
+	// the ports might still be referenced by previously serialized
+	// devices, so we modify a copy
+	ports := copyPorts(s.device.Ports)
+
+	for _, c := range update.GetChanges() {
+		t := findTerminal(ports, c.GetPort(), c.GetTerminal())
+		if t == nil {
+			return fmt.Errorf("%w: unknown terminal %s/%s", errOutOfSync,
+				c.GetPort(), c.GetTerminal())
+		}
+		t.State = c.GetState()
+		t.Sensed = optionalBool(c.Sensed)
+		t.Mismatch = c.GetMismatch()
+	}
+
+	s.device.Ports = ports
+	s.updateHealth(update.GetHealth())
+	s.sequence = update.GetSequence()
+
+	if s.eventHandler != nil {
+		go s.eventHandler(s, s.serialize())
+	}
+
+	return nil
+}
+
+func copyPorts(ports []sw.Port) []sw.Port {
+	c := make([]sw.Port, 0, len(ports))
+	for _, p := range ports {
+		p.Terminals = append([]sw.Terminal{}, p.Terminals...)
+		c = append(c, p)
+	}
+	return c
+}
+
+func findTerminal(ports []sw.Port, portName, terminalName string) *sw.Terminal {
+	for i := range ports {
+		if ports[i].Name != portName {
+			continue
+		}
+		for j := range ports[i].Terminals {
+			if ports[i].Terminals[j].Name == terminalName {
+				return &ports[i].Terminals[j]
+			}
+		}
+	}
+	return nil
+}
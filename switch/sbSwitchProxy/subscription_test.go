@@ -0,0 +1,129 @@
+package sbSwitchProxy
+
+import (
+	"errors"
+	"testing"
+
+	sbSwitch "github.com/dh1tw/remoteSwitch/sb_switch"
+)
+
+func testSnapshot(sequence uint64) *sbSwitch.StateUpdate {
+	return &sbSwitch.StateUpdate{
+		Sequence: sequence,
+		Snapshot: &sbSwitch.Device{
+			Name: "Antenna Switch",
+			Ports: []*sbSwitch.Port{
+				{
+					Name: "Radio",
+					Terminals: []*sbSwitch.Terminal{
+						{Name: "Yagi", Index: 0},
+						{Name: "Dipole", Index: 1, State: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+func testChange(sequence uint64, terminal string, state bool) *sbSwitch.StateUpdate {
+	return &sbSwitch.StateUpdate{
+		Sequence: sequence,
+		Changes: []*sbSwitch.TerminalChange{
+			{Port: "Radio", Terminal: terminal, State: state},
+		},
+	}
+}
+
+func TestSbSwitchProxy_applyUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		updates    []*sbSwitch.StateUpdate
+		wantErr    error
+		wantSeq    uint64
+		wantStates []bool
+	}{
+		{"snapshot", []*sbSwitch.StateUpdate{testSnapshot(5)}, nil, 5,
+			[]bool{false, true}},
+		{"consecutive updates", []*sbSwitch.StateUpdate{
+			testSnapshot(5),
+			testChange(6, "Yagi", true),
+			testChange(7, "Dipole", false),
+		}, nil, 7, []bool{true, false}},
+		{"keepalive", []*sbSwitch.StateUpdate{
+			testSnapshot(5),
+			{Sequence: 5},
+		}, nil, 5, []bool{false, true}},
+		{"missed update", []*sbSwitch.StateUpdate{
+			testSnapshot(5),
+			testChange(7, "Yagi", true),
+		}, errOutOfSync, 5, []bool{false, true}},
+		{"update before snapshot", []*sbSwitch.StateUpdate{
+			testChange(1, "Yagi", true),
+		}, errOutOfSync, 0, nil},
+		{"unknown terminal", []*sbSwitch.StateUpdate{
+			testSnapshot(5),
+			testChange(6, "Vertical", true),
+		}, errOutOfSync, 5, []bool{false, true}},
+		{"snapshot resets sequence", []*sbSwitch.StateUpdate{
+			testSnapshot(5),
+			testChange(6, "Yagi", true),
+			testSnapshot(2),
+		}, nil, 2, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SbSwitchProxy{}
+			var err error
+			for _, u := range tt.updates {
+				if err = s.applyUpdate(u); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if s.sequence != tt.wantSeq {
+				t.Errorf("sequence = %d, want %d", s.sequence, tt.wantSeq)
+			}
+			if tt.wantStates == nil {
+				return
+			}
+			for i, terminal := range s.device.Ports[0].Terminals {
+				if terminal.State != tt.wantStates[i] {
+					t.Errorf("terminal %s state = %v, want %v", terminal.Name,
+						terminal.State, tt.wantStates[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSbSwitchProxy_applyUpdate_sensed(t *testing.T) {
+
+	s := &SbSwitchProxy{}
+	if err := s.applyUpdate(testSnapshot(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	sensed := false
+	change := &sbSwitch.StateUpdate{
+		Sequence: 6,
+		Changes: []*sbSwitch.TerminalChange{
+			{Port: "Radio", Terminal: "Dipole", State: true, Sensed: &sensed, Mismatch: true},
+		},
+	}
+	if err := s.applyUpdate(change); err != nil {
+		t.Fatal(err)
+	}
+
+	dipole := s.device.Ports[0].Terminals[1]
+	if !dipole.State || dipole.Sensed == nil || *dipole.Sensed || !dipole.Mismatch {
+		t.Errorf("dipole = %+v, want sensed off and mismatch", dipole)
+	}
+
+	// the change doesn't share its field with the terminal
+	sensed = true
+	if *s.device.Ports[0].Terminals[1].Sensed {
+		t.Error("sensed state shared with the update")
+	}
+}
@@ -0,0 +1,99 @@
+package serialrelay
+
+import (
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+)
+
+// Switch is a functional option to set the switch's configuration.
+func Switch(sc SwitchConfig) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.switchConfig = sc
+	}
+}
+
+// SwitchConfig describes a switch which is a collection of ports.
+type SwitchConfig struct {
+	Name      string
+	Index     int
+	Exclusive bool
+	Ports     []PortConfig
+}
+
+// PortConfig describes a port which is a collection of relays.
+type PortConfig struct {
+	Name      string
+	Index     int
+	Exclusive bool
+	Terminals []RelayConfig
+}
+
+// RelayConfig describes a relay of the board. Relays are numbered
+// starting with 1.
+type RelayConfig struct {
+	Name     string
+	Relay    int
+	Inverted bool
+	Index    int
+}
+
+// Board is a functional option to set the family of the relay board,
+// which determines the protocol. Supported are LCUS, KMTronic and Denkovi.
+func Board(board string) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.board = board
+	}
+}
+
+// Portname is a functional option to set the serial port to which the
+// board is connected. Portnames in the form host:port are opened as a
+// TCP connection to a serial server (e.g. ser2net).
+func Portname(portname string) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.spConfig.Name = portname
+	}
+}
+
+// Device is a functional option to select the serial port by the
+// properties of the USB device (e.g. its serial number) instead of its
+// portname, which depends on the order in which the USB serial devices
+// have been enumerated. The port is looked up whenever it is opened.
+func Device(m serialport.Match) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.spConfig.Match = m
+	}
+}
+
+// Baudrate is a functional option to set the baudrate of the serial port.
+func Baudrate(baudrate int) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.spConfig.Baudrate = baudrate
+	}
+}
+
+// PollingInterval is a functional option to set the interval in which
+// the state of the relays is read. It only applies to boards which are
+// able to report the state of their relays.
+func PollingInterval(d time.Duration) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.pollingInterval = d
+	}
+}
+
+// Timeout is a functional option to set the time after which a command
+// without response is considered to have failed.
+func Timeout(d time.Duration) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.timeout = d
+	}
+}
+
+// EventHandler sets a callback function through which the switch
+// will report Events
+func EventHandler(h func(sw.Switcher, sw.Device)) func(*SerialRelay) {
+	return func(s *SerialRelay) {
+		s.eventHandler = h
+	}
+}
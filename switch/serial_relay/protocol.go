@@ -0,0 +1,114 @@
+package serialrelay
+
+import (
+	"fmt"
+	"time"
+)
+
+// Supported relay board families
+const (
+	LCUS     = "lcus"
+	KMTronic = "kmtronic"
+	Denkovi  = "denkovi"
+)
+
+// protocol encodes the commands of a relay board family. Relays are
+// numbered starting with 1.
+type protocol struct {
+	name      string
+	maxRelays int
+	// set returns the command to switch a relay.
+	set func(relay int, state bool) []byte
+	// status is the command to query the state of all relays. It is
+	// nil if the boards can't report the state of their relays.
+	status []byte
+	// statusLength is the length of the response to the status command.
+	statusLength int
+	// parseStatus decodes the response to the status command.
+	parseStatus func(resp []byte) ([]bool, error)
+	// delay is the time the board needs to process a command which
+	// is not acknowledged.
+	delay time.Duration
+}
+
+var protocols = map[string]protocol{
+	LCUS:     lcusProtocol,
+	KMTronic: kmtronicProtocol,
+	Denkovi:  denkoviProtocol,
+}
+
+// lcusProtocol is used by the LCUS-1/2/4/8 boards (CH340 USB serial
+// chip). The boards don't acknowledge commands and can't report their
+// state. A command consists of the start byte 0xA0, the relay, the state
+// and the checksum (sum of the previous bytes).
+var lcusProtocol = protocol{
+	name:      "LCUS",
+	maxRelays: 8,
+	set: func(relay int, state bool) []byte {
+		cmd := []byte{0xA0, byte(relay), 0x00, 0x00}
+		if state {
+			cmd[2] = 0x01
+		}
+		cmd[3] = cmd[0] + cmd[1] + cmd[2]
+		return cmd
+	},
+	delay: time.Millisecond * 50,
+}
+
+// kmtronicProtocol is used by the KMTronic USB relay boards. A command
+// consists of 0xFF, the relay and the state. The status command 0xFF 0x09
+// 0x00 returns one byte (0 or 1) per relay.
+var kmtronicProtocol = protocol{
+	name:      "KMTronic",
+	maxRelays: 8,
+	set: func(relay int, state bool) []byte {
+		cmd := []byte{0xFF, byte(relay), 0x00}
+		if state {
+			cmd[2] = 0x01
+		}
+		return cmd
+	},
+	status:       []byte{0xFF, 0x09, 0x00},
+	statusLength: 8,
+	parseStatus: func(resp []byte) ([]bool, error) {
+		states := make([]bool, len(resp))
+		for i, b := range resp {
+			switch b {
+			case 0x00:
+			case 0x01:
+				states[i] = true
+			default:
+				return nil, fmt.Errorf("invalid state 0x%02X of relay %d", b, i+1)
+			}
+		}
+		return states, nil
+	},
+	delay: time.Millisecond * 20,
+}
+
+// denkoviProtocol is used by the Denkovi USB relay boards with virtual
+// COM port. The commands are ASCII strings like "01+//" (relay 1 on) and
+// "01-//" (relay 1 off). The status command "ask//" returns two bytes
+// with one bit per relay; relay 1 is the least significant bit of the
+// first byte.
+var denkoviProtocol = protocol{
+	name:      "Denkovi",
+	maxRelays: 16,
+	set: func(relay int, state bool) []byte {
+		op := '-'
+		if state {
+			op = '+'
+		}
+		return []byte(fmt.Sprintf("%02d%c//", relay, op))
+	},
+	status:       []byte("ask//"),
+	statusLength: 2,
+	parseStatus: func(resp []byte) ([]bool, error) {
+		states := make([]bool, len(resp)*8)
+		for i := range states {
+			states[i] = resp[i/8]&(1<<(uint(i)%8)) != 0
+		}
+		return states, nil
+	},
+	delay: time.Millisecond * 20,
+}
@@ -0,0 +1,533 @@
+package serialrelay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/serialport"
+)
+
+// SerialRelay contains the state and configuration of a USB relay
+// board which is controlled through a (virtual) serial port. The board
+// can also be attached to a serial server (e.g. ser2net).
+type SerialRelay struct {
+	sync.Mutex
+	name            string
+	index           int
+	exclusive       bool
+	ports           map[string]*port
+	switchConfig    SwitchConfig
+	eventHandler    func(sw.Switcher, sw.Device)
+	board           string
+	protocol        protocol
+	spConfig        serialport.Config
+	sp              io.ReadWriteCloser
+	bus             sync.Mutex // serializes the access to the serial port
+	pollingInterval time.Duration
+	timeout         time.Duration
+	initialized     bool
+	lastSeen        time.Time
+	lastError       string
+	closeCh         chan struct{}
+	closeOnce       sync.Once
+}
+
+// port represents a set of terminals (relays). This struct holds the
+// configuration and state of the port.
+type port struct {
+	name      string
+	terminals map[string]*terminal
+	exclusive bool
+	index     int
+}
+
+// terminal represents a particular relay. This struct holds the
+// configuration and the (logical) state of the terminal.
+type terminal struct {
+	name     string
+	relay    int
+	inverted bool
+	state    bool
+	index    int
+}
+
+// NewSerialRelay is the constructor for a serial relay board.
+// The constructor takes functional arguments for configuring the switch.
+func NewSerialRelay(options ...func(*SerialRelay)) *SerialRelay {
+
+	s := &SerialRelay{
+		name:  "My USB Relay",
+		ports: make(map[string]*port),
+		board: LCUS,
+		spConfig: serialport.Config{
+			Name:        "/dev/ttyUSB0",
+			Baudrate:    9600,
+			ReadTimeout: time.Millisecond * 100,
+		},
+		pollingInterval: time.Second,
+		timeout:         time.Second,
+		closeCh:         make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// Init opens the serial port and reads the state of the relays. Boards
+// which can't report their state are reset (all configured relays off).
+func (s *SerialRelay) Init() error {
+
+	p, ok := protocols[s.board]
+	if !ok {
+		return fmt.Errorf("unknown relay board %s (supported: %s, %s, %s)",
+			s.board, LCUS, KMTronic, Denkovi)
+	}
+	s.protocol = p
+
+	s.name = s.switchConfig.Name
+	s.index = s.switchConfig.Index
+	s.exclusive = s.switchConfig.Exclusive
+
+	relays := make(map[int]string)
+
+	for _, pConfig := range s.switchConfig.Ports {
+		if _, portNameExists := s.ports[pConfig.Name]; portNameExists {
+			return fmt.Errorf("portname %s already exists", pConfig.Name)
+		}
+		prt := &port{
+			name:      pConfig.Name,
+			terminals: make(map[string]*terminal),
+			exclusive: pConfig.Exclusive,
+			index:     pConfig.Index,
+		}
+
+		for _, rConfig := range pConfig.Terminals {
+			if _, ok := prt.terminals[rConfig.Name]; ok {
+				return fmt.Errorf("terminal %s already exists on port %s",
+					rConfig.Name, pConfig.Name)
+			}
+			if rConfig.Relay < 1 || rConfig.Relay > p.maxRelays {
+				return fmt.Errorf("invalid relay %d for terminal %s (%s boards have relays 1-%d)",
+					rConfig.Relay, rConfig.Name, p.name, p.maxRelays)
+			}
+			// the same relay may only be used by the same terminal on
+			// different ports (e.g. a shared antenna)
+			if name, ok := relays[rConfig.Relay]; ok && name != rConfig.Name {
+				return fmt.Errorf("relay %d already used by terminal %s",
+					rConfig.Relay, name)
+			}
+			relays[rConfig.Relay] = rConfig.Name
+
+			prt.terminals[rConfig.Name] = &terminal{
+				name:     rConfig.Name,
+				relay:    rConfig.Relay,
+				inverted: rConfig.Inverted,
+				index:    rConfig.Index,
+			}
+		}
+
+		s.ports[pConfig.Name] = prt
+	}
+
+	if len(relays) == 0 {
+		return fmt.Errorf("no relays configured")
+	}
+
+	if p.status != nil {
+		if err := s.update(); err != nil {
+			return fmt.Errorf("unable to read relays of %s: %v", s.name, err)
+		}
+	} else {
+		// the state of the relays is unknown; start from a known state
+		if err := s.reset(); err != nil {
+			return fmt.Errorf("unable to reset relays of %s: %v", s.name, err)
+		}
+	}
+
+	s.Lock()
+	s.initialized = true
+	s.lastSeen = time.Now()
+	s.Unlock()
+
+	if p.status != nil && s.pollingInterval > 0 {
+		go s.poll()
+	}
+
+	return nil
+}
+
+// reset switches all configured relays off.
+func (s *SerialRelay) reset() error {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	for _, p := range s.ports {
+		for _, t := range p.terminals {
+			if err := s.setState(t, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Name returns the Name of this relay board.
+func (s *SerialRelay) Name() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.name
+}
+
+// SetPort sets the Terminals of a particular Port. The portRequest
+// can contain n terminals.
+func (s *SerialRelay) SetPort(portRequest sw.Port) error {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+	s.Lock()
+	defer s.Unlock()
+
+	// ensure that the requested port exists
+	p, ok := s.ports[portRequest.Name]
+	if !ok {
+		return fmt.Errorf("%s is an invalid port", portRequest.Name)
+	}
+
+	// ensure that the requested terminal exists
+	for _, t := range portRequest.Terminals {
+		if _, ok := p.terminals[t.Name]; !ok {
+			return fmt.Errorf("%s is an invalid terminal", t.Name)
+		}
+	}
+
+	// if SerialRelay.exclusive is true, a particular terminal can only
+	// be active on one port
+	if s.exclusive {
+		for prtName, prt := range s.ports {
+
+			// only check the remaining ports
+			if prtName == portRequest.Name {
+				continue
+			}
+
+			for _, t := range portRequest.Terminals {
+				if r, found := prt.terminals[t.Name]; found && r.state {
+					return fmt.Errorf("terminal %s in use by port %s",
+						t.Name, prtName)
+				}
+			}
+		}
+	}
+
+	// if port.exclusive is enabled, only one terminal can be active
+	// on this port.
+	if p.exclusive {
+		activate := make(map[string]bool)
+		for _, t := range portRequest.Terminals {
+			if t.State {
+				activate[t.Name] = true
+			}
+		}
+
+		// deactivate all other relays on this port; relays which are
+		// requested to be active are not touched to avoid chattering
+		for _, r := range p.terminals {
+			if !r.state || activate[r.name] {
+				continue
+			}
+			if err := s.setState(r, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	// set state of the terminal
+	for _, t := range portRequest.Terminals {
+		if err := s.setState(p.terminals[t.Name], t.State); err != nil {
+			return err
+		}
+	}
+
+	s.lastSeen = time.Now()
+	s.lastError = ""
+
+	if s.eventHandler != nil {
+		device := s.serialize()
+		go s.eventHandler(s, device)
+	}
+
+	return nil
+}
+
+// setState switches the relay of a terminal. The same relay might be
+// shared by several ports, so the state of all terminals using the relay
+// is updated. This method is not threadsafe.
+func (s *SerialRelay) setState(r *terminal, state bool) error {
+
+	cmd := s.protocol.set(r.relay, state != r.inverted)
+	if _, err := s.exchange(cmd, 0); err != nil {
+		s.lastError = err.Error()
+		return err
+	}
+
+	for _, p := range s.ports {
+		for _, t := range p.terminals {
+			if t.relay == r.relay {
+				t.state = state
+			}
+		}
+	}
+
+	return nil
+}
+
+// exchange writes a command to the board and reads respLength bytes
+// of response. The serial port is opened if necessary and closed after
+// an error, so that it will be reopened (e.g. after the board has been
+// unplugged) with the next command. The caller must hold the bus lock.
+func (s *SerialRelay) exchange(cmd []byte, respLength int) ([]byte, error) {
+
+	reused := s.sp != nil
+
+	if s.sp == nil {
+		sp, err := serialport.Open(s.spConfig)
+		if err != nil {
+			return nil, err
+		}
+		s.sp = sp
+	}
+
+	resp, err := s.write(cmd, respLength)
+	if err != nil {
+		s.sp.Close()
+		s.sp = nil
+		// a port which has been open for a while might have been
+		// closed by the peer; try once more with a new connection
+		if reused && !errors.Is(err, serialport.ErrTimeout) {
+			return s.exchange(cmd, respLength)
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *SerialRelay) write(cmd []byte, respLength int) ([]byte, error) {
+
+	if _, err := s.sp.Write(cmd); err != nil {
+		return nil, err
+	}
+
+	if respLength == 0 {
+		// the board doesn't acknowledge the command; give it some time
+		// to process it before the next command
+		time.Sleep(s.protocol.delay)
+		return nil, nil
+	}
+
+	resp := make([]byte, respLength)
+	if err := serialport.ReadFull(s.sp, resp, s.timeout); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// GetPort returns switch.Port struct containing the current state of
+// the requested port.
+func (s *SerialRelay) GetPort(portName string) (sw.Port, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	p, ok := s.ports[portName]
+	if !ok {
+		return sw.Port{}, fmt.Errorf("%s in an invalid port", portName)
+	}
+
+	return p.serialize(), nil
+}
+
+// Serialize returns a switch.Device struct containing the current
+// state and configuration of this relay board.
+func (s *SerialRelay) Serialize() sw.Device {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.serialize()
+}
+
+// serialize returns a switch.Port struct containing the current
+// state and configuration of this port. This method
+// is not threadsafe.
+func (p *port) serialize() sw.Port {
+	swPort := sw.Port{
+		Name:      p.name,
+		Index:     p.index,
+		Exclusive: p.exclusive,
+		Terminals: []sw.Terminal{},
+	}
+
+	for _, r := range p.terminals {
+		t := sw.Terminal{
+			Name:  r.name,
+			Index: r.index,
+			State: r.state,
+		}
+		swPort.Terminals = append(swPort.Terminals, t)
+	}
+
+	// sort the Terminals by index
+	sort.Slice(swPort.Terminals, func(i, j int) bool {
+		return swPort.Terminals[i].Index < swPort.Terminals[j].Index
+	})
+
+	return swPort
+}
+
+// Health returns the health of this relay board. The board is
+// considered online as long as the last command succeeded. Boards which
+// can't report their state are only checked when they are switched.
+func (s *SerialRelay) Health() sw.Health {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.health()
+}
+
+// health returns the health of this relay board. This method
+// is not threadsafe.
+func (s *SerialRelay) health() sw.Health {
+	return sw.Health{
+		Online:   s.initialized && len(s.lastError) == 0,
+		LastSeen: s.lastSeen,
+		Error:    s.lastError,
+		Model:    s.protocol.name,
+	}
+}
+
+// serialize returns a switch.Device struct containing the current
+// state and configuration of this relay board. This method
+// is not threadsafe.
+func (s *SerialRelay) serialize() sw.Device {
+
+	health := s.health()
+
+	dev := sw.Device{
+		Name:      s.name,
+		Index:     s.index,
+		Exclusive: s.exclusive,
+		Health:    &health,
+	}
+
+	// serialize all ports
+	for _, p := range s.ports {
+		swPort := p.serialize()
+		dev.Ports = append(dev.Ports, swPort)
+	}
+
+	// sort the ports by index
+	sort.Slice(dev.Ports, func(i, j int) bool {
+		return dev.Ports[i].Index < dev.Ports[j].Index
+	})
+
+	return dev
+}
+
+// poll reads the state of the relays periodically until the switch
+// is closed.
+func (s *SerialRelay) poll() {
+
+	ticker := time.NewTicker(s.pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+			s.update()
+		}
+	}
+}
+
+// update reads the state of the relays from the board and updates the
+// terminals. This detects changes made by other applications or a board
+// which has been power cycled. The event handler is called if the state
+// or the health of the switch has changed.
+func (s *SerialRelay) update() error {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+
+	resp, err := s.exchange(s.protocol.status, s.protocol.statusLength)
+
+	var states []bool
+	if err == nil {
+		states, err = s.protocol.parseStatus(resp)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	changed := false
+
+	if err != nil {
+		if s.lastError != err.Error() {
+			log.Printf("serial relay %s: %v", s.name, err)
+			s.lastError = err.Error()
+			changed = true
+		}
+	} else {
+		if s.lastError != "" {
+			log.Printf("serial relay %s: connection restored", s.name)
+			s.lastError = ""
+			changed = true
+		}
+		s.lastSeen = time.Now()
+
+		for _, p := range s.ports {
+			for _, t := range p.terminals {
+				if t.relay > len(states) {
+					continue
+				}
+				state := states[t.relay-1] != t.inverted
+				if state != t.state {
+					t.state = state
+					changed = true
+				}
+			}
+		}
+	}
+
+	if changed && s.initialized && s.eventHandler != nil {
+		device := s.serialize()
+		go s.eventHandler(s, device)
+	}
+
+	return err
+}
+
+// Close stops polling and closes the serial port. The state of the
+// relays is not modified.
+func (s *SerialRelay) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+	})
+
+	s.bus.Lock()
+	defer s.bus.Unlock()
+	if s.sp != nil {
+		s.sp.Close()
+		s.sp = nil
+	}
+}
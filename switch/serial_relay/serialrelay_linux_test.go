@@ -0,0 +1,125 @@
+//go:build linux
+
+package serialrelay
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/internal/switchtest"
+)
+
+// newPtySimulator starts a simulator on a pseudo terminal and returns
+// the name of the serial port for the driver.
+func newPtySimulator(t *testing.T, board string, relays int) (*Simulator, string) {
+	t.Helper()
+
+	sim, err := NewSimulator(board, relays)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	master, portname := switchtest.OpenPty(t)
+
+	var closed bool
+	var mu sync.Mutex
+
+	go func() {
+		for {
+			// reading from the master fails while the slave isn't
+			// opened by the driver
+			sim.Serve(master)
+			mu.Lock()
+			done := closed
+			mu.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}()
+
+	t.Cleanup(func() {
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+		master.Close()
+	})
+
+	return sim, portname
+}
+
+func TestSerialRelay_pty(t *testing.T) {
+
+	boards := []struct {
+		board  string
+		relays int
+	}{
+		{LCUS, 4},
+		{KMTronic, 8},
+		{Denkovi, 16},
+	}
+
+	for _, b := range boards {
+		t.Run(b.board, func(t *testing.T) {
+			sim, portname := newPtySimulator(t, b.board, b.relays)
+
+			// state before remoteSwitch starts; 40m on port B is
+			// inverted and therefore off
+			sim.SetRelay(1, true)
+			sim.SetRelay(4, true)
+
+			s, events := newTestRelay(t, b.board, portname)
+
+			if protocols[b.board].status == nil {
+				// boards without status are reset
+				if sim.Relay(1) {
+					t.Error("relay 1 not reset by Init")
+				}
+			} else if !switchtest.TerminalState(t, s, "A", "80m") {
+				t.Error("state of relay 1 not read by Init")
+			}
+
+			requests := []struct {
+				port     string
+				terminal string
+				wantErr  bool
+			}{
+				{"A", "40m", false},
+				{"B", "80m", false},
+				{"B", "40m", true}, // in use by port A
+				{"B", "20m", true},
+			}
+			for _, r := range requests {
+				err := s.SetPort(sw.Port{Name: r.port, Terminals: []sw.Terminal{{Name: r.terminal, State: true}}})
+				if (err != nil) != r.wantErr {
+					t.Fatalf("SetPort(%s, %s) error = %v, wantErr %v", r.port, r.terminal, err, r.wantErr)
+				}
+			}
+
+			want := []bool{false, true, true, true}
+			for i, w := range want {
+				if got := sim.Relay(i + 1); got != w {
+					t.Errorf("relay %d = %v, want %v", i+1, got, w)
+				}
+			}
+
+			if protocols[b.board].status == nil {
+				return
+			}
+
+			// relay switched by another application
+			sim.SetRelay(2, false)
+
+			switchtest.Eventually(t, func() bool { return !switchtest.TerminalState(t, s, "A", "40m") })
+
+			select {
+			case <-events:
+			case <-time.After(time.Second):
+				t.Fatal("no event after external change")
+			}
+		})
+	}
+}
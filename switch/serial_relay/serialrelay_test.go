@@ -0,0 +1,193 @@
+package serialrelay
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/internal/switchtest"
+)
+
+var testConfig = SwitchConfig{
+	Name:      "Bandswitch",
+	Exclusive: true,
+	Ports: []PortConfig{
+		{
+			Name:      "A",
+			Index:     0,
+			Exclusive: true,
+			Terminals: []RelayConfig{
+				{Name: "80m", Relay: 1, Index: 0},
+				{Name: "40m", Relay: 2, Index: 1},
+			},
+		},
+		{
+			Name:      "B",
+			Index:     1,
+			Exclusive: true,
+			Terminals: []RelayConfig{
+				{Name: "80m", Relay: 3, Index: 0},
+				{Name: "40m", Relay: 4, Index: 1, Inverted: true},
+			},
+		},
+	},
+}
+
+func newTestRelay(t *testing.T, board, portname string, opts ...func(*SerialRelay)) (*SerialRelay, chan sw.Device) {
+	t.Helper()
+
+	handler, events := switchtest.Events()
+
+	opts = append([]func(*SerialRelay){
+		Switch(testConfig),
+		Board(board),
+		Portname(portname),
+		PollingInterval(time.Millisecond * 20),
+		Timeout(time.Millisecond * 200),
+		EventHandler(handler),
+	}, opts...)
+
+	s := NewSerialRelay(opts...)
+	switchtest.Init(t, s)
+
+	return s, events
+}
+
+func Test_protocolSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		board string
+		relay int
+		state bool
+		want  []byte
+	}{
+		{"lcus relay 1 on", LCUS, 1, true, []byte{0xA0, 0x01, 0x01, 0xA2}},
+		{"lcus relay 1 off", LCUS, 1, false, []byte{0xA0, 0x01, 0x00, 0xA1}},
+		{"lcus relay 8 on", LCUS, 8, true, []byte{0xA0, 0x08, 0x01, 0xA9}},
+		{"kmtronic relay 1 on", KMTronic, 1, true, []byte{0xFF, 0x01, 0x01}},
+		{"kmtronic relay 8 off", KMTronic, 8, false, []byte{0xFF, 0x08, 0x00}},
+		{"denkovi relay 1 on", Denkovi, 1, true, []byte("01+//")},
+		{"denkovi relay 16 off", Denkovi, 16, false, []byte("16-//")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protocols[tt.board].set(tt.relay, tt.state); !bytes.Equal(got, tt.want) {
+				t.Errorf("set() = % X, want % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_protocolParseStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		board   string
+		resp    []byte
+		want    []bool
+		wantErr bool
+	}{
+		{"kmtronic", KMTronic, []byte{1, 0, 0, 1, 0, 0, 0, 1},
+			[]bool{true, false, false, true, false, false, false, true}, false},
+		{"kmtronic invalid state", KMTronic, []byte{2, 0, 0, 0, 0, 0, 0, 0}, nil, true},
+		{"denkovi", Denkovi, []byte{0x05, 0x80},
+			[]bool{true, false, true, false, false, false, false, false,
+				false, false, false, false, false, false, false, true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := protocols[tt.board].parseStatus(tt.resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialRelay_Init(t *testing.T) {
+
+	sim, err := NewSimulator(KMTronic, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := sim.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	tests := []struct {
+		name    string
+		opts    []func(*SerialRelay)
+		wantErr bool
+	}{
+		{"valid", []func(*SerialRelay){Switch(testConfig), Board(KMTronic), Portname(addr)}, false},
+		{"unknown board", []func(*SerialRelay){Switch(testConfig), Board("sainsmart"), Portname(addr)}, true},
+		{"no relays", []func(*SerialRelay){Board(KMTronic), Portname(addr)}, true},
+		{"relay out of range", []func(*SerialRelay){Board(KMTronic), Portname(addr), Switch(SwitchConfig{
+			Name: "Switch",
+			Ports: []PortConfig{{Name: "A", Terminals: []RelayConfig{
+				{Name: "80m", Relay: 9},
+			}}},
+		})}, true},
+		{"relay used twice", []func(*SerialRelay){Board(KMTronic), Portname(addr), Switch(SwitchConfig{
+			Name: "Switch",
+			Ports: []PortConfig{{Name: "A", Terminals: []RelayConfig{
+				{Name: "80m", Relay: 1},
+				{Name: "40m", Relay: 1},
+			}}},
+		})}, true},
+		{"serial server not reachable", []func(*SerialRelay){Switch(testConfig), Board(KMTronic),
+			Portname("127.0.0.1:1")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSerialRelay(tt.opts...)
+			defer s.Close()
+			if err := s.Init(); (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// the board is attached to a serial server (e.g. ser2net)
+func TestSerialRelay_serialServer(t *testing.T) {
+
+	sim, err := NewSimulator(Denkovi, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := sim.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, events := newTestRelay(t, Denkovi, addr)
+
+	err = s.SetPort(sw.Port{Name: "B", Terminals: []sw.Terminal{{Name: "40m", State: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 40m on port B is inverted
+	if sim.Relay(4) {
+		t.Error("relay 4 should be off")
+	}
+
+	sim.Close()
+
+	switchtest.Eventually(t, func() bool { return !s.Health().Online })
+
+	var dev sw.Device
+	switchtest.Eventually(t, func() bool {
+		select {
+		case dev = <-events:
+		default:
+		}
+		return dev.Health != nil && !dev.Health.Online
+	})
+}
@@ -0,0 +1,252 @@
+package serialrelay
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Simulator emulates a USB relay board of one of the supported
+// families. It serves the board's protocol on any io.ReadWriter (e.g. the
+// master side of a pseudo terminal) or on a TCP socket, like a board
+// behind a serial server. The simulator is meant for tests and for trying
+// out configurations without hardware.
+type Simulator struct {
+	sync.Mutex
+	board    string
+	relays   []bool
+	commands int
+	lis      net.Listener
+	conns    map[net.Conn]struct{}
+}
+
+// NewSimulator returns a simulator of a relay board with the given
+// amount of relays.
+func NewSimulator(board string, relays int) (*Simulator, error) {
+
+	p, ok := protocols[board]
+	if !ok {
+		return nil, fmt.Errorf("unknown relay board %s", board)
+	}
+
+	if relays < 1 || relays > p.maxRelays {
+		return nil, fmt.Errorf("%s boards have 1-%d relays", p.name, p.maxRelays)
+	}
+
+	s := &Simulator{
+		board:  board,
+		relays: make([]bool, relays),
+		conns:  make(map[net.Conn]struct{}),
+	}
+
+	return s, nil
+}
+
+// Relay returns the state of a relay (starting with 1).
+func (s *Simulator) Relay(relay int) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.relays[relay-1]
+}
+
+// SetRelay sets the state of a relay (starting with 1), e.g. to simulate
+// a relay which has been switched by another application.
+func (s *Simulator) SetRelay(relay int, state bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.relays[relay-1] = state
+}
+
+// Commands returns the amount of valid commands received so far.
+func (s *Simulator) Commands() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.commands
+}
+
+// Listen starts serving the simulated board on a TCP socket on
+// address (e.g. "127.0.0.1:0" for a random port) and returns the
+// address it is listening on.
+func (s *Simulator) Listen(address string) (string, error) {
+
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", err
+	}
+
+	s.Lock()
+	s.lis = lis
+	s.Unlock()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			s.Lock()
+			s.conns[conn] = struct{}{}
+			s.Unlock()
+
+			go func() {
+				s.Serve(conn)
+				s.Lock()
+				delete(s.conns, conn)
+				s.Unlock()
+				conn.Close()
+			}()
+		}
+	}()
+
+	return lis.Addr().String(), nil
+}
+
+// Close stops listening and closes all TCP connections.
+func (s *Simulator) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	for c := range s.conns {
+		c.Close()
+	}
+
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Close()
+}
+
+// Serve executes the commands read from rw until reading fails.
+func (s *Simulator) Serve(rw io.ReadWriter) error {
+	switch s.board {
+	case LCUS:
+		return s.serveLCUS(rw)
+	case KMTronic:
+		return s.serveKMTronic(rw)
+	default:
+		return s.serveDenkovi(rw)
+	}
+}
+
+// readFrame skips bytes until the start byte and reads the remaining
+// bytes of the frame.
+func readFrame(r io.Reader, start byte, length int) ([]byte, error) {
+	frame := make([]byte, length)
+	for {
+		if _, err := io.ReadFull(r, frame[:1]); err != nil {
+			return nil, err
+		}
+		if frame[0] == start {
+			break
+		}
+	}
+	if _, err := io.ReadFull(r, frame[1:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (s *Simulator) serveLCUS(rw io.ReadWriter) error {
+	for {
+		frame, err := readFrame(rw, 0xA0, 4)
+		if err != nil {
+			return err
+		}
+		// invalid commands are ignored by the board
+		if frame[0]+frame[1]+frame[2] != frame[3] || frame[2] > 1 {
+			continue
+		}
+		s.set(int(frame[1]), frame[2] == 1)
+	}
+}
+
+func (s *Simulator) serveKMTronic(rw io.ReadWriter) error {
+	for {
+		frame, err := readFrame(rw, 0xFF, 3)
+		if err != nil {
+			return err
+		}
+
+		if frame[1] == 0x09 && frame[2] == 0x00 {
+			s.Lock()
+			s.commands++
+			// the status always contains 8 relays
+			resp := make([]byte, 8)
+			for i, r := range s.relays {
+				if r {
+					resp[i] = 0x01
+				}
+			}
+			s.Unlock()
+			if _, err := rw.Write(resp); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if frame[2] > 1 {
+			continue
+		}
+		s.set(int(frame[1]), frame[2] == 1)
+	}
+}
+
+func (s *Simulator) serveDenkovi(rw io.ReadWriter) error {
+
+	var cmd []byte
+	b := make([]byte, 1)
+
+	for {
+		if _, err := io.ReadFull(rw, b); err != nil {
+			return err
+		}
+		cmd = append(cmd, b[0])
+		if !strings.HasSuffix(string(cmd), "//") {
+			if len(cmd) > 16 {
+				cmd = cmd[:0]
+			}
+			continue
+		}
+
+		c := strings.TrimSuffix(string(cmd), "//")
+		cmd = cmd[:0]
+
+		switch {
+		case c == "ask":
+			s.Lock()
+			s.commands++
+			resp := make([]byte, 2)
+			for i, r := range s.relays {
+				if r {
+					resp[i/8] |= 1 << (uint(i) % 8)
+				}
+			}
+			s.Unlock()
+			if _, err := rw.Write(resp); err != nil {
+				return err
+			}
+		case len(c) == 3 && (c[2] == '+' || c[2] == '-'):
+			relay, err := strconv.Atoi(c[:2])
+			if err != nil {
+				continue
+			}
+			s.set(relay, c[2] == '+')
+		}
+	}
+}
+
+// set switches a relay; commands for relays which don't exist are
+// ignored like the real boards do.
+func (s *Simulator) set(relay int, state bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if relay < 1 || relay > len(s.relays) {
+		return
+	}
+	s.relays[relay-1] = state
+	s.commands++
+}
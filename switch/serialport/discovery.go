@@ -0,0 +1,128 @@
+package serialport
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Device is a USB serial device attached to this computer.
+type Device struct {
+	// Name of the serial port (e.g. "/dev/ttyACM0"). It depends on the
+	// order in which the devices have been enumerated.
+	Name string
+	// ByID contains the stable links to the serial port created by udev
+	// in /dev/serial/by-id.
+	ByID         []string
+	VendorID     string
+	ProductID    string
+	Serial       string
+	Manufacturer string
+	Product      string
+}
+
+// Match selects a USB serial device by its properties instead of the
+// name of its serial port, which changes when other USB serial devices
+// are enumerated first. Empty fields match any device.
+type Match struct {
+	// VendorID and ProductID in hex (e.g. "04d8")
+	VendorID  string
+	ProductID string
+	Serial    string
+	// ByID is a glob pattern (e.g. "usb-FTDI_*") matched against the
+	// links in /dev/serial/by-id. Patterns containing a slash are matched
+	// against the full path of the links.
+	ByID string
+}
+
+// IsZero returns true if no property has been set.
+func (m Match) IsZero() bool {
+	return m == Match{}
+}
+
+// Validate checks the glob pattern.
+func (m Match) Validate() error {
+	if _, err := filepath.Match(m.ByID, ""); err != nil {
+		return fmt.Errorf("invalid by-id pattern %q: %v", m.ByID, err)
+	}
+	return nil
+}
+
+func (m Match) String() string {
+	s := []string{}
+	for _, f := range []struct{ key, value string }{
+		{"vendor", m.VendorID},
+		{"product", m.ProductID},
+		{"serial", m.Serial},
+		{"by-id", m.ByID},
+	} {
+		if len(f.value) > 0 {
+			s = append(s, fmt.Sprintf("%s=%s", f.key, f.value))
+		}
+	}
+	return "usb device " + strings.Join(s, " ")
+}
+
+// Matches checks if the device has all the properties of the match.
+func (m Match) Matches(d Device) bool {
+
+	if len(m.VendorID) > 0 && hexID(m.VendorID) != hexID(d.VendorID) {
+		return false
+	}
+
+	if len(m.ProductID) > 0 && hexID(m.ProductID) != hexID(d.ProductID) {
+		return false
+	}
+
+	if len(m.Serial) > 0 && m.Serial != d.Serial {
+		return false
+	}
+
+	if len(m.ByID) == 0 {
+		return true
+	}
+
+	for _, link := range d.ByID {
+		name := filepath.Base(link)
+		if strings.Contains(m.ByID, "/") {
+			name = link
+		}
+		if ok, _ := filepath.Match(m.ByID, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hexID normalizes USB vendor and product IDs (e.g. "0x04D8" => "04d8").
+func hexID(id string) string {
+	return strings.TrimPrefix(strings.ToLower(id), "0x")
+}
+
+// Resolve returns the name of the serial port (e.g. "/dev/ttyACM0") of
+// the USB serial device which matches. Resolve fails if none or more than
+// one device matches.
+func (m Match) Resolve() (string, error) {
+
+	devices, err := List()
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{}
+	for _, d := range devices {
+		if m.Matches(d) {
+			names = append(names, d.Name)
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("%s not found", m)
+	case 1:
+		return names[0], nil
+	default:
+		return "", fmt.Errorf("%s is ambiguous (%s)", m, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,102 @@
+package serialport
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// the roots of sysfs and the device files; replaced in the tests
+var (
+	sysfsRoot = "/sys"
+	devRoot   = "/dev"
+)
+
+// List returns the USB serial devices attached to this computer. The
+// properties of the devices are read from sysfs.
+func List() ([]Device, error) {
+
+	ttys, err := os.ReadDir(filepath.Join(sysfsRoot, "class", "tty"))
+	if err != nil {
+		return nil, err
+	}
+
+	byID := byIDLinks()
+	devices := []Device{}
+
+	for _, tty := range ttys {
+		// only ttys with a device (not the virtual consoles)
+		dir, err := filepath.EvalSymlinks(filepath.Join(sysfsRoot, "class", "tty", tty.Name(), "device"))
+		if err != nil {
+			continue
+		}
+
+		usbDir, ok := findUSBDevice(dir)
+		if !ok {
+			continue
+		}
+
+		name := filepath.Join(devRoot, tty.Name())
+		devices = append(devices, Device{
+			Name:         name,
+			ByID:         byID[name],
+			VendorID:     readAttr(usbDir, "idVendor"),
+			ProductID:    readAttr(usbDir, "idProduct"),
+			Serial:       readAttr(usbDir, "serial"),
+			Manufacturer: readAttr(usbDir, "manufacturer"),
+			Product:      readAttr(usbDir, "product"),
+		})
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+
+	return devices, nil
+}
+
+// findUSBDevice returns the directory of the USB device to which the
+// tty belongs. Depending on the driver, the tty is a child of the USB
+// interface (cdc_acm) or of the usb-serial port (e.g. ftdi_sio).
+func findUSBDevice(dir string) (string, bool) {
+	for i := 0; i < 4; i++ {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir, true
+		}
+		dir = filepath.Dir(dir)
+	}
+	return "", false
+}
+
+// byIDLinks returns the links in /dev/serial/by-id for each serial port.
+func byIDLinks() map[string][]string {
+
+	links := make(map[string][]string)
+
+	dir := filepath.Join(devRoot, "serial", "by-id")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// no USB serial devices attached
+		return links
+	}
+
+	for _, e := range entries {
+		link := filepath.Join(dir, e.Name())
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		links[target] = append(links[target], link)
+	}
+
+	return links
+}
+
+func readAttr(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
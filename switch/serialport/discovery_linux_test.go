@@ -0,0 +1,146 @@
+package serialport
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeSysfs creates a sysfs and /dev tree with a cdc_acm device
+// (ttyACM0), an ftdi_sio device (ttyUSB0), a platform serial port (ttyS0)
+// and a virtual console (tty0).
+func fakeSysfs(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	sysfsRoot = filepath.Join(root, "sys")
+	devRoot = filepath.Join(root, "dev")
+	t.Cleanup(func() {
+		sysfsRoot = "/sys"
+		devRoot = "/dev"
+	})
+
+	mkdir := func(path string) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(target, name string) {
+		mkdir(filepath.Dir(name))
+		if err := os.Symlink(target, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usbDevice := func(dir, vendor, product, serial, manufacturer string) {
+		mkdir(dir)
+		write(filepath.Join(dir, "idVendor"), vendor+"\n")
+		write(filepath.Join(dir, "idProduct"), product+"\n")
+		write(filepath.Join(dir, "serial"), serial+"\n")
+		write(filepath.Join(dir, "manufacturer"), manufacturer+"\n")
+	}
+
+	devices := filepath.Join(sysfsRoot, "devices")
+	tty := filepath.Join(sysfsRoot, "class", "tty")
+
+	// cdc_acm: the device of the tty is the USB interface
+	usbDevice(filepath.Join(devices, "usb1", "1-1"), "04d8", "000a", "RB0001", "Microchip")
+	mkdir(filepath.Join(devices, "usb1", "1-1", "1-1:1.0"))
+	mkdir(filepath.Join(tty, "ttyACM0"))
+	link(filepath.Join(devices, "usb1", "1-1", "1-1:1.0"), filepath.Join(tty, "ttyACM0", "device"))
+
+	// ftdi_sio: the device of the tty is the usb-serial port
+	usbDevice(filepath.Join(devices, "usb1", "1-2"), "0403", "6001", "A10K", "FTDI")
+	mkdir(filepath.Join(devices, "usb1", "1-2", "1-2:1.0", "ttyUSB0"))
+	mkdir(filepath.Join(tty, "ttyUSB0"))
+	link(filepath.Join(devices, "usb1", "1-2", "1-2:1.0", "ttyUSB0"), filepath.Join(tty, "ttyUSB0", "device"))
+
+	mkdir(filepath.Join(devices, "platform", "serial8250"))
+	mkdir(filepath.Join(tty, "ttyS0"))
+	link(filepath.Join(devices, "platform", "serial8250"), filepath.Join(tty, "ttyS0", "device"))
+
+	mkdir(filepath.Join(tty, "tty0"))
+
+	for _, name := range []string{"ttyACM0", "ttyUSB0", "ttyS0", "tty0"} {
+		mkdir(devRoot)
+		write(filepath.Join(devRoot, name), "")
+	}
+	link("../../ttyACM0", filepath.Join(devRoot, "serial", "by-id", "usb-Microchip_Remotebox_RB0001-if00"))
+	link("../../ttyUSB0", filepath.Join(devRoot, "serial", "by-id", "usb-FTDI_FT232R_A10K-if00-port0"))
+
+	return root
+}
+
+func TestList(t *testing.T) {
+
+	root := fakeSysfs(t)
+
+	devices, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Device{
+		{
+			Name:         filepath.Join(root, "dev", "ttyACM0"),
+			ByID:         []string{filepath.Join(root, "dev", "serial", "by-id", "usb-Microchip_Remotebox_RB0001-if00")},
+			VendorID:     "04d8",
+			ProductID:    "000a",
+			Serial:       "RB0001",
+			Manufacturer: "Microchip",
+		},
+		{
+			Name:         filepath.Join(root, "dev", "ttyUSB0"),
+			ByID:         []string{filepath.Join(root, "dev", "serial", "by-id", "usb-FTDI_FT232R_A10K-if00-port0")},
+			VendorID:     "0403",
+			ProductID:    "6001",
+			Serial:       "A10K",
+			Manufacturer: "FTDI",
+		},
+	}
+
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("List() = %+v, want %+v", devices, want)
+	}
+}
+
+func TestMatch_Resolve(t *testing.T) {
+
+	root := fakeSysfs(t)
+
+	tests := []struct {
+		name    string
+		match   Match
+		want    string
+		wantErr bool
+	}{
+		{"vendor and product", Match{VendorID: "04D8", ProductID: "0x000a"}, "ttyACM0", false},
+		{"serial", Match{Serial: "A10K"}, "ttyUSB0", false},
+		{"by-id pattern", Match{ByID: "usb-Microchip_*"}, "ttyACM0", false},
+		{"by-id path", Match{ByID: filepath.Join(root, "dev", "serial", "by-id", "usb-FTDI*")}, "ttyUSB0", false},
+		{"not found", Match{VendorID: "04d8", Serial: "A10K"}, "", true},
+		{"ambiguous", Match{ByID: "usb-*"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := tt.match.Resolve()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && name != filepath.Join(root, "dev", tt.want) {
+				t.Errorf("Resolve() = %s, want %s", name, tt.want)
+			}
+		})
+	}
+
+	if err := (Match{ByID: "usb-["}).Validate(); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package serialport
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// List returns the USB serial devices attached to this computer. It is
+// only supported on Linux.
+func List() ([]Device, error) {
+	return nil, fmt.Errorf("listing serial devices is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,143 @@
+// Package serialport opens the connection to devices with a serial
+// interface. The device can either be attached to a local serial port or
+// be exposed on the network through a serial server (e.g. ser2net).
+package serialport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// ErrTimeout is returned by ReadFull if the data didn't arrive in time.
+var ErrTimeout = errors.New("timeout waiting for data")
+
+// Config contains the parameters of a serial connection.
+type Config struct {
+	// Name of the serial port (e.g. "/dev/ttyUSB0" or "COM3"). Names in
+	// the form host:port are opened as a TCP connection to a serial server.
+	Name     string
+	Baudrate int
+	// Parity can be 'N' (none), 'E' (even) or 'O' (odd). Defaults to none.
+	Parity byte
+	// ReadTimeout of the serial port. Reads return without data after this
+	// timeout. It has no effect on TCP connections.
+	ReadTimeout time.Duration
+	// Match selects the serial port by the properties of the USB device
+	// instead of its Name. The port is looked up each time it is opened.
+	Match Match
+}
+
+// IsNetwork checks if the port name refers to a serial server on the
+// network.
+func IsNetwork(name string) bool {
+	return strings.Contains(name, ":")
+}
+
+// Open opens the serial port or the TCP connection to the serial server
+// described by the config. The port is configured with 8 data bits and
+// one stop bit.
+func Open(c Config) (io.ReadWriteCloser, error) {
+
+	if !c.Match.IsZero() {
+		name, err := c.Match.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		c.Name = name
+	}
+
+	if IsNetwork(c.Name) {
+		return net.Dial("tcp", c.Name)
+	}
+
+	parity := serial.ParityNone
+	switch c.Parity {
+	case 0, 'N':
+	case 'E':
+		parity = serial.ParityEven
+	case 'O':
+		parity = serial.ParityOdd
+	default:
+		return nil, fmt.Errorf("invalid parity %c", c.Parity)
+	}
+
+	spConfig := &serial.Config{
+		Name:        c.Name,
+		Baud:        c.Baudrate,
+		ReadTimeout: c.ReadTimeout,
+		Parity:      parity,
+		Size:        8,
+		StopBits:    1,
+	}
+
+	return serial.OpenPort(spConfig)
+}
+
+// ReadFull reads exactly len(buf) bytes from a port opened with Open
+// within timeout. Serial ports return io.EOF once their ReadTimeout has
+// expired without data; on serial ports this is not treated as an error
+// but only as a reason to check the deadline.
+func ReadFull(r io.Reader, buf []byte, timeout time.Duration) error {
+
+	deadline := time.Now().Add(timeout)
+
+	conn, isConn := r.(net.Conn)
+	if isConn {
+		conn.SetReadDeadline(deadline)
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	for n := 0; n < len(buf); {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case isConn && errors.As(err, &netErr) && netErr.Timeout():
+				return ErrTimeout
+			case isConn || err != io.EOF:
+				return err
+			}
+		}
+		if n < len(buf) && time.Now().After(deadline) {
+			return ErrTimeout
+		}
+	}
+
+	return nil
+}
+
+// MaxReconnectInterval is the longest delay between two reconnect attempts.
+const MaxReconnectInterval = time.Second * 30
+
+// Reconnect calls connect until it succeeds or done is closed. The delay
+// before each attempt starts with interval and doubles after each failed
+// attempt up to MaxReconnectInterval. Reconnect returns false if done has
+// been closed.
+func Reconnect(done <-chan struct{}, interval time.Duration, connect func() error) bool {
+
+	delay := interval
+
+	for {
+		select {
+		case <-done:
+			return false
+		case <-time.After(delay):
+		}
+
+		if err := connect(); err == nil {
+			return true
+		}
+
+		delay *= 2
+		if delay > MaxReconnectInterval {
+			delay = MaxReconnectInterval
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package smartplug
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// errUnauthorized is returned if the device rejected the credentials.
+var errUnauthorized = errors.New("unauthorized; check username and password")
+
+// api abstracts the HTTP API of a particular firmware. Outlets are
+// numbered like in the API of the device.
+type api interface {
+	// states returns the state of all outlets of the device.
+	states() (map[int]bool, error)
+	// setState switches an outlet and returns its new state.
+	setState(outlet int, state bool) (bool, error)
+}
+
+// client performs the HTTP requests to the device.
+type client struct {
+	http     *http.Client
+	baseURL  string
+	username string
+	password string
+	digest   bool // Shelly Gen2 uses digest authentication
+}
+
+// get requests path from the device and decodes the JSON response into v.
+func (c *client) get(path string, query url.Values, v interface{}) error {
+
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if c.password != "" && !c.digest {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized && c.digest && c.password != "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		auth, err := digestAuthorization(challenge, c.username, c.password,
+			req.Method, req.URL.RequestURI())
+		if err != nil {
+			return err
+		}
+
+		req, err = http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", auth)
+
+		resp, err = c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return errUnauthorized
+	default:
+		return fmt.Errorf("%v: unexpected response from %s", resp.StatusCode, path)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// digestAuthorization returns the Authorization header for the digest
+// challenge of the device (RFC 7616).
+func digestAuthorization(challenge, username, password, method, uri string) (string, error) {
+
+	if !strings.HasPrefix(challenge, "Digest ") {
+		return "", fmt.Errorf("unsupported authentication challenge '%s'", challenge)
+	}
+
+	params := map[string]string{}
+	for _, p := range strings.Split(strings.TrimPrefix(challenge, "Digest "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+
+	var h func() hash.Hash
+	switch strings.ToUpper(params["algorithm"]) {
+	case "", "MD5":
+		h = md5.New
+	case "SHA-256":
+		h = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", params["algorithm"])
+	}
+
+	hexHash := func(s string) string {
+		hh := h()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(b)
+	nc := "00000001"
+
+	ha1 := hexHash(username + ":" + params["realm"] + ":" + password)
+	ha2 := hexHash(method + ":" + uri)
+
+	var response string
+	if params["qop"] == "" {
+		response = hexHash(ha1 + ":" + params["nonce"] + ":" + ha2)
+	} else {
+		response = hexHash(ha1 + ":" + params["nonce"] + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, params["realm"], params["nonce"], uri, response)
+	if params["algorithm"] != "" {
+		auth += fmt.Sprintf(", algorithm=%s", params["algorithm"])
+	}
+	if params["qop"] != "" {
+		auth += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s"`, nc, cnonce)
+	}
+	if params["opaque"] != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, params["opaque"])
+	}
+
+	return auth, nil
+}
+
+// tasmota implements the Tasmota command API (cm?cmnd=...). Tasmota
+// numbers its relays starting with 1.
+type tasmota struct {
+	client
+}
+
+func (t *tasmota) command(cmnd string) (map[string]interface{}, error) {
+	q := url.Values{}
+	if t.password != "" {
+		q.Set("user", t.username)
+		q.Set("password", t.password)
+	}
+	q.Set("cmnd", cmnd)
+
+	res := map[string]interface{}{}
+	if err := t.get("/cm", q, &res); err != nil {
+		return nil, err
+	}
+
+	// Tasmota responds with 200 even if the credentials are wrong
+	if w, ok := res["WARNING"].(string); ok && strings.Contains(w, "Need user=") {
+		return nil, errUnauthorized
+	}
+
+	return res, nil
+}
+
+func (t *tasmota) states() (map[int]bool, error) {
+	res, err := t.command("Status 11")
+	if err != nil {
+		return nil, err
+	}
+
+	sts, ok := res["StatusSTS"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid status response from tasmota device")
+	}
+
+	return parseTasmotaPower(sts)
+}
+
+func (t *tasmota) setState(outlet int, state bool) (bool, error) {
+	value := "Off"
+	if state {
+		value = "On"
+	}
+
+	res, err := t.command(fmt.Sprintf("Power%d %s", outlet, value))
+	if err != nil {
+		return false, err
+	}
+
+	states, err := parseTasmotaPower(res)
+	if err != nil {
+		return false, err
+	}
+
+	newState, ok := states[outlet]
+	if !ok {
+		return false, fmt.Errorf("tasmota device has no relay %d", outlet)
+	}
+
+	return newState, nil
+}
+
+// parseTasmotaPower extracts the relay states from a Tasmota response
+// like {"POWER1":"ON","POWER2":"OFF"}. Devices with a single relay
+// report it as "POWER".
+func parseTasmotaPower(res map[string]interface{}) (map[int]bool, error) {
+
+	states := map[int]bool{}
+
+	for k, v := range res {
+		if !strings.HasPrefix(k, "POWER") {
+			continue
+		}
+
+		outlet := 1
+		if n := strings.TrimPrefix(k, "POWER"); n != "" {
+			var err error
+			outlet, err = strconv.Atoi(n)
+			if err != nil {
+				continue
+			}
+		}
+
+		s, _ := v.(string)
+		switch s {
+		case "ON":
+			states[outlet] = true
+		case "OFF":
+			states[outlet] = false
+		default:
+			return nil, fmt.Errorf("unknown state '%v' of %s", v, k)
+		}
+	}
+
+	if len(states) == 0 {
+		return nil, fmt.Errorf("response does not contain any relay state")
+	}
+
+	return states, nil
+}
+
+// shellyGen1 implements the HTTP API of first generation Shelly devices.
+// The relays are numbered starting with 0.
+type shellyGen1 struct {
+	client
+}
+
+type shellyGen1Relay struct {
+	IsOn bool `json:"ison"`
+}
+
+func (s *shellyGen1) states() (map[int]bool, error) {
+	res := struct {
+		Relays []shellyGen1Relay `json:"relays"`
+	}{}
+
+	if err := s.get("/status", nil, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Relays) == 0 {
+		return nil, fmt.Errorf("shelly device has no relays")
+	}
+
+	states := map[int]bool{}
+	for i, r := range res.Relays {
+		states[i] = r.IsOn
+	}
+
+	return states, nil
+}
+
+func (s *shellyGen1) setState(outlet int, state bool) (bool, error) {
+	q := url.Values{}
+	q.Set("turn", "off")
+	if state {
+		q.Set("turn", "on")
+	}
+
+	res := shellyGen1Relay{}
+	if err := s.get(fmt.Sprintf("/relay/%d", outlet), q, &res); err != nil {
+		return false, err
+	}
+
+	return res.IsOn, nil
+}
+
+// shellyGen2 implements the RPC API of second generation (Plus/Pro)
+// Shelly devices. The switches are numbered starting with 0.
+type shellyGen2 struct {
+	client
+}
+
+func (s *shellyGen2) states() (map[int]bool, error) {
+	res := map[string]json.RawMessage{}
+	if err := s.get("/rpc/Shelly.GetStatus", nil, &res); err != nil {
+		return nil, err
+	}
+
+	states := map[int]bool{}
+	for k, v := range res {
+		if !strings.HasPrefix(k, "switch:") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(k, "switch:"))
+		if err != nil {
+			continue
+		}
+		sw := struct {
+			Output bool `json:"output"`
+		}{}
+		if err := json.Unmarshal(v, &sw); err != nil {
+			return nil, fmt.Errorf("invalid status of %s: %v", k, err)
+		}
+		states[id] = sw.Output
+	}
+
+	if len(states) == 0 {
+		return nil, fmt.Errorf("shelly device has no switches")
+	}
+
+	return states, nil
+}
+
+func (s *shellyGen2) setState(outlet int, state bool) (bool, error) {
+	q := url.Values{}
+	q.Set("id", strconv.Itoa(outlet))
+	q.Set("on", strconv.FormatBool(state))
+
+	// the response only contains the previous state ("was_on")
+	res := map[string]interface{}{}
+	if err := s.get("/rpc/Switch.Set", q, &res); err != nil {
+		return false, err
+	}
+
+	return state, nil
+}
@@ -0,0 +1,95 @@
+package smartplug
+
+import (
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// Name is a functional option to set the name of this device.
+func Name(name string) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.name = name
+	}
+}
+
+// Index is a functional option to set the order in which it will
+// be displayed on the graphical interface.
+func Index(i int) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.index = i
+	}
+}
+
+// Firmware is a functional option to set the firmware (API) of the
+// device. Supported are Tasmota, ShellyGen1 and ShellyGen2.
+func Firmware(firmware string) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.firmware = firmware
+	}
+}
+
+// Username is a functional option to set the username required to access
+// the device. Shelly Gen2 devices always use the username 'admin'.
+func Username(username string) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.username = username
+	}
+}
+
+// Password is a functional option to set the password required to access
+// the device. Authentication is disabled if the password is empty.
+func Password(password string) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.password = password
+	}
+}
+
+// URL is a functional option to set the IP address or url under which the
+// device can be found.
+func URL(url string) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.rawurl = url
+	}
+}
+
+// PollingInterval is a functional option to set the interval in which
+// the state of the outlets is queried.
+func PollingInterval(interval time.Duration) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.pollingInterval = interval
+	}
+}
+
+// Terminals is a functional option to set the outlets of the device
+// which are represented as terminals.
+func Terminals(ts []Terminal) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		// better make a copy
+		for _, t := range ts {
+			d.terminals[t.Outlet] = &Terminal{
+				Name:   t.Name,
+				Outlet: t.Outlet,
+				Index:  t.Index,
+				state:  false,
+			}
+		}
+	}
+}
+
+// EventHandler sets a callback function through which the SmartPlug
+// will report Events
+func EventHandler(h func(sw.Switcher, sw.Device)) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.eventHandler = h
+	}
+}
+
+// ErrorCh is a functional option allows you to pass a channel to the
+// SmartPlug. The channel will be closed when an unrecoverable error
+// occurs (e.g. the device rejects the credentials).
+func ErrorCh(ch chan struct{}) func(*SmartPlug) {
+	return func(d *SmartPlug) {
+		d.errorCh = ch
+	}
+}
@@ -0,0 +1,372 @@
+package smartplug
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// Supported firmwares / APIs
+const (
+	Tasmota    = "tasmota"
+	ShellyGen1 = "shelly-gen1"
+	ShellyGen2 = "shelly-gen2"
+)
+
+// SmartPlug is a switch for WiFi smart plugs and relays running the
+// Tasmota firmware or the Shelly firmware (Gen1 and Gen2). Each outlet
+// (relay) of the device is represented by a terminal.
+type SmartPlug struct {
+	sync.RWMutex
+	name            string
+	index           int
+	portName        string
+	firmware        string
+	pollingInterval time.Duration
+	pollingTicker   *time.Ticker
+	terminals       map[int]*Terminal
+	username        string
+	password        string
+	rawurl          string
+	api             api
+	lastSeen        time.Time
+	lastError       string
+	eventHandler    func(sw.Switcher, sw.Device)
+	closer          sync.Once
+	stopPolling     chan struct{}
+	errorCh         chan struct{}
+	errorOnce       sync.Once
+}
+
+// Terminal is the smallest unit and typically is something that is
+// switched by one relay.
+type Terminal struct {
+	Name   string // A name associated to the terminal
+	Outlet int    // Outlet is the relay number as used by the device's API
+	Index  int    // Index sets the order in which it will be displayed on the GUI
+	state  bool
+}
+
+// NewSmartPlug is the constructor for a SmartPlug. The constructor takes
+// functional arguments for configuring the device.
+func NewSmartPlug(options ...func(*SmartPlug)) *SmartPlug {
+
+	d := &SmartPlug{
+		name:            "mySmartPlug",
+		index:           0,
+		portName:        "PS",
+		firmware:        Tasmota,
+		rawurl:          "192.168.4.1",
+		pollingInterval: time.Second * 3,
+		terminals:       make(map[int]*Terminal),
+	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	return d
+}
+
+// Init checks the configuration and makes a first query to ensure that
+// the device is reachable and that the credentials are correct.
+func (d *SmartPlug) Init() error {
+	d.Lock()
+	defer d.Unlock()
+
+	if len(d.terminals) == 0 {
+		return fmt.Errorf("no terminals configured for %s", d.name)
+	}
+
+	c := client{
+		http:     &http.Client{Timeout: 3 * time.Second},
+		baseURL:  deviceURL(d.rawurl),
+		username: d.username,
+		password: d.password,
+	}
+
+	switch d.firmware {
+	case Tasmota:
+		if c.username == "" {
+			c.username = "admin"
+		}
+		d.api = &tasmota{c}
+	case ShellyGen1:
+		d.api = &shellyGen1{c}
+	case ShellyGen2:
+		// Gen2 devices only know the user 'admin'
+		c.username = "admin"
+		c.digest = true
+		d.api = &shellyGen2{c}
+	default:
+		return fmt.Errorf("unknown firmware %s (supported: %s, %s, %s)",
+			d.firmware, Tasmota, ShellyGen1, ShellyGen2)
+	}
+
+	states, err := d.api.states()
+	if err != nil {
+		return fmt.Errorf("unable to query %s: %v", d.name, err)
+	}
+
+	for _, t := range d.terminals {
+		if _, ok := states[t.Outlet]; !ok {
+			return fmt.Errorf("%s has no outlet %d (terminal %s)", d.name, t.Outlet, t.Name)
+		}
+	}
+
+	d.updateTerminals(states)
+	d.lastSeen = time.Now()
+
+	d.pollingTicker = time.NewTicker(d.pollingInterval)
+	d.stopPolling = make(chan struct{})
+
+	go d.poll()
+
+	return nil
+}
+
+// Close shuts down the switch.
+func (d *SmartPlug) Close() {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.pollingTicker != nil {
+		d.pollingTicker.Stop()
+	}
+	d.closer.Do(func() {
+		if d.stopPolling != nil {
+			close(d.stopPolling)
+		}
+	})
+}
+
+// poll the device for the current state of the outlets. In case the
+// outlets have been switched manually (button) or through the web
+// interface of the device, we have to bring remoteSwitch back in sync.
+// This function is blocking and executes an infinite loop. It should be
+// executed in its own go routine.
+func (d *SmartPlug) poll() {
+	for {
+		select {
+		case <-d.pollingTicker.C:
+			d.Lock()
+			wasOnline := d.health().Online
+			changed := false
+			states, err := d.api.states()
+			if err != nil {
+				log.Println(err)
+				d.lastError = err.Error()
+				// wrong credentials can't be fixed at runtime
+				if errors.Is(err, errUnauthorized) && d.errorCh != nil {
+					d.errorOnce.Do(func() { close(d.errorCh) })
+				}
+			} else {
+				d.lastSeen = time.Now()
+				d.lastError = ""
+				changed = d.updateTerminals(states)
+			}
+			// notify the listener when the outlets have changed, the
+			// device went offline or came back online
+			if (changed || wasOnline != d.health().Online) && d.eventHandler != nil {
+				go d.eventHandler(d, d.serialize())
+			}
+			d.Unlock()
+		case <-d.stopPolling:
+			return
+		}
+	}
+}
+
+// Health returns the health of the connection to the device. The
+// device is considered offline if the last request failed or if it hasn't
+// been polled successfully within the last three polling intervals.
+func (d *SmartPlug) Health() sw.Health {
+	d.RLock()
+	defer d.RUnlock()
+	return d.health()
+}
+
+// health returns the health of the connection to the device. This
+// method is not threadsafe.
+func (d *SmartPlug) health() sw.Health {
+	return sw.Health{
+		Online: len(d.lastError) == 0 &&
+			time.Since(d.lastSeen) <= 3*d.pollingInterval,
+		LastSeen: d.lastSeen,
+		Error:    d.lastError,
+		Model:    d.model(),
+	}
+}
+
+func (d *SmartPlug) model() string {
+	switch d.firmware {
+	case ShellyGen1:
+		return "Shelly Gen1"
+	case ShellyGen2:
+		return "Shelly Gen2"
+	}
+	return "Tasmota"
+}
+
+// Name returns the Name of this SmartPlug
+func (d *SmartPlug) Name() string {
+	d.RLock()
+	defer d.RUnlock()
+	return d.name
+}
+
+// SetPort sets the Terminals of a particular Port. The portRequest
+// can contain n terminals.
+func (d *SmartPlug) SetPort(portRequest sw.Port) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// ensure that all requested terminals exist before switching any
+	for _, treq := range portRequest.Terminals {
+		if _, err := d.getTerminal(treq.Name); err != nil {
+			return err
+		}
+	}
+
+	changed := false
+
+	for _, treq := range portRequest.Terminals {
+		t, _ := d.getTerminal(treq.Name)
+		state, err := d.api.setState(t.Outlet, treq.State)
+		if err != nil {
+			d.lastError = err.Error()
+			if d.eventHandler != nil {
+				go d.eventHandler(d, d.serialize())
+			}
+			return err
+		}
+		if t.state != state {
+			t.state = state
+			changed = true
+		}
+	}
+
+	wasOnline := d.health().Online
+	d.lastSeen = time.Now()
+	d.lastError = ""
+
+	if (changed || !wasOnline) && d.eventHandler != nil {
+		go d.eventHandler(d, d.serialize())
+	}
+
+	return nil
+}
+
+// GetPort returns switch.Port struct containing the current state of
+// the port. Portname is ignored since this device will only ever
+// contain one port.
+func (d *SmartPlug) GetPort(portName string) (sw.Port, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.getPort(), nil
+}
+
+func (d *SmartPlug) getPort() sw.Port {
+
+	p := sw.Port{
+		Name:      d.portName,
+		Index:     0, //this type of Switch only has one Port ever
+		Terminals: []sw.Terminal{},
+	}
+
+	for _, t := range d.terminals {
+		swt := sw.Terminal{
+			Name:  t.Name,
+			Index: t.Index,
+			State: t.state,
+		}
+		p.Terminals = append(p.Terminals, swt)
+	}
+
+	// Sort the slice of Terminals by index
+	sort.Slice(p.Terminals, func(i, j int) bool {
+		return p.Terminals[i].Index < p.Terminals[j].Index
+	})
+
+	return p
+}
+
+// Serialize returns a switch.Device struct containing the current
+// state and configuration of this SmartPlug.
+func (d *SmartPlug) Serialize() sw.Device {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.serialize()
+}
+
+// serialize returns a switch.Device struct containing the current
+// state and configuration of this SmartPlug. This method
+// is not threadsafe.
+func (d *SmartPlug) serialize() sw.Device {
+
+	health := d.health()
+
+	device := sw.Device{
+		Name:   d.name,
+		Index:  d.index,
+		Health: &health,
+		Ports: []sw.Port{
+			d.getPort(),
+		},
+	}
+
+	return device
+}
+
+// getTerminal returns the pointer to a Terminal requested by its name.
+// If no Terminal is found under the specified name, nil and an error
+// will be returned.
+func (d *SmartPlug) getTerminal(name string) (*Terminal, error) {
+
+	for _, t := range d.terminals {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("terminal %v does not exist", name)
+}
+
+// updateTerminals updates the state of the terminals with the states
+// reported by the device. Outlets which are not configured as terminals
+// are ignored. It returns true if at least one terminal has changed.
+// This method is not threadsafe.
+func (d *SmartPlug) updateTerminals(states map[int]bool) bool {
+
+	changed := false
+
+	for outlet, state := range states {
+		t, ok := d.terminals[outlet]
+		if !ok || t.state == state {
+			continue
+		}
+		t.state = state
+		changed = true
+	}
+
+	return changed
+}
+
+// deviceURL returns the base URL of the device. The scheme can be
+// omitted, in which case http is used.
+func deviceURL(rawurl string) string {
+	u := strings.TrimSuffix(rawurl, "/")
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+	return u
+}
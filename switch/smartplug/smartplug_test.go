@@ -0,0 +1,446 @@
+package smartplug
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// fakeDevice is an httptest.Server emulating the HTTP API of a Tasmota,
+// Shelly Gen1 or Shelly Gen2 device with a number of relays.
+type fakeDevice struct {
+	sync.Mutex
+	*httptest.Server
+	firmware string
+	username string
+	password string
+	relays   []bool
+}
+
+func newFakeDevice(firmware string, relays int, username, password string) *fakeDevice {
+	f := &fakeDevice{
+		firmware: firmware,
+		username: username,
+		password: password,
+		relays:   make([]bool, relays),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeDevice) relay(i int) bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.relays[i]
+}
+
+func (f *fakeDevice) setRelay(i int, state bool) {
+	f.Lock()
+	defer f.Unlock()
+	f.relays[i] = state
+}
+
+func (f *fakeDevice) setPassword(password string) {
+	f.Lock()
+	defer f.Unlock()
+	f.password = password
+}
+
+func (f *fakeDevice) handle(rw http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch f.firmware {
+	case Tasmota:
+		f.handleTasmota(rw, req)
+	case ShellyGen1:
+		f.handleShellyGen1(rw, req)
+	case ShellyGen2:
+		f.handleShellyGen2(rw, req)
+	}
+}
+
+func (f *fakeDevice) handleTasmota(rw http.ResponseWriter, req *http.Request) {
+
+	q := req.URL.Query()
+	if f.password != "" && (q.Get("user") != f.username || q.Get("password") != f.password) {
+		json.NewEncoder(rw).Encode(map[string]string{"WARNING": "Need user=<username>&password=<password>"})
+		return
+	}
+
+	power := func(i int) (string, string) {
+		key := "POWER"
+		if len(f.relays) > 1 {
+			key += strconv.Itoa(i + 1)
+		}
+		if f.relays[i] {
+			return key, "ON"
+		}
+		return key, "OFF"
+	}
+
+	cmnd := q.Get("cmnd")
+	switch {
+	case cmnd == "Status 11":
+		sts := map[string]string{"Time": "2026-10-19T12:00:00"}
+		for i := range f.relays {
+			k, v := power(i)
+			sts[k] = v
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"StatusSTS": sts})
+	case strings.HasPrefix(cmnd, "Power"):
+		var n int
+		var state string
+		if _, err := fmt.Sscanf(cmnd, "Power%d %s", &n, &state); err != nil || n < 1 || n > len(f.relays) {
+			json.NewEncoder(rw).Encode(map[string]string{"Command": "Unknown"})
+			return
+		}
+		f.relays[n-1] = state == "On"
+		k, v := power(n - 1)
+		json.NewEncoder(rw).Encode(map[string]string{k: v})
+	default:
+		json.NewEncoder(rw).Encode(map[string]string{"Command": "Unknown"})
+	}
+}
+
+func (f *fakeDevice) handleShellyGen1(rw http.ResponseWriter, req *http.Request) {
+
+	if f.password != "" {
+		user, password, ok := req.BasicAuth()
+		if !ok || user != f.username || password != f.password {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if req.URL.Path == "/status" {
+		relays := []shellyGen1Relay{}
+		for _, r := range f.relays {
+			relays = append(relays, shellyGen1Relay{IsOn: r})
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"relays": relays})
+		return
+	}
+
+	var n int
+	if _, err := fmt.Sscanf(req.URL.Path, "/relay/%d", &n); err != nil || n >= len(f.relays) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch req.URL.Query().Get("turn") {
+	case "on":
+		f.relays[n] = true
+	case "off":
+		f.relays[n] = false
+	}
+	json.NewEncoder(rw).Encode(shellyGen1Relay{IsOn: f.relays[n]})
+}
+
+func (f *fakeDevice) handleShellyGen2(rw http.ResponseWriter, req *http.Request) {
+
+	if f.password != "" && !f.validDigest(req) {
+		rw.Header().Set("WWW-Authenticate",
+			`Digest qop="auth", realm="shellyplus2pm-fake", nonce="1697712000", algorithm=SHA-256`)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch req.URL.Path {
+	case "/rpc/Shelly.GetStatus":
+		status := map[string]interface{}{"sys": map[string]interface{}{"uptime": 42}}
+		for i, r := range f.relays {
+			status[fmt.Sprintf("switch:%d", i)] = map[string]interface{}{"id": i, "output": r}
+		}
+		json.NewEncoder(rw).Encode(status)
+	case "/rpc/Switch.Set":
+		n, err := strconv.Atoi(req.URL.Query().Get("id"))
+		if err != nil || n >= len(f.relays) {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		wasOn := f.relays[n]
+		f.relays[n] = req.URL.Query().Get("on") == "true"
+		json.NewEncoder(rw).Encode(map[string]bool{"was_on": wasOn})
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// validDigest checks the digest authorization header of the request.
+func (f *fakeDevice) validDigest(req *http.Request) bool {
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Digest ") {
+		return false
+	}
+
+	params := map[string]string{}
+	for _, p := range strings.Split(strings.TrimPrefix(auth, "Digest "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	h := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	ha1 := h("admin:" + params["realm"] + ":" + f.password)
+	ha2 := h(req.Method + ":" + params["uri"])
+	want := h(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+
+	return params["username"] == "admin" && params["uri"] == req.URL.RequestURI() &&
+		params["response"] == want
+}
+
+func newTestPlug(f *fakeDevice, username, password string, opts ...func(*SmartPlug)) (*SmartPlug, chan sw.Device) {
+
+	events := make(chan sw.Device, 100)
+
+	opts = append([]func(*SmartPlug){
+		Name("Amplifier"),
+		Firmware(f.firmware),
+		URL(f.URL),
+		Username(username),
+		Password(password),
+		PollingInterval(time.Millisecond * 20),
+		EventHandler(func(s sw.Switcher, d sw.Device) { events <- d }),
+	}, opts...)
+
+	return NewSmartPlug(opts...), events
+}
+
+// firstOutlet returns the number of the first outlet in the API of the firmware.
+func firstOutlet(firmware string) int {
+	if firmware == Tasmota {
+		return 1
+	}
+	return 0
+}
+
+func TestSmartPlug(t *testing.T) {
+
+	for _, firmware := range []string{Tasmota, ShellyGen1, ShellyGen2} {
+		t.Run(firmware, func(t *testing.T) {
+
+			f := newFakeDevice(firmware, 2, "admin", "secret")
+			defer f.Close()
+
+			first := firstOutlet(firmware)
+			plug, events := newTestPlug(f, "admin", "secret", Terminals([]Terminal{
+				{Name: "PSU", Outlet: first, Index: 0},
+				{Name: "PA", Outlet: first + 1, Index: 1},
+			}))
+			if err := plug.Init(); err != nil {
+				t.Fatal(err)
+			}
+			defer plug.Close()
+
+			if h := plug.Health(); !h.Online {
+				t.Fatalf("plug offline after Init: %v", h.Error)
+			}
+
+			// switch the second relay through remoteSwitch
+			err := plug.SetPort(sw.Port{Terminals: []sw.Terminal{{Name: "PA", State: true}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !f.relay(1) {
+				t.Error("relay 1 not switched on")
+			}
+			if f.relay(0) {
+				t.Error("relay 0 unexpectedly switched on")
+			}
+
+			// switch the first relay on the device (button / web interface)
+			f.setRelay(0, true)
+
+			deadline := time.After(time.Second * 2)
+			for {
+				select {
+				case dev := <-events:
+					if dev.Ports[0].Terminals[0].State {
+						return
+					}
+				case <-deadline:
+					t.Fatal("external change not detected")
+				}
+			}
+		})
+	}
+}
+
+func TestSmartPlug_Init(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		firmware string
+		password string
+		outlet   int
+		wantErr  bool
+	}{
+		{"tasmota", Tasmota, "secret", 1, false},
+		{"tasmota wrong password", Tasmota, "wrong", 1, true},
+		{"tasmota invalid outlet", Tasmota, "secret", 3, true},
+		{"shelly gen1", ShellyGen1, "secret", 0, false},
+		{"shelly gen1 wrong password", ShellyGen1, "wrong", 0, true},
+		{"shelly gen1 invalid outlet", ShellyGen1, "secret", 2, true},
+		{"shelly gen2", ShellyGen2, "secret", 1, false},
+		{"shelly gen2 wrong password", ShellyGen2, "wrong", 1, true},
+		{"shelly gen2 invalid outlet", ShellyGen2, "secret", 2, true},
+		{"unknown firmware", "espurna", "secret", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeDevice(tt.firmware, 2, "admin", "secret")
+			defer f.Close()
+
+			plug, _ := newTestPlug(f, "admin", tt.password,
+				Terminals([]Terminal{{Name: "PSU", Outlet: tt.outlet}}))
+			defer plug.Close()
+
+			if err := plug.Init(); (err != nil) != tt.wantErr {
+				t.Errorf("SmartPlug.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSmartPlug_SetPort_invalidTerminal(t *testing.T) {
+
+	f := newFakeDevice(Tasmota, 1, "", "")
+	defer f.Close()
+
+	plug, _ := newTestPlug(f, "", "", Terminals([]Terminal{{Name: "PSU", Outlet: 1}}))
+	if err := plug.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close()
+
+	err := plug.SetPort(sw.Port{Terminals: []sw.Terminal{
+		{Name: "PSU", State: true},
+		{Name: "Rotator", State: true},
+	}})
+	if err == nil {
+		t.Fatal("expected error for unknown terminal")
+	}
+	if f.relay(0) {
+		t.Error("relay switched although the request contained an invalid terminal")
+	}
+}
+
+func TestSmartPlug_errorCh(t *testing.T) {
+
+	f := newFakeDevice(ShellyGen1, 1, "admin", "secret")
+	defer f.Close()
+
+	errorCh := make(chan struct{})
+	plug, _ := newTestPlug(f, "admin", "secret", ErrorCh(errorCh),
+		Terminals([]Terminal{{Name: "PSU", Outlet: 0}}))
+	if err := plug.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close()
+
+	// the password has been changed on the device
+	f.setPassword("changed")
+
+	select {
+	case <-errorCh:
+	case <-time.After(time.Second * 2):
+		t.Fatal("errorCh not closed after the device rejected the credentials")
+	}
+
+	if plug.Health().Online {
+		t.Error("plug should be offline")
+	}
+}
+
+func TestSmartPlug_offline(t *testing.T) {
+
+	f := newFakeDevice(Tasmota, 1, "", "")
+
+	plug, events := newTestPlug(f, "", "", Terminals([]Terminal{{Name: "PSU", Outlet: 1}}))
+	if err := plug.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close()
+
+	f.Close()
+
+	deadline := time.After(time.Second * 5)
+	for {
+		select {
+		case dev := <-events:
+			if !dev.Health.Online {
+				return
+			}
+		case <-deadline:
+			t.Fatal("no offline event")
+		}
+	}
+}
+
+func Test_parseTasmotaPower(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[int]bool
+		wantErr bool
+	}{
+		{"single relay", `{"POWER":"ON"}`, map[int]bool{1: true}, false},
+		{"several relays", `{"POWER1":"OFF","POWER2":"ON","Time":"x"}`, map[int]bool{1: false, 2: true}, false},
+		{"invalid state", `{"POWER1":"TOGGLE"}`, nil, true},
+		{"no relays", `{"Command":"Unknown"}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(tt.input), &res); err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseTasmotaPower(res)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTasmotaPower() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseTasmotaPower() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("parseTasmotaPower() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_deviceURL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"192.168.1.50", "http://192.168.1.50"},
+		{"192.168.1.50:8080/", "http://192.168.1.50:8080"},
+		{"https://plug.example.com", "https://plug.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := deviceURL(tt.input); got != tt.want {
+				t.Errorf("deviceURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
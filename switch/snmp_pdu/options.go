@@ -0,0 +1,160 @@
+package snmppdu
+
+import (
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+)
+
+// Supported SNMP versions
+const (
+	Version2c = "2c"
+	Version3  = "3"
+)
+
+// Supported authentication and privacy protocols of SNMP v3
+const (
+	MD5 = "MD5"
+	SHA = "SHA"
+	DES = "DES"
+	AES = "AES"
+)
+
+// USMConfig contains the credentials of a SNMP v3 user. Without an
+// AuthProtocol the requests are neither authenticated nor encrypted
+// (noAuthNoPriv); without a PrivProtocol they are not encrypted
+// (authNoPriv).
+type USMConfig struct {
+	User         string
+	AuthProtocol string // MD5 or SHA
+	AuthPassword string
+	PrivProtocol string // DES or AES (128 bit)
+	PrivPassword string
+}
+
+// Name is a functional option to set the name of this device.
+func Name(name string) func(*PDU) {
+	return func(d *PDU) {
+		d.name = name
+	}
+}
+
+// Index is a functional option to set the order in which it will
+// be displayed on the graphical interface.
+func Index(i int) func(*PDU) {
+	return func(d *PDU) {
+		d.index = i
+	}
+}
+
+// Address is a functional option to set the address (host[:port]) of the
+// PDU's SNMP agent. The port defaults to 161.
+func Address(address string) func(*PDU) {
+	return func(d *PDU) {
+		d.address = address
+	}
+}
+
+// Version is a functional option to set the SNMP version (Version2c or
+// Version3).
+func Version(version string) func(*PDU) {
+	return func(d *PDU) {
+		d.version = version
+	}
+}
+
+// Community is a functional option to set the community of SNMP v2c. The
+// community must have write access.
+func Community(community string) func(*PDU) {
+	return func(d *PDU) {
+		d.community = community
+	}
+}
+
+// USM is a functional option to set the credentials of the SNMP v3 user.
+func USM(c USMConfig) func(*PDU) {
+	return func(d *PDU) {
+		d.usm = c
+	}
+}
+
+// Context is a functional option to set the SNMP v3 context name.
+func Context(context string) func(*PDU) {
+	return func(d *PDU) {
+		d.context = context
+	}
+}
+
+// OutletOID is a functional option to set the OID which controls the
+// outlets, without the outlet number (e.g. the APC rPDUOutletControl-
+// OutletCommand ".1.3.6.1.4.1.318.1.1.12.3.3.1.1.4"). The number of the
+// outlet is appended to get the OID of a particular outlet.
+func OutletOID(oid string) func(*PDU) {
+	return func(d *PDU) {
+		d.outletOID = oid
+	}
+}
+
+// Values is a functional option to set the integer values which are
+// written to the outlet OIDs to switch an outlet on, off or to reboot
+// (power cycle) it. An outlet is considered on if its OID reads the on
+// value. With a reboot value of 0, the outlets can't be power cycled
+// by the PDU and pulses have to be emulated. The defaults (1, 2, 3)
+// match the APC switched rack PDUs.
+func Values(on, off, reboot int) func(*PDU) {
+	return func(d *PDU) {
+		d.onValue = on
+		d.offValue = off
+		d.rebootValue = reboot
+	}
+}
+
+// PollingInterval is a functional option to set the interval in which
+// the state of the outlets is queried.
+func PollingInterval(interval time.Duration) func(*PDU) {
+	return func(d *PDU) {
+		d.pollingInterval = interval
+	}
+}
+
+// Timeout is a functional option to set the time to wait for the
+// response of the agent. Requests are sent twice before they fail.
+func Timeout(timeout time.Duration) func(*PDU) {
+	return func(d *PDU) {
+		d.timeout = timeout
+	}
+}
+
+// Terminals is a functional option to set the outlets of the device
+// which are represented as terminals.
+func Terminals(ts []Terminal) func(*PDU) {
+	return func(d *PDU) {
+		// better make a copy
+		for _, t := range ts {
+			d.terminals[t.Outlet] = &Terminal{
+				Name:   t.Name,
+				Outlet: t.Outlet,
+				OID:    t.OID,
+				Index:  t.Index,
+				state:  false,
+			}
+		}
+	}
+}
+
+// EventHandler sets a callback function through which the PDU
+// will report Events
+func EventHandler(h func(sw.Switcher, sw.Device)) func(*PDU) {
+	return func(d *PDU) {
+		d.eventHandler = h
+	}
+}
+
+// ErrorCh is a functional option allows you to pass a channel to the
+// PDU. The channel will be closed when an unrecoverable error occurs
+// (e.g. the agent reports that it doesn't know the SNMP v3 user).
+func ErrorCh(ch chan struct{}) func(*PDU) {
+	return func(d *PDU) {
+		d.errorCh = ch
+	}
+}
@@ -0,0 +1,196 @@
+package snmppdu
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// This file contains the SNMP client of the PDU. The protocol (including
+// the user based security model of SNMP v3) is implemented by gosnmp.
+
+// errUnauthorized is returned if the agent rejects the credentials.
+// Agents don't respond to SNMP v2c requests with a wrong community, so
+// with v2c this results in a timeout instead. With authenticated SNMP v3
+// users, the unauthenticated reports of the agent are discarded, which
+// results in a timeout, too.
+var errUnauthorized = errors.New("unauthorized")
+
+// normalizeOID returns an OID in dotted notation with a leading dot
+// (e.g. ".1.3.6.1.2.1.1.1.0"), like the OIDs returned by gosnmp.
+func normalizeOID(oid string) string {
+	return "." + strings.TrimPrefix(strings.TrimSpace(oid), ".")
+}
+
+// validateOID checks that an OID in dotted notation can be encoded.
+func validateOID(oid string) error {
+
+	parts := strings.Split(strings.TrimPrefix(normalizeOID(oid), "."), ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid oid %s", oid)
+	}
+
+	nums := make([]uint64, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid oid %s", oid)
+		}
+		nums = append(nums, n)
+	}
+
+	if nums[0] > 2 || (nums[0] < 2 && nums[1] >= 40) {
+		return fmt.Errorf("invalid oid %s", oid)
+	}
+
+	return nil
+}
+
+// usmParams validates the credentials of the SNMP v3 user and returns the
+// corresponding security level and parameters.
+func usmParams(c USMConfig) (gosnmp.SnmpV3MsgFlags, *gosnmp.UsmSecurityParameters, error) {
+
+	sp := &gosnmp.UsmSecurityParameters{
+		UserName:                 c.User,
+		AuthenticationProtocol:   gosnmp.NoAuth,
+		AuthenticationPassphrase: c.AuthPassword,
+		PrivacyProtocol:          gosnmp.NoPriv,
+		PrivacyPassphrase:        c.PrivPassword,
+	}
+
+	switch strings.ToUpper(c.AuthProtocol) {
+	case "":
+	case MD5:
+		sp.AuthenticationProtocol = gosnmp.MD5
+	case SHA:
+		sp.AuthenticationProtocol = gosnmp.SHA
+	default:
+		return 0, nil, fmt.Errorf("unknown auth protocol %s (supported: %s, %s)", c.AuthProtocol, MD5, SHA)
+	}
+
+	switch strings.ToUpper(c.PrivProtocol) {
+	case "":
+	case DES:
+		sp.PrivacyProtocol = gosnmp.DES
+	case AES:
+		sp.PrivacyProtocol = gosnmp.AES
+	default:
+		return 0, nil, fmt.Errorf("unknown privacy protocol %s (supported: %s, %s)", c.PrivProtocol, DES, AES)
+	}
+
+	flags := gosnmp.NoAuthNoPriv
+
+	if sp.AuthenticationProtocol != gosnmp.NoAuth {
+		if len(c.AuthPassword) < 8 {
+			return 0, nil, fmt.Errorf("auth password must have at least 8 characters")
+		}
+		flags = gosnmp.AuthNoPriv
+	}
+
+	if sp.PrivacyProtocol != gosnmp.NoPriv {
+		if flags == gosnmp.NoAuthNoPriv {
+			return 0, nil, fmt.Errorf("privacy requires authentication")
+		}
+		if len(c.PrivPassword) < 8 {
+			return 0, nil, fmt.Errorf("privacy password must have at least 8 characters")
+		}
+		flags = gosnmp.AuthPriv
+	}
+
+	return flags, sp, nil
+}
+
+// client is a SNMP client for the Get and Set requests. It is not
+// threadsafe.
+type client struct {
+	snmp     *gosnmp.GoSNMP
+	secLevel gosnmp.SnmpV3MsgFlags
+}
+
+// newClient returns a client for the agent at address (host[:port]).
+// The port defaults to 161. The requests are sent twice before they fail.
+func newClient(address string, snmp *gosnmp.GoSNMP) (*client, error) {
+
+	host, port := address, "161"
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host, port = h, p
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in address %s", address)
+	}
+
+	snmp.Target = host
+	snmp.Port = uint16(p)
+	snmp.Retries = 1
+
+	if err := snmp.Connect(); err != nil {
+		return nil, err
+	}
+
+	return &client{
+		snmp:     snmp,
+		secLevel: snmp.MsgFlags & gosnmp.AuthPriv,
+	}, nil
+}
+
+func (c *client) close() error {
+	return c.snmp.Conn.Close()
+}
+
+// get returns the values of the OIDs.
+func (c *client) get(oids ...string) ([]gosnmp.SnmpPDU, error) {
+
+	resp, err := c.snmp.Get(oids)
+	if err := c.check(resp, err); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Variables) != len(oids) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(oids), len(resp.Variables))
+	}
+
+	return resp.Variables, nil
+}
+
+// set sets the integer value of the OID.
+func (c *client) set(oid string, value int) error {
+	resp, err := c.snmp.Set([]gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Integer, Value: value}})
+	return c.check(resp, err)
+}
+
+// check returns the error of a request or of its response.
+func (c *client) check(resp *gosnmp.SnmpPacket, err error) error {
+
+	switch {
+	case errors.Is(err, gosnmp.ErrUnknownUsername):
+		return fmt.Errorf("%w: unknown user name", errUnauthorized)
+	case errors.Is(err, gosnmp.ErrWrongDigest):
+		return fmt.Errorf("%w: wrong digest (check the auth password)", errUnauthorized)
+	case errors.Is(err, gosnmp.ErrDecryption):
+		return fmt.Errorf("%w: decryption error (check the privacy password)", errUnauthorized)
+	case errors.Is(err, gosnmp.ErrUnknownSecurityLevel):
+		return fmt.Errorf("%w: unsupported security level", errUnauthorized)
+	case err != nil:
+		return err
+	}
+
+	// the response must have the same security level as the request,
+	// otherwise an unencrypted response to an encrypted request would
+	// be accepted (RFC 3412, section 7.2)
+	if c.snmp.Version == gosnmp.Version3 && resp.MsgFlags&gosnmp.AuthPriv != c.secLevel {
+		return fmt.Errorf("response with security level %v received, expected %v",
+			resp.MsgFlags&gosnmp.AuthPriv, c.secLevel)
+	}
+
+	if resp.Error != gosnmp.NoError {
+		return fmt.Errorf("snmp error %v (index %d)", resp.Error, resp.ErrorIndex)
+	}
+
+	return nil
+}
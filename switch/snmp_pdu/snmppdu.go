@@ -0,0 +1,485 @@
+// Package snmppdu implements a switch for switched power distribution
+// units (e.g. APC rack PDUs) which are controlled through SNMP v2c or v3.
+// Each outlet of the PDU is represented by a terminal. The outlets are
+// switched by writing configurable integer values to one OID per outlet.
+package snmppdu
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/gosnmp/gosnmp"
+)
+
+// maxVarBinds is the maximum number of outlets queried in one request
+const maxVarBinds = 16
+
+// PDU is a switch for a switched power distribution unit with a SNMP
+// agent.
+type PDU struct {
+	sync.RWMutex
+	name            string
+	index           int
+	portName        string
+	address         string
+	version         string
+	community       string
+	usm             USMConfig
+	context         string
+	outletOID       string
+	onValue         int
+	offValue        int
+	rebootValue     int
+	pollingInterval time.Duration
+	pollingTicker   *time.Ticker
+	timeout         time.Duration
+	terminals       map[int]*Terminal
+	client          *client
+	lastSeen        time.Time
+	lastError       string
+	eventHandler    func(sw.Switcher, sw.Device)
+	closer          sync.Once
+	stopPolling     chan struct{}
+	errorCh         chan struct{}
+	errorOnce       sync.Once
+}
+
+// Terminal is the smallest unit and typically is something that is
+// switched by one relay.
+type Terminal struct {
+	Name   string // A name associated to the terminal
+	Outlet int    // Outlet is the number of the outlet on the PDU
+	OID    string // OID of the outlet; defaults to the OutletOID + Outlet
+	Index  int    // Index sets the order in which it will be displayed on the GUI
+	state  bool
+}
+
+// NewPDU is the constructor for a PDU. The constructor takes functional
+// arguments for configuring the device.
+func NewPDU(options ...func(*PDU)) *PDU {
+
+	d := &PDU{
+		name:            "myPDU",
+		index:           0,
+		portName:        "PS",
+		address:         "192.168.1.50",
+		version:         Version2c,
+		community:       "private",
+		onValue:         1,
+		offValue:        2,
+		rebootValue:     3,
+		pollingInterval: time.Second * 3,
+		timeout:         time.Second * 2,
+		terminals:       make(map[int]*Terminal),
+	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	return d
+}
+
+// Init checks the configuration and makes a first query to ensure that
+// the agent is reachable, that the credentials are correct and that the
+// outlets exist.
+func (d *PDU) Init() error {
+	d.Lock()
+	defer d.Unlock()
+
+	if len(d.terminals) == 0 {
+		return fmt.Errorf("no terminals configured for %s", d.name)
+	}
+
+	for _, t := range d.terminals {
+		if len(t.OID) == 0 {
+			if len(d.outletOID) == 0 {
+				return fmt.Errorf("no oid for terminal %s (set the outlet-oid of %s)", t.Name, d.name)
+			}
+			t.OID = normalizeOID(d.outletOID) + "." + strconv.Itoa(t.Outlet)
+		}
+		t.OID = normalizeOID(t.OID)
+		if err := validateOID(t.OID); err != nil {
+			return fmt.Errorf("terminal %s: %v", t.Name, err)
+		}
+	}
+
+	if d.onValue == d.offValue {
+		return fmt.Errorf("on and off values must be different")
+	}
+
+	snmp := &gosnmp.GoSNMP{
+		Timeout: d.timeout,
+	}
+
+	switch d.version {
+	case Version2c:
+		snmp.Version = gosnmp.Version2c
+		snmp.Community = d.community
+	case Version3:
+		if len(d.usm.User) == 0 {
+			return fmt.Errorf("snmp v3 requires a user")
+		}
+		// validate the credentials before contacting the agent
+		flags, sp, err := usmParams(d.usm)
+		if err != nil {
+			return err
+		}
+		snmp.Version = gosnmp.Version3
+		snmp.SecurityModel = gosnmp.UserSecurityModel
+		snmp.MsgFlags = flags
+		snmp.SecurityParameters = sp
+		snmp.ContextName = d.context
+	default:
+		return fmt.Errorf("unsupported snmp version %s (supported: %s, %s)",
+			d.version, Version2c, Version3)
+	}
+
+	c, err := newClient(d.address, snmp)
+	if err != nil {
+		return err
+	}
+	d.client = c
+
+	states, err := d.states()
+	if err != nil {
+		c.close()
+		return fmt.Errorf("unable to query %s: %v", d.name, err)
+	}
+
+	d.updateTerminals(states)
+	d.lastSeen = time.Now()
+
+	d.pollingTicker = time.NewTicker(d.pollingInterval)
+	d.stopPolling = make(chan struct{})
+
+	go d.poll()
+
+	return nil
+}
+
+// Close shuts down the switch.
+func (d *PDU) Close() {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.pollingTicker != nil {
+		d.pollingTicker.Stop()
+	}
+	d.closer.Do(func() {
+		if d.stopPolling != nil {
+			close(d.stopPolling)
+		}
+		if d.client != nil {
+			d.client.close()
+		}
+	})
+}
+
+// poll the agent for the current state of the outlets. In case the
+// outlets have been switched manually or through the web interface of
+// the PDU, we have to bring remoteSwitch back in sync.
+// This function is blocking and executes an infinite loop. It should be
+// executed in its own go routine.
+func (d *PDU) poll() {
+	for {
+		select {
+		case <-d.pollingTicker.C:
+			d.Lock()
+			wasOnline := d.health().Online
+			changed := false
+			states, err := d.states()
+			if err != nil {
+				log.Println(err)
+				d.lastError = err.Error()
+				// wrong credentials can't be fixed at runtime
+				if errors.Is(err, errUnauthorized) && d.errorCh != nil {
+					d.errorOnce.Do(func() { close(d.errorCh) })
+				}
+			} else {
+				d.lastSeen = time.Now()
+				d.lastError = ""
+				changed = d.updateTerminals(states)
+			}
+			// notify the listener when the outlets have changed, the
+			// device went offline or came back online
+			if (changed || wasOnline != d.health().Online) && d.eventHandler != nil {
+				go d.eventHandler(d, d.serialize())
+			}
+			d.Unlock()
+		case <-d.stopPolling:
+			return
+		}
+	}
+}
+
+// states queries the state of all outlets which are configured as
+// terminals. This method is not threadsafe.
+func (d *PDU) states() (map[int]bool, error) {
+
+	outlets := make([]int, 0, len(d.terminals))
+	for outlet := range d.terminals {
+		outlets = append(outlets, outlet)
+	}
+	sort.Ints(outlets)
+
+	states := make(map[int]bool, len(outlets))
+
+	for len(outlets) > 0 {
+		n := len(outlets)
+		if n > maxVarBinds {
+			n = maxVarBinds
+		}
+
+		oids := make([]string, 0, n)
+		for _, outlet := range outlets[:n] {
+			oids = append(oids, d.terminals[outlet].OID)
+		}
+
+		vbs, err := d.client.get(oids...)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, vb := range vbs {
+			t := d.terminals[outlets[i]]
+			switch vb.Type {
+			case gosnmp.Integer, gosnmp.Gauge32:
+			case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+				return nil, fmt.Errorf("%s has no outlet %d (oid %s, terminal %s)",
+					d.name, t.Outlet, t.OID, t.Name)
+			default:
+				return nil, fmt.Errorf("oid %s of terminal %s is not an integer", t.OID, t.Name)
+			}
+			states[t.Outlet] = gosnmp.ToBigInt(vb.Value).Int64() == int64(d.onValue)
+		}
+
+		outlets = outlets[n:]
+	}
+
+	return states, nil
+}
+
+// Health returns the health of the connection to the PDU. The PDU is
+// considered offline if the last request failed or if it hasn't been
+// polled successfully within the last three polling intervals.
+func (d *PDU) Health() sw.Health {
+	d.RLock()
+	defer d.RUnlock()
+	return d.health()
+}
+
+// health returns the health of the connection to the PDU. This
+// method is not threadsafe.
+func (d *PDU) health() sw.Health {
+	return sw.Health{
+		Online: len(d.lastError) == 0 &&
+			time.Since(d.lastSeen) <= 3*d.pollingInterval,
+		LastSeen: d.lastSeen,
+		Error:    d.lastError,
+		Model:    "SNMP PDU",
+	}
+}
+
+// Name returns the Name of this PDU
+func (d *PDU) Name() string {
+	d.RLock()
+	defer d.RUnlock()
+	return d.name
+}
+
+// SetPort sets the Terminals of a particular Port. The portRequest
+// can contain n terminals.
+func (d *PDU) SetPort(portRequest sw.Port) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// ensure that all requested terminals exist before switching any
+	for _, treq := range portRequest.Terminals {
+		if _, err := d.getTerminal(treq.Name); err != nil {
+			return err
+		}
+	}
+
+	changed := false
+
+	for _, treq := range portRequest.Terminals {
+		t, _ := d.getTerminal(treq.Name)
+		value := d.offValue
+		if treq.State {
+			value = d.onValue
+		}
+		if err := d.set(t, value); err != nil {
+			return err
+		}
+		if t.state != treq.State {
+			t.state = treq.State
+			changed = true
+		}
+	}
+
+	wasOnline := d.health().Online
+	d.lastSeen = time.Now()
+	d.lastError = ""
+
+	if (changed || !wasOnline) && d.eventHandler != nil {
+		go d.eventHandler(d, d.serialize())
+	}
+
+	return nil
+}
+
+// Pulse power cycles the outlet of a terminal through the reboot value.
+// The PDU switches the outlet off and on again after the reboot duration
+// configured in the PDU, therefore dur is ignored. Other pulses (e.g.
+// switching an outlet on temporarily) and pulses of PDUs without a reboot
+// value are rejected with an error wrapping sw.ErrPulseNotSupported.
+func (d *PDU) Pulse(portName string, terminal sw.Terminal, dur time.Duration) error {
+	d.Lock()
+	defer d.Unlock()
+
+	t, err := d.getTerminal(terminal.Name)
+	if err != nil {
+		return err
+	}
+
+	if t.state == terminal.State {
+		return nil
+	}
+
+	if d.rebootValue == 0 || terminal.State {
+		return fmt.Errorf("%w: %s can only power cycle its outlets", sw.ErrPulseNotSupported, d.name)
+	}
+
+	if err := d.set(t, d.rebootValue); err != nil {
+		return err
+	}
+
+	d.lastSeen = time.Now()
+	d.lastError = ""
+
+	// switching the outlet on again will be picked up by polling
+	t.state = terminal.State
+	if d.eventHandler != nil {
+		go d.eventHandler(d, d.serialize())
+	}
+
+	return nil
+}
+
+// set writes the value to the OID of the terminal. This method is not
+// threadsafe.
+func (d *PDU) set(t *Terminal, value int) error {
+
+	if err := d.client.set(t.OID, value); err != nil {
+		d.lastError = err.Error()
+		if d.eventHandler != nil {
+			go d.eventHandler(d, d.serialize())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetPort returns switch.Port struct containing the current state of
+// the port. Portname is ignored since this device will only ever
+// contain one port.
+func (d *PDU) GetPort(portName string) (sw.Port, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.getPort(), nil
+}
+
+func (d *PDU) getPort() sw.Port {
+
+	p := sw.Port{
+		Name:      d.portName,
+		Index:     0, //this type of Switch only has one Port ever
+		Terminals: []sw.Terminal{},
+	}
+
+	for _, t := range d.terminals {
+		swt := sw.Terminal{
+			Name:  t.Name,
+			Index: t.Index,
+			State: t.state,
+		}
+		p.Terminals = append(p.Terminals, swt)
+	}
+
+	// Sort the slice of Terminals by index
+	sort.Slice(p.Terminals, func(i, j int) bool {
+		return p.Terminals[i].Index < p.Terminals[j].Index
+	})
+
+	return p
+}
+
+// Serialize returns a switch.Device struct containing the current
+// state and configuration of this PDU.
+func (d *PDU) Serialize() sw.Device {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.serialize()
+}
+
+// serialize returns a switch.Device struct containing the current
+// state and configuration of this PDU. This method
+// is not threadsafe.
+func (d *PDU) serialize() sw.Device {
+
+	health := d.health()
+
+	device := sw.Device{
+		Name:   d.name,
+		Index:  d.index,
+		Health: &health,
+		Ports: []sw.Port{
+			d.getPort(),
+		},
+	}
+
+	return device
+}
+
+// getTerminal returns the pointer to a Terminal requested by its name.
+// If no Terminal is found under the specified name, nil and an error
+// will be returned.
+func (d *PDU) getTerminal(name string) (*Terminal, error) {
+
+	for _, t := range d.terminals {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("terminal %v does not exist", name)
+}
+
+// updateTerminals updates the state of the terminals with the states
+// reported by the agent. It returns true if at least one terminal has
+// changed. This method is not threadsafe.
+func (d *PDU) updateTerminals(states map[int]bool) bool {
+
+	changed := false
+
+	for outlet, state := range states {
+		t, ok := d.terminals[outlet]
+		if !ok || t.state == state {
+			continue
+		}
+		t.state = state
+		changed = true
+	}
+
+	return changed
+}
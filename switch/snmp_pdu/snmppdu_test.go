@@ -0,0 +1,660 @@
+package snmppdu
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/internal/switchtest"
+	"github.com/gosnmp/gosnmp"
+)
+
+const apcOutletOID = "1.3.6.1.4.1.318.1.1.12.3.3.1.1.4"
+
+// fakeAgent is an in-process SNMP agent of an APC PDU. The outlets are
+// switched on with 1, off with 2 and rebooted with 3. The messages are
+// encoded and decoded with gosnmp.
+type fakeAgent struct {
+	sync.Mutex
+	conn           net.PacketConn
+	community      string
+	usm            USMConfig
+	flags          gosnmp.SnmpV3MsgFlags
+	engineID       string
+	boots          uint32
+	start          time.Time
+	timeOffset     int
+	outlets        map[string]int
+	reboots        map[string]int
+	silent         bool
+	downgrade      bool                  // respond with a lower security level
+	downgradeFlags gosnmp.SnmpV3MsgFlags // security level of the downgraded responses
+	salt           uint64
+}
+
+func newFakeAgent(t *testing.T, outlets int, community string, usm USMConfig) *fakeAgent {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &fakeAgent{
+		conn:      conn,
+		community: community,
+		engineID:  string([]byte{0x80, 0x00, 0x13, 0x70, 0x01, 0x7f, 0x00, 0x00, 0x01}),
+		boots:     3,
+		start:     time.Now().Add(-time.Hour),
+		outlets:   make(map[string]int),
+		reboots:   make(map[string]int),
+	}
+
+	a.setUSM(t, usm)
+
+	for i := 1; i <= outlets; i++ {
+		a.outlets[outletOID(i)] = 2
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	go a.serve()
+
+	return a
+}
+
+func outletOID(outlet int) string {
+	return "." + apcOutletOID + "." + strconv.Itoa(outlet)
+}
+
+func (a *fakeAgent) addr() string {
+	return a.conn.LocalAddr().String()
+}
+
+func (a *fakeAgent) setUSM(t *testing.T, usm USMConfig) {
+	t.Helper()
+	a.Lock()
+	defer a.Unlock()
+
+	a.usm = usm
+	a.flags = gosnmp.NoAuthNoPriv
+	if len(usm.User) > 0 {
+		flags, _, err := usmParams(usm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.flags = flags
+	}
+}
+
+func (a *fakeAgent) outlet(i int) int {
+	a.Lock()
+	defer a.Unlock()
+	return a.outlets[outletOID(i)]
+}
+
+func (a *fakeAgent) setOutlet(i int, value int) {
+	a.Lock()
+	defer a.Unlock()
+	a.outlets[outletOID(i)] = value
+}
+
+func (a *fakeAgent) rebooted(i int) int {
+	a.Lock()
+	defer a.Unlock()
+	return a.reboots[outletOID(i)]
+}
+
+// setDowngrade makes the agent respond with the security level flags
+// instead of the security level of the request.
+func (a *fakeAgent) setDowngrade(flags gosnmp.SnmpV3MsgFlags) {
+	a.Lock()
+	defer a.Unlock()
+	a.downgrade = true
+	a.downgradeFlags = flags
+}
+
+func (a *fakeAgent) setSilent(silent bool) {
+	a.Lock()
+	defer a.Unlock()
+	a.silent = silent
+}
+
+func (a *fakeAgent) setTimeOffset(offset int) {
+	a.Lock()
+	defer a.Unlock()
+	a.timeOffset = offset
+}
+
+func (a *fakeAgent) serve() {
+
+	buf := make([]byte, 65535)
+
+	for {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := a.handle(buf[:n]); resp != nil {
+			a.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// handle returns the response to a request or nil if the request is
+// dropped.
+func (a *fakeAgent) handle(b []byte) []byte {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.silent {
+		return nil
+	}
+
+	if len(a.usm.User) == 0 {
+		return a.handleV2c(b)
+	}
+
+	// the header is decoded without the credentials (the pdu of
+	// encrypted requests can't be decoded)
+	probe := &gosnmp.GoSNMP{
+		Version:            gosnmp.Version3,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: &gosnmp.UsmSecurityParameters{UserName: a.usm.User},
+	}
+	hdr, _ := probe.SnmpDecodePacket(b)
+	if hdr == nil || hdr.Version != gosnmp.Version3 {
+		return nil
+	}
+	sp, ok := hdr.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok {
+		return nil
+	}
+
+	engineTime := int(time.Since(a.start)/time.Second) + a.timeOffset
+
+	switch {
+	case len(sp.AuthoritativeEngineID) == 0:
+		return a.report(hdr, usmStatsUnknownEngineIDs, gosnmp.NoAuthNoPriv)
+	case sp.UserName != a.usm.User:
+		return a.report(hdr, usmStatsUnknownUserNames, gosnmp.NoAuthNoPriv)
+	case hdr.MsgFlags&gosnmp.AuthPriv != a.flags:
+		return a.report(hdr, usmStatsUnsupportedSecLevels, gosnmp.NoAuthNoPriv)
+	}
+
+	agent := &gosnmp.GoSNMP{
+		Version:            gosnmp.Version3,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		MsgFlags:           a.flags,
+		SecurityParameters: a.securityParameters(a.flags),
+	}
+	req, err := agent.UnmarshalTrap(b, false)
+	if err != nil {
+		return a.report(hdr, usmStatsWrongDigests, gosnmp.NoAuthNoPriv)
+	}
+
+	if sp.AuthoritativeEngineBoots != a.boots || abs(int(sp.AuthoritativeEngineTime)-engineTime) > 150 {
+		// reports about the time window are authenticated
+		return a.report(req, usmStatsNotInTimeWindows, a.flags&gosnmp.AuthNoPriv)
+	}
+
+	flags := a.flags
+	if a.downgrade {
+		flags = a.downgradeFlags
+	}
+
+	resp := a.process(req)
+	resp.Version = gosnmp.Version3
+	resp.MsgFlags = flags
+	resp.SecurityModel = gosnmp.UserSecurityModel
+	resp.SecurityParameters = a.securityParameters(flags)
+	resp.ContextEngineID = a.engineID
+	resp.ContextName = req.ContextName
+	resp.MsgID = req.MsgID
+	resp.MsgMaxSize = 65507
+
+	out, _ := resp.MarshalMsg()
+	return out
+}
+
+// handleV2c returns the response to a SNMP v2c request. Must be called
+// with the lock held.
+func (a *fakeAgent) handleV2c(b []byte) []byte {
+
+	req, err := (&gosnmp.GoSNMP{Version: gosnmp.Version2c}).SnmpDecodePacket(b)
+	if err != nil || req.Community != a.community {
+		return nil
+	}
+
+	resp := a.process(req)
+	resp.Version = gosnmp.Version2c
+	resp.Community = a.community
+
+	out, _ := resp.MarshalMsg()
+	return out
+}
+
+// securityParameters returns the USM parameters of a message of the
+// agent with the security level flags. Must be called with the lock held.
+func (a *fakeAgent) securityParameters(flags gosnmp.SnmpV3MsgFlags) *gosnmp.UsmSecurityParameters {
+
+	_, sp, _ := usmParams(a.usm)
+	if flags&gosnmp.AuthNoPriv == 0 {
+		sp.AuthenticationProtocol = gosnmp.NoAuth
+	}
+	if flags&gosnmp.AuthPriv != gosnmp.AuthPriv {
+		sp.PrivacyProtocol = gosnmp.NoPriv
+	}
+
+	a.salt++
+	sp.AuthoritativeEngineID = a.engineID
+	sp.AuthoritativeEngineBoots = a.boots
+	sp.AuthoritativeEngineTime = uint32(int(time.Since(a.start)/time.Second) + a.timeOffset)
+	sp.PrivacyParameters = bytes.Repeat([]byte{byte(a.salt)}, 8)
+	sp.InitSecurityKeys()
+
+	return sp
+}
+
+// USM statistics which are reported to the manager (RFC 3414)
+const (
+	usmStatsUnsupportedSecLevels = ".1.3.6.1.6.3.15.1.1.1.0"
+	usmStatsNotInTimeWindows     = ".1.3.6.1.6.3.15.1.1.2.0"
+	usmStatsUnknownUserNames     = ".1.3.6.1.6.3.15.1.1.3.0"
+	usmStatsUnknownEngineIDs     = ".1.3.6.1.6.3.15.1.1.4.0"
+	usmStatsWrongDigests         = ".1.3.6.1.6.3.15.1.1.5.0"
+)
+
+// report returns a Report PDU with the security level flags. Must be
+// called with the lock held.
+func (a *fakeAgent) report(req *gosnmp.SnmpPacket, oid string, flags gosnmp.SnmpV3MsgFlags) []byte {
+
+	sp := a.securityParameters(flags)
+	if req.SecurityParameters != nil {
+		if rsp, ok := req.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok {
+			sp.UserName = rsp.UserName
+		}
+	}
+
+	resp := &gosnmp.SnmpPacket{
+		Version:            gosnmp.Version3,
+		MsgFlags:           flags,
+		SecurityModel:      gosnmp.UserSecurityModel,
+		SecurityParameters: sp,
+		ContextEngineID:    a.engineID,
+		PDUType:            gosnmp.Report,
+		MsgID:              req.MsgID,
+		RequestID:          req.RequestID,
+		MsgMaxSize:         65507,
+		Variables:          []gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Counter32, Value: uint32(1)}},
+	}
+
+	out, _ := resp.MarshalMsg()
+	return out
+}
+
+// process executes a Get or Set request. Must be called with the lock
+// held.
+func (a *fakeAgent) process(req *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+
+	resp := &gosnmp.SnmpPacket{PDUType: gosnmp.GetResponse, RequestID: req.RequestID}
+
+	for i, vb := range req.Variables {
+		v, ok := a.outlets[vb.Name]
+		switch {
+		case !ok && req.PDUType == gosnmp.GetRequest:
+			resp.Variables = append(resp.Variables, gosnmp.SnmpPDU{Name: vb.Name, Type: gosnmp.NoSuchObject})
+			continue
+		case !ok:
+			resp.Error = gosnmp.NotWritable
+			resp.ErrorIndex = uint8(i + 1)
+			resp.Variables = req.Variables
+			return resp
+		case req.PDUType == gosnmp.SetRequest && gosnmp.ToBigInt(vb.Value).Int64() == 3:
+			a.reboots[vb.Name]++
+			v = 1
+		case req.PDUType == gosnmp.SetRequest:
+			v = int(gosnmp.ToBigInt(vb.Value).Int64())
+		}
+		a.outlets[vb.Name] = v
+		resp.Variables = append(resp.Variables, gosnmp.SnmpPDU{Name: vb.Name, Type: gosnmp.Integer, Value: v})
+	}
+
+	return resp
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+var testTerminals = []Terminal{
+	{Name: "Router", Outlet: 1, Index: 0},
+	{Name: "Transceiver", Outlet: 2, Index: 1},
+	{Name: "Amplifier", Outlet: 3, Index: 2},
+}
+
+func newTestPDU(t *testing.T, a *fakeAgent, opts ...func(*PDU)) (*PDU, chan sw.Device) {
+	t.Helper()
+
+	handler, events := switchtest.Events()
+
+	opts = append([]func(*PDU){
+		Name("Rack"),
+		Address(a.addr()),
+		OutletOID(apcOutletOID),
+		Terminals(testTerminals),
+		PollingInterval(time.Millisecond * 20),
+		Timeout(time.Millisecond * 100),
+		EventHandler(handler),
+	}, opts...)
+
+	d := NewPDU(opts...)
+	switchtest.Init(t, d)
+
+	return d, events
+}
+
+func Test_validateOID(t *testing.T) {
+	tests := []struct {
+		name    string
+		oid     string
+		wantErr bool
+	}{
+		{"sysDescr", ".1.3.6.1.2.1.1.1.0", false},
+		{"without leading dot", "1.3.6.1.4.1.318", false},
+		{"joint-iso", "2.999.3", false},
+		{"too short", "1", true},
+		{"invalid first arc", "3.1", true},
+		{"invalid second arc", "1.40", true},
+		{"not a number", "1.3.six", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateOID(tt.oid); (err != nil) != tt.wantErr {
+				t.Errorf("validateOID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var testUSMConfigs = []struct {
+	name string
+	usm  USMConfig
+}{
+	{"noAuthNoPriv", USMConfig{User: "ops"}},
+	{"authNoPriv", USMConfig{User: "ops", AuthProtocol: MD5, AuthPassword: "authpassword"}},
+	{"authPriv des", USMConfig{User: "ops", AuthProtocol: SHA, AuthPassword: "authpassword",
+		PrivProtocol: DES, PrivPassword: "privpassword"}},
+	{"authPriv aes", USMConfig{User: "ops", AuthProtocol: SHA, AuthPassword: "authpassword",
+		PrivProtocol: AES, PrivPassword: "privpassword"}},
+}
+
+func TestPDU(t *testing.T) {
+
+	type testCase struct {
+		name string
+		usm  USMConfig
+		opts []func(*PDU)
+	}
+
+	tests := []testCase{{name: "v2c", opts: []func(*PDU){Community("private")}}}
+	for _, c := range testUSMConfigs {
+		tests = append(tests, testCase{"v3 " + c.name, c.usm,
+			[]func(*PDU){Version(Version3), USM(c.usm)}})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			a := newFakeAgent(t, 4, "private", tt.usm)
+			a.setOutlet(2, 1)
+
+			d, events := newTestPDU(t, a, tt.opts...)
+
+			// the initial state has been read
+			if switchtest.TerminalState(t, d, "", "Router") || !switchtest.TerminalState(t, d, "", "Transceiver") {
+				t.Fatal("initial state not read")
+			}
+
+			req := sw.Port{Terminals: []sw.Terminal{
+				{Name: "Router", State: true},
+				{Name: "Transceiver", State: false},
+			}}
+			if err := d.SetPort(req); err != nil {
+				t.Fatal(err)
+			}
+			if a.outlet(1) != 1 || a.outlet(2) != 2 {
+				t.Errorf("outlets = %d, %d, want 1, 2", a.outlet(1), a.outlet(2))
+			}
+
+			// switched through the web interface of the PDU
+			a.setOutlet(3, 1)
+			switchtest.Eventually(t, func() bool { return switchtest.TerminalState(t, d, "", "Amplifier") })
+
+			if err := d.Pulse("PS", sw.Terminal{Name: "Router", State: false}, time.Second); err != nil {
+				t.Fatal(err)
+			}
+			if a.rebooted(1) != 1 {
+				t.Error("router not rebooted")
+			}
+
+			if h := d.Health(); !h.Online {
+				t.Errorf("pdu should be online: %+v", h)
+			}
+
+			select {
+			case <-events:
+			case <-time.After(time.Second):
+				t.Error("no event received")
+			}
+		})
+	}
+}
+
+func TestPDU_Init(t *testing.T) {
+
+	usm := testUSMConfigs[3].usm
+
+	a2c := newFakeAgent(t, 4, "private", USMConfig{})
+	a3 := newFakeAgent(t, 4, "", usm)
+
+	wrongPassword := usm
+	wrongPassword.AuthPassword = "wrongpassword"
+
+	unknownUser := usm
+	unknownUser.User = "admin"
+
+	noAuth := usm
+	noAuth.AuthProtocol = ""
+
+	tests := []struct {
+		name    string
+		opts    []func(*PDU)
+		wantErr bool
+	}{
+		{"v2c", []func(*PDU){Address(a2c.addr()), OutletOID(apcOutletOID), Terminals(testTerminals)}, false},
+		{"v3", []func(*PDU){Address(a3.addr()), OutletOID(apcOutletOID), Terminals(testTerminals),
+			Version(Version3), USM(usm)}, false},
+		{"terminal oid", []func(*PDU){Address(a2c.addr()), Terminals([]Terminal{
+			{Name: "Router", Outlet: 1, OID: outletOID(4)},
+		})}, false},
+		{"no terminals", []func(*PDU){Address(a2c.addr()), OutletOID(apcOutletOID)}, true},
+		{"no oid", []func(*PDU){Address(a2c.addr()), Terminals(testTerminals)}, true},
+		{"invalid oid", []func(*PDU){Address(a2c.addr()), OutletOID("1.3.x"), Terminals(testTerminals)}, true},
+		{"outlet does not exist", []func(*PDU){Address(a2c.addr()), OutletOID(apcOutletOID),
+			Terminals([]Terminal{{Name: "Router", Outlet: 7}})}, true},
+		{"same on and off values", []func(*PDU){Address(a2c.addr()), OutletOID(apcOutletOID),
+			Terminals(testTerminals), Values(1, 1, 0)}, true},
+		{"wrong community", []func(*PDU){Address(a2c.addr()), OutletOID(apcOutletOID), Terminals(testTerminals),
+			Community("public")}, true},
+		{"unknown version", []func(*PDU){Address(a2c.addr()), OutletOID(apcOutletOID), Terminals(testTerminals),
+			Version("1")}, true},
+		{"v3 without user", []func(*PDU){Address(a3.addr()), OutletOID(apcOutletOID), Terminals(testTerminals),
+			Version(Version3)}, true},
+		{"v3 wrong password", []func(*PDU){Address(a3.addr()), OutletOID(apcOutletOID), Terminals(testTerminals),
+			Version(Version3), USM(wrongPassword)}, true},
+		{"v3 unknown user", []func(*PDU){Address(a3.addr()), OutletOID(apcOutletOID), Terminals(testTerminals),
+			Version(Version3), USM(unknownUser)}, true},
+		{"v3 privacy without auth", []func(*PDU){Address(a3.addr()), OutletOID(apcOutletOID), Terminals(testTerminals),
+			Version(Version3), USM(noAuth)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewPDU(append(tt.opts, Timeout(time.Millisecond*50))...)
+			defer d.Close()
+			if err := d.Init(); (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPDU_SetPort_invalidTerminal(t *testing.T) {
+
+	a := newFakeAgent(t, 4, "private", USMConfig{})
+	d, _ := newTestPDU(t, a)
+
+	req := sw.Port{Terminals: []sw.Terminal{
+		{Name: "Router", State: true},
+		{Name: "Toaster", State: true},
+	}}
+	if err := d.SetPort(req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// no outlet must have been switched
+	if a.outlet(1) != 2 {
+		t.Error("router has been switched on")
+	}
+}
+
+func TestPDU_Pulse_notSupported(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		opts     []func(*PDU)
+		initial  int
+		terminal sw.Terminal
+	}{
+		{"reboot disabled", []func(*PDU){Values(1, 2, 0)}, 1, sw.Terminal{Name: "Router", State: false}},
+		{"pulse on", nil, 2, sw.Terminal{Name: "Router", State: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newFakeAgent(t, 4, "private", USMConfig{})
+			a.setOutlet(1, tt.initial)
+			d, _ := newTestPDU(t, a, tt.opts...)
+
+			err := d.Pulse("PS", tt.terminal, time.Second)
+			if !errors.Is(err, sw.ErrPulseNotSupported) {
+				t.Fatalf("expected ErrPulseNotSupported, got %v", err)
+			}
+			if a.rebooted(1) != 0 {
+				t.Error("router has been rebooted")
+			}
+			if a.outlet(1) != tt.initial {
+				t.Error("router has been switched")
+			}
+		})
+	}
+}
+
+// a response must not have a lower security level than the request
+func TestPDU_securityLevel(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		usm   USMConfig
+		flags gosnmp.SnmpV3MsgFlags
+	}{
+		{"authNoPriv answered by noAuthNoPriv", testUSMConfigs[1].usm, gosnmp.NoAuthNoPriv},
+		{"authPriv answered by noAuthNoPriv", testUSMConfigs[3].usm, gosnmp.NoAuthNoPriv},
+		{"authPriv answered by authNoPriv", testUSMConfigs[3].usm, gosnmp.AuthNoPriv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newFakeAgent(t, 4, "", tt.usm)
+			d, _ := newTestPDU(t, a, Version(Version3), USM(tt.usm))
+
+			a.setDowngrade(tt.flags)
+
+			req := sw.Port{Terminals: []sw.Terminal{{Name: "Router", State: true}}}
+			if err := d.SetPort(req); err == nil {
+				t.Fatal("response with a lower security level has been accepted")
+			}
+			if switchtest.TerminalState(t, d, "", "Router") {
+				t.Error("router is reported as switched on")
+			}
+		})
+	}
+}
+
+// the agent rebooted or its clock jumped
+func TestPDU_timeWindow(t *testing.T) {
+
+	usm := testUSMConfigs[1].usm
+	a := newFakeAgent(t, 4, "", usm)
+	d, _ := newTestPDU(t, a, Version(Version3), USM(usm), PollingInterval(time.Hour))
+
+	a.setTimeOffset(10000)
+
+	req := sw.Port{Terminals: []sw.Terminal{{Name: "Router", State: true}}}
+	if err := d.SetPort(req); err != nil {
+		t.Fatal(err)
+	}
+	if a.outlet(1) != 1 {
+		t.Error("router not switched on")
+	}
+}
+
+func TestPDU_errorCh(t *testing.T) {
+
+	usm := testUSMConfigs[0].usm
+	a := newFakeAgent(t, 4, "", usm)
+
+	errorCh := make(chan struct{})
+	newTestPDU(t, a, Version(Version3), USM(usm), ErrorCh(errorCh))
+
+	// the user has been removed from the PDU
+	changed := usm
+	changed.User = "admin"
+	a.setUSM(t, changed)
+
+	select {
+	case <-errorCh:
+	case <-time.After(time.Second):
+		t.Fatal("errorCh not closed")
+	}
+}
+
+func TestPDU_offline(t *testing.T) {
+
+	a := newFakeAgent(t, 4, "private", USMConfig{})
+	d, events := newTestPDU(t, a, Timeout(time.Millisecond*10))
+
+	a.setSilent(true)
+
+	switchtest.Eventually(t, func() bool { return !d.Health().Online })
+
+	select {
+	case dev := <-events:
+		if dev.Health.Online {
+			t.Error("event should report the pdu offline")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+
+	a.setSilent(false)
+	switchtest.Eventually(t, func() bool { return d.Health().Online })
+}
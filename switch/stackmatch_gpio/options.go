@@ -1,6 +1,9 @@
 package StackmatchGPIO
 
-import sw "github.com/dh1tw/remoteSwitch/switch"
+import (
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/pins"
+)
 
 // Switch is a functional option to set the switch's configuration.
 func Config(sc SmConfig) func(*SmGPIO) {
@@ -13,6 +16,17 @@ type SmConfig struct {
 	Name         string
 	Index        int
 	Combinations []CombinationConfig
+	// Backend selects the backend which provides the GPIO pins
+	Backend pins.BackendConfig
+}
+
+// Backend is a functional option to set the backend which provides the
+// GPIO pins. It takes precedence over the backend in the SmConfig
+// (e.g. to inject a pins.Fake in tests).
+func Backend(b pins.Backend) func(*SmGPIO) {
+	return func(s *SmGPIO) {
+		s.backend = b
+	}
 }
 
 type CombinationConfig struct {
@@ -24,6 +38,12 @@ type CombinationConfig struct {
 type TerminalConfig struct {
 	Name  string
 	Index int
+	// SensePin is an optional input pin through which the state of the
+	// terminal is read back. A terminal which is part of several
+	// combinations needs to be configured only once.
+	SensePin string
+	// SenseInverted inverts the logic of the SensePin
+	SenseInverted bool
 }
 
 // PinConfig describes a gpio pin.
@@ -7,13 +7,13 @@ package StackmatchGPIO
 
 import (
 	"fmt"
+	"log"
 	"sort"
 	"sync"
+	"time"
 
 	sw "github.com/dh1tw/remoteSwitch/switch"
-	"periph.io/x/conn/v3/gpio"
-	"periph.io/x/conn/v3/gpio/gpioreg"
-	"periph.io/x/host/v3"
+	"github.com/dh1tw/remoteSwitch/switch/pins"
 )
 
 // SmGPIO contains the state and configuration of a gpio based stackmatch
@@ -26,9 +26,18 @@ type SmGPIO struct {
 	terminals    []*terminal
 	pins         []*pin
 	config       SmConfig
+	backend      pins.Backend
 	eventHandler func(sw.Switcher, sw.Device)
+	initialized  bool
+	lastSeen     time.Time
+	lastError    string
+	stop         chan struct{} // closed by Close to stop the sense watchers
 }
 
+// senseInterval is the interval in which the sense pins are read if no
+// edge has been detected.
+const senseInterval = time.Second
+
 // combination holds for a given amount the terminals, the corresponding
 // relay (GPIO pin) configuration.
 type combination struct {
@@ -38,18 +47,23 @@ type combination struct {
 }
 
 // terminal describes a particular terminal of the stackmatch. The terminal
-// name is typically shown in the GUI as a selectable item.
+// name is typically shown in the GUI as a selectable item. The state of
+// the terminal can optionally be read back through a sense pin.
 type terminal struct {
-	name  string
-	index int
-	state bool
+	name          string
+	index         int
+	state         bool
+	sensePin      pins.InPin
+	senseInverted bool
+	sensed        bool
+	senseError    string
 }
 
 // pin holds the information associated to the pin / gpio pin.
 type pin struct {
 	inverted bool
 	state    bool
-	pin      gpio.PinOut
+	pin      pins.Pin
 }
 
 // NewStackmatchGPIO is the constructor for a GPIO based stackmatch (antenna combiner).
@@ -73,21 +87,13 @@ func NewStackmatchGPIO(options ...func(*SmGPIO)) *SmGPIO {
 }
 
 func (s *SmGPIO) Init() error {
-	hostState, err := host.Init()
-	if err != nil {
-		return err
-	}
 
-	// check if sysfs-gpio driver has been loaded
-	gpioDriverLoaded := false
-	for _, driver := range hostState.Loaded {
-		if driver.String() == "sysfs-gpio" {
-			gpioDriverLoaded = true
+	if s.backend == nil {
+		b, err := pins.NewBackend(s.config.Backend)
+		if err != nil {
+			return err
 		}
-	}
-
-	if !gpioDriverLoaded {
-		return fmt.Errorf("sysfs-gpio driver was not loaded; try running as root")
+		s.backend = b
 	}
 
 	s.name = s.config.Name
@@ -96,7 +102,8 @@ func (s *SmGPIO) Init() error {
 	// in these maps we will store temporarily the terminals and pins
 	// maps are used just for de-duplication
 	terminals := make(map[string]*terminal)
-	pins := make(map[string]*pin)
+	relays := make(map[string]*pin)
+	sensePins := make(map[string]TerminalConfig)
 
 	for _, cConfig := range s.config.Combinations {
 
@@ -108,18 +115,20 @@ func (s *SmGPIO) Init() error {
 		// create the pins for this combination
 		for _, pc := range cConfig.Pins {
 
-			newPin, ok := pins[pc.Name]
+			newPin, ok := relays[pc.Name]
 			// only create the pin if it doesn't exist yet
 			if !ok {
+				p, err := pins.ByName(s.backend, pc.Pin)
+				if err != nil {
+					return err
+				}
 				newPin = &pin{
 					inverted: pc.Inverted,
-					pin:      gpioreg.ByName(pc.Pin),
-				}
-				if newPin.pin == nil {
-					return fmt.Errorf("failed to find pin %s", pc.Name)
+					pin:      p,
 				}
-				pins[pc.Name] = newPin
-
+				relays[pc.Name] = newPin
+				// keep the order of the config
+				s.pins = append(s.pins, newPin)
 			}
 
 			newCombination.relays = append(newCombination.relays, newPin)
@@ -141,6 +150,14 @@ func (s *SmGPIO) Init() error {
 				terminals[tc.Name] = newTerminal
 			}
 
+			if len(tc.SensePin) > 0 {
+				if sc, ok := sensePins[tc.Name]; ok && sc != tc {
+					return fmt.Errorf("terminal %s: conflicting sense pins %s and %s",
+						tc.Name, sc.SensePin, tc.SensePin)
+				}
+				sensePins[tc.Name] = tc
+			}
+
 			newCombination.terminals[tc.Name] = newTerminal
 			// we append the name since each combination is a concatenation of
 			// all terminal names (e.g. OB114L20M3LEU)
@@ -157,19 +174,85 @@ func (s *SmGPIO) Init() error {
 		s.terminals = append(s.terminals, t)
 	}
 
-	// copy pins from the de-duplicated map in our main data structure as a slice
-	for _, p := range pins {
-		s.pins = append(s.pins, p)
+	// deactivate all pins in startup
+	if err := s.setPins(nil); err != nil {
+		return err
+	}
 
-		// deactivate all pins in startup
-		if p.setState(false); err != nil {
+	sensed := []*terminal{}
+	for tName, tc := range sensePins {
+		t := terminals[tName]
+		p, err := pins.InByName(s.backend, tc.SensePin)
+		if err != nil {
 			return err
 		}
+		level, err := p.Read()
+		if err != nil {
+			return fmt.Errorf("terminal %s: unable to read sense pin %s: %v", t.name, p, err)
+		}
+		t.sensePin = p
+		t.senseInverted = tc.SenseInverted
+		t.sensed = level != tc.SenseInverted
+		sensed = append(sensed, t)
 	}
 
+	// the watchers are started once all sense pins have been read, so
+	// that no event is emitted during Init
+	s.stop = make(chan struct{})
+	for _, t := range sensed {
+		t := t
+		go pins.Watch(t.sensePin, senseInterval, s.stop, func(level bool, err error) {
+			s.sense(t, level, err)
+		})
+	}
+
+	s.initialized = true
+	s.lastSeen = time.Now()
+
 	return nil
 }
 
+// sense is called by the watcher of a sense pin. If the sensed state of
+// the terminal has changed (e.g. a relay failed) or the pin can't be read,
+// an event is emitted.
+func (s *SmGPIO) sense(t *terminal, level bool, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// the stackmatch has been closed in the meantime
+	if s.stop == nil {
+		return
+	}
+
+	senseError := ""
+	if err != nil {
+		senseError = fmt.Sprintf("terminal %s: unable to read sense pin %s: %v",
+			t.name, t.sensePin, err)
+		if senseError != t.senseError {
+			log.Println(senseError)
+		}
+	}
+
+	sensed := t.sensed
+	if err == nil {
+		sensed = level != t.senseInverted
+	}
+
+	if sensed == t.sensed && senseError == t.senseError {
+		return
+	}
+
+	t.sensed = sensed
+	t.senseError = senseError
+	if err == nil {
+		s.lastSeen = time.Now()
+	}
+
+	if s.eventHandler != nil {
+		go s.eventHandler(s, s.serialize())
+	}
+}
+
 // sortStrings sorts the provided strings alphabetically and returns
 // them as a single concatenated string
 func sortStrings(strs ...string) string {
@@ -227,24 +310,25 @@ func (s *SmGPIO) SetPort(req sw.Port) error {
 		return fmt.Errorf("unknown terminal combination")
 	}
 
-	// deactivate everything
-	for _, r := range s.pins {
-		r.setState(false)
+	// activate the relays of the new combination and deactivate
+	// everything else
+	if err := s.setPins(c); err != nil {
+		s.lastError = err.Error()
+		return err
 	}
+
 	for _, t := range s.terminals {
 		t.state = false
 	}
 
-	// activate the relays of the new combination
-	for _, r := range c.relays {
-		r.setState(true)
-	}
-
 	// set the state of the terminals of the new combination
 	for _, t := range c.terminals {
 		t.state = true
 	}
 
+	s.lastSeen = time.Now()
+	s.lastError = ""
+
 	// notify the listener that something has changed
 	if s.eventHandler != nil {
 		go s.eventHandler(s, s.serialize())
@@ -253,22 +337,55 @@ func (s *SmGPIO) SetPort(req sw.Port) error {
 	return nil
 }
 
-func (r *pin) setState(state bool) error {
+// setPins activates the relays of the combination c and deactivates all
+// other relays. All pins are set at once, so that pins of the same I2C
+// port expander are written in a single bus transaction. If c is nil, all
+// relays are deactivated.
+func (s *SmGPIO) setPins(c *combination) error {
 
-	newState := state
-	if r.inverted {
-		newState = !newState
+	active := make(map[*pin]bool)
+	if c != nil {
+		for _, r := range c.relays {
+			active[r] = true
+		}
+	}
+
+	changes := make([]pins.Change, 0, len(s.pins))
+	relays := make([]*pin, 0, len(s.pins))
+
+	// deactivate first, then activate
+	for _, state := range []bool{false, true} {
+		for _, r := range s.pins {
+			if active[r] == state {
+				changes = append(changes, r.change(state))
+				relays = append(relays, r)
+			}
+		}
 	}
 
-	if err := r.pin.Out(gpio.Level(newState)); err != nil {
+	if err := pins.Out(changes...); err != nil {
 		return err
 	}
 
-	r.state = newState
+	for i, r := range relays {
+		r.state = changes[i].Level
+	}
 
 	return nil
 }
 
+// change returns the change of the pin for the requested state. It is
+// necessary in case the logic is inverted.
+func (r *pin) change(state bool) pins.Change {
+
+	newState := state
+	if r.inverted {
+		newState = !newState
+	}
+
+	return pins.Change{Pin: r.pin, Level: newState}
+}
+
 func (s *SmGPIO) GetPort(portName string) (sw.Port, error) {
 	s.RLock()
 	defer s.RUnlock()
@@ -292,6 +409,11 @@ func (s *SmGPIO) serializeTerminals() []sw.Terminal {
 			Index: term.index,
 			State: term.state,
 		}
+		if term.sensePin != nil {
+			sensed := term.sensed
+			t.Sensed = &sensed
+			t.Mismatch = sensed != term.state
+		}
 		terminals = append(terminals, t)
 	}
 
@@ -310,11 +432,41 @@ func (s *SmGPIO) Serialize() sw.Device {
 	return s.serialize()
 }
 
+// Health returns the health of the stackmatch. The stackmatch is
+// considered online once it has been initialized and as long as no
+// error occurred while writing to the GPIO pins or reading the sense pins.
+func (s *SmGPIO) Health() sw.Health {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.health()
+}
+
+// health returns the health of the stackmatch. This method is
+// not threadsafe.
+func (s *SmGPIO) health() sw.Health {
+	errMsg := s.lastError
+	for _, t := range s.terminals {
+		if len(errMsg) == 0 {
+			errMsg = t.senseError
+		}
+	}
+	return sw.Health{
+		Online:   s.initialized && len(errMsg) == 0,
+		LastSeen: s.lastSeen,
+		Error:    errMsg,
+		Model:    "GPIO Stackmatch",
+	}
+}
+
 func (s *SmGPIO) serialize() sw.Device {
 
+	health := s.health()
+
 	dev := sw.Device{
-		Name:  s.name,
-		Index: s.index,
+		Name:   s.name,
+		Index:  s.index,
+		Health: &health,
 		Ports: []sw.Port{
 			sw.Port{
 				Name:      s.portName,
@@ -326,6 +478,17 @@ func (s *SmGPIO) serialize() sw.Device {
 	return dev
 }
 
+// Close releases the pins of the stackmatch.
 func (s *SmGPIO) Close() {
-	// nothing to do
+	s.Lock()
+	defer s.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+
+	if s.backend != nil {
+		s.backend.Close()
+	}
 }
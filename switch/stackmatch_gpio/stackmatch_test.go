@@ -0,0 +1,187 @@
+package StackmatchGPIO
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	sw "github.com/dh1tw/remoteSwitch/switch"
+	"github.com/dh1tw/remoteSwitch/switch/pins"
+)
+
+// SJ2W stacker-v3 with the relays K1, K2, K3 and STCK; STCK is inverted
+var testConfig = SmConfig{
+	Name:  "Stackmatch 20m",
+	Index: 1,
+	Combinations: []CombinationConfig{
+		{
+			Terminals: []TerminalConfig{{Name: "A", Index: 0}},
+			Pins:      []PinConfig{{Name: "k1", Pin: "GPIO1"}, {Name: "stck", Pin: "GPIO4", Inverted: true}},
+		},
+		{
+			Terminals: []TerminalConfig{{Name: "B", Index: 1}},
+			Pins:      []PinConfig{{Name: "k2", Pin: "GPIO2"}, {Name: "stck", Pin: "GPIO4", Inverted: true}},
+		},
+		{
+			Terminals: []TerminalConfig{{Name: "A", Index: 0}, {Name: "B", Index: 1}},
+			Pins:      []PinConfig{{Name: "k3", Pin: "GPIO3"}},
+		},
+	},
+}
+
+func TestSmGPIO(t *testing.T) {
+
+	fake := pins.NewFake()
+	s := NewStackmatchGPIO(Config(testConfig), Backend(fake))
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	levels := func(want map[string]bool) {
+		t.Helper()
+		for pin, level := range want {
+			if got := fake.Level(pin); got != level {
+				t.Errorf("%s = %v, want %v", pin, got, level)
+			}
+		}
+	}
+
+	// all relays are deactivated on startup
+	levels(map[string]bool{"GPIO1": false, "GPIO2": false, "GPIO3": false, "GPIO4": true})
+
+	w := func(pin string, level bool) pins.Write { return pins.Write{Pin: pin, Level: level} }
+
+	requests := []struct {
+		name      string
+		terminals []sw.Terminal
+		wantErr   bool
+		want      map[string]bool
+		// the relays of the previous combination are released before
+		// the relays of the new combination are activated
+		wantWrites []pins.Write
+	}{
+		{"A", []sw.Terminal{{Name: "A", State: true}}, false,
+			map[string]bool{"GPIO1": true, "GPIO2": false, "GPIO3": false, "GPIO4": false},
+			[]pins.Write{w("GPIO2", false), w("GPIO3", false), w("GPIO1", true), w("GPIO4", false)}},
+		{"A+B", []sw.Terminal{{Name: "B", State: true}}, false,
+			map[string]bool{"GPIO1": false, "GPIO2": false, "GPIO3": true, "GPIO4": true},
+			[]pins.Write{w("GPIO1", false), w("GPIO4", true), w("GPIO2", false), w("GPIO3", true)}},
+		{"B", []sw.Terminal{{Name: "A", State: false}}, false,
+			map[string]bool{"GPIO1": false, "GPIO2": true, "GPIO3": false, "GPIO4": false},
+			[]pins.Write{w("GPIO1", false), w("GPIO3", false), w("GPIO4", false), w("GPIO2", true)}},
+		{"unknown terminal", []sw.Terminal{{Name: "C", State: true}}, true,
+			map[string]bool{"GPIO2": true}, []pins.Write{}},
+		{"unknown combination", []sw.Terminal{{Name: "B", State: false}}, true,
+			map[string]bool{"GPIO2": true}, []pins.Write{}},
+	}
+
+	for _, r := range requests {
+		fake.ClearWrites()
+		err := s.SetPort(sw.Port{Name: "SM", Terminals: r.terminals})
+		if (err != nil) != r.wantErr {
+			t.Fatalf("%s: SetPort() error = %v, wantErr %v", r.name, err, r.wantErr)
+		}
+		levels(r.want)
+		if got := fake.Writes(); !reflect.DeepEqual(got, r.wantWrites) {
+			t.Errorf("%s: writes = %v, want %v", r.name, got, r.wantWrites)
+		}
+	}
+
+	p, err := s.GetPort("SM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Terminals) != 2 || p.Terminals[0].State || !p.Terminals[1].State {
+		t.Errorf("unexpected terminals %v", p.Terminals)
+	}
+
+	fake.SetError(fmt.Errorf("broken"))
+	if err := s.SetPort(sw.Port{Name: "SM", Terminals: []sw.Terminal{{Name: "A", State: true}}}); err == nil {
+		t.Error("expected error for a failed write")
+	}
+	if s.Health().Online {
+		t.Error("stackmatch should be offline after a failed write")
+	}
+	// the terminals keep their state if the relays couldn't be set
+	if p, _ := s.GetPort("SM"); p.Terminals[0].State || !p.Terminals[1].State {
+		t.Errorf("terminals changed after a failed write: %v", p.Terminals)
+	}
+
+	fake.SetError(nil)
+	if err := s.SetPort(sw.Port{Name: "SM", Terminals: []sw.Terminal{{Name: "A", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	if h := s.Health(); !h.Online || h.Error != "" {
+		t.Errorf("stackmatch should be online again, got %+v", h)
+	}
+
+	s.Close()
+	if !fake.Closed() {
+		t.Error("backend not closed")
+	}
+}
+
+func TestSmGPIO_sensePins(t *testing.T) {
+
+	config := SmConfig{
+		Name: "Stackmatch 20m",
+		Combinations: []CombinationConfig{
+			{
+				Terminals: []TerminalConfig{{Name: "A", Index: 0, SensePin: "GPIO11"}},
+				Pins:      []PinConfig{{Name: "k1", Pin: "GPIO1"}},
+			},
+			{
+				Terminals: []TerminalConfig{{Name: "B", Index: 1}},
+				Pins:      []PinConfig{{Name: "k2", Pin: "GPIO2"}},
+			},
+			{
+				Terminals: []TerminalConfig{{Name: "A", Index: 0}, {Name: "B", Index: 1}},
+				Pins:      []PinConfig{{Name: "k3", Pin: "GPIO3"}},
+			},
+		},
+	}
+
+	fake := pins.NewFake()
+	events := make(chan sw.Device, 10)
+	s := NewStackmatchGPIO(Config(config), Backend(fake),
+		EventHandler(func(s sw.Switcher, d sw.Device) { events <- d }))
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	terminalA := func(t *testing.T) sw.Terminal {
+		t.Helper()
+		select {
+		case d := <-events:
+			return d.Ports[0].Terminals[0]
+		case <-time.After(time.Second):
+			t.Fatal("no event received")
+		}
+		return sw.Terminal{}
+	}
+
+	if err := s.SetPort(sw.Port{Name: "SM", Terminals: []sw.Terminal{{Name: "A", State: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	if a := terminalA(t); !a.State || a.Sensed == nil || *a.Sensed || !a.Mismatch {
+		t.Errorf("relay not closed yet: %+v", a)
+	}
+
+	fake.SetLevel("GPIO11", true)
+	if a := terminalA(t); !a.State || a.Sensed == nil || !*a.Sensed || a.Mismatch {
+		t.Errorf("relay closed: %+v", a)
+	}
+
+	p, _ := s.GetPort("SM")
+	if b := p.Terminals[1]; b.Sensed != nil || b.Mismatch {
+		t.Errorf("terminal without sense pin: %+v", b)
+	}
+
+	// conflicting sense pins
+	config.Combinations[2].Terminals[0].SensePin = "GPIO12"
+	if err := NewStackmatchGPIO(Config(config), Backend(pins.NewFake())).Init(); err == nil {
+		t.Error("expected an error for conflicting sense pins")
+	}
+}
@@ -1,5 +1,19 @@
 package Switch
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrRateLimited is returned (wrapped) by SetPort if a request has been
+// rejected because the state of the switch has been changed too often.
+var ErrRateLimited = errors.New("rate limited")
+
+// ErrPulseNotSupported is returned (wrapped) by Pulsers which can't
+// execute a particular pulse in hardware (e.g. a PDU which can only power
+// cycle its outlets). Such pulses are emulated by the pulse wrapper.
+var ErrPulseNotSupported = errors.New("pulse not supported")
+
 type Switcher interface {
 	Name() string
 	GetPort(portName string) (port Port, err error)
@@ -8,20 +22,83 @@ type Switcher interface {
 	Close()
 }
 
+// HealthReporter is an optional interface which can be implemented by
+// Switchers which are able to report the health of the connection
+// to their hardware.
+type HealthReporter interface {
+	Health() Health
+}
+
+// Pulser is an optional interface which can be implemented by Switchers
+// which are able to switch a terminal into a state for the duration d
+// and to revert it afterwards into the state it had before (e.g. to
+// power cycle a device). If the terminal is already in the requested
+// state, the pulse has no effect.
+type Pulser interface {
+	Pulse(portName string, terminal Terminal, d time.Duration) error
+}
+
+// Compose returns the Switcher s extended by the optional interfaces hr
+// and p (which may be nil). Only the methods of the Switcher interface
+// are taken from s, so that wrappers around a Switcher (e.g. pulse or
+// rate limiting) expose exactly the optional interfaces which they
+// support for the wrapped Switcher. If hr and p are nil, s is returned.
+func Compose(s Switcher, hr HealthReporter, p Pulser) Switcher {
+	switch {
+	case hr != nil && p != nil:
+		return &struct {
+			Switcher
+			HealthReporter
+			Pulser
+		}{s, hr, p}
+	case hr != nil:
+		return &struct {
+			Switcher
+			HealthReporter
+		}{s, hr}
+	case p != nil:
+		return &struct {
+			Switcher
+			Pulser
+		}{s, p}
+	}
+	return s
+}
+
 type Device struct {
-	Name  string `json:"name,omitempty"`
-	Index int    `json:"index,omitempty"`
-	Ports []Port `json:"ports,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Index     int     `json:"index,omitempty"`
+	Station   string  `json:"station,omitempty"`
+	Exclusive bool    `json:"exclusive,omitempty"`
+	Health    *Health `json:"health,omitempty"`
+	Ports     []Port  `json:"ports,omitempty"`
+}
+
+// Health describes the health of a switch and the connection
+// to its hardware. Model and Firmware are optional and only provided
+// if known by the driver.
+type Health struct {
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"last_seen,omitzero"`
+	Error    string    `json:"error,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Firmware string    `json:"firmware,omitempty"`
 }
 
 type Port struct {
 	Name      string     `json:"name,omitempty"`
 	Index     int        `json:"index,omitempty"`
+	Exclusive bool       `json:"exclusive,omitempty"`
 	Terminals []Terminal `json:"terminals,omitempty"`
 }
 
+// Terminal describes a terminal of a port. State is the commanded state.
+// Terminals which can be read back (e.g. through a sense input) report the
+// state read back in Sensed; Mismatch is set if it differs from State.
 type Terminal struct {
-	Name  string `json:"name,omitempty"`
-	Index int    `json:"index,omitempty"`
-	State bool   `json:"state,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Index    int    `json:"index,omitempty"`
+	State    bool   `json:"state,omitempty"`
+	Sensed   *bool  `json:"sensed,omitempty"`
+	Mismatch bool   `json:"mismatch,omitempty"`
 }